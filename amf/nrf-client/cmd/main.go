@@ -1,48 +1,64 @@
 package main
 
 import (
+	"context"
 	"log"
-	"time"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/danipopa/mob5g/amf/nrf-client/internal/api"
+	"github.com/danipopa/mob5g/amf/nrf-client/internal/config"
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 func main() {
-	nrfURL := "http://10.107.50.172:80"
-	amfID := "amf-instance-1"
-
-	nrfClient := nrfagent.NewNRFClient(nrfURL, amfID)
-
-	profile := nrfagent.NFProfile{
-		NFID:           amfID,
-		NFInstanceID:   amfID,
-		NFType:         "AMF",
-		Status:         "ACTIVE",
-		FQDN:           "amf1.example.com",
-		IPAddresses:    []string{"192.168.1.10"},
-		ServiceURLs:    []string{"http://amf1:8080"},
-		HeartbeatTimer: 30,
-		PLMNID:         nrfagent.PLMN{MCC: "310", MNC: "001"},
-		SNSSAIs:        []nrfagent.SNSSAI{{SST: "01", SD: "abc123"}},
-		AreaID:         "area1",
-		DNNs:           []string{"internet"},
+	configPath := os.Getenv("AMF_CONFIG")
+	if configPath == "" {
+		configPath = "config/amf.yaml"
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load AMF configuration: %v", err)
 	}
 
-	// Retry registration in a loop
-	for {
-		err := nrfClient.Register(profile)
-		if err != nil {
-			log.Printf("Failed to register AMF with NRF: %v. Retrying in 1 second...", err)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		log.Println("Successfully registered AMF with NRF")
-		break
+	profile := cfg.NFProfile()
+	nrfClient := nrfagent.NewNRFClientWithFailover(cfg.NRFURLs, "AMF", profile.NFID)
+
+	// Follow the NFs the AMF depends on through NRF status notifications
+	if cfg.NotificationURI != "" {
+		nrfClient.SetNotificationURI(cfg.NotificationURI)
+	}
+	for _, nfType := range cfg.WatchedNFTypes {
+		nrfClient.OnNFStatus(nfType, nrfagent.NFStatusHandlers{
+			OnRegistered: func(p nrfagent.NFProfile) {
+				log.Printf("%s %s is available", p.NFType, p.NFID)
+			},
+			OnDeregistered: func(p nrfagent.NFProfile) {
+				log.Printf("%s %s went away", p.NFType, p.NFID)
+			},
+		})
 	}
 
-	// Start heartbeat in a separate goroutine
-	go nrfClient.Heartbeat(profile)
+	notificationServer := &http.Server{
+		Addr:    cfg.ListenAddress,
+		Handler: nrfClient.ServeNotifications(http.NotFoundHandler()),
+	}
+	go func() {
+		if err := notificationServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error starting notification server: %v", err)
+		}
+	}()
 
-	// Keep the application running
-	select {}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Register, send heartbeats until SIGTERM, then deregister. The agent
+	// moves the registration to another NRF when the one in use fails.
+	err = nrfClient.Run(ctx, profile)
+	notificationServer.Close()
+	if err != nil {
+		log.Fatalf("AMF NRF agent stopped: %v", err)
+	}
+	log.Println("AMF NRF agent stopped")
 }
@@ -7,3 +7,9 @@ require (
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/go-redis/redis/v8 v8.11.5 // indirect
 )
+
+require github.com/danipopa/mob5g/sbi v0.0.0
+
+require gopkg.in/yaml.v3 v3.0.1
+
+replace github.com/danipopa/mob5g/sbi => ../../sbi
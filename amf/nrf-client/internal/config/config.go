@@ -0,0 +1,147 @@
+// Package config loads the configuration of the AMF NRF agent from a YAML
+// file, with environment variables overriding the file
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the AMF NRF agent
+type Config struct {
+	NRFURLs         []string `yaml:"nrf_urls"` // In order of preference
+	ListenAddress   string   `yaml:"listen_address"`
+	NotificationURI string   `yaml:"notification_uri"`
+	WatchedNFTypes  []string `yaml:"watched_nf_types"`
+	Profile         Profile  `yaml:"profile"`
+}
+
+// Profile is the part of the AMF profile registered with the NRF that is
+// configured
+type Profile struct {
+	NFInstanceID   string   `yaml:"nf_instance_id"`
+	FQDN           string   `yaml:"fqdn"`
+	IPAddresses    []string `yaml:"ip_addresses"`
+	ServiceURLs    []string `yaml:"service_urls"`
+	HeartbeatTimer int      `yaml:"heartbeat_timer"`
+	PLMNID         *PLMN    `yaml:"plmn_id"`
+	SNSSAIs        []SNSSAI `yaml:"snssais"`
+	AreaID         string   `yaml:"area_id"`
+	DNNs           []string `yaml:"dnns"`
+}
+
+// PLMN is the PLMN ID of the AMF
+type PLMN struct {
+	MCC string `yaml:"mcc"`
+	MNC string `yaml:"mnc"`
+}
+
+// SNSSAI is a network slice served by the AMF
+type SNSSAI struct {
+	SST string `yaml:"sst"`
+	SD  string `yaml:"sd"`
+}
+
+// Load reads the configuration file at path, applies the environment
+// overrides and checks the result
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	cfg := &Config{ListenAddress: ":8080"}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration %s: %w", path, err)
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the configuration with the environment variables that
+// are set, named as those read by nrfagent.FromEnv
+func (c *Config) applyEnv() error {
+	if urls := listFromEnv("NRF_URL"); len(urls) > 0 {
+		c.NRFURLs = urls
+	}
+	if id := os.Getenv("NF_INSTANCE_ID"); id != "" {
+		c.Profile.NFInstanceID = id
+	}
+	if fqdn := os.Getenv("NF_FQDN"); fqdn != "" {
+		c.Profile.FQDN = fqdn
+	}
+	if addresses := listFromEnv("NF_IP_ADDRESSES"); len(addresses) > 0 {
+		c.Profile.IPAddresses = addresses
+	}
+	if apiRoot := strings.TrimSuffix(os.Getenv("NF_API_ROOT"), "/"); apiRoot != "" {
+		c.Profile.ServiceURLs = []string{apiRoot}
+		c.NotificationURI = apiRoot + nrfagent.NotificationPath
+	}
+	if plmn := os.Getenv("NF_PLMN"); plmn != "" {
+		mcc, mnc, ok := strings.Cut(plmn, "-")
+		if !ok {
+			return fmt.Errorf("invalid NF_PLMN %q, expected mcc-mnc", plmn)
+		}
+		c.Profile.PLMNID = &PLMN{MCC: mcc, MNC: mnc}
+	}
+	return nil
+}
+
+// listFromEnv splits a comma separated environment variable
+func listFromEnv(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (c *Config) validate() error {
+	if len(c.NRFURLs) == 0 {
+		return fmt.Errorf("at least one NRF URL is required")
+	}
+	if c.Profile.NFInstanceID == "" {
+		return fmt.Errorf("profile.nf_instance_id is required")
+	}
+	if c.Profile.FQDN == "" && len(c.Profile.IPAddresses) == 0 {
+		return fmt.Errorf("profile requires an fqdn or ip_addresses")
+	}
+	if len(c.WatchedNFTypes) > 0 && c.NotificationURI == "" {
+		return fmt.Errorf("notification_uri is required to watch NF types")
+	}
+	return nil
+}
+
+// NFProfile returns the profile the AMF registers with the NRF
+func (c *Config) NFProfile() nrfagent.NFProfile {
+	p := c.Profile
+	profile := nrfagent.NFProfile{
+		NFID:           p.NFInstanceID,
+		NFInstanceID:   p.NFInstanceID,
+		NFType:         "AMF",
+		Status:         "REGISTERED",
+		FQDN:           p.FQDN,
+		IPAddresses:    p.IPAddresses,
+		ServiceURLs:    p.ServiceURLs,
+		HeartbeatTimer: p.HeartbeatTimer,
+		AreaID:         p.AreaID,
+		DNNs:           p.DNNs,
+	}
+	if p.PLMNID != nil {
+		profile.PLMNID = &nrfagent.PLMN{MCC: p.PLMNID.MCC, MNC: p.PLMNID.MNC}
+	}
+	for _, snssai := range p.SNSSAIs {
+		profile.SNSSAIs = append(profile.SNSSAIs, nrfagent.SNSSAI{SST: snssai.SST, SD: snssai.SD})
+	}
+	return profile
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/danipopa/mob5g/amf/udm-client/udmclient"
 	"github.com/danipopa/mob5g/amf/udm-client/udmservice"
 )
 
@@ -15,15 +21,73 @@ func main() {
 	if udmBaseURL == "" {
 		udmBaseURL = "http://udm-service:8080"
 	}
+	// Where the UDM reaches this service with changes of cached data
+	callbackURI := os.Getenv("SDM_CALLBACK_URI")
+	if callbackURI == "" {
+		callbackURI = "http://udm-client-service:8081" + udmservice.SDMNotificationPath
+	}
+	nfInstanceID := os.Getenv("NF_INSTANCE_ID")
+	if nfInstanceID == "" {
+		nfInstanceID, _ = os.Hostname()
+	}
 
 	// Initialize the UDM service
-	service := udmservice.NewUDMService(udmBaseURL)
-	router := service.SetupRouter()
+	service := udmservice.NewUDMService(udmBaseURL, nfInstanceID, callbackURI)
+	tlsConfig, err := tlsConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize TLS: %v", err)
+	}
+	if tlsConfig == nil || tlsConfig.ClientCAs == nil {
+		log.Println("No NF_TLS_CLIENT_CA_FILE, notified changes evict the cached subscription data instead of updating it")
+	}
+	server := &http.Server{Addr: ":8081", Handler: service.SetupRouter(), TLSConfig: tlsConfig}
 
 	// Start the HTTP server
 	log.Printf("Starting UDM Client Service on port 8081 (UDM base URL: %s)...", udmBaseURL)
-	if err := http.ListenAndServe(":8081", router); err != nil {
-		log.Fatalf("Failed to start UDM Client Service: %v", err)
-	}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS(os.Getenv("NF_TLS_CERT_FILE"), os.Getenv("NF_TLS_KEY_FILE"))
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start UDM Client Service: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	// Stop the notifications of the cached subscription data
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	service.Cache.Close(shutdownCtx)
+	log.Println("UDM Client Service stopped")
 }
 
+// tlsConfigFromEnv configures HTTPS when NF_TLS_CERT_FILE and
+// NF_TLS_KEY_FILE are set. Client certificates signed by the CAs in
+// NF_TLS_CLIENT_CA_FILE are verified, and authenticate the UDM notifying
+// changes of subscription data.
+func tlsConfigFromEnv() (*tls.Config, error) {
+	if os.Getenv("NF_TLS_CERT_FILE") == "" || os.Getenv("NF_TLS_KEY_FILE") == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile := os.Getenv("NF_TLS_CLIENT_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+		// The AMF reaches this service without a certificate
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
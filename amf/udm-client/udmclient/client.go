@@ -29,7 +29,8 @@ type SubscriptionData struct {
 	MobilityRestrictions string   `json:"mobility_restrictions"`
 }
 
-// AuthVector represents the authentication vector for a UE
+// AuthVector represents an EPS authentication vector for a UE. 5G
+// authentication uses the vectors returned by GenerateAuthData.
 type AuthVector struct {
 	RAND  string `json:"rand"`
 	AUTN  string `json:"autn"`
@@ -50,6 +51,9 @@ type SNSSAI struct {
 }
 
 // GetSubscriptionData fetches subscription data for a given UE ID
+//
+// Deprecated: the subscription data of a UE is fetched per resource with
+// GetSDMResource.
 func (c *UDMClient) GetSubscriptionData(ueID string) (*SubscriptionData, error) {
 	url := fmt.Sprintf("%s/nudm-sdm/v1/subscription-data/%s", c.udmBaseURL, ueID)
 
@@ -71,7 +75,9 @@ func (c *UDMClient) GetSubscriptionData(ueID string) (*SubscriptionData, error)
 	return &data, nil
 }
 
-// GetAuthVector fetches the authentication vector for a given UE ID
+// GetAuthVector fetches the EPS authentication vector for a given UE ID
+//
+// Deprecated: 5G authentication vectors are obtained with GenerateAuthData.
 func (c *UDMClient) GetAuthVector(ueID string) (*AuthVector, error) {
 	url := fmt.Sprintf("%s/nudm-auth/v1/auth-vectors/%s", c.udmBaseURL, ueID)
 
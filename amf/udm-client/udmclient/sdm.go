@@ -0,0 +1,260 @@
+package udmclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Subscription data resources of a UE in Nudm_SDM (TS 29.503)
+const (
+	ResourceAMData         = "am-data"
+	ResourceNSSAI          = "nssai"
+	ResourceSMFSelectData  = "smf-select-data"
+	sdmAPIRoot             = "/nudm-sdm/v2"
+	sdmSubscriptionsSuffix = "sdm-subscriptions"
+)
+
+// AccessAndMobilitySubscriptionData is the access and mobility subscription
+// data of a UE (TS 29.503 AccessAndMobilitySubscriptionData)
+type AccessAndMobilitySubscriptionData struct {
+	GPSIs                       []string `json:"gpsis,omitempty"`
+	SubscribedUeAmbr            *Ambr    `json:"subscribedUeAmbr,omitempty"`
+	NSSAI                       *NSSAI   `json:"nssai,omitempty"`
+	RATRestrictions             []string `json:"ratRestrictions,omitempty"`
+	CoreNetworkTypeRestrictions []string `json:"coreNetworkTypeRestrictions,omitempty"`
+	RFSPIndex                   *int     `json:"rfspIndex,omitempty"`
+	SubsRegTimer                *int     `json:"subsRegTimer,omitempty"`
+	MICOAllowed                 bool     `json:"micoAllowed,omitempty"`
+}
+
+// Ambr is an aggregate maximum bit rate, e.g. "1 Gbps"
+type Ambr struct {
+	Uplink   string `json:"uplink"`
+	Downlink string `json:"downlink"`
+}
+
+// NSSAI is the subscribed network slices of a UE (TS 29.503 Nssai)
+type NSSAI struct {
+	DefaultSingleNSSAIs []Snssai `json:"defaultSingleNssais"`
+	SingleNSSAIs        []Snssai `json:"singleNssais,omitempty"`
+}
+
+// Snssai is a network slice as encoded in the SBI (TS 29.571 Snssai)
+type Snssai struct {
+	SST int    `json:"sst"`
+	SD  string `json:"sd,omitempty"`
+}
+
+// SMFSelectionSubscriptionData tells the DNNs a UE may use per slice
+// (TS 29.503 SmfSelectionSubscriptionData)
+type SMFSelectionSubscriptionData struct {
+	SubscribedSnssaiInfos map[string]SnssaiInfo `json:"subscribedSnssaiInfos,omitempty"` // By slice, e.g. "1-000001"
+}
+
+// SnssaiInfo lists the DNNs subscribed in a slice
+type SnssaiInfo struct {
+	DNNInfos []DNNInfo `json:"dnnInfos"`
+}
+
+// DNNInfo is a subscribed DNN
+type DNNInfo struct {
+	DNN                 string `json:"dnn"`
+	DefaultDNNIndicator bool   `json:"defaultDnnIndicator,omitempty"`
+}
+
+// SDMSubscription is a subscription to changes of subscription data
+// (TS 29.503 SdmSubscription)
+type SDMSubscription struct {
+	NFInstanceID          string     `json:"nfInstanceId"`
+	CallbackReference     string     `json:"callbackReference"`
+	MonitoredResourceURIs []string   `json:"monitoredResourceUris"`
+	ImplicitUnsubscribe   bool       `json:"implicitUnsubscribe,omitempty"`
+	Expires               *time.Time `json:"expires,omitempty"`
+	SubscriptionID        string     `json:"subscriptionId,omitempty"`
+}
+
+// ModificationNotification is sent by the UDM to the callback reference of
+// an SDM subscription (TS 29.503 ModificationNotification)
+type ModificationNotification struct {
+	NotifyItems []NotifyItem `json:"notifyItems"`
+}
+
+// NotifyItem lists the changes of one resource
+type NotifyItem struct {
+	ResourceID string       `json:"resourceId"`
+	Changes    []ChangeItem `json:"changes"`
+}
+
+// ChangeItem is a change of a resource, addressed by a JSON pointer
+// relative to it (TS 29.571 ChangeItem)
+type ChangeItem struct {
+	Op        string          `json:"op"` // ADD, MOVE, REMOVE or REPLACE
+	Path      string          `json:"path"`
+	From      string          `json:"from,omitempty"`
+	OrigValue json.RawMessage `json:"origValue,omitempty"`
+	NewValue  json.RawMessage `json:"newValue,omitempty"`
+}
+
+// SDMResourceURI returns the URI of a subscription data resource of a UE,
+// as monitored by SDM subscriptions
+func (c *UDMClient) SDMResourceURI(supi, resource string) string {
+	return fmt.Sprintf("%s%s/%s/%s", c.udmBaseURL, sdmAPIRoot, url.PathEscape(supi), resource)
+}
+
+// ParseSDMResourceURI returns the SUPI and resource of a resource URI
+// received in a notification
+func ParseSDMResourceURI(resourceURI string) (supi, resource string, err error) {
+	u, err := url.Parse(resourceURI)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid resource URI %q: %w", resourceURI, err)
+	}
+	dir, resource := path.Split(strings.TrimSuffix(u.Path, "/"))
+	supi = path.Base(dir)
+	if !strings.HasPrefix(dir, sdmAPIRoot+"/") || resource == "" || supi == "" {
+		return "", "", fmt.Errorf("%q is not a subscription data resource", resourceURI)
+	}
+	if supi, err = url.PathUnescape(supi); err != nil {
+		return "", "", fmt.Errorf("invalid SUPI in %q: %w", resourceURI, err)
+	}
+	return supi, resource, nil
+}
+
+// GetAMData fetches the access and mobility subscription data of a UE
+func (c *UDMClient) GetAMData(ctx context.Context, supi string) (*AccessAndMobilitySubscriptionData, error) {
+	var data AccessAndMobilitySubscriptionData
+	if err := c.getSDMData(ctx, supi, ResourceAMData, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetNSSAI fetches the subscribed network slices of a UE
+func (c *UDMClient) GetNSSAI(ctx context.Context, supi string) (*NSSAI, error) {
+	var data NSSAI
+	if err := c.getSDMData(ctx, supi, ResourceNSSAI, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetSMFSelectionData fetches the SMF selection subscription data of a UE
+func (c *UDMClient) GetSMFSelectionData(ctx context.Context, supi string) (*SMFSelectionSubscriptionData, error) {
+	var data SMFSelectionSubscriptionData
+	if err := c.getSDMData(ctx, supi, ResourceSMFSelectData, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (c *UDMClient) getSDMData(ctx context.Context, supi, resource string, data interface{}) error {
+	raw, err := c.GetSDMResource(ctx, supi, resource)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", resource, err)
+	}
+	return nil
+}
+
+// GetSDMResource fetches a subscription data resource of a UE as JSON
+func (c *UDMClient) GetSDMResource(ctx context.Context, supi, resource string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.SDMResourceURI(supi, resource), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", resource, err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", resource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", resource, err)
+	}
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("UDM returned invalid JSON for %s", resource)
+	}
+	return raw, nil
+}
+
+// SubscribeSDM subscribes to changes of subscription data of a UE. The
+// returned subscription holds the ID assigned by the UDM and, when the UDM
+// limits it, the expiry of the subscription.
+func (c *UDMClient) SubscribeSDM(ctx context.Context, supi string, subscription SDMSubscription) (*SDMSubscription, error) {
+	payload, err := json.Marshal(subscription)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SDM subscription: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s%s/%s/%s", c.udmBaseURL, sdmAPIRoot, url.PathEscape(supi), sdmSubscriptionsSuffix)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SDM subscription request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to subscription data changes: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, responseError(resp)
+	}
+	var created SDMSubscription
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to decode SDM subscription: %w", err)
+	}
+	if created.SubscriptionID == "" {
+		// The ID is the last segment of the subscription URI
+		created.SubscriptionID = path.Base(resp.Header.Get("Location"))
+	}
+	if created.SubscriptionID == "" || created.SubscriptionID == "." || created.SubscriptionID == "/" {
+		return nil, fmt.Errorf("UDM returned no SDM subscription ID")
+	}
+	return &created, nil
+}
+
+// UnsubscribeSDM removes an SDM subscription
+func (c *UDMClient) UnsubscribeSDM(ctx context.Context, supi, subscriptionID string) error {
+	endpoint := fmt.Sprintf("%s%s/%s/%s/%s", c.udmBaseURL, sdmAPIRoot, url.PathEscape(supi), sdmSubscriptionsSuffix, url.PathEscape(subscriptionID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create SDM unsubscription request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe from subscription data changes: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// responseError turns an unexpected UDM response into a *ResponseError
+func responseError(resp *http.Response) error {
+	respErr := &ResponseError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json") {
+		var problem ProblemDetails
+		if json.NewDecoder(resp.Body).Decode(&problem) == nil {
+			respErr.Problem = &problem
+		}
+	}
+	return respErr
+}
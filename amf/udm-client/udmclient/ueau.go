@@ -0,0 +1,195 @@
+package udmclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+// Authentication methods (TS 29.503 AuthType)
+const (
+	AuthType5GAKA       = "5G_AKA"
+	AuthTypeEAPAKAPrime = "EAP_AKA_PRIME"
+)
+
+// Authentication vector types (TS 29.503 AvType)
+const (
+	AvType5GHeAKA     = "5G_HE_AKA"
+	AvTypeEAPAKAPrime = "EAP_AKA_PRIME"
+)
+
+// AuthenticationInfoRequest asks the UDM to generate an authentication
+// vector (TS 29.503 AuthenticationInfoRequest)
+type AuthenticationInfoRequest struct {
+	ServingNetworkName    string                 `json:"servingNetworkName"` // e.g. 5G:mnc001.mcc001.3gppnetwork.org
+	ResynchronizationInfo *ResynchronizationInfo `json:"resynchronizationInfo,omitempty"`
+	AusfInstanceID        string                 `json:"ausfInstanceId,omitempty"`
+	// AuthType is the authentication method the AMF asks for. The UDM
+	// decides based on the subscription when it is empty.
+	AuthType string `json:"authType,omitempty"`
+}
+
+// ResynchronizationInfo carries the RAND of the rejected challenge and the
+// AUTS returned by the UE after a synchronization failure (TS 33.102 6.3.5)
+type ResynchronizationInfo struct {
+	RAND string `json:"rand"` // 16 octets, hex encoded
+	AUTS string `json:"auts"` // 14 octets, hex encoded
+}
+
+// AuthenticationInfoResult is the answer of the UDM to generate-auth-data
+// (TS 29.503 AuthenticationInfoResult)
+type AuthenticationInfoResult struct {
+	AuthType             string                `json:"authType"`
+	AuthenticationVector *AuthenticationVector `json:"authenticationVector,omitempty"`
+	SUPI                 string                `json:"supi,omitempty"` // Resolved from the SUCI
+}
+
+// AuthenticationVector is either a 5G HE AV, for 5G AKA, or an EAP-AKA'
+// vector, as told by AvType. Hex encoded fields.
+type AuthenticationVector struct {
+	AvType string `json:"avType"`
+	RAND   string `json:"rand"`
+	AUTN   string `json:"autn"`
+
+	// 5G HE AV (TS 33.501 6.1.3.2)
+	XRESStar string `json:"xresStar,omitempty"`
+	KAUSF    string `json:"kausf,omitempty"`
+
+	// EAP-AKA' vector (TS 33.501 6.1.3.1)
+	XRES    string `json:"xres,omitempty"`
+	CKPrime string `json:"ckPrime,omitempty"`
+	IKPrime string `json:"ikPrime,omitempty"`
+}
+
+// ProblemDetails is the error body returned by the UDM (TS 29.571, RFC 7807)
+type ProblemDetails struct {
+	Title  string `json:"title,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	Cause  string `json:"cause,omitempty"` // e.g. AUTHENTICATION_REJECTED
+}
+
+// ResponseError is returned when the UDM rejects a request
+type ResponseError struct {
+	StatusCode int
+	Status     string
+	Problem    *ProblemDetails // When the UDM described the problem
+}
+
+func (e *ResponseError) Error() string {
+	if e.Problem != nil && e.Problem.Cause != "" {
+		return fmt.Sprintf("unexpected response from UDM: %s (%s)", e.Status, e.Problem.Cause)
+	}
+	return fmt.Sprintf("unexpected response from UDM: %s", e.Status)
+}
+
+// ErrInvalidRequest is returned for requests that are not sent to the UDM
+// because they are malformed
+var ErrInvalidRequest = errors.New("invalid authentication request")
+
+var (
+	// SUPI or SUCI as in TS 29.571 SupiOrSuci, without its catch-all
+	// alternative for future formats
+	supiOrSuciPattern = regexp.MustCompile(`^(imsi-[0-9]{5,15}|nai-.+|gci-.+|gli-.+|suci-(0-[0-9]{3}-[0-9]{2,3}|[1-7]-.+)-[0-9]{1,4}-(0-0-.+|[a-fA-F1-9]-([1-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])-[a-fA-F0-9]+))$`)
+	// Serving network name of TS 24.501 9.12.1
+	servingNetworkNamePattern = regexp.MustCompile(`^5G:mnc[0-9]{3}\.mcc[0-9]{3}\.3gppnetwork\.org(:.+)?$`)
+)
+
+// GenerateAuthData asks the UDM for an authentication vector for a UE
+// identified by its SUPI or SUCI (Nudm_UEAU_Get). With ResynchronizationInfo
+// the UDM first resynchronizes its sequence number with the USIM.
+func (c *UDMClient) GenerateAuthData(ctx context.Context, supiOrSuci string, request AuthenticationInfoRequest) (*AuthenticationInfoResult, error) {
+	if err := validateAuthenticationInfoRequest(supiOrSuci, request); err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode authentication request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/nudm-ueau/v1/%s/security-information/generate-auth-data", c.udmBaseURL, url.PathEscape(supiOrSuci))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authentication request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request authentication data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	var result AuthenticationInfoResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode authentication data: %w", err)
+	}
+	if err := validateAuthenticationInfoResult(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func validateAuthenticationInfoRequest(supiOrSuci string, request AuthenticationInfoRequest) error {
+	if !supiOrSuciPattern.MatchString(supiOrSuci) {
+		return fmt.Errorf("%w: %q is neither a SUPI nor a SUCI", ErrInvalidRequest, supiOrSuci)
+	}
+	if !servingNetworkNamePattern.MatchString(request.ServingNetworkName) {
+		return fmt.Errorf("%w: invalid servingNetworkName %q", ErrInvalidRequest, request.ServingNetworkName)
+	}
+	switch request.AuthType {
+	case "", AuthType5GAKA, AuthTypeEAPAKAPrime:
+	default:
+		return fmt.Errorf("%w: unsupported authType %q", ErrInvalidRequest, request.AuthType)
+	}
+	if resync := request.ResynchronizationInfo; resync != nil {
+		if !isHexOctets(resync.RAND, 16) {
+			return fmt.Errorf("%w: resynchronizationInfo.rand must be 16 hex encoded octets", ErrInvalidRequest)
+		}
+		if !isHexOctets(resync.AUTS, 14) {
+			return fmt.Errorf("%w: resynchronizationInfo.auts must be 14 hex encoded octets", ErrInvalidRequest)
+		}
+	}
+	return nil
+}
+
+// validateAuthenticationInfoResult checks that the vector returned by the
+// UDM holds the fields of its type
+func validateAuthenticationInfoResult(result *AuthenticationInfoResult) error {
+	av := result.AuthenticationVector
+	if av == nil {
+		return fmt.Errorf("UDM returned no authentication vector")
+	}
+	switch {
+	case result.AuthType == AuthType5GAKA && av.AvType == AvType5GHeAKA:
+		if av.RAND == "" || av.AUTN == "" || av.XRESStar == "" || av.KAUSF == "" {
+			return fmt.Errorf("UDM returned an incomplete 5G HE AV")
+		}
+	case result.AuthType == AuthTypeEAPAKAPrime && av.AvType == AvTypeEAPAKAPrime:
+		if av.RAND == "" || av.AUTN == "" || av.XRES == "" || av.CKPrime == "" || av.IKPrime == "" {
+			return fmt.Errorf("UDM returned an incomplete EAP-AKA' vector")
+		}
+	default:
+		return fmt.Errorf("UDM returned a %s vector for %s", av.AvType, result.AuthType)
+	}
+	return nil
+}
+
+// isHexOctets reports whether s is the hex encoding of n octets
+func isHexOctets(s string, n int) bool {
+	if len(s) != 2*n {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
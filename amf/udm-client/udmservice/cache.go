@@ -0,0 +1,472 @@
+package udmservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danipopa/mob5g/amf/udm-client/udmclient"
+)
+
+// CachedResources are the subscription data resources kept per SUPI
+var CachedResources = []string{udmclient.ResourceAMData, udmclient.ResourceNSSAI, udmclient.ResourceSMFSelectData}
+
+// ErrUnknownCallback is returned for a notification sent to the callback
+// reference of no subscription of the cache
+var ErrUnknownCallback = errors.New("no SDM subscription with this callback reference")
+
+// SDMCache keeps the subscription data of UEs fetched from the UDM. It
+// subscribes to changes of the data of each UE it caches, and applies the
+// changes notified by an authenticated UDM or evicts the data they concern.
+// Data of UEs without a subscription is not cached, so that it is never
+// stale.
+type SDMCache struct {
+	client       *udmclient.UDMClient
+	nfInstanceID string
+	callbackURI  string
+
+	mu        sync.Mutex
+	ues       map[string]*cachedUE // By SUPI
+	callbacks map[string]string    // SUPIs by callback ID
+}
+
+// cachedUE is the cached subscription data of a UE
+type cachedUE struct {
+	subscribeMu    sync.Mutex // Serializes subscribing for the UE
+	evicted        bool       // No longer in the cache, so not to subscribe for
+	subscriptionID string
+	// callbackID ends the callback reference of the subscription, so that
+	// notifications are only taken from who the UDM gave it to
+	callbackID string
+	expires    time.Time                  // Zero when the subscription does not expire
+	resources  map[string]json.RawMessage // By resource name
+	// generation changes on every notification and refresh, so that data
+	// fetched before them is not cached
+	generation uint64
+}
+
+// NewSDMCache creates a cache whose SDM subscriptions name the NF instance
+// and send notifications to callbackURI
+func NewSDMCache(client *udmclient.UDMClient, nfInstanceID, callbackURI string) *SDMCache {
+	return &SDMCache{
+		client:       client,
+		nfInstanceID: nfInstanceID,
+		callbackURI:  callbackURI,
+		ues:          make(map[string]*cachedUE),
+		callbacks:    make(map[string]string),
+	}
+}
+
+// Get returns a subscription data resource of a UE, from the cache when
+// present and from the UDM otherwise
+func (c *SDMCache) Get(ctx context.Context, supi, resource string) (json.RawMessage, error) {
+	c.mu.Lock()
+	ue := c.ues[supi]
+	if ue == nil {
+		ue = &cachedUE{resources: make(map[string]json.RawMessage)}
+		c.ues[supi] = ue
+	}
+	if data, ok := ue.resources[resource]; ok && !ue.expired() {
+		c.mu.Unlock()
+		return data, nil
+	}
+	c.mu.Unlock()
+
+	// Subscribe first, so that changes made while fetching are notified
+	subscribed := c.subscribe(ctx, supi, ue)
+
+	c.mu.Lock()
+	generation := ue.generation
+	c.mu.Unlock()
+
+	data, err := c.client.GetSDMResource(ctx, supi, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if subscribed && ue.generation == generation && c.ues[supi] == ue {
+		ue.resources[resource] = data
+	}
+	return data, nil
+}
+
+// subscribe makes sure that the UDM notifies changes of the cached data of
+// a UE, and reports whether it does
+func (c *SDMCache) subscribe(ctx context.Context, supi string, ue *cachedUE) bool {
+	ue.subscribeMu.Lock()
+	defer ue.subscribeMu.Unlock()
+	if ue.evicted {
+		return false
+	}
+
+	c.mu.Lock()
+	if ue.subscriptionID != "" && !ue.expired() {
+		c.mu.Unlock()
+		return true
+	}
+	// Changes after the expiry were missed
+	ue.subscriptionID = ""
+	delete(c.callbacks, ue.callbackID)
+	ue.callbackID = ""
+	ue.resources = make(map[string]json.RawMessage)
+	ue.generation++
+	c.mu.Unlock()
+
+	var created *udmclient.SDMSubscription
+	callbackID, err := newCallbackID()
+	if err == nil {
+		subscription := udmclient.SDMSubscription{
+			NFInstanceID:      c.nfInstanceID,
+			CallbackReference: strings.TrimSuffix(c.callbackURI, "/") + "/" + callbackID,
+		}
+		for _, resource := range CachedResources {
+			subscription.MonitoredResourceURIs = append(subscription.MonitoredResourceURIs, c.client.SDMResourceURI(supi, resource))
+		}
+		created, err = c.client.SubscribeSDM(ctx, supi, subscription)
+	}
+	if err != nil {
+		log.Printf("Not caching subscription data of %s: %v", supi, err)
+		// The UE is not kept without a subscription, and its next use
+		// subscribes again through a new entry
+		c.mu.Lock()
+		if c.ues[supi] == ue {
+			delete(c.ues, supi)
+		}
+		c.mu.Unlock()
+		ue.evicted = true
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ue.subscriptionID = created.SubscriptionID
+	ue.callbackID = callbackID
+	c.callbacks[callbackID] = supi
+	ue.expires = time.Time{}
+	if created.Expires != nil {
+		ue.expires = *created.Expires
+	}
+	return true
+}
+
+// newCallbackID returns a random ID for the callback reference of a
+// subscription, which cannot be guessed from the others
+func newCallbackID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a callback ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (ue *cachedUE) expired() bool {
+	return !ue.expires.IsZero() && !time.Now().Before(ue.expires)
+}
+
+// Refresh drops the cached subscription data of a UE and fetches it again
+// from the UDM
+func (c *SDMCache) Refresh(ctx context.Context, supi string) error {
+	c.mu.Lock()
+	if ue := c.ues[supi]; ue != nil {
+		ue.resources = make(map[string]json.RawMessage)
+		ue.generation++
+	}
+	c.mu.Unlock()
+
+	for _, resource := range CachedResources {
+		if _, err := c.Get(ctx, supi, resource); err != nil {
+			return fmt.Errorf("failed to refresh %s of %s: %w", resource, supi, err)
+		}
+	}
+	return nil
+}
+
+// Evict drops the cached subscription data of a UE and removes its SDM
+// subscription
+func (c *SDMCache) Evict(ctx context.Context, supi string) error {
+	c.mu.Lock()
+	ue := c.ues[supi]
+	delete(c.ues, supi)
+	if ue != nil {
+		delete(c.callbacks, ue.callbackID)
+	}
+	c.mu.Unlock()
+	if ue == nil {
+		return nil
+	}
+
+	ue.subscribeMu.Lock()
+	defer ue.subscribeMu.Unlock()
+	ue.evicted = true
+	if ue.subscriptionID == "" {
+		return nil
+	}
+	return c.client.UnsubscribeSDM(ctx, supi, ue.subscriptionID)
+}
+
+// Close removes the SDM subscriptions of all cached UEs
+func (c *SDMCache) Close(ctx context.Context) {
+	c.mu.Lock()
+	supis := make([]string, 0, len(c.ues))
+	for supi := range c.ues {
+		supis = append(supis, supi)
+	}
+	c.mu.Unlock()
+
+	for _, supi := range supis {
+		if err := c.Evict(ctx, supi); err != nil {
+			log.Printf("Failed to unsubscribe from subscription data of %s: %v", supi, err)
+		}
+	}
+}
+
+// HandleNotification takes the changes notified by the UDM to the callback
+// reference ending with callbackID, for the resources of the UE that
+// subscription monitors. Changes from an authenticated UDM are applied to
+// the cached resources; otherwise, or when there are no changes or they
+// cannot be applied, the resources are evicted and fetched again on their
+// next use.
+func (c *SDMCache) HandleNotification(callbackID string, notification udmclient.ModificationNotification, authenticated bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	supi, ok := c.callbacks[callbackID]
+	ue := c.ues[supi]
+	if !ok || ue == nil || ue.callbackID != callbackID {
+		return ErrUnknownCallback
+	}
+	for _, item := range notification.NotifyItems {
+		itemSUPI, resource, err := udmclient.ParseSDMResourceURI(item.ResourceID)
+		if err != nil {
+			log.Printf("Ignoring SDM notification: %v", err)
+			continue
+		}
+		if itemSUPI != supi || !isCachedResource(resource) {
+			log.Printf("Ignoring SDM notification about %s, which the subscription for %s does not monitor", item.ResourceID, supi)
+			continue
+		}
+		ue.generation++
+
+		// The NSSAI is also part of the access and mobility data
+		switch resource {
+		case udmclient.ResourceAMData:
+			delete(ue.resources, udmclient.ResourceNSSAI)
+		case udmclient.ResourceNSSAI:
+			delete(ue.resources, udmclient.ResourceAMData)
+		}
+
+		data, ok := ue.resources[resource]
+		if !ok {
+			continue
+		}
+		if len(item.Changes) == 0 || !authenticated {
+			delete(ue.resources, resource)
+			continue
+		}
+		updated, err := applyChanges(data, item.Changes)
+		if err != nil {
+			log.Printf("Evicting %s of %s: %v", resource, supi, err)
+			delete(ue.resources, resource)
+			continue
+		}
+		ue.resources[resource] = updated
+	}
+	return nil
+}
+
+// isCachedResource reports whether a resource is one of CachedResources
+func isCachedResource(resource string) bool {
+	for _, cached := range CachedResources {
+		if resource == cached {
+			return true
+		}
+	}
+	return false
+}
+
+// applyChanges applies change items, whose paths are JSON pointers
+// (RFC 6901), to a JSON document
+func applyChanges(data json.RawMessage, changes []udmclient.ChangeItem) (json.RawMessage, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		var err error
+		switch change.Op {
+		case "ADD", "REPLACE":
+			var value interface{}
+			if err = json.Unmarshal(change.NewValue, &value); err != nil {
+				return nil, fmt.Errorf("invalid newValue of %s %s: %w", change.Op, change.Path, err)
+			}
+			doc, err = setPointer(doc, change.Path, value, change.Op == "ADD")
+		case "REMOVE":
+			doc, _, err = removePointer(doc, change.Path)
+		case "MOVE":
+			var value interface{}
+			if doc, value, err = removePointer(doc, change.From); err == nil {
+				doc, err = setPointer(doc, change.Path, value, true)
+			}
+		default:
+			err = fmt.Errorf("unsupported operation %q", change.Op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// splitPointer returns the reference tokens of a JSON pointer
+func splitPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// setPointer sets the value at a JSON pointer. With insert, a value is
+// inserted in an array and members may be created, as in a JSON patch add.
+func setPointer(doc interface{}, pointer string, value interface{}, insert bool) (interface{}, error) {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := resolvePointer(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", pointer, err)
+	}
+	last := tokens[len(tokens)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := container[last]; !ok && !insert {
+			return nil, fmt.Errorf("%s does not exist", pointer)
+		}
+		container[last] = value
+	case []interface{}:
+		index := len(container)
+		if last != "-" || !insert {
+			if index, err = arrayIndex(container, last, insert); err != nil {
+				return nil, fmt.Errorf("%s: %w", pointer, err)
+			}
+		}
+		if !insert {
+			container[index] = value
+			break
+		}
+		container = append(container, nil)
+		copy(container[index+1:], container[index:])
+		container[index] = value
+		// The grown array replaces the old one in its own parent
+		return replaceAt(doc, tokens[:len(tokens)-1], container)
+	default:
+		return nil, fmt.Errorf("parent of %s is not a container", pointer)
+	}
+	return doc, nil
+}
+
+// removePointer removes the value at a JSON pointer and returns it
+func removePointer(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole resource")
+	}
+	parent, err := resolvePointer(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", pointer, err)
+	}
+	last := tokens[len(tokens)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		value, ok := container[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s does not exist", pointer)
+		}
+		delete(container, last)
+		return doc, value, nil
+	case []interface{}:
+		index, err := arrayIndex(container, last, false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", pointer, err)
+		}
+		value := container[index]
+		shrunk := append(container[:index:index], container[index+1:]...)
+		doc, err = replaceAt(doc, tokens[:len(tokens)-1], shrunk)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("parent of %s is not a container", pointer)
+	}
+}
+
+// resolvePointer returns the value referenced by tokens
+func resolvePointer(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			doc = value
+		case []interface{}:
+			index, err := arrayIndex(container, token, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("%q is not in a container", token)
+		}
+	}
+	return doc, nil
+}
+
+// arrayIndex parses an array index token. The index past the end is valid
+// for insertions.
+func arrayIndex(array []interface{}, token string, insert bool) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > len(array) || (index == len(array) && !insert) {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+// replaceAt replaces the value referenced by tokens, which exists
+func replaceAt(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	escaped := make([]string, len(tokens))
+	for i, token := range tokens {
+		escaped[i] = strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+	}
+	return setPointer(doc, "/"+strings.Join(escaped, "/"), value, false)
+}
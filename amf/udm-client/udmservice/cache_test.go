@@ -0,0 +1,513 @@
+package udmservice
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danipopa/mob5g/amf/udm-client/udmclient"
+)
+
+func TestApplyChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		changes  []udmclient.ChangeItem
+		expected string // empty when the changes cannot be applied
+	}{
+		{"add member", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/b", NewValue: json.RawMessage(`2`)}},
+			`{"a": 1, "b": 2}`},
+		{"add nested member", `{"a": {"b": 1}}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/a/c", NewValue: json.RawMessage(`[]`)}},
+			`{"a": {"b": 1, "c": []}}`},
+		{"add member to a missing object", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/b/c", NewValue: json.RawMessage(`2`)}},
+			``},
+		{"insert in array", `{"a": [1, 3]}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/a/1", NewValue: json.RawMessage(`2`)}},
+			`{"a": [1, 2, 3]}`},
+		{"append to array", `{"a": [1]}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/a/-", NewValue: json.RawMessage(`2`)}},
+			`{"a": [1, 2]}`},
+		{"insert at the end of an array", `{"a": [1]}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/a/1", NewValue: json.RawMessage(`2`)}},
+			`{"a": [1, 2]}`},
+		{"insert past the end of an array", `{"a": [1]}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/a/2", NewValue: json.RawMessage(`2`)}},
+			``},
+		{"insert in nested array", `{"a": [{"b": ["x", "z"]}]}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/a/0/b/1", NewValue: json.RawMessage(`"y"`)}},
+			`{"a": [{"b": ["x", "y", "z"]}]}`},
+		{"replace member", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "REPLACE", Path: "/a", NewValue: json.RawMessage(`{"b": 2}`)}},
+			`{"a": {"b": 2}}`},
+		{"replace missing member", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "REPLACE", Path: "/b", NewValue: json.RawMessage(`2`)}},
+			``},
+		{"replace array element", `{"a": [1, 2]}`,
+			[]udmclient.ChangeItem{{Op: "REPLACE", Path: "/a/1", NewValue: json.RawMessage(`3`)}},
+			`{"a": [1, 3]}`},
+		{"replace past the end of an array", `{"a": [1, 2]}`,
+			[]udmclient.ChangeItem{{Op: "REPLACE", Path: "/a/2", NewValue: json.RawMessage(`3`)}},
+			``},
+		{"replace the end of an array", `{"a": [1, 2]}`,
+			[]udmclient.ChangeItem{{Op: "REPLACE", Path: "/a/-", NewValue: json.RawMessage(`3`)}},
+			``},
+		{"replace whole resource", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "REPLACE", Path: "", NewValue: json.RawMessage(`{"b": 2}`)}},
+			`{"b": 2}`},
+		{"replace without value", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "REPLACE", Path: "/a"}},
+			``},
+		{"remove member", `{"a": 1, "b": 2}`,
+			[]udmclient.ChangeItem{{Op: "REMOVE", Path: "/a"}},
+			`{"b": 2}`},
+		{"remove missing member", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "REMOVE", Path: "/b"}},
+			``},
+		{"remove array element", `{"a": [1, 2, 3]}`,
+			[]udmclient.ChangeItem{{Op: "REMOVE", Path: "/a/1"}},
+			`{"a": [1, 3]}`},
+		{"remove past the end of an array", `{"a": [1]}`,
+			[]udmclient.ChangeItem{{Op: "REMOVE", Path: "/a/1"}},
+			``},
+		{"remove the whole resource", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "REMOVE", Path: ""}},
+			``},
+		{"move member", `{"a": {"b": 1}, "c": {}}`,
+			[]udmclient.ChangeItem{{Op: "MOVE", From: "/a/b", Path: "/c/d"}},
+			`{"a": {}, "c": {"d": 1}}`},
+		{"move array element", `{"a": ["w", "x", "y", "z"]}`,
+			[]udmclient.ChangeItem{{Op: "MOVE", From: "/a/1", Path: "/a/3"}},
+			`{"a": ["w", "y", "z", "x"]}`},
+		{"move between arrays", `{"a": [1, 2], "b": [3]}`,
+			[]udmclient.ChangeItem{{Op: "MOVE", From: "/a/0", Path: "/b/-"}},
+			`{"a": [2], "b": [3, 1]}`},
+		{"move missing member", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "MOVE", From: "/b", Path: "/c"}},
+			``},
+		{"escaped member names", `{"a/b": 1, "c~d": 2}`,
+			[]udmclient.ChangeItem{{Op: "REMOVE", Path: "/a~1b"}, {Op: "REPLACE", Path: "/c~0d", NewValue: json.RawMessage(`3`)}},
+			`{"c~d": 3}`},
+		{"index with a leading zero", `{"a": [1, 2]}`,
+			[]udmclient.ChangeItem{{Op: "REMOVE", Path: "/a/01"}},
+			``},
+		{"negative index", `{"a": [1, 2]}`,
+			[]udmclient.ChangeItem{{Op: "REMOVE", Path: "/a/-1"}},
+			``},
+		{"non numeric index", `{"a": [1, 2]}`,
+			[]udmclient.ChangeItem{{Op: "REPLACE", Path: "/a/b", NewValue: json.RawMessage(`3`)}},
+			``},
+		{"member of a scalar", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/a/b", NewValue: json.RawMessage(`2`)}},
+			``},
+		{"pointer without leading slash", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "REMOVE", Path: "a"}},
+			``},
+		{"unsupported operation", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "COPY", From: "/a", Path: "/b"}},
+			``},
+		{"failing change discards the others", `{"a": 1}`,
+			[]udmclient.ChangeItem{{Op: "ADD", Path: "/b", NewValue: json.RawMessage(`2`)}, {Op: "REMOVE", Path: "/c"}},
+			``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, err := applyChanges(json.RawMessage(tt.data), tt.changes)
+			if tt.expected == "" {
+				if err == nil {
+					t.Fatalf("changes applied, giving %s", updated)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyChanges: %v", err)
+			}
+			var got, expected interface{}
+			json.Unmarshal(updated, &got)
+			json.Unmarshal([]byte(tt.expected), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("got %s, expected %s", updated, tt.expected)
+			}
+		})
+	}
+}
+
+// fakeUDM serves the SDM resources and subscriptions of UEs
+type fakeUDM struct {
+	*httptest.Server
+
+	mu              sync.Mutex
+	resources       map[string]string // JSON by "supi/resource"
+	subscriptions   map[string]udmclient.SDMSubscription
+	subscribeStatus int          // Status answered to subscriptions when not 0
+	fetches         int          // Resources served
+	onFetch         func(string) // Called with "supi/resource" between reading and serving a resource
+}
+
+func newFakeUDM(t *testing.T) *fakeUDM {
+	t.Helper()
+	udm := &fakeUDM{resources: make(map[string]string), subscriptions: make(map[string]udmclient.SDMSubscription)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /nudm-sdm/v2/{supi}/{resource}", udm.getResource)
+	mux.HandleFunc("POST /nudm-sdm/v2/{supi}/sdm-subscriptions", udm.subscribe)
+	mux.HandleFunc("DELETE /nudm-sdm/v2/{supi}/sdm-subscriptions/{id}", udm.unsubscribe)
+	udm.Server = httptest.NewServer(mux)
+	t.Cleanup(udm.Close)
+	return udm
+}
+
+func (udm *fakeUDM) getResource(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("supi") + "/" + r.PathValue("resource")
+	udm.mu.Lock()
+	udm.fetches++
+	data, ok := udm.resources[key]
+	onFetch := udm.onFetch
+	udm.mu.Unlock()
+	if onFetch != nil {
+		onFetch(key)
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(data))
+}
+
+func (udm *fakeUDM) subscribe(w http.ResponseWriter, r *http.Request) {
+	var subscription udmclient.SDMSubscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	udm.mu.Lock()
+	defer udm.mu.Unlock()
+	if udm.subscribeStatus != 0 {
+		http.Error(w, http.StatusText(udm.subscribeStatus), udm.subscribeStatus)
+		return
+	}
+	subscription.SubscriptionID = "sub-" + r.PathValue("supi") + "-" + string(rune('a'+len(udm.subscriptions)))
+	udm.subscriptions[subscription.SubscriptionID] = subscription
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func (udm *fakeUDM) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	udm.mu.Lock()
+	defer udm.mu.Unlock()
+	if _, ok := udm.subscriptions[r.PathValue("id")]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	delete(udm.subscriptions, r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// callbackID returns the callback ID of the only subscription of a UE
+func (udm *fakeUDM) callbackID(t *testing.T, supi string) string {
+	t.Helper()
+	udm.mu.Lock()
+	defer udm.mu.Unlock()
+	var ids []string
+	for _, subscription := range udm.subscriptions {
+		if strings.HasPrefix(subscription.SubscriptionID, "sub-"+supi+"-") {
+			ids = append(ids, path.Base(subscription.CallbackReference))
+		}
+	}
+	if len(ids) != 1 {
+		t.Fatalf("%d subscriptions for %s, expected 1", len(ids), supi)
+	}
+	return ids[0]
+}
+
+func (udm *fakeUDM) fetchCount() int {
+	udm.mu.Lock()
+	defer udm.mu.Unlock()
+	return udm.fetches
+}
+
+func (udm *fakeUDM) subscriptionCount() int {
+	udm.mu.Lock()
+	defer udm.mu.Unlock()
+	return len(udm.subscriptions)
+}
+
+const testSUPI = "imsi-001010000000001"
+
+// newTestCache returns a cache of the data of testSUPI served by a fake UDM
+func newTestCache(t *testing.T) (*SDMCache, *fakeUDM) {
+	udm := newFakeUDM(t)
+	udm.resources[testSUPI+"/am-data"] = `{"micoAllowed": false, "gpsis": ["msisdn-1"]}`
+	udm.resources[testSUPI+"/nssai"] = `{"defaultSingleNssais": [{"sst": 1}]}`
+	udm.resources[testSUPI+"/smf-select-data"] = `{"subscribedSnssaiInfos": {}}`
+	return NewSDMCache(udmclient.NewUDMClient(udm.URL), "amf-1", "http://amf:8081"+SDMNotificationPath), udm
+}
+
+// get reads a resource of testSUPI through the cache
+func get(t *testing.T, cache *SDMCache, resource string) string {
+	t.Helper()
+	data, err := cache.Get(context.Background(), testSUPI, resource)
+	if err != nil {
+		t.Fatalf("Get %s: %v", resource, err)
+	}
+	var compact strings.Builder
+	var doc interface{}
+	json.Unmarshal(data, &doc)
+	json.NewEncoder(&compact).Encode(doc)
+	return strings.TrimSpace(compact.String())
+}
+
+// TestCacheSubscribes checks that the data of a UE is cached once the UDM
+// accepted to notify its changes
+func TestCacheSubscribes(t *testing.T) {
+	cache, udm := newTestCache(t)
+
+	get(t, cache, "am-data")
+	get(t, cache, "am-data")
+	get(t, cache, "nssai")
+	if fetches := udm.fetchCount(); fetches != 2 {
+		t.Errorf("%d fetches, expected 2", fetches)
+	}
+	if subscriptions := udm.subscriptionCount(); subscriptions != 1 {
+		t.Errorf("%d subscriptions, expected 1", subscriptions)
+	}
+	udm.mu.Lock()
+	for _, subscription := range udm.subscriptions {
+		if !strings.HasPrefix(subscription.CallbackReference, "http://amf:8081"+SDMNotificationPath+"/") || len(subscription.MonitoredResourceURIs) != len(CachedResources) {
+			t.Errorf("subscription %+v", subscription)
+		}
+	}
+	udm.mu.Unlock()
+}
+
+// TestCacheWithoutSubscription checks that the data of a UE is not cached
+// while the UDM refuses to notify its changes
+func TestCacheWithoutSubscription(t *testing.T) {
+	cache, udm := newTestCache(t)
+	udm.subscribeStatus = http.StatusServiceUnavailable
+
+	get(t, cache, "am-data")
+	get(t, cache, "am-data")
+	if fetches := udm.fetchCount(); fetches != 2 {
+		t.Errorf("%d fetches, expected 2", fetches)
+	}
+	cache.mu.Lock()
+	cached := len(cache.ues)
+	cache.mu.Unlock()
+	if cached != 0 {
+		t.Errorf("%d UEs cached without subscription", cached)
+	}
+
+	// Cached once the UDM accepts the subscription
+	udm.mu.Lock()
+	udm.subscribeStatus = 0
+	udm.mu.Unlock()
+	get(t, cache, "am-data")
+	get(t, cache, "am-data")
+	if fetches := udm.fetchCount(); fetches != 3 {
+		t.Errorf("%d fetches, expected 3", fetches)
+	}
+}
+
+// TestNotificationDuringFetch checks that data fetched before a change is
+// notified is not cached
+func TestNotificationDuringFetch(t *testing.T) {
+	cache, udm := newTestCache(t)
+	notified := false
+	udm.onFetch = func(key string) {
+		if notified {
+			return
+		}
+		notified = true
+		udm.mu.Lock()
+		udm.resources[testSUPI+"/am-data"] = `{"micoAllowed": true}`
+		udm.mu.Unlock()
+		notification := udmclient.ModificationNotification{NotifyItems: []udmclient.NotifyItem{{
+			ResourceID: udm.URL + "/nudm-sdm/v2/" + testSUPI + "/am-data",
+			Changes:    []udmclient.ChangeItem{{Op: "REPLACE", Path: "/micoAllowed", NewValue: json.RawMessage(`true`)}},
+		}}}
+		if err := cache.HandleNotification(udm.callbackID(t, testSUPI), notification, true); err != nil {
+			t.Errorf("HandleNotification: %v", err)
+		}
+	}
+
+	// The fetch answers with the data before the change
+	if data := get(t, cache, "am-data"); data != `{"gpsis":["msisdn-1"],"micoAllowed":false}` {
+		t.Errorf("got %s", data)
+	}
+	if data := get(t, cache, "am-data"); data != `{"micoAllowed":true}` {
+		t.Errorf("got %s, expected the changed data", data)
+	}
+	if fetches := udm.fetchCount(); fetches != 2 {
+		t.Errorf("%d fetches, expected 2", fetches)
+	}
+}
+
+// TestEvict checks that evicting a UE removes its subscription, after which
+// its former callback reference is no longer served
+func TestEvict(t *testing.T) {
+	cache, udm := newTestCache(t)
+	get(t, cache, "am-data")
+	callbackID := udm.callbackID(t, testSUPI)
+
+	if err := cache.Evict(context.Background(), testSUPI); err != nil {
+		t.Fatalf("Evict: %v", err)
+	}
+	if subscriptions := udm.subscriptionCount(); subscriptions != 0 {
+		t.Errorf("%d subscriptions left", subscriptions)
+	}
+	if err := cache.HandleNotification(callbackID, udmclient.ModificationNotification{}, true); !errors.Is(err, ErrUnknownCallback) {
+		t.Errorf("HandleNotification after Evict: %v, expected ErrUnknownCallback", err)
+	}
+
+	// The next use subscribes again
+	get(t, cache, "am-data")
+	if fetches, subscriptions := udm.fetchCount(), udm.subscriptionCount(); fetches != 2 || subscriptions != 1 {
+		t.Errorf("%d fetches and %d subscriptions, expected 2 and 1", fetches, subscriptions)
+	}
+	if err := cache.Evict(context.Background(), "imsi-unknown"); err != nil {
+		t.Errorf("Evict of an unknown UE: %v", err)
+	}
+}
+
+// TestHandleNotification checks which notifications update, evict or leave
+// the cached data
+func TestHandleNotification(t *testing.T) {
+	replaceMICO := []udmclient.ChangeItem{{Op: "REPLACE", Path: "/micoAllowed", NewValue: json.RawMessage(`true`)}}
+	tests := []struct {
+		name          string
+		callbackID    string // the one of the subscription when empty
+		supi          string
+		resource      string
+		changes       []udmclient.ChangeItem
+		authenticated bool
+		err           error
+		amData        string // cached access and mobility data, empty when evicted
+		nssaiCached   bool
+	}{
+		{"authenticated change", "", testSUPI, "am-data", replaceMICO, true, nil, `{"gpsis":["msisdn-1"],"micoAllowed":true}`, false},
+		{"unauthenticated change", "", testSUPI, "am-data", replaceMICO, false, nil, "", false},
+		{"no changes", "", testSUPI, "am-data", nil, true, nil, "", false},
+		{"changes that cannot be applied", "", testSUPI, "am-data", []udmclient.ChangeItem{{Op: "REMOVE", Path: "/rfspIndex"}}, true, nil, "", false},
+		{"change of the NSSAI", "", testSUPI, "nssai", []udmclient.ChangeItem{{Op: "REMOVE", Path: "/defaultSingleNssais/0"}}, true, nil, "", true},
+		{"change of the SMF selection data", "", testSUPI, "smf-select-data", nil, true, nil, `{"gpsis":["msisdn-1"],"micoAllowed":false}`, true},
+		{"resource of another UE", "", "imsi-001010000000002", "am-data", replaceMICO, true, nil, `{"gpsis":["msisdn-1"],"micoAllowed":false}`, true},
+		{"resource not monitored", "", testSUPI, "sdm-subscriptions", nil, true, nil, `{"gpsis":["msisdn-1"],"micoAllowed":false}`, true},
+		{"unknown callback", "0123456789abcdef", testSUPI, "am-data", replaceMICO, true, ErrUnknownCallback, `{"gpsis":["msisdn-1"],"micoAllowed":false}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, udm := newTestCache(t)
+			get(t, cache, "am-data")
+			get(t, cache, "nssai")
+			callbackID := tt.callbackID
+			if callbackID == "" {
+				callbackID = udm.callbackID(t, testSUPI)
+			}
+
+			notification := udmclient.ModificationNotification{NotifyItems: []udmclient.NotifyItem{{
+				ResourceID: udm.URL + "/nudm-sdm/v2/" + tt.supi + "/" + tt.resource,
+				Changes:    tt.changes,
+			}}}
+			if err := cache.HandleNotification(callbackID, notification, tt.authenticated); !errors.Is(err, tt.err) {
+				t.Fatalf("HandleNotification: %v, expected %v", err, tt.err)
+			}
+
+			cache.mu.Lock()
+			ue := cache.ues[testSUPI]
+			amData, amDataCached := ue.resources["am-data"]
+			_, nssaiCached := ue.resources["nssai"]
+			cache.mu.Unlock()
+			if amDataCached != (tt.amData != "") {
+				t.Fatalf("am-data cached: %v, expected %v", amDataCached, tt.amData != "")
+			}
+			if amDataCached {
+				var doc interface{}
+				json.Unmarshal(amData, &doc)
+				if compact, _ := json.Marshal(doc); string(compact) != tt.amData {
+					t.Errorf("cached am-data %s, expected %s", compact, tt.amData)
+				}
+			}
+			if nssaiCached != tt.nssaiCached {
+				t.Errorf("nssai cached: %v, expected %v", nssaiCached, tt.nssaiCached)
+			}
+		})
+	}
+}
+
+// TestSDMNotificationHandler checks that notifications reach the cache
+// through the callback IDs of its subscriptions, and are only applied when
+// the UDM authenticated with a verified client certificate
+func TestSDMNotificationHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		callbackID    string // the one of the subscription when empty
+		authenticated bool
+		status        int
+		cached        string // cached access and mobility data, empty when evicted
+	}{
+		{"authenticated", "", true, http.StatusNoContent, `{"gpsis":["msisdn-1"],"micoAllowed":true}`},
+		{"unauthenticated", "", false, http.StatusNoContent, ""},
+		{"unknown callback", "0123456789abcdef", true, http.StatusNotFound, `{"gpsis":["msisdn-1"],"micoAllowed":false}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, udm := newTestCache(t)
+			service := &UDMService{Client: cache.client, Cache: cache}
+			get(t, cache, "am-data")
+			callbackID := tt.callbackID
+			if callbackID == "" {
+				callbackID = udm.callbackID(t, testSUPI)
+			}
+
+			body, _ := json.Marshal(udmclient.ModificationNotification{NotifyItems: []udmclient.NotifyItem{{
+				ResourceID: udm.URL + "/nudm-sdm/v2/" + testSUPI + "/am-data",
+				Changes:    []udmclient.ChangeItem{{Op: "REPLACE", Path: "/micoAllowed", NewValue: json.RawMessage(`true`)}},
+			}}})
+			req := httptest.NewRequest(http.MethodPost, SDMNotificationPath+"/"+callbackID, strings.NewReader(string(body)))
+			if tt.authenticated {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+			}
+			rec := httptest.NewRecorder()
+			service.SetupRouter().ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, expected %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			cache.mu.Lock()
+			amData, cached := cache.ues[testSUPI].resources["am-data"]
+			cache.mu.Unlock()
+			var doc interface{}
+			json.Unmarshal(amData, &doc)
+			if compact, _ := json.Marshal(doc); cached != (tt.cached != "") || (cached && string(compact) != tt.cached) {
+				t.Errorf("cached am-data %s, expected %q", amData, tt.cached)
+			}
+		})
+	}
+}
+
+// TestGetSubscriptionDataHandler checks that the subscription data of a UE
+// is redirected to its access and mobility data
+func TestGetSubscriptionDataHandler(t *testing.T) {
+	service := &UDMService{}
+	rec := httptest.NewRecorder()
+	service.SetupRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/subscription-data/"+testSUPI, nil))
+	if rec.Code != http.StatusPermanentRedirect {
+		t.Fatalf("status %d, expected %d: %s", rec.Code, http.StatusPermanentRedirect, rec.Body)
+	}
+	if location := rec.Header().Get("Location"); location != "/nudm-sdm/v2/"+testSUPI+"/am-data" {
+		t.Errorf("redirected to %s", location)
+	}
+}
@@ -1,8 +1,10 @@
 package udmservice
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/danipopa/mob5g/amf/udm-client/udmclient"	
 
@@ -10,46 +12,148 @@ import (
 
 )
 
+// SDMNotificationPath is where the UDM sends changes of cached subscription
+// data, followed by the callback ID of the subscription
+const SDMNotificationPath = "/sdm-notifications"
+
 // UDMService represents the microservice for the UDM client
 type UDMService struct {
 	Client *udmclient.UDMClient
+	Cache  *SDMCache
 }
 
-// NewUDMService initializes the UDMService with a UDM client
-func NewUDMService(udmBaseURL string) *UDMService {
+// NewUDMService initializes the UDMService with a UDM client. The UDM sends
+// changes of cached subscription data below callbackURI, which is served at
+// SDMNotificationPath.
+func NewUDMService(udmBaseURL, nfInstanceID, callbackURI string) *UDMService {
+	client := udmclient.NewUDMClient(udmBaseURL)
 	return &UDMService{
-		Client: udmclient.NewUDMClient(udmBaseURL),
+		Client: client,
+		Cache:  NewSDMCache(client, nfInstanceID, callbackURI),
 	}
 }
 
-// GetSubscriptionDataHandler handles requests for subscription data
+// GetSubscriptionDataHandler redirects the requests for the subscription
+// data of a UE to its access and mobility data, served from the cache
 func (s *UDMService) GetSubscriptionDataHandler(w http.ResponseWriter, r *http.Request) {
+	ueID := mux.Vars(r)["ueId"]
+	http.Redirect(w, r, "/nudm-sdm/v2/"+url.PathEscape(ueID)+"/"+udmclient.ResourceAMData, http.StatusPermanentRedirect)
+}
+
+// GetAuthVectorHandler handles requests for authentication vectors
+func (s *UDMService) GetAuthVectorHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	ueID := vars["ueId"]
 
-	data, err := s.Client.GetSubscriptionData(ueID)
+	vector, err := s.Client.GetAuthVector(ueID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve subscription data: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to retrieve authentication vector: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	json.NewEncoder(w).Encode(vector)
 }
 
-// GetAuthVectorHandler handles requests for authentication vectors
-func (s *UDMService) GetAuthVectorHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	ueID := vars["ueId"]
+// GenerateAuthDataHandler obtains an authentication vector from the UDM for
+// the SUPI or SUCI of the path (Nudm_UEAU_Get). Rejections of the UDM are
+// passed on with their status and problem details.
+func (s *UDMService) GenerateAuthDataHandler(w http.ResponseWriter, r *http.Request) {
+	supiOrSuci := mux.Vars(r)["supiOrSuci"]
 
-	vector, err := s.Client.GetAuthVector(ueID)
+	var request udmclient.AuthenticationInfoRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeProblem(w, http.StatusBadRequest, &udmclient.ProblemDetails{Title: "Malformed request", Detail: err.Error(), Cause: "INVALID_MSG_FORMAT"})
+		return
+	}
+
+	result, err := s.Client.GenerateAuthData(r.Context(), supiOrSuci, request)
+	if errors.Is(err, udmclient.ErrInvalidRequest) {
+		writeProblem(w, http.StatusBadRequest, &udmclient.ProblemDetails{Title: "Invalid request", Detail: err.Error(), Cause: "MANDATORY_IE_INCORRECT"})
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to retrieve authentication vector: %v", err), http.StatusInternalServerError)
+		writeUDMError(w, "Failed to generate authentication data", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(vector)
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetSDMResourceHandler serves the access and mobility data, NSSAI or SMF
+// selection data of a SUPI from the cache
+func (s *UDMService) GetSDMResourceHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	data, err := s.Cache.Get(r.Context(), vars["supi"], vars["resource"])
+	if err != nil {
+		writeUDMError(w, "Failed to retrieve subscription data", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// RefreshSDMCacheHandler fetches the cached subscription data of a SUPI
+// again from the UDM
+func (s *UDMService) RefreshSDMCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.Cache.Refresh(r.Context(), mux.Vars(r)["supi"]); err != nil {
+		writeUDMError(w, "Failed to refresh subscription data", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EvictSDMCacheHandler drops the cached subscription data of a SUPI, e.g.
+// when the UE deregisters
+func (s *UDMService) EvictSDMCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.Cache.Evict(r.Context(), mux.Vars(r)["supi"]); err != nil {
+		writeUDMError(w, "Failed to unsubscribe from subscription data", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SDMNotificationHandler receives the changes of subscription data the
+// cache subscribed to. The changes are only applied when the UDM presented
+// a client certificate verified by the server; otherwise the cache evicts
+// the data they concern.
+func (s *UDMService) SDMNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	var notification udmclient.ModificationNotification
+	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+		writeProblem(w, http.StatusBadRequest, &udmclient.ProblemDetails{Title: "Malformed notification", Detail: err.Error(), Cause: "INVALID_MSG_FORMAT"})
+		return
+	}
+	authenticated := r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+	if err := s.Cache.HandleNotification(mux.Vars(r)["callbackId"], notification, authenticated); err != nil {
+		writeProblem(w, http.StatusNotFound, &udmclient.ProblemDetails{Title: "Subscription not found", Detail: err.Error(), Cause: "SUBSCRIPTION_NOT_FOUND"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUDMError passes a rejection of the UDM on with its status and problem
+// details, and answers other errors with 502
+func writeUDMError(w http.ResponseWriter, title string, err error) {
+	var respErr *udmclient.ResponseError
+	if errors.As(err, &respErr) {
+		problem := respErr.Problem
+		if problem == nil {
+			problem = &udmclient.ProblemDetails{Title: respErr.Status}
+		}
+		writeProblem(w, respErr.StatusCode, problem)
+		return
+	}
+	writeProblem(w, http.StatusBadGateway, &udmclient.ProblemDetails{Title: title, Detail: err.Error()})
+}
+
+// writeProblem writes an error response with problem details
+func writeProblem(w http.ResponseWriter, status int, problem *udmclient.ProblemDetails) {
+	problem.Status = status
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
 }
 
 // SetupRouter initializes the routes for the microservice
@@ -57,6 +161,11 @@ func (s *UDMService) SetupRouter() *mux.Router {
 	router := mux.NewRouter()
 	router.HandleFunc("/subscription-data/{ueId}", s.GetSubscriptionDataHandler).Methods("GET")
 	router.HandleFunc("/auth-vectors/{ueId}", s.GetAuthVectorHandler).Methods("GET")
+	router.HandleFunc("/nudm-ueau/v1/{supiOrSuci}/security-information/generate-auth-data", s.GenerateAuthDataHandler).Methods("POST")
+	router.HandleFunc("/nudm-sdm/v2/{supi}/{resource:am-data|nssai|smf-select-data}", s.GetSDMResourceHandler).Methods("GET")
+	router.HandleFunc("/sdm-cache/{supi}/refresh", s.RefreshSDMCacheHandler).Methods("POST")
+	router.HandleFunc("/sdm-cache/{supi}", s.EvictSDMCacheHandler).Methods("DELETE")
+	router.HandleFunc(SDMNotificationPath+"/{callbackId}", s.SDMNotificationHandler).Methods("POST")
 	return router
 }
 
@@ -11,3 +11,9 @@ require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 )
+
+require github.com/danipopa/mob5g/sbi v0.0.0
+
+require github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
+
+replace github.com/danipopa/mob5g/sbi => ../sbi
@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
-
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gorilla/mux"
 
-        "github.com/danipopa/mob5g/ausf/src"
+	"github.com/danipopa/mob5g/ausf/src"
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"github.com/danipopa/mob5g/sbi/oauth"
 )
 
 func main() {
+	// Register with the NRF, when NRF_URL is set, so that the AMF finds the AUSF
+	nrfClient, profile, err := nrfagent.FromEnv("AUSF", "http://ausf-service:8080", "nausf-auth")
+	if err != nil {
+		log.Fatalf("Failed to configure NRF registration: %v", err)
+	}
+
 	// Initialize Redis storage
 	storage := ausf.NewRedisStorage("redis-service:6379")
 
@@ -22,10 +33,35 @@ func main() {
 	router.HandleFunc("/nausf-auth/v1/authenticate/{ueId}", handlers.Authenticate).Methods("POST")
 	router.HandleFunc("/nausf-auth/v1/verify/{ueId}", handlers.Verify).Methods("POST")
 
+	// Require SBI access tokens when the NRF token key is configured
+	validator, err := oauth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SBI authorization: %v", err)
+	}
+	if validator != nil {
+		router.Use(validator.Middleware)
+	}
+
+	var handler http.Handler = router
+	if nrfClient != nil {
+		handler = nrfClient.ServeNotifications(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start HTTP server
-	log.Println("Starting AUSF service on port 8080...")
-	if err := http.ListenAndServe(":8080", router); err != nil {
-		log.Fatalf("Failed to start AUSF service: %v", err)
+	go func() {
+		log.Println("Starting AUSF service on port 8080...")
+		if err := http.ListenAndServe(":8080", handler); err != nil {
+			log.Fatalf("Failed to start AUSF service: %v", err)
+		}
+	}()
+
+	// Stay registered with the NRF until SIGTERM, then deregister
+	if nrfClient == nil {
+		<-ctx.Done()
+	} else if err := nrfClient.Run(ctx, profile); err != nil {
+		log.Printf("AUSF NRF agent stopped: %v", err)
 	}
 }
-
@@ -1,19 +1,217 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/danipopa/nrf/internal/api"
 )
 
 func main() {
+	cfg := api.DefaultConfig()
+	cfg.APIRoot = os.Getenv("NRF_API_ROOT")
+	cfg.InstanceID = os.Getenv("NRF_INSTANCE_ID")
+
+	// Access token service
+	cfg.Token.KeyFile = os.Getenv("NRF_TOKEN_KEY_FILE")
+	cfg.Token.Lifetime = durationFromEnv("NRF_TOKEN_LIFETIME", cfg.Token.Lifetime)
+	if cfg.InstanceID != "" {
+		cfg.Token.Issuer = cfg.InstanceID
+	}
+	// Tokens are only issued to NFs presenting the client certificate of
+	// their instance, unless the NRF cannot be reached from untrusted hosts
+	if allow, _ := strconv.ParseBool(os.Getenv("NRF_TOKEN_ALLOW_UNAUTHENTICATED")); allow {
+		log.Println("Issuing access tokens to unauthenticated clients, the NRF must not be reachable from untrusted hosts")
+		cfg.Token.AllowUnauthenticatedClients = true
+	}
+
+	// Heartbeat reaper
+	cfg.Reaper.Interval = durationFromEnv("NRF_REAPER_INTERVAL", cfg.Reaper.Interval)
+	cfg.Reaper.Grace = durationFromEnv("NRF_HEARTBEAT_GRACE", cfg.Reaper.Grace)
+	cfg.Reaper.DeregisterAfter = durationFromEnv("NRF_DEREGISTER_AFTER", cfg.Reaper.DeregisterAfter)
+
+	// Subscriber notifications
+	cfg.Dispatcher.MaxAttempts = intFromEnv("NRF_NOTIFY_MAX_ATTEMPTS", cfg.Dispatcher.MaxAttempts)
+	cfg.Dispatcher.InitialBackoff = durationFromEnv("NRF_NOTIFY_INITIAL_BACKOFF", cfg.Dispatcher.InitialBackoff)
+	cfg.Dispatcher.MaxBackoff = durationFromEnv("NRF_NOTIFY_MAX_BACKOFF", cfg.Dispatcher.MaxBackoff)
+
+	// Discovery results
+	cfg.Discovery.ValidityPeriod = durationFromEnv("NRF_DISCOVERY_VALIDITY", cfg.Discovery.ValidityPeriod)
+
+	// Peer and parent NRFs
+	cfg.Forwarding.Peers = listFromEnv("NRF_PEERS")
+	cfg.Forwarding.LocalPLMNs = plmnsFromEnv("NRF_PLMN_LIST")
+	cfg.Forwarding.RequestTimeout = durationFromEnv("NRF_FORWARD_TIMEOUT", cfg.Forwarding.RequestTimeout)
+	cfg.Forwarding.CacheTTL = durationFromEnv("NRF_FORWARD_CACHE_TTL", cfg.Forwarding.CacheTTL)
+
+	// Election of the replica running the background jobs
+	if hostname, err := os.Hostname(); err == nil {
+		cfg.Leader.CandidateID = hostname
+	}
+	cfg.Leader.LeaseTTL = durationFromEnv("NRF_LEADER_LEASE", cfg.Leader.LeaseTTL)
+	cfg.Leader.RenewInterval = cfg.Leader.LeaseTTL / 3
+
+	store, err := newStore()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	server, err := api.NewServer(store, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize NRF: %v", err)
+	}
+
 	// Initialize the router
-	router := api.SetupRouter()
+	router := server.SetupRouter()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Every replica serves requests and keeps its discovery cache up to date,
+	// but only the elected one runs the reaper and the dispatcher
+	var jobs sync.WaitGroup
+	jobs.Add(2)
+	go func() {
+		defer jobs.Done()
+		server.RunBackgroundJobs(ctx)
+	}()
+	go func() {
+		defer jobs.Done()
+		server.StartCacheInvalidation(ctx)
+	}()
+
+	tlsConfig, err := tlsConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize TLS: %v", err)
+	}
+	if !cfg.Token.AllowUnauthenticatedClients && (tlsConfig == nil || tlsConfig.ClientCAs == nil) {
+		log.Println("No NRF_TLS_CLIENT_CA_FILE, access token requests will be refused")
+	}
 
 	// Start the server
+	httpServer := &http.Server{Addr: ":8080", Handler: router, TLSConfig: tlsConfig}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
 	log.Println("Starting NRF server on port 8080...")
-	if err := http.ListenAndServe(":8080", router); err != nil {
+	if tlsConfig != nil {
+		err = httpServer.ListenAndServeTLS(os.Getenv("NRF_TLS_CERT_FILE"), os.Getenv("NRF_TLS_KEY_FILE"))
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Error starting server: %v", err)
 	}
+	jobs.Wait()
+	log.Println("NRF stopped")
+}
+
+// newStore selects the storage backend from NRF_STORE: "redis" (the
+// default, at NRF_REDIS_ADDR) or "memory" for a standalone NRF
+func newStore() (api.Store, error) {
+	switch backend := os.Getenv("NRF_STORE"); backend {
+	case "", "redis":
+		addr := os.Getenv("NRF_REDIS_ADDR")
+		if addr == "" {
+			addr = "redis-service:6379"
+		}
+		log.Printf("Connecting to Redis at %s...", addr)
+		return api.NewRedisStore(context.Background(), addr)
+	case "memory":
+		log.Println("Using in-memory storage, state is lost on restart")
+		return api.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown NRF_STORE %q", backend)
+	}
 }
 
+// tlsConfigFromEnv configures HTTPS when NRF_TLS_CERT_FILE and
+// NRF_TLS_KEY_FILE are set. Client certificates signed by the CAs in
+// NRF_TLS_CLIENT_CA_FILE are verified, and authenticate access token requests
+func tlsConfigFromEnv() (*tls.Config, error) {
+	if os.Getenv("NRF_TLS_CERT_FILE") == "" || os.Getenv("NRF_TLS_KEY_FILE") == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile := os.Getenv("NRF_TLS_CLIENT_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+		// NFs without a certificate still register and discover
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// durationFromEnv reads a duration such as "30s" from an environment variable
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %v", name, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// intFromEnv reads a positive integer from an environment variable
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// listFromEnv reads a comma separated list from an environment variable
+func listFromEnv(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// plmnsFromEnv reads a list of PLMN IDs written as "<mcc>-<mnc>", such as "001-01,001-02"
+func plmnsFromEnv(name string) []api.PLMNQuery {
+	var plmns []api.PLMNQuery
+	for _, item := range listFromEnv(name) {
+		mcc, mnc, ok := strings.Cut(item, "-")
+		if !ok || mcc == "" || mnc == "" {
+			log.Printf("Ignoring invalid PLMN %q in %s", item, name)
+			continue
+		}
+		plmns = append(plmns, api.PLMNQuery{MCC: mcc, MNC: mnc})
+	}
+	return plmns
+}
@@ -2,6 +2,8 @@ module github.com/danipopa/nrf
 
 go 1.23.4
 
+require github.com/golang-jwt/jwt/v5 v5.2.1
+
 require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// BootstrappingInfo tells NFs where to find the NRF services (TS 29.510 BootstrappingInfo)
+type BootstrappingInfo struct {
+	Status string          `json:"status"`
+	Links  map[string]Link `json:"_links"`
+}
+
+// Bootstrapping returns the URIs of the NRF services. They are built on the
+// configured apiRoot, or on the address the request was sent to.
+func (s *Server) Bootstrapping(w http.ResponseWriter, r *http.Request) {
+	apiRoot := strings.TrimSuffix(s.config.APIRoot, "/")
+	if apiRoot == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		apiRoot = scheme + "://" + r.Host
+	}
+
+	info := BootstrappingInfo{
+		Status: "OPERATIVE",
+		Links: map[string]Link{
+			"nnrf-nfm":    {Href: apiRoot + "/nnrf-nfm/v1"},
+			"nnrf-disc":   {Href: apiRoot + "/nnrf-disc/v1"},
+			"nnrf-oauth2": {Href: apiRoot + "/oauth2/token"},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/3gppHal+json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestBootstrapping checks that the links to the NRF services are built on
+// the configured apiRoot, or on the address the request was sent to
+func TestBootstrapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiRoot string
+		tls     bool
+		nfm     string
+	}{
+		{"configured apiRoot", "https://nrf.example:8443/", false, "https://nrf.example:8443/nnrf-nfm/v1"},
+		{"address of the request", "", false, "http://nrf.local:8000/nnrf-nfm/v1"},
+		{"address of a TLS request", "", true, "https://nrf.local:8000/nnrf-nfm/v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.APIRoot = tt.apiRoot
+			req := httptest.NewRequest(http.MethodGet, "/bootstrapping", nil)
+			req.Host = "nrf.local:8000"
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+			newTestRouter(t, cfg).ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/3gppHal+json" {
+				t.Fatalf("status %d with %s: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+			}
+
+			var info BootstrappingInfo
+			if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+				t.Fatalf("invalid bootstrapping info: %v", err)
+			}
+			if info.Status != "OPERATIVE" || info.Links["nnrf-nfm"].Href != tt.nfm {
+				t.Errorf("status %s and nnrf-nfm link %q, expected %q", info.Status, info.Links["nnrf-nfm"].Href, tt.nfm)
+			}
+			if len(info.Links) != 3 || info.Links["nnrf-disc"].Href == "" || info.Links["nnrf-oauth2"].Href == "" {
+				t.Errorf("links %v", info.Links)
+			}
+		})
+	}
+}
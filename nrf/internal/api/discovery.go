@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DiscoveryQuery holds the TS 29.510 NFDiscovery parameters supported by the NRF
+type DiscoveryQuery struct {
+	TargetNFType      string
+	RequesterNFType   string
+	ServiceNames      []string
+	SNSSAIs           []SNSSAIQuery
+	DNN               string
+	TargetPLMNs       []PLMNQuery
+	TAI               *TAIQuery
+	PreferredLocality string
+	Limit             int // Maximum number of profiles returned, 0 for no limit
+	MaxPayloadSize    int // Maximum response size in kilo-octets
+}
+
+// SNSSAIQuery is an S-NSSAI as sent in the snssais query parameter
+type SNSSAIQuery struct {
+	SST interface{} `json:"sst"`
+	SD  string      `json:"sd"`
+}
+
+// PLMNQuery is a PLMN ID as sent in the target-plmn-list query parameter
+type PLMNQuery struct {
+	MCC string `json:"mcc"`
+	MNC string `json:"mnc"`
+}
+
+// TAIQuery is a tracking area as sent in the tai query parameter
+type TAIQuery struct {
+	PLMNID PLMNQuery `json:"plmnId"`
+	TAC    string    `json:"tac"`
+}
+
+// parseDiscoveryQuery reads the discovery parameters from the request URL.
+// List parameters may be given as repeated values or comma separated, and
+// structured parameters are JSON encoded as in TS 29.510.
+func parseDiscoveryQuery(values url.Values) (*DiscoveryQuery, error) {
+	query := &DiscoveryQuery{
+		TargetNFType:      firstValue(values, "target-nf-type", "nf-type", "nf_type"),
+		RequesterNFType:   values.Get("requester-nf-type"),
+		DNN:               values.Get("dnn"),
+		PreferredLocality: values.Get("preferred-locality"),
+		ServiceNames:      listValues(values, "service-names"),
+	}
+
+	if err := parseLimits(query, values.Get("limit"), values.Get("max-payload-size")); err != nil {
+		return nil, err
+	}
+	if raw := values.Get("snssais"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &query.SNSSAIs); err != nil {
+			return nil, fmt.Errorf("invalid snssais: %w", err)
+		}
+	}
+	if raw := values.Get("target-plmn-list"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &query.TargetPLMNs); err != nil {
+			return nil, fmt.Errorf("invalid target-plmn-list: %w", err)
+		}
+	}
+	if raw := values.Get("tai"); raw != "" {
+		query.TAI = &TAIQuery{}
+		if err := json.Unmarshal([]byte(raw), query.TAI); err != nil {
+			return nil, fmt.Errorf("invalid tai: %w", err)
+		}
+	}
+	return query, nil
+}
+
+// firstValue returns the first non-empty value among the given parameter names
+func firstValue(values url.Values, names ...string) string {
+	for _, name := range names {
+		if v := values.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// listValues splits a list parameter given as repeated or comma separated values
+func listValues(values url.Values, name string) []string {
+	var list []string
+	for _, v := range values[name] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// indexCriteria turns the query into groups of indexes. An NF matches a
+// group if it is in any of its indexes, and must match every group.
+func (q *DiscoveryQuery) indexCriteria() [][]string {
+	var criteria [][]string
+
+	if q.TargetNFType != "" {
+		criteria = append(criteria, []string{nfTypeIndex(q.TargetNFType)})
+	}
+	if len(q.ServiceNames) > 0 {
+		var indexes []string
+		for _, name := range q.ServiceNames {
+			indexes = append(indexes, serviceIndex(name))
+		}
+		criteria = append(criteria, indexes)
+	}
+	if len(q.SNSSAIs) > 0 {
+		var indexes []string
+		for _, snssai := range q.SNSSAIs {
+			indexes = append(indexes, snssaiIndex(fmt.Sprint(snssai.SST), snssai.SD))
+		}
+		criteria = append(criteria, indexes)
+	}
+	if q.DNN != "" {
+		criteria = append(criteria, []string{dnnIndex(q.DNN)})
+	}
+	if len(q.TargetPLMNs) > 0 {
+		var indexes []string
+		for _, plmn := range q.TargetPLMNs {
+			indexes = append(indexes, plmnIndex(plmn.MCC, plmn.MNC))
+		}
+		criteria = append(criteria, indexes)
+	}
+	if q.TAI != nil {
+		criteria = append(criteria, []string{taiIndex(q.TAI.PLMNID.MCC, q.TAI.PLMNID.MNC, q.TAI.TAC)})
+	}
+
+	if len(criteria) == 0 {
+		criteria = append(criteria, []string{indexAll})
+	}
+	return criteria
+}
+
+// discoverProfiles returns the discoverable profiles matching the query,
+// best ranked first, with the entity tag of the matching set
+func (s *Server) discoverProfiles(ctx context.Context, query *DiscoveryQuery) ([]NFProfile, string, error) {
+	candidates, err := s.discoveryCandidates(ctx, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	results := copyProfiles(candidates.profiles)
+	rankProfiles(results)
+	if query.PreferredLocality != "" {
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Locality == query.PreferredLocality &&
+				results[j].Locality != query.PreferredLocality
+		})
+	}
+	return limitResults(results, query.Limit, query.MaxPayloadSize), candidates.etag, nil
+}
+
+// discoveryCandidates returns the discoverable profiles matching the query,
+// from the result cache when possible
+func (s *Server) discoveryCandidates(ctx context.Context, query *DiscoveryQuery) (*cachedResult, error) {
+	key := query.cacheKey()
+	cached, generation := s.results.get(key, time.Now())
+	if cached != nil {
+		return cached, nil
+	}
+
+	criteria := query.indexCriteria()
+	ids, err := s.store.FindNFInstanceIDs(ctx, criteria)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := s.store.GetProfiles(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]NFProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		if !isDiscoverable(profile) || !allowsRequester(profile, query.RequesterNFType) {
+			continue
+		}
+		if !selectServices(&profile, query) {
+			continue
+		}
+		matching = append(matching, profile)
+	}
+
+	result := newCachedResult(criteria, matching, s.config.Discovery.ValidityPeriod)
+	s.results.put(key, result, generation)
+	return result, nil
+}
+
+// allowsRequester reports whether the NF accepts requests from the given NF type
+func allowsRequester(profile NFProfile, requesterNFType string) bool {
+	if requesterNFType == "" || len(profile.AllowedNFTypes) == 0 {
+		return true
+	}
+	for _, nfType := range profile.AllowedNFTypes {
+		if strings.EqualFold(nfType, requesterNFType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiscoveryConfig controls how long discovery results may be reused
+type DiscoveryConfig struct {
+	ValidityPeriod time.Duration // Advertised to consumers and used for the NRF's own cache
+}
+
+// DefaultDiscoveryConfig returns the discovery settings used when none are configured
+func DefaultDiscoveryConfig() DiscoveryConfig {
+	return DiscoveryConfig{ValidityPeriod: time.Minute}
+}
+
+// SearchResult is the body of a discovery response (TS 29.510 SearchResult)
+type SearchResult struct {
+	ValidityPeriod int         `json:"validityPeriod"` // Seconds during which the result may be reused
+	NFInstances    []NFProfile `json:"nfInstances"`
+}
+
+// resultCache keeps the profiles matching recent discovery queries. An
+// entry expires after the validity period, or as soon as an NF it may
+// concern registers, changes or deregisters.
+type resultCache struct {
+	mu         sync.Mutex
+	entries    map[string]*cachedResult
+	generation uint64 // Incremented by every invalidation
+}
+
+// cachedResult holds the discoverable profiles matching a query, before ranking
+type cachedResult struct {
+	criteria [][]string
+	profiles []NFProfile // Sorted by NF instance ID
+	ids      map[string]bool
+	etag     string
+	expires  time.Time
+}
+
+func newResultCache() *resultCache {
+	return &resultCache{entries: make(map[string]*cachedResult)}
+}
+
+// get returns the cached result of a query if it is still valid, otherwise
+// the current generation to pass to put
+func (c *resultCache) get(key string, now time.Time) (*cachedResult, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && now.Before(entry.expires) {
+		return entry, c.generation
+	}
+	delete(c.entries, key)
+	return nil, c.generation
+}
+
+// put caches the result of a query read from the store at the given
+// generation. It is discarded if a profile changed since, as the result may
+// predate that change.
+func (c *resultCache) put(key string, entry *cachedResult, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	now := time.Now()
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry
+}
+
+// invalidate drops the results that contain the profile or whose query it
+// matches now
+func (c *resultCache) invalidate(profile NFProfile) {
+	indexes := make(map[string]bool)
+	for _, index := range profileIndexes(profile) {
+		indexes[index] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for key, entry := range c.entries {
+		if entry.ids[profile.NFID] || matchesIndexes(entry.criteria, indexes) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// matchesIndexes reports whether a profile in the given indexes meets every
+// group of criteria
+func matchesIndexes(criteria [][]string, indexes map[string]bool) bool {
+	for _, group := range criteria {
+		matched := false
+		for _, index := range group {
+			if indexes[index] {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheKey normalizes the parts of the query that select profiles. The
+// limits and the preferred locality only apply to a selection.
+func (q *DiscoveryQuery) cacheKey() string {
+	criteria := q.indexCriteria()
+	for _, group := range criteria {
+		sort.Strings(group)
+	}
+	names := append([]string(nil), q.ServiceNames...)
+	sort.Strings(names)
+
+	key, _ := json.Marshal(struct {
+		Criteria  [][]string `json:"c"`
+		Requester string     `json:"r"`
+		Services  []string   `json:"s"`
+	}{criteria, strings.ToUpper(q.RequesterNFType), names})
+	return string(key)
+}
+
+// newCachedResult prepares the profiles matching a query for caching
+func newCachedResult(criteria [][]string, profiles []NFProfile, ttl time.Duration) *cachedResult {
+	ids := make(map[string]bool, len(profiles))
+	for _, profile := range profiles {
+		ids[profile.NFID] = true
+	}
+	return &cachedResult{
+		criteria: criteria,
+		profiles: profiles,
+		ids:      ids,
+		etag:     discoveryETag("", profiles),
+		expires:  time.Now().Add(ttl),
+	}
+}
+
+// discoveryETag is a weak entity tag of a set of discovered profiles, added
+// to the set identified by base if any. The order of the results and the
+// selection made by the limits vary between responses with the same tag.
+func discoveryETag(base string, profiles []NFProfile) string {
+	hash := sha256.New()
+	hash.Write([]byte(base))
+	json.NewEncoder(hash).Encode(profiles)
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// copyProfiles copies cached profiles so that ranking can reorder their services
+func copyProfiles(profiles []NFProfile) []NFProfile {
+	copies := make([]NFProfile, len(profiles))
+	for i, profile := range profiles {
+		copies[i] = profile
+		copies[i].NFServices = append([]NFService(nil), profile.NFServices...)
+	}
+	return copies
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStore counts the discovery queries reaching the store it wraps,
+// and may act right after each of them
+type countingStore struct {
+	*MemoryStore
+	finds     atomic.Int32
+	afterFind func()
+}
+
+func (s *countingStore) FindNFInstanceIDs(ctx context.Context, criteria [][]string) ([]string, error) {
+	s.finds.Add(1)
+	ids, err := s.MemoryStore.FindNFInstanceIDs(ctx, criteria)
+	if s.afterFind != nil {
+		s.afterFind()
+	}
+	return ids, err
+}
+
+// discoverWithETag queries the NRF with If-None-Match and returns the status
+// and the ETag of the response
+func discoverWithETag(t *testing.T, router http.Handler, query, ifNoneMatch string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nfs?"+query, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+		t.Errorf("304 response with a body: %s", rec.Body)
+	}
+	return rec.Code, rec.Header().Get("ETag")
+}
+
+// heartbeat sends a heartbeat of a registered NF
+func heartbeat(t *testing.T, router http.Handler, nfInstanceID string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/nnrf-nfm/v1/nf-instances/"+nfInstanceID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("heartbeat of %s: status %d, expected %d: %s", nfInstanceID, rec.Code, http.StatusNoContent, rec.Body)
+	}
+}
+
+// deregister deregisters a registered NF
+func deregister(t *testing.T, router http.Handler, nfInstanceID string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/nnrf-nfm/v1/nf-instances/"+nfInstanceID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deregistration of %s: status %d, expected %d: %s", nfInstanceID, rec.Code, http.StatusNoContent, rec.Body)
+	}
+}
+
+// smfProfile returns the profile of an SMF serving the internet DNN
+func smfProfile(id string) NFProfile {
+	return NFProfile{NFID: id, NFType: "SMF", Status: statusRegistered, IPAddresses: []string{"10.0.0.1"}, DNNs: []string{"internet"}}
+}
+
+// TestDiscoveryConditionalGet checks that the ETag of a discovery result
+// follows the set of matching profiles, and that If-None-Match is answered
+// with 304 while the set is unchanged
+func TestDiscoveryConditionalGet(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Discovery.ValidityPeriod = 30 * time.Second
+	router := newTestRouter(t, cfg)
+	register(t, router, smfProfile("smf-1"))
+	register(t, router, smfProfile("smf-2"))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nfs?target-nf-type=SMF", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status %d and ETag %q: %s", rec.Code, etag, rec.Body)
+	}
+	if cacheControl := rec.Header().Get("Cache-Control"); cacheControl != "max-age=30" {
+		t.Errorf("Cache-Control %q, expected max-age=30", cacheControl)
+	}
+	var result SearchResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil || result.ValidityPeriod != 30 {
+		t.Errorf("validity period %d, expected 30: %v", result.ValidityPeriod, err)
+	}
+
+	tests := []struct {
+		name        string
+		change      func()
+		query       string
+		ifNoneMatch string
+		status      int
+		sameETag    bool
+	}{
+		{"same tag", nil, "target-nf-type=SMF", etag, http.StatusNotModified, true},
+		{"strong form of the tag", nil, "target-nf-type=SMF", etag[2:], http.StatusNotModified, true},
+		{"one of several tags", nil, "target-nf-type=SMF", `"other", ` + etag, http.StatusNotModified, true},
+		{"any tag", nil, "target-nf-type=SMF", "*", http.StatusNotModified, true},
+		{"other tag", nil, "target-nf-type=SMF", `W/"other"`, http.StatusOK, true},
+		{"other limits", nil, "target-nf-type=SMF&limit=1&preferred-locality=east", etag, http.StatusNotModified, true},
+		{"query of other NFs", nil, "target-nf-type=AMF", etag, http.StatusOK, false},
+		{"heartbeat", func() { heartbeat(t, router, "smf-1") }, "target-nf-type=SMF", etag, http.StatusNotModified, true},
+		{"NF of another type registered", func() { register(t, router, testProfile()) }, "target-nf-type=SMF", etag, http.StatusNotModified, true},
+		{"matching NF registered", func() { register(t, router, smfProfile("smf-3")) }, "target-nf-type=SMF", etag, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.change != nil {
+				tt.change()
+			}
+			status, got := discoverWithETag(t, router, tt.query, tt.ifNoneMatch)
+			if status != tt.status {
+				t.Errorf("status %d, expected %d", status, tt.status)
+			}
+			if (got == etag) != tt.sameETag {
+				t.Errorf("ETag %s, expected the first one (%s): %v", got, etag, tt.sameETag)
+			}
+		})
+	}
+}
+
+// TestDiscoveryETagChanges checks that changing or deregistering a
+// discovered NF changes the ETag of the results it was in
+func TestDiscoveryETagChanges(t *testing.T) {
+	router := newTestRouter(t, DefaultConfig())
+	register(t, router, smfProfile("smf-1"))
+	register(t, router, smfProfile("smf-2"))
+	_, etag := discoverWithETag(t, router, "dnn=internet", "")
+
+	changed := smfProfile("smf-1")
+	changed.FQDN = "smf-1.example"
+	register(t, router, changed)
+	status, changedETag := discoverWithETag(t, router, "dnn=internet", etag)
+	if status != http.StatusOK || changedETag == etag {
+		t.Errorf("status %d and ETag %s after a profile change", status, changedETag)
+	}
+
+	// Leaving the DNN takes the NF out of the result
+	changed.DNNs = []string{"ims"}
+	register(t, router, changed)
+	if ids := discover(t, router, "dnn=internet"); !slices.Equal(ids, []string{"smf-2"}) {
+		t.Errorf("discovered %v, expected smf-2", ids)
+	}
+
+	deregister(t, router, "smf-2")
+	if ids := discover(t, router, "dnn=internet"); len(ids) != 0 {
+		t.Errorf("discovered %v after deregistration", ids)
+	}
+}
+
+// TestDiscoveryResultCache checks that discovery results are read from the
+// store once per validity period, unless a change of the registry may
+// affect them
+func TestDiscoveryResultCache(t *testing.T) {
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	cfg := DefaultConfig()
+	cfg.Discovery.ValidityPeriod = 200 * time.Millisecond
+	server, err := NewServer(store, cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	router := server.SetupRouter()
+	register(t, router, smfProfile("smf-1"))
+	finds := func(expected int32) {
+		t.Helper()
+		if got := store.finds.Load(); got != expected {
+			t.Errorf("%d queries of the store, expected %d", got, expected)
+		}
+	}
+
+	discover(t, router, "target-nf-type=SMF")
+	discover(t, router, "target-nf-type=smf&limit=1")
+	finds(1)
+
+	// Heartbeats, and NFs the result cannot contain, keep it
+	register(t, router, testProfile())
+	heartbeat(t, router, "smf-1")
+	discover(t, router, "target-nf-type=SMF")
+	finds(1)
+
+	// A matching NF registering drops it
+	register(t, router, smfProfile("smf-2"))
+	if ids := discover(t, router, "target-nf-type=SMF"); len(ids) != 2 {
+		t.Errorf("discovered %v, expected smf-1 and smf-2", ids)
+	}
+	finds(2)
+
+	// The result expires with its validity period
+	time.Sleep(cfg.Discovery.ValidityPeriod)
+	discover(t, router, "target-nf-type=SMF")
+	finds(3)
+}
+
+// TestDiscoveryResultCacheRace checks that a result read from the store
+// while a matching NF registers is not cached, as it may miss the NF
+func TestDiscoveryResultCacheRace(t *testing.T) {
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	server, err := NewServer(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	router := server.SetupRouter()
+	register(t, router, smfProfile("smf-1"))
+
+	raced := false
+	store.afterFind = func() {
+		if !raced {
+			raced = true
+			register(t, router, smfProfile("smf-2"))
+		}
+	}
+	if ids := discover(t, router, "target-nf-type=SMF"); len(ids) != 1 {
+		t.Fatalf("discovered %v, expected smf-1 only", ids)
+	}
+	if ids := discover(t, router, "target-nf-type=SMF"); len(ids) != 2 {
+		t.Errorf("discovered %v, expected smf-1 and smf-2", ids)
+	}
+}
+
+// TestDiscoveryCacheAcrossNRFs checks that an NRF drops the results
+// affected by registrations made through another NRF sharing its store
+func TestDiscoveryCacheAcrossNRFs(t *testing.T) {
+	store := NewMemoryStore()
+	first, err := NewServer(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	second, err := NewServer(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go second.StartCacheInvalidation(ctx)
+	router := second.SetupRouter()
+
+	// The second NRF subscribes to the events asynchronously
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		store.watchersMu.Lock()
+		subscribed := len(store.watchers) > 0
+		store.watchersMu.Unlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the second NRF never subscribed to the events")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	register(t, first.SetupRouter(), smfProfile("smf-1"))
+	if ids := discover(t, router, "target-nf-type=SMF"); len(ids) != 1 {
+		t.Fatalf("discovered %v, expected smf-1", ids)
+	}
+	register(t, first.SetupRouter(), smfProfile("smf-2"))
+	for len(discover(t, router, "target-nf-type=SMF")) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("second registration through the first NRF never discovered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
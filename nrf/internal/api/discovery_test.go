@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestRouter returns the router of an NRF on a MemoryStore
+func newTestRouter(t *testing.T, cfg Config) http.Handler {
+	t.Helper()
+	server, err := NewServer(NewMemoryStore(), cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return server.SetupRouter()
+}
+
+// register registers or replaces a profile through the NF management API
+func register(t *testing.T, router http.Handler, profile NFProfile) {
+	t.Helper()
+	body, _ := json.Marshal(profile)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/nnrf-nfm/v1/nf-instances/"+profile.NFID, strings.NewReader(string(body))))
+	if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		t.Fatalf("registering %s: status %d: %s", profile.NFID, rec.Code, rec.Body)
+	}
+}
+
+// discover queries the NRF and returns the IDs of the discovered NFs in the
+// order of the results
+func discover(t *testing.T, router http.Handler, query string) []string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nfs?"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("discovery %s: status %d, expected %d: %s", query, rec.Code, http.StatusOK, rec.Body)
+	}
+	var result SearchResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid discovery result: %v", err)
+	}
+	ids := []string{}
+	for _, profile := range result.NFInstances {
+		ids = append(ids, profile.NFID)
+	}
+	return ids
+}
+
+// discoveryProfiles returns SMFs and an AMF spread over slices, DNNs, PLMNs
+// and tracking areas
+func discoveryProfiles() []NFProfile {
+	return []NFProfile{
+		{
+			NFID: "smf-1", NFType: "SMF", Status: statusRegistered, IPAddresses: []string{"10.0.0.1"},
+			NFServices: []NFService{{ServiceInstanceID: "pdu", ServiceName: "nsmf-pdusession"}},
+			SNssais:    []map[string]string{{"sst": "1", "sd": "0A0B0C"}},
+			DNNs:       []string{"internet"},
+			PLMNID:     map[string]string{"mcc": "001", "mnc": "01"},
+			TAIs:       []TAI{{TAC: "000001"}},
+			Locality:   "east",
+		},
+		{
+			NFID: "smf-2", NFType: "smf", Status: statusRegistered, IPAddresses: []string{"10.0.0.2"},
+			ServiceURLs:    []string{"http://smf-2:8080/nsmf-pdusession/v1", "http://smf-2:8080/nsmf-event-exposure/v1"},
+			SNssais:        []map[string]string{{"sst": "01"}},
+			DNNs:           []string{"ims", "internet"},
+			PLMNID:         map[string]string{"mcc": "001", "mnc": "02"},
+			TAIs:           []TAI{{PLMNID: map[string]string{"mcc": "001", "mnc": "01"}, TAC: "00000A"}},
+			Locality:       "west",
+			AllowedNFTypes: []string{"AMF"},
+		},
+		{
+			NFID: "smf-3", NFType: "SMF", Status: statusSuspended, IPAddresses: []string{"10.0.0.3"},
+			DNNs:   []string{"internet"},
+			PLMNID: map[string]string{"mcc": "001", "mnc": "01"},
+		},
+		{
+			NFID: "amf-1", NFType: "AMF", Status: statusRegistered, IPAddresses: []string{"10.0.1.1"},
+			NFServices: []NFService{{ServiceInstanceID: "comm", ServiceName: "namf-comm"}},
+			PLMNID:     map[string]string{"mcc": "001", "mnc": "01"},
+		},
+	}
+}
+
+// TestDiscoveryQueries checks that every discovery parameter selects the
+// NFs through the secondary indexes of their profiles
+func TestDiscoveryQueries(t *testing.T) {
+	router := newTestRouter(t, DefaultConfig())
+	for _, profile := range discoveryProfiles() {
+		register(t, router, profile)
+	}
+	snssai := func(s string) string { return url.QueryEscape(s) }
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"no parameters", "", []string{"amf-1", "smf-1", "smf-2"}},
+		{"NF type", "target-nf-type=SMF", []string{"smf-1", "smf-2"}},
+		{"NF type in lower case", "target-nf-type=smf", []string{"smf-1", "smf-2"}},
+		{"legacy NF type parameter", "nf-type=AMF", []string{"amf-1"}},
+		{"service of an NFService", "service-names=namf-comm", []string{"amf-1"}},
+		{"service of a service URL", "service-names=nsmf-event-exposure", []string{"smf-2"}},
+		{"any of several services", "service-names=namf-comm,nsmf-event-exposure", []string{"amf-1", "smf-2"}},
+		{"repeated services", "service-names=namf-comm&service-names=nsmf-event-exposure", []string{"amf-1", "smf-2"}},
+		{"S-NSSAI", "snssais=" + snssai(`[{"sst": 1, "sd": "0A0B0C"}]`), []string{"smf-1"}},
+		{"S-NSSAI with SD in lower case", "snssais=" + snssai(`[{"sst": 1, "sd": "0a0b0c"}]`), []string{"smf-1"}},
+		{"S-NSSAI of another SD", "snssais=" + snssai(`[{"sst": 1, "sd": "010203"}]`), []string{}},
+		{"S-NSSAI without SD", "snssais=" + snssai(`[{"sst": "1"}]`), []string{"smf-2"}},
+		{"any of several S-NSSAIs", "snssais=" + snssai(`[{"sst": 1}, {"sst": 1, "sd": "0a0b0c"}]`), []string{"smf-1", "smf-2"}},
+		{"DNN", "dnn=ims", []string{"smf-2"}},
+		{"DNN shared by NFs", "dnn=internet", []string{"smf-1", "smf-2"}},
+		{"target PLMN", "target-plmn-list=" + url.QueryEscape(`[{"mcc": "001", "mnc": "02"}]`), []string{"smf-2"}},
+		{"any of several target PLMNs", "target-plmn-list=" + url.QueryEscape(`[{"mcc": "001", "mnc": "01"}, {"mcc": "001", "mnc": "02"}]`), []string{"amf-1", "smf-1", "smf-2"}},
+		{"TAI in the PLMN of the NF", "tai=" + url.QueryEscape(`{"plmnId": {"mcc": "001", "mnc": "01"}, "tac": "000001"}`), []string{"smf-1"}},
+		{"TAI in another PLMN", "tai=" + url.QueryEscape(`{"plmnId": {"mcc": "001", "mnc": "01"}, "tac": "00000a"}`), []string{"smf-2"}},
+		{"TAI of no NF", "tai=" + url.QueryEscape(`{"plmnId": {"mcc": "001", "mnc": "02"}, "tac": "00000a"}`), []string{}},
+		{"all parameters", "target-nf-type=SMF&service-names=nsmf-pdusession&dnn=internet&snssais=" + snssai(`[{"sst": 1, "sd": "0a0b0c"}]`), []string{"smf-1"}},
+		{"parameters matched by different NFs", "target-nf-type=AMF&dnn=internet", []string{}},
+		{"requester allowed", "target-nf-type=SMF&requester-nf-type=AMF", []string{"smf-1", "smf-2"}},
+		{"requester not allowed", "target-nf-type=SMF&requester-nf-type=NEF", []string{"smf-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := discover(t, router, tt.query)
+			slices.Sort(ids)
+			if !slices.Equal(ids, tt.expected) {
+				t.Errorf("discovered %v, expected %v", ids, tt.expected)
+			}
+		})
+	}
+}
+
+// TestDiscoveryInvalidQueries checks that malformed parameters are refused
+func TestDiscoveryInvalidQueries(t *testing.T) {
+	router := newTestRouter(t, DefaultConfig())
+	for _, query := range []string{
+		"snssais=" + url.QueryEscape(`{"sst": 1}`),
+		"target-plmn-list=001-01",
+		"tai=" + url.QueryEscape(`[{"tac": "000001"}]`),
+		"limit=0",
+		"max-payload-size=abc",
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nfs?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, expected %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// TestDiscoveryIndexMaintenance checks that the indexes follow the profiles
+// as they change and are deregistered
+func TestDiscoveryIndexMaintenance(t *testing.T) {
+	router := newTestRouter(t, DefaultConfig())
+	profile := discoveryProfiles()[0]
+	register(t, router, profile)
+	if ids := discover(t, router, "dnn=internet"); !slices.Equal(ids, []string{"smf-1"}) {
+		t.Fatalf("discovered %v before the change", ids)
+	}
+
+	// Replaced by a profile serving another DNN
+	profile.DNNs = []string{"ims"}
+	register(t, router, profile)
+	if ids := discover(t, router, "dnn=internet"); len(ids) != 0 {
+		t.Errorf("discovered %v on the DNN no longer served", ids)
+	}
+	if ids := discover(t, router, "dnn=ims"); !slices.Equal(ids, []string{"smf-1"}) {
+		t.Errorf("discovered %v on the new DNN", ids)
+	}
+
+	// Updated with a JSON Patch
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/nnrf-nfm/v1/nf-instances/smf-1", strings.NewReader(`[{"op": "replace", "path": "/locality", "value": "north"}, {"op": "add", "path": "/dnns/-", "value": "iot"}]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: status %d, expected %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if ids := discover(t, router, "dnn=iot"); !slices.Equal(ids, []string{"smf-1"}) {
+		t.Errorf("discovered %v on the patched DNN", ids)
+	}
+
+	deregister(t, router, "smf-1")
+	for _, query := range []string{"", "target-nf-type=SMF", "dnn=ims", "service-names=nsmf-pdusession"} {
+		if ids := discover(t, router, query); len(ids) != 0 {
+			t.Errorf("discovered %v with %q after deregistration", ids, query)
+		}
+	}
+}
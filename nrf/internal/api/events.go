@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Registry events that have no NFStatusNotify counterpart
+const (
+	NFHeartbeat = "NF_HEARTBEAT"
+	NFSuspended = "NF_SUSPENDED"
+)
+
+// eventBufferSize is the number of events a subscriber may fall behind by
+// before it misses events
+const eventBufferSize = 256
+
+// watchKeepAlive is how often an idle watch stream receives a comment, so
+// that proxies do not close it
+const watchKeepAlive = 15 * time.Second
+
+// RegistryEvent is a change in the NF registry, as streamed to watchers
+type RegistryEvent struct {
+	Event        string     `json:"event"`
+	NFInstanceID string     `json:"nfInstanceId"`
+	NFType       string     `json:"nfType"`
+	Status       string     `json:"status"`
+	Timestamp    time.Time  `json:"timestamp"`
+	NFProfile    *NFProfile `json:"nfProfile,omitempty"`
+}
+
+// publishEvent tells the watchers of every NRF process about a change in
+// the registry. As with notifications, the event is published even if ctx
+// is cancelled.
+func (s *Server) publishEvent(ctx context.Context, event string, profile NFProfile) {
+	err := s.store.PublishEvent(context.WithoutCancel(ctx), RegistryEvent{
+		Event:        event,
+		NFInstanceID: profile.NFID,
+		NFType:       profile.NFType,
+		Status:       profile.Status,
+		Timestamp:    time.Now().UTC(),
+		NFProfile:    &profile,
+	})
+	if err != nil {
+		log.Printf("Failed to publish %s event for %s: %v", event, profile.NFID, err)
+	}
+}
+
+// WatchEvents streams the registry events as Server-Sent Events until the
+// client disconnects. The nf-type parameter restricts the stream to some NF
+// types.
+func (s *Server) WatchEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	nfTypes := make(map[string]bool)
+	for _, nfType := range listValues(r.URL.Query(), "nf-type") {
+		nfTypes[strings.ToUpper(nfType)] = true
+	}
+
+	events, err := s.store.SubscribeEvents(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to subscribe to registry events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": watching NF registry\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if len(nfTypes) > 0 && !nfTypes[event.NFType] {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// StartCacheInvalidation drops the cached discovery results affected by the
+// registry changes made through other NRF processes. It blocks until runCtx
+// is done.
+func (s *Server) StartCacheInvalidation(runCtx context.Context) {
+	events, err := s.store.SubscribeEvents(runCtx)
+	if err != nil {
+		log.Printf("Failed to subscribe to registry events, discovery results of other NRFs are cached until they expire: %v", err)
+		return
+	}
+	for event := range events {
+		if event.Event != NFHeartbeat && event.NFProfile != nil {
+			s.results.invalidate(*event.NFProfile)
+		}
+	}
+}
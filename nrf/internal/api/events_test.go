@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// watchStream reads the events of a watch stream
+type watchStream struct {
+	events chan RegistryEvent
+	cancel context.CancelFunc
+}
+
+// watch opens a watch stream. The NRF is subscribed to the registry events
+// when it returns.
+func watch(t *testing.T, nrfURL, query string) *watchStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, nrfURL+"/nrf-admin/v1/events?"+query, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatalf("watch: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		cancel()
+		t.Fatalf("watch returned %s with %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	stream := &watchStream{events: make(chan RegistryEvent, eventBufferSize), cancel: cancel}
+	t.Cleanup(func() {
+		cancel()
+		resp.Body.Close()
+	})
+	go func() {
+		defer close(stream.events)
+		scanner := bufio.NewScanner(resp.Body)
+		var name string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				var event RegistryEvent
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil || event.Event != name {
+					t.Errorf("invalid event %q of type %q: %v", line, name, err)
+					continue
+				}
+				stream.events <- event
+			}
+		}
+	}()
+	return stream
+}
+
+// next returns the next event of the stream
+func (s *watchStream) next(t *testing.T) RegistryEvent {
+	t.Helper()
+	select {
+	case event, ok := <-s.events:
+		if !ok {
+			t.Fatalf("watch stream closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for an event")
+	}
+	return RegistryEvent{}
+}
+
+// TestWatchEvents checks that registrations, heartbeats, profile changes
+// and deregistrations are streamed to the watchers
+func TestWatchEvents(t *testing.T) {
+	nrf := httptest.NewServer(newTestRouter(t, DefaultConfig()))
+	t.Cleanup(nrf.Close)
+	stream := watch(t, nrf.URL, "")
+
+	smf := smfProfile("smf-1")
+	register(t, nrf.Config.Handler, smf)
+	heartbeat(t, nrf.Config.Handler, "smf-1")
+	smf.FQDN = "smf-1.example"
+	register(t, nrf.Config.Handler, smf)
+	req := httptest.NewRequest(http.MethodPatch, "/nnrf-nfm/v1/nf-instances/smf-1", strings.NewReader(`[{"op": "add", "path": "/locality", "value": "east"}]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	rec := httptest.NewRecorder()
+	nrf.Config.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: status %d, expected %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	deregister(t, nrf.Config.Handler, "smf-1")
+
+	expected := []struct {
+		event    string
+		fqdn     string
+		locality string
+	}{
+		{NFRegistered, "", ""},
+		{NFHeartbeat, "", ""},
+		{NFProfileChanged, "smf-1.example", ""},
+		{NFHeartbeat, "smf-1.example", "east"},
+		{NFProfileChanged, "smf-1.example", "east"},
+		{NFDeregistered, "smf-1.example", "east"},
+	}
+	for _, want := range expected {
+		event := stream.next(t)
+		if event.Event != want.event || event.NFInstanceID != "smf-1" || event.NFType != "SMF" || event.Status != statusRegistered || event.Timestamp.IsZero() {
+			t.Fatalf("received %+v, expected %s of smf-1", event, want.event)
+		}
+		if event.NFProfile == nil || event.NFProfile.FQDN != want.fqdn || event.NFProfile.Locality != want.locality {
+			t.Errorf("%s carries profile %+v, expected FQDN %q and locality %q", event.Event, event.NFProfile, want.fqdn, want.locality)
+		}
+	}
+}
+
+// TestWatchEventsByNFType checks that a watch stream restricted to some NF
+// types only receives their events
+func TestWatchEventsByNFType(t *testing.T) {
+	nrf := httptest.NewServer(newTestRouter(t, DefaultConfig()))
+	t.Cleanup(nrf.Close)
+	amfs := watch(t, nrf.URL, "nf-type=amf")
+	all := watch(t, nrf.URL, "nf-type=AMF,SMF")
+
+	register(t, nrf.Config.Handler, smfProfile("smf-1"))
+	register(t, nrf.Config.Handler, testProfile())
+
+	if event := amfs.next(t); event.NFInstanceID != "amf-1" || event.Event != NFRegistered {
+		t.Errorf("AMF watcher received %+v, expected the registration of amf-1", event)
+	}
+	for _, id := range []string{"smf-1", "amf-1"} {
+		if event := all.next(t); event.NFInstanceID != id {
+			t.Errorf("received %s, expected an event of %s", event.NFInstanceID, id)
+		}
+	}
+}
+
+// TestWatchEventsOfReaper checks that the NFs suspended and removed for
+// missing heartbeats are streamed
+func TestWatchEventsOfReaper(t *testing.T) {
+	store := NewMemoryStore()
+	server, err := NewServer(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	nrf := httptest.NewServer(server.SetupRouter())
+	t.Cleanup(nrf.Close)
+	stream := watch(t, nrf.URL, "")
+
+	profile := testProfile()
+	register(t, nrf.Config.Handler, profile)
+	if event := stream.next(t); event.Event != NFRegistered {
+		t.Fatalf("received %s, expected %s", event.Event, NFRegistered)
+	}
+
+	ctx := context.Background()
+	expiry := time.Now().Add(time.Duration(profile.HeartbeatTimer)*time.Second + server.config.Reaper.Grace)
+	server.reapExpiredHeartbeats(ctx, expiry.Add(time.Second))
+	if event := stream.next(t); event.Event != NFSuspended || event.Status != statusSuspended {
+		t.Errorf("received %s of an NF %s, expected %s", event.Event, event.Status, NFSuspended)
+	}
+	server.reapExpiredHeartbeats(ctx, expiry.Add(time.Second+server.config.Reaper.DeregisterAfter+time.Second))
+	if event := stream.next(t); event.Event != NFDeregistered {
+		t.Errorf("received %s, expected %s", event.Event, NFDeregistered)
+	}
+}
+
+// TestWatchDisconnection checks that the NRF stops publishing to a watcher
+// once it disconnects
+func TestWatchDisconnection(t *testing.T) {
+	store := NewMemoryStore()
+	server, err := NewServer(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	nrf := httptest.NewServer(server.SetupRouter())
+	t.Cleanup(nrf.Close)
+	watchers := func() int {
+		store.watchersMu.Lock()
+		defer store.watchersMu.Unlock()
+		return len(store.watchers)
+	}
+
+	stream := watch(t, nrf.URL, "")
+	if n := watchers(); n != 1 {
+		t.Fatalf("%d watchers, expected 1", n)
+	}
+	stream.cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for watchers() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("watcher still subscribed after disconnecting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
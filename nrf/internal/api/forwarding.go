@@ -0,0 +1,318 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// viaHeader records the NRFs a request was forwarded by, so that peers
+// configured in a loop do not forward it back and forth
+const viaHeader = "Via"
+
+// ForwardingConfig controls how requests the NRF cannot serve alone are
+// forwarded to peer or parent NRFs
+type ForwardingConfig struct {
+	Peers          []string      // apiRoots of the peer or parent NRFs, in order of preference
+	LocalPLMNs     []PLMNQuery   // PLMNs served by this NRF; discovery of other PLMNs is forwarded
+	RequestTimeout time.Duration // Timeout of a single forwarded request
+	CacheTTL       time.Duration // How long the results of a forwarded discovery are reused
+	MaxHops        int           // Number of NRFs a request may traverse
+}
+
+// DefaultForwardingConfig returns the forwarding settings used when none are
+// configured; without peers nothing is forwarded
+func DefaultForwardingConfig() ForwardingConfig {
+	return ForwardingConfig{
+		RequestTimeout: 3 * time.Second,
+		CacheTTL:       30 * time.Second,
+		MaxHops:        3,
+	}
+}
+
+// peerResultCache keeps the results of forwarded discoveries by query
+type peerResultCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedPeerResult
+}
+
+type cachedPeerResult struct {
+	profiles []NFProfile
+	expires  time.Time
+}
+
+func newPeerResultCache() *peerResultCache {
+	return &peerResultCache{entries: make(map[string]cachedPeerResult)}
+}
+
+// get returns the cached results of a query, if they have not expired
+func (c *peerResultCache) get(key string, now time.Time) ([]NFProfile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		return nil, false
+	}
+	return entry.profiles, true
+}
+
+// put caches the results of a query, dropping the entries that have expired
+func (c *peerResultCache) put(key string, profiles []NFProfile, now time.Time, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedPeerResult{profiles: profiles, expires: now.Add(ttl)}
+}
+
+// viaHops returns the NRFs listed in the Via header of a request
+func viaHops(r *http.Request) []string {
+	var hops []string
+	for _, header := range r.Header.Values(viaHeader) {
+		for _, hop := range strings.Split(header, ",") {
+			// Each hop is "<protocol> <received-by>"
+			if fields := strings.Fields(hop); len(fields) >= 2 {
+				hops = append(hops, fields[1])
+			}
+		}
+	}
+	return hops
+}
+
+// canForward reports whether a request may be forwarded to the peers: there
+// are peers, the request has not already been through this NRF, and it has
+// not traversed too many NRFs
+func (s *Server) canForward(r *http.Request) bool {
+	cfg := s.config.Forwarding
+	if len(cfg.Peers) == 0 {
+		return false
+	}
+	hops := viaHops(r)
+	if len(hops) >= cfg.MaxHops {
+		return false
+	}
+	for _, hop := range hops {
+		if hop == s.config.InstanceID {
+			return false
+		}
+	}
+	return true
+}
+
+// newForwardedRequest builds a request to a peer NRF on behalf of r
+func (s *Server) newForwardedRequest(ctx context.Context, r *http.Request, method, target string, body []byte, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for _, via := range r.Header.Values(viaHeader) {
+		req.Header.Add(viaHeader, via)
+	}
+	req.Header.Add(viaHeader, "1.1 "+s.config.InstanceID)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// targetsForeignPLMN reports whether the query asks for NFs of a PLMN this
+// NRF does not serve
+func (q *DiscoveryQuery) targetsForeignPLMN(localPLMNs []PLMNQuery) bool {
+	if len(localPLMNs) == 0 {
+		return false
+	}
+	for _, target := range q.TargetPLMNs {
+		local := false
+		for _, plmn := range localPLMNs {
+			if plmn == target {
+				local = true
+				break
+			}
+		}
+		if !local {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardDiscovery asks the peer NRFs for the NFs matching the discovery
+// request and merges their answers in order of preference. Answers are
+// cached for CacheTTL, or less if a peer gives a shorter validity period;
+// nothing is cached when no peer answered.
+func (s *Server) forwardDiscovery(ctx context.Context, r *http.Request) []NFProfile {
+	key := r.URL.Query().Encode()
+	if profiles, ok := s.forwardCache.get(key, time.Now()); ok {
+		return profiles
+	}
+
+	peers := s.config.Forwarding.Peers
+	answers := make([]*SearchResult, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			result, err := s.discoverAtPeer(ctx, r, peer, key)
+			if err != nil {
+				log.Printf("Discovery forwarded to %s failed: %v", peer, err)
+				return
+			}
+			answers[i] = result
+		}(i, peer)
+	}
+	wg.Wait()
+
+	var merged []NFProfile
+	ttl := s.config.Forwarding.CacheTTL
+	answered := false
+	for _, answer := range answers {
+		if answer == nil {
+			continue
+		}
+		answered = true
+		merged = mergeProfiles(merged, answer.NFInstances)
+		if validity := time.Duration(answer.ValidityPeriod) * time.Second; validity < ttl {
+			ttl = validity
+		}
+	}
+	if answered && ttl > 0 {
+		s.forwardCache.put(key, merged, time.Now(), ttl)
+	}
+	return merged
+}
+
+// discoverAtPeer sends a discovery request to a peer NRF
+func (s *Server) discoverAtPeer(ctx context.Context, r *http.Request, peer, rawQuery string) (*SearchResult, error) {
+	target := strings.TrimSuffix(peer, "/") + "/nnrf-disc/v1/nfs?" + rawQuery
+	req, err := s.newForwardedRequest(ctx, r, http.MethodGet, target, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.peerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	var result SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid discovery result: %w", err)
+	}
+	return &result, nil
+}
+
+// mergeProfiles appends the profiles not already in results, keeping their order
+func mergeProfiles(results, profiles []NFProfile) []NFProfile {
+	seen := make(map[string]bool, len(results))
+	for _, profile := range results {
+		seen[profile.NFID] = true
+	}
+	for _, profile := range profiles {
+		if !seen[profile.NFID] {
+			seen[profile.NFID] = true
+			results = append(results, profile)
+		}
+	}
+	return results
+}
+
+// shouldForwardSubscription reports whether a subscription also concerns NFs
+// registered at the peers. Only a subscription to an NF instance registered
+// here is kept local.
+func (s *Server) shouldForwardSubscription(r *http.Request, subscription SubscriptionData) bool {
+	if !s.canForward(r) {
+		return false
+	}
+	if cond := subscription.SubscrCond; cond != nil && cond.NFInstanceID != "" {
+		if _, err := s.store.GetProfile(r.Context(), cond.NFInstanceID); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// forwardSubscription creates the subscription at every peer NRF, which
+// notify the subscriber directly. It returns the URIs of the subscriptions
+// created; peers that fail are skipped.
+func (s *Server) forwardSubscription(ctx context.Context, r *http.Request, subscription SubscriptionData) []string {
+	subscription.SubscriptionID = ""
+	subscription.PeerSubscriptions = nil
+	body, err := json.Marshal(subscription)
+	if err != nil {
+		log.Printf("Failed to encode forwarded subscription: %v", err)
+		return nil
+	}
+
+	var created []string
+	for _, peer := range s.config.Forwarding.Peers {
+		uri, err := s.subscribeAtPeer(ctx, r, peer, body)
+		if err != nil {
+			log.Printf("Subscription forwarded to %s failed: %v", peer, err)
+			continue
+		}
+		created = append(created, uri)
+	}
+	return created
+}
+
+// subscribeAtPeer creates a subscription at a peer NRF and returns its URI
+func (s *Server) subscribeAtPeer(ctx context.Context, r *http.Request, peer string, body []byte) (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(peer, "/") + "/nnrf-nfm/v1/subscriptions")
+	if err != nil {
+		return "", err
+	}
+	req, err := s.newForwardedRequest(ctx, r, http.MethodPost, base.String(), body, "application/json")
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.peerClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("peer returned %s", resp.Status)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || location.Path == "" {
+		return "", fmt.Errorf("peer returned no subscription URI")
+	}
+	return base.ResolveReference(location).String(), nil
+}
+
+// updatePeerSubscriptions sends a request about a subscription to the peers
+// it was forwarded to. Failures are logged: the peer subscriptions expire
+// with their validityTime anyway.
+func (s *Server) updatePeerSubscriptions(ctx context.Context, r *http.Request, subscription SubscriptionData, method string, body []byte, contentType string) {
+	for _, uri := range subscription.PeerSubscriptions {
+		req, err := s.newForwardedRequest(ctx, r, method, uri, body, contentType)
+		if err != nil {
+			log.Printf("Failed to forward %s of subscription %s to %s: %v", method, subscription.SubscriptionID, uri, err)
+			continue
+		}
+		resp, err := s.peerClient.Do(req)
+		if err != nil {
+			log.Printf("Failed to forward %s of subscription %s to %s: %v", method, subscription.SubscriptionID, uri, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			log.Printf("Peer returned %s to %s of subscription %s at %s", resp.Status, method, subscription.SubscriptionID, uri)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// testNRF is an NRF served over HTTP that counts the discovery requests it
+// receives
+type testNRF struct {
+	*httptest.Server
+	store       *MemoryStore
+	discoveries atomic.Int32
+}
+
+// startNRFs starts NRFs whose peers are given by their indexes, and whose
+// configuration may be adjusted by configure
+func startNRFs(t *testing.T, peers [][]int, configure func(i int, cfg *Config)) []*testNRF {
+	t.Helper()
+	nrfs := make([]*testNRF, len(peers))
+	routers := make([]http.Handler, len(peers))
+	for i := range nrfs {
+		nrf := &testNRF{store: NewMemoryStore()}
+		i := i
+		nrf.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/nnrf-disc/v1/nfs" {
+				nrf.discoveries.Add(1)
+			}
+			routers[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(nrf.Close)
+		nrfs[i] = nrf
+	}
+	for i, nrf := range nrfs {
+		cfg := DefaultConfig()
+		for _, peer := range peers[i] {
+			cfg.Forwarding.Peers = append(cfg.Forwarding.Peers, nrfs[peer].URL)
+		}
+		if configure != nil {
+			configure(i, &cfg)
+		}
+		server, err := NewServer(nrf.store, cfg)
+		if err != nil {
+			t.Fatalf("NewServer: %v", err)
+		}
+		routers[i] = server.SetupRouter()
+	}
+	return nrfs
+}
+
+// discoverSMFs asks an NRF for the SMFs and returns their IDs
+func discoverSMFs(t *testing.T, nrf *testNRF) []string {
+	t.Helper()
+	resp, err := http.Get(nrf.URL + "/nnrf-disc/v1/nfs?target-nf-type=SMF")
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("discovery returned %s", resp.Status)
+	}
+	var result SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid discovery result: %v", err)
+	}
+	var ids []string
+	for _, profile := range result.NFInstances {
+		ids = append(ids, profile.NFID)
+	}
+	return ids
+}
+
+// TestForwardedDiscovery checks that discoveries travel along chains and
+// loops of peer NRFs, each going through an NRF once
+func TestForwardedDiscovery(t *testing.T) {
+	tests := []struct {
+		name         string
+		peers        [][]int
+		instanceIDs  []string // configured instance IDs, generated when empty
+		registeredAt int
+		found        bool
+		discoveries  []int32 // discovery requests received by each NRF
+	}{
+		{"chain", [][]int{{1}, {2}, {}}, nil, 2, true, []int32{1, 1, 1}},
+		{"chain of configured NRFs", [][]int{{1}, {2}, {}}, []string{"nrf-a", "nrf-b", "nrf-c"}, 2, true, []int32{1, 1, 1}},
+		{"loop of two", [][]int{{1}, {0}}, nil, -1, false, []int32{2, 1}},
+		{"loop of three", [][]int{{1}, {2}, {0}}, nil, -1, false, []int32{2, 1, 1}},
+		{"loop found at its end", [][]int{{1}, {2}, {0}}, nil, 2, true, []int32{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrfs := startNRFs(t, tt.peers, func(i int, cfg *Config) {
+				// Loops are only cut by the instance IDs
+				cfg.Forwarding.MaxHops = 10
+				if tt.instanceIDs != nil {
+					cfg.InstanceID = tt.instanceIDs[i]
+				}
+			})
+			if tt.registeredAt >= 0 {
+				smf := NFProfile{NFID: "smf-1", NFInstanceID: "smf-1", NFType: "SMF", Status: statusRegistered, IPAddresses: []string{"10.0.0.1"}}
+				if err := nrfs[tt.registeredAt].store.PutProfile(context.Background(), smf, nil); err != nil {
+					t.Fatalf("PutProfile: %v", err)
+				}
+			}
+
+			ids := discoverSMFs(t, nrfs[0])
+			if found := len(ids) == 1 && ids[0] == "smf-1"; found != tt.found {
+				t.Errorf("discovered %v, expected smf-1 found: %v", ids, tt.found)
+			}
+			for i, nrf := range nrfs {
+				if got := nrf.discoveries.Load(); got != tt.discoveries[i] {
+					t.Errorf("NRF %d received %d discoveries, expected %d", i, got, tt.discoveries[i])
+				}
+			}
+		})
+	}
+}
+
+// TestGeneratedInstanceIDs checks that NRFs started without an instance ID
+// each get their own
+func TestGeneratedInstanceIDs(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		server, err := NewServer(NewMemoryStore(), DefaultConfig())
+		if err != nil {
+			t.Fatalf("NewServer: %v", err)
+		}
+		if id := server.config.InstanceID; id == "" || seen[id] {
+			t.Fatalf("instance ID %q, expected a new one", id)
+		}
+		seen[server.config.InstanceID] = true
+	}
+}
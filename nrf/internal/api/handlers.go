@@ -1,20 +1,16 @@
 package api
 
 import (
-	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time" // Import the time package for date and time operations
 
-	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
 )
 
-var ctx = context.Background()
-var redisClient *redis.Client
-
 // NFProfile represents a Network Function profile
 type NFProfile struct {
 	NFID              string            `json:"nf_id"`
@@ -24,27 +20,29 @@ type NFProfile struct {
 	FQDN              string            `json:"fqdn"`
 	IPAddresses       []string          `json:"ip_addresses"`
 	ServiceURLs       []string          `json:"service_urls"`
+	NFServices        []NFService       `json:"nf_services,omitempty"`
 	HeartbeatTimer    int               `json:"heartbeat_timer"`
+	Priority          *int              `json:"priority,omitempty"`
+	Capacity          *int              `json:"capacity,omitempty"`
+	Load              *int              `json:"load,omitempty"`
 	PLMNID            map[string]string `json:"plmn_id"`
 	SNssais           []map[string]string `json:"snssais"`
+	DNNs              []string          `json:"dnns,omitempty"`
+	TAIs              []TAI             `json:"tais,omitempty"`
+	Locality          string            `json:"locality,omitempty"`
+	AllowedNFTypes    []string          `json:"allowed_nf_types,omitempty"`
 	AdditionalInfo    map[string]string `json:"additional_info"`
 	Subscriptions     []string          `json:"subscriptions"`
 }
 
-// Initialize Redis connection
-func init() {
-	log.Println("Initializing Redis client...")
-	redisClient = redis.NewClient(&redis.Options{
-		Addr: "redis-service:6379",
-	})
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
-	}
-	log.Println("Redis client initialized successfully.")
+// TAI represents a tracking area served by an NF
+type TAI struct {
+	PLMNID map[string]string `json:"plmn_id,omitempty"`
+	TAC    string            `json:"tac"`
 }
 
 // RegisterNF handles NF registration or replacement
-func RegisterNF(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RegisterNF(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	nfInstanceID := vars["nfInstanceID"]
 
@@ -58,172 +56,240 @@ func RegisterNF(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Mismatch between URL and profile NFID", http.StatusBadRequest)
 		return
 	}
-
-	data, err := json.Marshal(profile)
-	if err != nil {
-		http.Error(w, "Failed to process profile", http.StatusInternalServerError)
+	if err := validateProfile(&profile); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	// The NRF decides on the heartbeat timer when the NF does not propose one
+	if profile.HeartbeatTimer == 0 {
+		profile.HeartbeatTimer = defaultHeartbeatTimer
+	}
 
-	if err := redisClient.Set(ctx, nfInstanceID, data, 0).Err(); err != nil {
+	_, previous, err := s.updateProfile(r.Context(), nfInstanceID, func(current *NFProfile) (*NFProfile, error) {
+		if err := checkIfMatch(r, current); err != nil {
+			return nil, err
+		}
+		return &profile, nil
+	})
+	if errors.Is(err, errPreconditionFailed) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to save profile", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("NF registered successfully"))
-}
-
-// DiscoverNFs retrieves NFs based on filters
-func DiscoverNFs(w http.ResponseWriter, r *http.Request) {
-	nfType := r.URL.Query().Get("nf_type")
-	iter := redisClient.Scan(ctx, 0, "*", 0).Iterator()
-
-	var results []NFProfile
-	for iter.Next(ctx) {
-		val, err := redisClient.Get(ctx, iter.Val()).Result()
-		if err != nil {
-			continue
-		}
+	if previous == nil {
+		s.notifyNFStatus(r.Context(), NFRegistered, profile)
+		s.publishEvent(r.Context(), NFRegistered, profile)
+	} else {
+		s.notifyNFStatus(r.Context(), NFProfileChanged, profile)
+		s.publishEvent(r.Context(), NFProfileChanged, profile)
+	}
 
-		var profile NFProfile
-		if err := json.Unmarshal([]byte(val), &profile); err == nil {
-			if nfType == "" || profile.NFType == nfType {
-				results = append(results, profile)
-			}
-		}
+	if err := s.scheduleHeartbeatExpiry(r.Context(), profile); err != nil {
+		log.Printf("Failed to schedule heartbeat expiry for %s: %v", nfInstanceID, err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	w.Header().Set("ETag", profileETag(profile))
+	if previous == nil {
+		w.Header().Set("Location", nfInstancePath(nfInstanceID))
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(profile)
 }
 
-// DeregisterNF removes an NF profile
-func DeregisterNF(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	nfID := vars["nf_id"]
+// GetNFInstance returns a registered NF profile
+func (s *Server) GetNFInstance(w http.ResponseWriter, r *http.Request) {
+	nfInstanceID := mux.Vars(r)["nfInstanceID"]
 
-	if err := redisClient.Del(ctx, nfID).Err(); err != nil {
-		http.Error(w, "Failed to deregister NF", http.StatusInternalServerError)
+	profile, err := s.store.GetProfile(r.Context(), nfInstanceID)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "NF not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("NF deregistered successfully"))
-}
-
-// NFHeartBeat updates the heartbeat of an NF
-func NFHeartBeat(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    nfInstanceID := vars["nfInstanceID"]
-
-    existingProfileJSON, err := redisClient.Get(ctx, nfInstanceID).Result()
-    if err != nil {
-        http.Error(w, "NF not found", http.StatusNotFound)
-        return
-    }
-
-    var profile NFProfile
-    if err := json.Unmarshal([]byte(existingProfileJSON), &profile); err != nil {
-        http.Error(w, "Failed to process profile", http.StatusInternalServerError)
-        return
-    }
-
-    // Initialize AdditionalInfo if it is nil
-    if profile.AdditionalInfo == nil {
-        profile.AdditionalInfo = make(map[string]string)
-    }
-
-    // Use server-side timestamp for the heartbeat
-    serverTime := time.Now().UTC().Format(time.RFC3339)
-    profile.AdditionalInfo["last_heartbeat"] = serverTime
-
-    data, err := json.Marshal(profile)
-    if err != nil {
-        http.Error(w, "Failed to update profile", http.StatusInternalServerError)
-        return
-    }
-
-    if err := redisClient.Set(ctx, nfInstanceID, data, 0).Err(); err != nil {
-        http.Error(w, "Failed to save profile", http.StatusInternalServerError)
-        return
-    }
-
-    w.WriteHeader(http.StatusNoContent)
+	etag := profileETag(*profile)
+	w.Header().Set("ETag", etag)
+	if matchesIfNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
 }
 
-
-// CreateSubscription adds a new subscription
-func CreateSubscription(w http.ResponseWriter, r *http.Request) {
-	var subscription map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+// ListNFInstances returns the URIs of the registered NF instances, optionally
+// of one NF type, one page at a time (TS 29.510 UriList)
+func (s *Server) ListNFInstances(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	limit, err := positiveParam(values, "limit", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	subscriptionID := subscription["subscriptionId"].(string)
-	data, err := json.Marshal(subscription)
+	pageNumber, err := positiveParam(values, "page-number", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pageSize, err := positiveParam(values, "page-size", defaultPageSize)
 	if err != nil {
-		http.Error(w, "Failed to process subscription", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := redisClient.Set(ctx, subscriptionID, data, 0).Err(); err != nil {
-		http.Error(w, "Failed to save subscription", http.StatusInternalServerError)
+	index := indexAll
+	if nfType := values.Get("nf-type"); nfType != "" {
+		index = nfTypeIndex(nfType)
+	}
+	ids, err := s.store.FindNFInstanceIDs(r.Context(), [][]string{{index}})
+	if err != nil {
+		http.Error(w, "Failed to list NF instances", http.StatusInternalServerError)
 		return
 	}
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
 
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("Subscription created successfully"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newURIList(r.URL, ids, pageNumber, pageSize))
 }
 
-// NotifySubscribers sends notifications to subscribers
-func NotifySubscribers(w http.ResponseWriter, r *http.Request) {
-	var notification map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+// DiscoverNFs retrieves NFs based on filters
+func (s *Server) DiscoverNFs(w http.ResponseWriter, r *http.Request) {
+	query, err := parseDiscoveryQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	iter := redisClient.Scan(ctx, 0, "subscription:*", 0).Iterator()
-	for iter.Next(ctx) {
-		subscriptionJSON, err := redisClient.Get(ctx, iter.Val()).Result()
-		if err != nil {
-			continue
-		}
+	results, etag, err := s.discoverProfiles(r.Context(), query)
+	if err != nil {
+		http.Error(w, "Failed to discover NFs", http.StatusInternalServerError)
+		return
+	}
 
-		var subscription map[string]interface{}
-		if err := json.Unmarshal([]byte(subscriptionJSON), &subscription); err == nil {
-			notificationURL := subscription["notificationUri"].(string)
-			go sendNotification(notificationURL, notification)
+	// NFs not registered here may be known to a peer or parent NRF
+	if s.canForward(r) && (len(results) == 0 || query.targetsForeignPLMN(s.config.Forwarding.LocalPLMNs)) {
+		if remote := s.forwardDiscovery(r.Context(), r); len(remote) > 0 {
+			results = limitResults(mergeProfiles(results, remote), query.Limit, query.MaxPayloadSize)
+			etag = discoveryETag(etag, remote)
 		}
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Notifications sent"))
+	validity := int(s.config.Discovery.ValidityPeriod / time.Second)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", validity))
+	if matchesIfNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResult{ValidityPeriod: validity, NFInstances: results})
 }
 
-func sendNotification(notificationURL string, notification map[string]interface{}) {
-	data, _ := json.Marshal(notification)
-	http.Post(notificationURL, "application/json", bytes.NewBuffer(data))
+// DeregisterNF removes an NF profile
+func (s *Server) DeregisterNF(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	nfID := vars["nf_id"]
+
+	profile, err := s.store.GetProfile(r.Context(), nfID)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "NF not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.store.DeleteProfile(r.Context(), *profile); err != nil {
+		http.Error(w, "Failed to deregister NF", http.StatusInternalServerError)
+		return
+	}
+	s.notifyNFStatus(r.Context(), NFDeregistered, *profile)
+	s.publishEvent(r.Context(), NFDeregistered, *profile)
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// SetupRouter initializes the router and routes
-func SetupRouter() *mux.Router {
-	router := mux.NewRouter()
+// NFHeartBeat handles PATCH on an NF profile. A request without a body is a
+// plain heartbeat; otherwise the body is a JSON Patch (RFC 6902) applied to
+// the stored profile. Either way the heartbeat timer of the NF restarts.
+func (s *Server) NFHeartBeat(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	nfInstanceID := vars["nfInstanceID"]
 
-	// NF Management
-	router.HandleFunc("/nnrf-nfm/v1/nf-instances/{nfInstanceID}", RegisterNF).Methods("PUT")
-	router.HandleFunc("/nnrf-nfm/v1/nf-instances/{nfInstanceID}", NFHeartBeat).Methods("PATCH")
-	router.HandleFunc("/nnrf-nfm/v1/nf-instances/{nf_id}", DeregisterNF).Methods("DELETE")
+	patch, status, err := readJSONPatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
 
-	// NF Discovery
-	router.HandleFunc("/nnrf-disc/v1/nfs", DiscoverNFs).Methods("GET")
+	resumed := false
+	updated, _, err := s.updateProfile(r.Context(), nfInstanceID, func(current *NFProfile) (*NFProfile, error) {
+		if current == nil {
+			return nil, ErrNotFound
+		}
+		if err := checkIfMatch(r, current); err != nil {
+			return nil, err
+		}
 
-	// Subscription Management
-	router.HandleFunc("/nnrf-sub/v1/subscriptions", CreateSubscription).Methods("POST")
-	router.HandleFunc("/nnrf-notify/v1/notifications", NotifySubscribers).Methods("POST")
+		profile := *current
+		if len(patch) > 0 {
+			patched, err := patchProfile(profile, patch)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+			}
+			profile = *patched
+		}
 
-	return router
-}
+		// Use server-side timestamp for the heartbeat
+		info := make(map[string]string, len(profile.AdditionalInfo)+1)
+		for k, v := range profile.AdditionalInfo {
+			info[k] = v
+		}
+		info["last_heartbeat"] = time.Now().UTC().Format(time.RFC3339)
+		profile.AdditionalInfo = info
 
+		// A heartbeat from a suspended NF brings it back into service
+		resumed = resumeIfSuspended(&profile)
+		return &profile, nil
+	})
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "NF not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errPreconditionFailed):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	case errors.Is(err, errInvalidPatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to save profile", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.scheduleHeartbeatExpiry(r.Context(), *updated); err != nil {
+		log.Printf("Failed to schedule heartbeat expiry for %s: %v", nfInstanceID, err)
+	}
+	s.publishEvent(r.Context(), NFHeartbeat, *updated)
+	if resumed || len(patch) > 0 {
+		s.notifyNFStatus(r.Context(), NFProfileChanged, *updated)
+		s.publishEvent(r.Context(), NFProfileChanged, *updated)
+	}
+
+	w.Header().Set("ETag", profileETag(*updated))
+	if len(patch) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
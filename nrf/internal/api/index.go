@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Secondary indexes used by discovery. Every index is a set of NF instance
+// IDs, named after the profile attribute it covers; a Store decides how the
+// sets are kept (the Redis store prefixes the names with "nrf:idx:").
+const indexAll = "all"
+
+func nfTypeIndex(nfType string) string {
+	return "nf-type:" + strings.ToUpper(nfType)
+}
+
+func serviceIndex(serviceName string) string {
+	return "service:" + serviceName
+}
+
+func snssaiIndex(sst, sd string) string {
+	return "snssai:" + normalizeSST(sst) + ":" + strings.ToLower(sd)
+}
+
+func dnnIndex(dnn string) string {
+	return "dnn:" + dnn
+}
+
+func plmnIndex(mcc, mnc string) string {
+	return "plmn:" + mcc + "-" + mnc
+}
+
+func taiIndex(mcc, mnc, tac string) string {
+	return "tai:" + mcc + "-" + mnc + ":" + strings.ToLower(tac)
+}
+
+func localityIndex(locality string) string {
+	return "locality:" + locality
+}
+
+// normalizeSST renders an SST so that "1", "01" and 1 share one index entry
+func normalizeSST(sst string) string {
+	if n, err := strconv.Atoi(sst); err == nil {
+		return strconv.Itoa(n)
+	}
+	return sst
+}
+
+// profileIndexes lists every secondary index the profile belongs to
+func profileIndexes(profile NFProfile) []string {
+	indexes := []string{indexAll, nfTypeIndex(profile.NFType)}
+
+	for _, name := range serviceNames(profile) {
+		indexes = append(indexes, serviceIndex(name))
+	}
+	for _, snssai := range profile.SNssais {
+		indexes = append(indexes, snssaiIndex(snssai["sst"], snssai["sd"]))
+	}
+	for _, dnn := range profile.DNNs {
+		indexes = append(indexes, dnnIndex(dnn))
+	}
+	if profile.PLMNID["mcc"] != "" {
+		indexes = append(indexes, plmnIndex(profile.PLMNID["mcc"], profile.PLMNID["mnc"]))
+	}
+	for _, tai := range profile.TAIs {
+		plmn := tai.PLMNID
+		if plmn == nil {
+			plmn = profile.PLMNID
+		}
+		indexes = append(indexes, taiIndex(plmn["mcc"], plmn["mnc"], tai.TAC))
+	}
+	if profile.Locality != "" {
+		indexes = append(indexes, localityIndex(profile.Locality))
+	}
+	return indexes
+}
+
+// serviceNames lists the service names offered by a profile, from its
+// NFService entries and from its service URLs
+func serviceNames(profile NFProfile) []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, service := range profile.NFServices {
+		add(service.ServiceName)
+	}
+	for _, serviceURL := range profile.ServiceURLs {
+		add(serviceURLName(serviceURL))
+	}
+	return names
+}
+
+// serviceURLName derives the service name from a service URL, which follows
+// the {apiRoot}/{serviceName}/{version} layout of TS 29.501 (e.g.
+// http://udm:8080/nudm-sdm/v2 offers nudm-sdm)
+func serviceURLName(serviceURL string) string {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return ""
+	}
+	return strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)[0]
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestApplyJSONPatch runs the examples of RFC 6902 appendix A, except A.13
+// whose duplicate "op" member encoding/json does not report, and checks
+// the errors on invalid pointers and array indexes
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		expected string // empty when the patch fails
+	}{
+		// RFC 6902 appendix A
+		{"A.1 adding an object member",
+			`{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			`{"baz": "qux", "foo": "bar"}`},
+		{"A.2 adding an array element",
+			`{"foo": ["bar", "baz"]}`,
+			`[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			`{"foo": ["bar", "qux", "baz"]}`},
+		{"A.3 removing an object member",
+			`{"baz": "qux", "foo": "bar"}`,
+			`[{"op": "remove", "path": "/baz"}]`,
+			`{"foo": "bar"}`},
+		{"A.4 removing an array element",
+			`{"foo": ["bar", "qux", "baz"]}`,
+			`[{"op": "remove", "path": "/foo/1"}]`,
+			`{"foo": ["bar", "baz"]}`},
+		{"A.5 replacing a value",
+			`{"baz": "qux", "foo": "bar"}`,
+			`[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			`{"baz": "boo", "foo": "bar"}`},
+		{"A.6 moving a value",
+			`{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			`[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			`{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`},
+		{"A.7 moving an array element",
+			`{"foo": ["all", "grass", "cows", "eat"]}`,
+			`[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			`{"foo": ["all", "cows", "eat", "grass"]}`},
+		{"A.8 testing a value: success",
+			`{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			`[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			`{"baz": "qux", "foo": ["a", 2, "c"]}`},
+		{"A.9 testing a value: error",
+			`{"baz": "qux"}`,
+			`[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			``},
+		{"A.10 adding a nested member object",
+			`{"foo": "bar"}`,
+			`[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			`{"foo": "bar", "child": {"grandchild": {}}}`},
+		{"A.11 ignoring unrecognized elements",
+			`{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			`{"foo": "bar", "baz": "qux"}`},
+		{"A.12 adding to a nonexistent target",
+			`{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			``},
+		{"A.14 ~ escape ordering",
+			`{"/": 9, "~1": 10}`,
+			`[{"op": "test", "path": "/~01", "value": 10}]`,
+			`{"/": 9, "~1": 10}`},
+		{"A.15 comparing strings and numbers",
+			`{"/": 9, "~1": 10}`,
+			`[{"op": "test", "path": "/~01", "value": "10"}]`,
+			``},
+		{"A.16 adding an array value",
+			`{"foo": ["bar"]}`,
+			`[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			`{"foo": ["bar", ["abc", "def"]]}`},
+
+		// Copies, whole documents and failing patches
+		{"copy is independent of its source",
+			`{"foo": {"bar": 1}}`,
+			`[{"op": "copy", "from": "/foo", "path": "/baz"}, {"op": "replace", "path": "/baz/bar", "value": 2}]`,
+			`{"foo": {"bar": 1}, "baz": {"bar": 2}}`},
+		{"replace the whole document",
+			`{"foo": "bar"}`,
+			`[{"op": "replace", "path": "", "value": ["baz"]}]`,
+			`["baz"]`},
+		{"remove the whole document",
+			`{"foo": "bar"}`,
+			`[{"op": "remove", "path": ""}]`,
+			``},
+		{"failing operation discards the patch",
+			`{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz", "value": "qux"}, {"op": "remove", "path": "/missing"}]`,
+			``},
+		{"move into a child",
+			`{"foo": {"bar": {}}}`,
+			`[{"op": "move", "from": "/foo", "path": "/foo/bar/baz"}]`,
+			``},
+		{"add without value",
+			`{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz"}]`,
+			``},
+		{"replace missing member",
+			`{"foo": "bar"}`,
+			`[{"op": "replace", "path": "/baz", "value": "qux"}]`,
+			``},
+		{"unknown operation",
+			`{"foo": "bar"}`,
+			`[{"op": "merge", "path": "/foo", "value": "qux"}]`,
+			``},
+		{"pointer without leading slash",
+			`{"foo": "bar"}`,
+			`[{"op": "remove", "path": "foo"}]`,
+			``},
+
+		// Array indexes
+		{"add at the end of an array",
+			`{"foo": ["bar"]}`,
+			`[{"op": "add", "path": "/foo/1", "value": "baz"}]`,
+			`{"foo": ["bar", "baz"]}`},
+		{"add past the end of an array",
+			`{"foo": ["bar"]}`,
+			`[{"op": "add", "path": "/foo/2", "value": "baz"}]`,
+			``},
+		{"index with a leading zero",
+			`{"foo": ["bar", "baz"]}`,
+			`[{"op": "add", "path": "/foo/01", "value": "qux"}]`,
+			``},
+		{"negative index",
+			`{"foo": ["bar"]}`,
+			`[{"op": "add", "path": "/foo/-1", "value": "qux"}]`,
+			``},
+		{"non numeric index",
+			`{"foo": ["bar"]}`,
+			`[{"op": "replace", "path": "/foo/bar", "value": "qux"}]`,
+			``},
+		{"replace at the end of an array",
+			`{"foo": ["bar"]}`,
+			`[{"op": "replace", "path": "/foo/-", "value": "qux"}]`,
+			``},
+		{"remove past the end of an array",
+			`{"foo": ["bar"]}`,
+			`[{"op": "remove", "path": "/foo/1"}]`,
+			``},
+		{"test past the end of an array",
+			`{"foo": ["bar"]}`,
+			`[{"op": "test", "path": "/foo/1", "value": "bar"}]`,
+			``},
+		{"nested array element",
+			`{"foo": [{"bar": ["a", "c"]}]}`,
+			`[{"op": "add", "path": "/foo/0/bar/1", "value": "b"}]`,
+			`{"foo": [{"bar": ["a", "b", "c"]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch []PatchItem
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatalf("invalid patch: %v", err)
+			}
+			patched, err := applyJSONPatch([]byte(tt.document), patch)
+			if tt.expected == "" {
+				if err == nil {
+					t.Fatalf("patch applied, giving %s", patched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyJSONPatch: %v", err)
+			}
+
+			var got, expected interface{}
+			json.Unmarshal(patched, &got)
+			json.Unmarshal([]byte(tt.expected), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("got %s, expected %s", patched, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// backgroundJobsLease is the lease held by the NRF process running the
+// heartbeat reaper and the notification dispatcher
+const backgroundJobsLease = "background-jobs"
+
+// LeaderConfig controls the election of the NRF process that runs the
+// background jobs among the replicas sharing a store
+type LeaderConfig struct {
+	CandidateID   string        // Identifies this process among the replicas, e.g. its pod name
+	LeaseTTL      time.Duration // How long the leader keeps the lead without renewing it
+	RenewInterval time.Duration // How often the lead is renewed or, by the others, claimed
+}
+
+// DefaultLeaderConfig returns the election settings used when none are configured
+func DefaultLeaderConfig() LeaderConfig {
+	return LeaderConfig{
+		CandidateID:   "nrf",
+		LeaseTTL:      15 * time.Second,
+		RenewInterval: 5 * time.Second,
+	}
+}
+
+// RunBackgroundJobs runs the heartbeat reaper and the notification
+// dispatcher while this process leads the NRF replicas, and stops them when
+// it loses the lead or cannot renew it. It blocks until runCtx is done, then
+// hands the lead over. Both jobs claim their work in the store, so the short
+// overlap possible when the lead changes hands does not duplicate it.
+func (s *Server) RunBackgroundJobs(runCtx context.Context) {
+	cfg := s.config.Leader
+	ticker := time.NewTicker(cfg.RenewInterval)
+	defer ticker.Stop()
+
+	var stopJobs func()
+	for {
+		leading, err := s.store.AcquireLease(runCtx, backgroundJobsLease, cfg.CandidateID, cfg.LeaseTTL)
+		if err != nil && runCtx.Err() == nil {
+			log.Printf("Leader election failed for %s: %v", cfg.CandidateID, err)
+		}
+
+		switch {
+		case leading && stopJobs == nil:
+			log.Printf("%s leads the NRF replicas, starting background jobs", cfg.CandidateID)
+			stopJobs = s.startLeaderJobs(runCtx)
+		case !leading && stopJobs != nil:
+			log.Printf("%s no longer leads the NRF replicas, stopping background jobs", cfg.CandidateID)
+			stopJobs()
+			stopJobs = nil
+		}
+
+		select {
+		case <-runCtx.Done():
+			if stopJobs != nil {
+				stopJobs()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.RenewInterval)
+			if err := s.store.ReleaseLease(ctx, backgroundJobsLease, cfg.CandidateID); err != nil {
+				log.Printf("Failed to hand over the lead of %s: %v", cfg.CandidateID, err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startLeaderJobs starts the jobs run by the leader. The returned function
+// stops them and waits for them to return.
+func (s *Server) startLeaderJobs(runCtx context.Context) func() {
+	ctx, cancel := context.WithCancel(runCtx)
+	var jobs sync.WaitGroup
+	jobs.Add(2)
+	go func() {
+		defer jobs.Done()
+		s.StartHeartbeatReaper(ctx)
+	}()
+	go func() {
+		defer jobs.Done()
+		s.StartNotificationDispatcher(ctx)
+	}()
+	return func() {
+		cancel()
+		jobs.Wait()
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// replicaStore is the view an NRF replica has of a store shared with other
+// replicas. It counts the background jobs the replica starts and runs, and
+// may stop answering lease requests.
+type replicaStore struct {
+	*MemoryStore
+	unreachable atomic.Bool
+	starts      atomic.Int32 // Notification dispatchers started
+	reaps       atomic.Int32 // Heartbeat reaper runs
+}
+
+func (s *replicaStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	if s.unreachable.Load() {
+		return false, errors.New("store unreachable")
+	}
+	return s.MemoryStore.AcquireLease(ctx, name, holder, ttl)
+}
+
+func (s *replicaStore) RecoverNotificationQueues(ctx context.Context) error {
+	s.starts.Add(1)
+	return s.MemoryStore.RecoverNotificationQueues(ctx)
+}
+
+func (s *replicaStore) ExpiredHeartbeats(ctx context.Context, now time.Time) ([]string, error) {
+	s.reaps.Add(1)
+	return s.MemoryStore.ExpiredHeartbeats(ctx, now)
+}
+
+// replica is an NRF replica running its background jobs when it leads
+type replica struct {
+	store  *replicaStore
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startReplica runs the leader election of an NRF replica on a shared store
+// until the test ends
+func startReplica(t *testing.T, shared *MemoryStore, candidateID string) *replica {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Leader = LeaderConfig{CandidateID: candidateID, LeaseTTL: 300 * time.Millisecond, RenewInterval: 20 * time.Millisecond}
+	cfg.Reaper.Interval = 10 * time.Millisecond
+	cfg.Dispatcher.Interval = 10 * time.Millisecond
+	store := &replicaStore{MemoryStore: shared}
+	server, err := NewServer(store, cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &replica{store: store, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		server.RunBackgroundJobs(ctx)
+	}()
+	t.Cleanup(r.stop)
+	return r
+}
+
+// stop ends the replica and waits for it to hand over the lead
+func (r *replica) stop() {
+	r.cancel()
+	<-r.done
+}
+
+// running reports whether the background jobs of the replica are running
+func (r *replica) running() bool {
+	reaps := r.store.reaps.Load()
+	time.Sleep(50 * time.Millisecond)
+	return r.store.reaps.Load() > reaps+1
+}
+
+// leaseHolder returns the replica holding the lead of the background jobs
+func leaseHolder(store *MemoryStore) string {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	current, ok := store.leases[backgroundJobsLease]
+	if !ok || !time.Now().Before(current.expires) {
+		return ""
+	}
+	return current.holder
+}
+
+// TestLeaderElection checks that a single replica runs the background jobs,
+// that the lead moves on when its holder stops or cannot renew it, and that
+// the jobs stop with the lead
+func TestLeaderElection(t *testing.T) {
+	shared := NewMemoryStore()
+	first := startReplica(t, shared, "nrf-a")
+	eventually(t, func() bool { return first.store.starts.Load() == 1 }, "the first replica to lead")
+	second := startReplica(t, shared, "nrf-b")
+
+	if firstRunning, secondRunning := first.running(), second.running(); !firstRunning || secondRunning {
+		t.Fatalf("jobs running on the first replica: %v, on the second: %v", firstRunning, secondRunning)
+	}
+	if holder := leaseHolder(shared); holder != "nrf-a" {
+		t.Fatalf("lease held by %q, expected nrf-a", holder)
+	}
+
+	// The leader cannot renew its lease: it stops its jobs at once, and the
+	// other replica takes the lead once the lease expires
+	first.store.unreachable.Store(true)
+	eventually(t, func() bool { return second.store.starts.Load() == 1 }, "the second replica to lead")
+	if first.running() {
+		t.Errorf("jobs still running on the replica that lost the lead")
+	}
+	first.store.unreachable.Store(false)
+	if !second.running() || first.store.starts.Load() != 1 {
+		t.Errorf("lead taken back by the first replica")
+	}
+
+	// The leader stopping hands the lead over without waiting for its lease
+	// to expire
+	second.stop()
+	stopped := time.Now()
+	if holder := leaseHolder(shared); holder == "nrf-b" {
+		t.Errorf("lease still held by the stopped replica")
+	}
+	eventually(t, func() bool { return first.store.starts.Load() == 2 }, "the first replica to lead again")
+	if handover := time.Since(stopped); handover >= 300*time.Millisecond {
+		t.Errorf("lead handed over in %v, no faster than the lease expiry", handover)
+	}
+
+	first.stop()
+	if holder := leaseHolder(shared); holder != "" {
+		t.Errorf("lease held by %q after every replica stopped", holder)
+	}
+}
+
+// eventually waits for a condition checked by polling
+func eventually(t *testing.T, condition func() bool, description string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// defaultPageSize is the number of NF instances listed per page when the
+// requester does not ask for a page size
+const defaultPageSize = 100
+
+// Link is a hypermedia link (TS 29.571 Link)
+type Link struct {
+	Href string `json:"href"`
+}
+
+// URIListLinks are the links of a page of NF instances
+type URIListLinks struct {
+	Self  Link   `json:"self"`
+	First *Link  `json:"first,omitempty"`
+	Prev  *Link  `json:"prev,omitempty"`
+	Next  *Link  `json:"next,omitempty"`
+	Last  *Link  `json:"last,omitempty"`
+	Item  []Link `json:"item"`
+}
+
+// URIList is a page of NF instance URIs (TS 29.510 UriList)
+type URIList struct {
+	Links          URIListLinks `json:"_links"`
+	TotalItemCount int          `json:"totalItemCount"`
+}
+
+// nfInstancePath returns the resource URI of an NF instance, relative to the apiRoot
+func nfInstancePath(nfInstanceID string) string {
+	return "/nnrf-nfm/v1/nf-instances/" + url.PathEscape(nfInstanceID)
+}
+
+// positiveParam reads an optional positive integer query parameter
+func positiveParam(values url.Values, name string, fallback int) (int, error) {
+	value := values.Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return n, nil
+}
+
+// newURIList builds the given page of the NF instance list. The page links
+// repeat the request URL with another page-number.
+func newURIList(requestURL *url.URL, ids []string, pageNumber, pageSize int) URIList {
+	pages := (len(ids) + pageSize - 1) / pageSize
+	if pages == 0 {
+		pages = 1
+	}
+
+	pageLink := func(page int) *Link {
+		query := requestURL.Query()
+		query.Set("page-number", strconv.Itoa(page))
+		query.Set("page-size", strconv.Itoa(pageSize))
+		return &Link{Href: requestURL.Path + "?" + query.Encode()}
+	}
+
+	list := URIList{
+		Links: URIListLinks{
+			Self:  *pageLink(pageNumber),
+			First: pageLink(1),
+			Last:  pageLink(pages),
+			Item:  []Link{},
+		},
+		TotalItemCount: len(ids),
+	}
+	if pageNumber > 1 && pageNumber <= pages {
+		list.Links.Prev = pageLink(pageNumber - 1)
+	}
+	if pageNumber < pages {
+		list.Links.Next = pageLink(pageNumber + 1)
+	}
+
+	start := (pageNumber - 1) * pageSize
+	for i := start; i < len(ids) && i < start+pageSize; i++ {
+		list.Links.Item = append(list.Links.Item, Link{Href: nfInstancePath(ids[i])})
+	}
+	return list
+}
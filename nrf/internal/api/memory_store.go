@@ -0,0 +1,444 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the NRF state in process memory. It is meant for tests
+// and local demos: the state is lost on restart and cannot be shared between
+// NRF processes. Entries are stored JSON encoded, so callers never share maps
+// or slices with the store, as with Redis.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	profiles      map[string][]byte
+	indexes       map[string]map[string]bool
+	subscriptions map[string][]byte
+	deadlines     map[string]time.Time
+
+	queues      map[string][]NotificationJob
+	pending     map[string]time.Time
+	deadLetters []NotificationJob // newest first
+	leases      map[string]lease
+
+	watchersMu sync.Mutex
+	watchers   map[chan RegistryEvent]bool
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		profiles:      make(map[string][]byte),
+		indexes:       make(map[string]map[string]bool),
+		subscriptions: make(map[string][]byte),
+		deadlines:     make(map[string]time.Time),
+		queues:        make(map[string][]NotificationJob),
+		pending:       make(map[string]time.Time),
+		leases:        make(map[string]lease),
+		watchers:      make(map[chan RegistryEvent]bool),
+	}
+}
+
+// GetProfile reads an NF profile
+func (s *MemoryStore) GetProfile(ctx context.Context, nfInstanceID string) (*NFProfile, error) {
+	s.mu.Lock()
+	data, ok := s.profiles[nfInstanceID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var profile NFProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode profile %s: %w", nfInstanceID, err)
+	}
+	return &profile, nil
+}
+
+// GetProfiles fetches several NF profiles, skipping missing ones
+func (s *MemoryStore) GetProfiles(ctx context.Context, nfInstanceIDs []string) ([]NFProfile, error) {
+	profiles := make([]NFProfile, 0, len(nfInstanceIDs))
+	for _, id := range nfInstanceIDs {
+		profile, err := s.GetProfile(ctx, id)
+		if err != nil {
+			continue
+		}
+		profiles = append(profiles, *profile)
+	}
+	return profiles, nil
+}
+
+// PutProfile saves an NF profile and moves it between indexes, unless the
+// stored profile no longer matches previous
+func (s *MemoryStore) PutProfile(ctx context.Context, profile NFProfile, previous *NFProfile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("failed to encode profile: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stored *NFProfile
+	if current, ok := s.profiles[profile.NFID]; ok {
+		stored = &NFProfile{}
+		if err := json.Unmarshal(current, stored); err != nil {
+			return fmt.Errorf("failed to decode profile %s: %w", profile.NFID, err)
+		}
+	}
+	if !sameProfileVersion(stored, previous) {
+		return ErrConflict
+	}
+
+	if previous != nil {
+		s.unindex(*previous)
+	}
+	s.profiles[profile.NFID] = data
+	for _, index := range profileIndexes(profile) {
+		if s.indexes[index] == nil {
+			s.indexes[index] = make(map[string]bool)
+		}
+		s.indexes[index][profile.NFID] = true
+	}
+	return nil
+}
+
+// DeleteProfile removes an NF profile with its index entries and heartbeat deadline
+func (s *MemoryStore) DeleteProfile(ctx context.Context, profile NFProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unindex(profile)
+	delete(s.profiles, profile.NFID)
+	delete(s.deadlines, profile.NFID)
+	return nil
+}
+
+// unindex removes the profile from its indexes; s.mu must be held
+func (s *MemoryStore) unindex(profile NFProfile) {
+	for _, index := range profileIndexes(profile) {
+		delete(s.indexes[index], profile.NFID)
+		if len(s.indexes[index]) == 0 {
+			delete(s.indexes, index)
+		}
+	}
+}
+
+// FindNFInstanceIDs intersects the unions of every group of indexes
+func (s *MemoryStore) FindNFInstanceIDs(ctx context.Context, criteria [][]string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return matchCriteria(criteria, func(indexes []string) ([]string, error) {
+		var members []string
+		for _, index := range indexes {
+			for id := range s.indexes[index] {
+				members = append(members, id)
+			}
+		}
+		return members, nil
+	})
+}
+
+// GetSubscription reads a subscription that has not expired
+func (s *MemoryStore) GetSubscription(ctx context.Context, subscriptionID string) (*SubscriptionData, error) {
+	s.mu.Lock()
+	data, ok := s.subscriptions[subscriptionID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var subscription SubscriptionData
+	if err := json.Unmarshal(data, &subscription); err != nil {
+		return nil, fmt.Errorf("failed to decode subscription %s: %w", subscriptionID, err)
+	}
+	if subscription.ValidityTime != nil && !time.Now().Before(*subscription.ValidityTime) {
+		s.mu.Lock()
+		delete(s.subscriptions, subscriptionID)
+		s.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	return &subscription, nil
+}
+
+// PutSubscription saves a subscription until its validity time
+func (s *MemoryStore) PutSubscription(ctx context.Context, subscription SubscriptionData) error {
+	if !time.Now().Before(*subscription.ValidityTime) {
+		return fmt.Errorf("validityTime is in the past")
+	}
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return fmt.Errorf("failed to encode subscription: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscriptions[subscription.SubscriptionID] = data
+	return nil
+}
+
+// DeleteSubscription removes a subscription
+func (s *MemoryStore) DeleteSubscription(ctx context.Context, subscriptionID string) error {
+	if _, err := s.GetSubscription(ctx, subscriptionID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscriptions, subscriptionID)
+	return nil
+}
+
+// ListSubscriptions returns every subscription that has not expired
+func (s *MemoryStore) ListSubscriptions(ctx context.Context) ([]SubscriptionData, error) {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.subscriptions))
+	for id := range s.subscriptions {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+
+	var subscriptions []SubscriptionData
+	for _, id := range ids {
+		subscription, err := s.GetSubscription(ctx, id)
+		if err != nil {
+			continue
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+	return subscriptions, nil
+}
+
+// SetHeartbeatDeadline sets the time at which the reaper should act on the NF
+func (s *MemoryStore) SetHeartbeatDeadline(ctx context.Context, nfInstanceID string, deadline time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadlines[nfInstanceID] = deadline
+	return nil
+}
+
+// ExpiredHeartbeats lists the NFs whose deadline has passed, earliest first
+func (s *MemoryStore) ExpiredHeartbeats(ctx context.Context, now time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return dueEntries(s.deadlines, now), nil
+}
+
+// ClaimHeartbeatDeadline removes an expired deadline
+func (s *MemoryStore) ClaimHeartbeatDeadline(ctx context.Context, nfInstanceID string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deadline, ok := s.deadlines[nfInstanceID]
+	if !ok || deadline.After(now) {
+		return false, nil
+	}
+	delete(s.deadlines, nfInstanceID)
+	return true, nil
+}
+
+// EnqueueNotification appends a job to its subscription's queue
+func (s *MemoryStore) EnqueueNotification(ctx context.Context, job NotificationJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queues[job.SubscriptionID] = append(s.queues[job.SubscriptionID], job)
+	if _, scheduled := s.pending[job.SubscriptionID]; !scheduled {
+		s.pending[job.SubscriptionID] = time.Now()
+	}
+	return nil
+}
+
+// DueNotificationQueues lists the subscriptions whose queue is due
+func (s *MemoryStore) DueNotificationQueues(ctx context.Context, now time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return dueEntries(s.pending, now), nil
+}
+
+// ClaimNotificationQueue leases a due queue until the given time. The queue
+// stays pending, so that enqueueing does not make it due before then.
+func (s *MemoryStore) ClaimNotificationQueue(ctx context.Context, subscriptionID string, now, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if due, ok := s.pending[subscriptionID]; !ok || due.After(now) {
+		return false, nil
+	}
+	s.pending[subscriptionID] = until
+	return true, nil
+}
+
+// PeekNotification returns the oldest queued notification
+func (s *MemoryStore) PeekNotification(ctx context.Context, subscriptionID string) (*NotificationJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.queues[subscriptionID]
+	if len(queue) == 0 {
+		return nil, ErrNotFound
+	}
+	job := queue[0]
+	return &job, nil
+}
+
+// UpdateNotification replaces the head of the job's queue
+func (s *MemoryStore) UpdateNotification(ctx context.Context, job NotificationJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.queues[job.SubscriptionID]
+	if len(queue) == 0 {
+		return ErrNotFound
+	}
+	queue[0] = job
+	return nil
+}
+
+// PopNotification removes the head of the queue
+func (s *MemoryStore) PopNotification(ctx context.Context, subscriptionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.queues[subscriptionID]
+	switch len(queue) {
+	case 0:
+	case 1:
+		delete(s.queues, subscriptionID)
+	default:
+		s.queues[subscriptionID] = queue[1:]
+	}
+	return nil
+}
+
+// ScheduleNotificationQueue releases a claimed queue, due at the given time
+// if it still holds notifications
+func (s *MemoryStore) ScheduleNotificationQueue(ctx context.Context, subscriptionID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queues[subscriptionID]) > 0 {
+		s.pending[subscriptionID] = at
+	} else {
+		delete(s.pending, subscriptionID)
+	}
+	return nil
+}
+
+// DropNotificationQueue discards the notifications pending for a subscription
+func (s *MemoryStore) DropNotificationQueue(ctx context.Context, subscriptionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.queues, subscriptionID)
+	delete(s.pending, subscriptionID)
+	return nil
+}
+
+// RecoverNotificationQueues is a no-op: queues never outlive the process that claimed them
+func (s *MemoryStore) RecoverNotificationQueues(ctx context.Context) error {
+	return nil
+}
+
+// DeadLetterNotifications moves a failing subscription's notifications to
+// the dead-letter list and removes the subscription
+func (s *MemoryStore) DeadLetterNotifications(ctx context.Context, failed NotificationJob, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters := []NotificationJob{failed}
+	if queue := s.queues[failed.SubscriptionID]; len(queue) > 1 {
+		letters = append(letters, queue[1:]...)
+	}
+	for _, job := range letters {
+		s.deadLetters = append([]NotificationJob{job}, s.deadLetters...)
+	}
+	if len(s.deadLetters) > limit {
+		s.deadLetters = s.deadLetters[:limit]
+	}
+
+	delete(s.queues, failed.SubscriptionID)
+	delete(s.pending, failed.SubscriptionID)
+	delete(s.subscriptions, failed.SubscriptionID)
+	return nil
+}
+
+// ListDeadLetters returns the dead-lettered notifications, newest first
+func (s *MemoryStore) ListDeadLetters(ctx context.Context) ([]NotificationJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]NotificationJob(nil), s.deadLetters...), nil
+}
+
+// ClearDeadLetters empties the dead-letter list
+func (s *MemoryStore) ClearDeadLetters(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters = nil
+	return nil
+}
+
+// dueEntries returns the keys whose time is not after now, earliest first
+func dueEntries(times map[string]time.Time, now time.Time) []string {
+	var due []string
+	for key, at := range times {
+		if !at.After(now) {
+			due = append(due, key)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return times[due[i]].Before(times[due[j]]) })
+	return due
+}
+
+// PublishEvent hands the event to the current subscribers, skipping those
+// whose buffer is full
+func (s *MemoryStore) PublishEvent(ctx context.Context, event RegistryEvent) error {
+	s.watchersMu.Lock()
+	defer s.watchersMu.Unlock()
+	for watcher := range s.watchers {
+		select {
+		case watcher <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+// SubscribeEvents registers a subscriber until ctx is done
+func (s *MemoryStore) SubscribeEvents(ctx context.Context) (<-chan RegistryEvent, error) {
+	events := make(chan RegistryEvent, eventBufferSize)
+	s.watchersMu.Lock()
+	s.watchers[events] = true
+	s.watchersMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.watchersMu.Lock()
+		delete(s.watchers, events)
+		s.watchersMu.Unlock()
+		close(events)
+	}()
+	return events, nil
+}
+
+// lease is the holder of a lease and the time its lease ends
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+// AcquireLease takes or extends a lease
+func (s *MemoryStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if current, ok := s.leases[name]; ok && current.holder != holder && now.Before(current.expires) {
+		return false, nil
+	}
+	s.leases[name] = lease{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLease gives up a lease held by holder
+func (s *MemoryStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leases[name].holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// NotificationJob is a notification waiting to be delivered to a subscriber
+type NotificationJob struct {
+	SubscriptionID  string          `json:"subscriptionId"`
+	NotificationURI string          `json:"notificationUri"`
+	Notification    json.RawMessage `json:"notification"`
+	Attempts        int             `json:"attempts"`
+	CreatedAt       time.Time       `json:"createdAt"`
+	LastError       string          `json:"lastError,omitempty"`
+}
+
+// DispatcherConfig controls delivery of notifications to subscribers
+type DispatcherConfig struct {
+	Interval        time.Duration // How often due notifications are picked up
+	Workers         int           // Subscribers served concurrently
+	MaxAttempts     int           // Delivery attempts before a notification is dead-lettered
+	InitialBackoff  time.Duration // Delay before the first retry
+	MaxBackoff      time.Duration // Upper bound of the retry delay
+	RequestTimeout  time.Duration // Timeout of a single delivery
+	DeadLetterLimit int           // Number of dead-lettered notifications kept
+}
+
+// DefaultDispatcherConfig returns the dispatcher settings used when none are configured
+func DefaultDispatcherConfig() DispatcherConfig {
+	return DispatcherConfig{
+		Interval:        500 * time.Millisecond,
+		Workers:         8,
+		MaxAttempts:     8,
+		InitialBackoff:  time.Second,
+		MaxBackoff:      2 * time.Minute,
+		RequestTimeout:  5 * time.Second,
+		DeadLetterLimit: 1000,
+	}
+}
+
+// enqueueNotification queues a notification for delivery to a subscriber
+func (s *Server) enqueueNotification(ctx context.Context, subscription SubscriptionData, notification map[string]interface{}) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	return s.store.EnqueueNotification(ctx, NotificationJob{
+		SubscriptionID:  subscription.SubscriptionID,
+		NotificationURI: subscription.NFStatusNotificationURI,
+		Notification:    payload,
+		CreatedAt:       time.Now().UTC(),
+	})
+}
+
+// StartNotificationDispatcher delivers queued notifications, retrying failed
+// deliveries with exponential backoff. It blocks until runCtx is done.
+func (s *Server) StartNotificationDispatcher(runCtx context.Context) {
+	cfg := s.config.Dispatcher
+	if err := s.store.RecoverNotificationQueues(runCtx); err != nil {
+		log.Printf("Failed to recover notification queues: %v", err)
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	workers := make(chan struct{}, cfg.Workers)
+
+	log.Printf("Notification dispatcher started (%d workers, max %d attempts)", cfg.Workers, cfg.MaxAttempts)
+	for {
+		select {
+		case <-runCtx.Done():
+			log.Println("Notification dispatcher stopped")
+			return
+		case now := <-ticker.C:
+			subscriptionIDs, err := s.store.DueNotificationQueues(runCtx, now)
+			if err != nil {
+				log.Printf("Failed to read pending notifications: %v", err)
+				continue
+			}
+
+			for _, subscriptionID := range subscriptionIDs {
+				workers <- struct{}{}
+				// Claiming the queue keeps its notifications in order, even
+				// with several NRF processes sharing the same store. The
+				// lease outlasts a delivery, and lapses if this NRF stops.
+				claimed, err := s.store.ClaimNotificationQueue(runCtx, subscriptionID, time.Now(), time.Now().Add(s.notificationLease()))
+				if err != nil || !claimed {
+					<-workers
+					continue
+				}
+				go func(subscriptionID string) {
+					defer func() { <-workers }()
+					s.deliverNextNotification(runCtx, subscriptionID)
+				}(subscriptionID)
+			}
+		}
+	}
+}
+
+// notificationLease is how long a claimed queue is kept from other workers:
+// long enough for the store calls and the delivery of its head
+func (s *Server) notificationLease() time.Duration {
+	return 2*s.config.Dispatcher.RequestTimeout + s.config.Dispatcher.Interval
+}
+
+// deliverNextNotification sends the oldest notification queued for a
+// subscription and releases the claimed queue, scheduling the rest of it
+func (s *Server) deliverNextNotification(ctx context.Context, subscriptionID string) {
+	job, err := s.store.PeekNotification(ctx, subscriptionID)
+	if errors.Is(err, ErrNotFound) {
+		s.scheduleNotificationQueue(ctx, subscriptionID, 0)
+		return
+	} else if err != nil {
+		log.Printf("Failed to read notification queue of %s: %v", subscriptionID, err)
+		s.scheduleNotificationQueue(ctx, subscriptionID, s.config.Dispatcher.InitialBackoff)
+		return
+	}
+
+	if _, err := s.store.GetSubscription(ctx, subscriptionID); errors.Is(err, ErrNotFound) {
+		// The subscription expired or was removed while notifications were queued
+		if err := s.store.DropNotificationQueue(ctx, subscriptionID); err != nil {
+			log.Printf("Failed to drop notification queue of %s: %v", subscriptionID, err)
+			s.scheduleNotificationQueue(ctx, subscriptionID, s.config.Dispatcher.InitialBackoff)
+		}
+		return
+	} else if err != nil {
+		log.Printf("Failed to read subscription %s: %v", subscriptionID, err)
+		s.scheduleNotificationQueue(ctx, subscriptionID, s.config.Dispatcher.InitialBackoff)
+		return
+	}
+
+	job.Attempts++
+	if err := s.postNotification(*job); err != nil {
+		job.LastError = err.Error()
+		if job.Attempts >= s.config.Dispatcher.MaxAttempts {
+			log.Printf("Giving up on notification to %s after %d attempts: %v", job.NotificationURI, job.Attempts, err)
+			s.expireFailingSubscription(ctx, *job)
+			return
+		}
+
+		if err := s.store.UpdateNotification(ctx, *job); err != nil {
+			log.Printf("Failed to record delivery attempt for %s: %v", subscriptionID, err)
+		}
+		s.scheduleNotificationQueue(ctx, subscriptionID, s.notificationBackoff(job.Attempts))
+		return
+	}
+
+	if err := s.store.PopNotification(ctx, subscriptionID); err != nil {
+		log.Printf("Failed to remove delivered notification for %s: %v", subscriptionID, err)
+	}
+	s.scheduleNotificationQueue(ctx, subscriptionID, 0)
+}
+
+// postNotification performs a single delivery attempt
+func (s *Server) postNotification(job NotificationJob) error {
+	resp, err := s.notifyClient.Post(job.NotificationURI, "application/json", bytes.NewReader(job.Notification))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("subscriber returned %s", resp.Status)
+	}
+	return nil
+}
+
+// scheduleNotificationQueue releases the claimed queue, due again after
+// delay if it still holds notifications
+func (s *Server) scheduleNotificationQueue(ctx context.Context, subscriptionID string, delay time.Duration) {
+	if err := s.store.ScheduleNotificationQueue(ctx, subscriptionID, time.Now().Add(delay)); err != nil {
+		log.Printf("Failed to schedule notification queue of %s: %v", subscriptionID, err)
+	}
+}
+
+// notificationBackoff returns the delay before the next delivery attempt
+func (s *Server) notificationBackoff(attempts int) time.Duration {
+	cfg := s.config.Dispatcher
+	backoff := cfg.InitialBackoff
+	for i := 1; i < attempts && backoff < cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > cfg.MaxBackoff {
+		backoff = cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// expireFailingSubscription removes a subscription whose callback keeps
+// failing and moves its undelivered notifications to the dead-letter list
+func (s *Server) expireFailingSubscription(ctx context.Context, failed NotificationJob) {
+	if err := s.store.DeadLetterNotifications(ctx, failed, s.config.Dispatcher.DeadLetterLimit); err != nil {
+		log.Printf("Failed to dead-letter notifications of %s: %v", failed.SubscriptionID, err)
+		s.scheduleNotificationQueue(ctx, failed.SubscriptionID, s.config.Dispatcher.InitialBackoff)
+		return
+	}
+	log.Printf("Subscription %s expired after repeated notification failures", failed.SubscriptionID)
+}
+
+// ListDeadLetters returns the notifications that could not be delivered, newest first
+func (s *Server) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.store.ListDeadLetters(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to read dead-letter list", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// ClearDeadLetters empties the dead-letter list
+func (s *Server) ClearDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.ClearDeadLetters(r.Context()); err != nil {
+		http.Error(w, "Failed to clear dead-letter list", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
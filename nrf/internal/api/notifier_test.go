@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestNotificationEnqueuedDuringDelivery checks that a notification queued
+// while the head of the queue is being delivered neither makes the queue
+// due to a second worker nor loses the head
+func TestNotificationEnqueuedDuringDelivery(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		received    []string
+		inFlight    int
+		maxInFlight int
+	)
+	firstArrived := make(chan struct{})
+	releaseFirst := make(chan struct{})
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification map[string]string
+		json.NewDecoder(r.Body).Decode(&notification)
+
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		received = append(received, notification["event"])
+		first := len(received) == 1
+		mu.Unlock()
+
+		if first {
+			close(firstArrived)
+			<-releaseFirst
+		}
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer subscriber.Close()
+
+	cfg := DefaultConfig()
+	cfg.Dispatcher.Interval = 5 * time.Millisecond
+	store := NewMemoryStore()
+	server, err := NewServer(store, cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	validityTime := time.Now().Add(time.Hour)
+	subscription := SubscriptionData{SubscriptionID: "sub-1", NFStatusNotificationURI: subscriber.URL, ValidityTime: &validityTime}
+	if err := store.PutSubscription(ctx, subscription); err != nil {
+		t.Fatalf("PutSubscription: %v", err)
+	}
+	go server.StartNotificationDispatcher(ctx)
+
+	enqueue := func(event string) {
+		if err := server.enqueueNotification(ctx, subscription, map[string]interface{}{"event": event}); err != nil {
+			t.Fatalf("enqueueNotification: %v", err)
+		}
+	}
+	enqueue("first")
+	select {
+	case <-firstArrived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first notification not delivered")
+	}
+
+	// The dispatcher ticks several times while the first delivery is held
+	enqueue("second")
+	time.Sleep(20 * cfg.Dispatcher.Interval)
+	close(releaseFirst)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := len(received) >= 2
+		mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(cfg.Dispatcher.Interval)
+	}
+	time.Sleep(10 * cfg.Dispatcher.Interval)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 || received[0] != "first" || received[1] != "second" {
+		t.Errorf("subscriber received %v, expected [first second]", received)
+	}
+	if maxInFlight != 1 {
+		t.Errorf("%d deliveries to the subscriber were in flight at once, expected 1", maxInFlight)
+	}
+	if _, err := store.PeekNotification(ctx, subscription.SubscriptionID); err != ErrNotFound {
+		t.Errorf("queue not empty after delivery: %v", err)
+	}
+}
+
+// unreliableStore fails some calls of the store it wraps
+type unreliableStore struct {
+	*MemoryStore
+	getSubscriptionErr error
+	dropErr            error
+}
+
+func (s *unreliableStore) GetSubscription(ctx context.Context, subscriptionID string) (*SubscriptionData, error) {
+	if s.getSubscriptionErr != nil {
+		return nil, s.getSubscriptionErr
+	}
+	return s.MemoryStore.GetSubscription(ctx, subscriptionID)
+}
+
+func (s *unreliableStore) DropNotificationQueue(ctx context.Context, subscriptionID string) error {
+	if s.dropErr != nil {
+		return s.dropErr
+	}
+	return s.MemoryStore.DropNotificationQueue(ctx, subscriptionID)
+}
+
+// TestNotificationStoreFailures checks that a queue whose subscription
+// cannot be read, or cannot be dropped, is neither delivered nor stranded
+func TestNotificationStoreFailures(t *testing.T) {
+	errUnavailable := errors.New("store unavailable")
+	tests := []struct {
+		name            string
+		subscribed      bool
+		getSubscription error
+		drop            error
+		rescheduled     bool
+	}{
+		{"subscription unreadable", true, errUnavailable, nil, true},
+		{"subscription removed", false, nil, nil, false},
+		{"subscription removed, queue not dropped", false, nil, errUnavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivered := 0
+			subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				delivered++
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer subscriber.Close()
+
+			store := &unreliableStore{MemoryStore: NewMemoryStore()}
+			server, err := NewServer(store, DefaultConfig())
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			cfg := server.config.Dispatcher
+			ctx := context.Background()
+			validityTime := time.Now().Add(time.Hour)
+			subscription := SubscriptionData{SubscriptionID: "sub-1", NFStatusNotificationURI: subscriber.URL, ValidityTime: &validityTime}
+			if tt.subscribed {
+				if err := store.PutSubscription(ctx, subscription); err != nil {
+					t.Fatalf("PutSubscription: %v", err)
+				}
+			}
+			if err := server.enqueueNotification(ctx, subscription, map[string]interface{}{"event": "first"}); err != nil {
+				t.Fatalf("enqueueNotification: %v", err)
+			}
+			now := time.Now()
+			if claimed, err := store.ClaimNotificationQueue(ctx, subscription.SubscriptionID, now, now.Add(time.Hour)); !claimed || err != nil {
+				t.Fatalf("ClaimNotificationQueue: %v, %v", claimed, err)
+			}
+
+			store.getSubscriptionErr, store.dropErr = tt.getSubscription, tt.drop
+			server.deliverNextNotification(ctx, subscription.SubscriptionID)
+			if delivered != 0 {
+				t.Errorf("notification delivered %d times", delivered)
+			}
+			if due, _ := store.DueNotificationQueues(ctx, time.Now()); len(due) != 0 {
+				t.Errorf("queue due again without backoff: %v", due)
+			}
+			due, _ := store.DueNotificationQueues(ctx, time.Now().Add(cfg.InitialBackoff+time.Second))
+			if rescheduled := len(due) == 1; rescheduled != tt.rescheduled {
+				t.Errorf("queues due after the backoff: %v, expected rescheduled %v", due, tt.rescheduled)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenConfig controls the Nnrf_AccessToken service
+type TokenConfig struct {
+	Issuer   string        // NF instance ID of this NRF, used as the token issuer
+	KeyFile  string        // PEM encoded EC P-256 private key; a key is generated when empty
+	Lifetime time.Duration // Validity of issued access tokens
+	// AllowUnauthenticatedClients issues tokens to clients that only name a
+	// registered NF instance, without a TLS client certificate proving it.
+	// Anyone reaching the NRF can then get the tokens of any NF, so it is
+	// only for NRFs that untrusted hosts cannot reach.
+	AllowUnauthenticatedClients bool
+}
+
+// DefaultTokenConfig returns the token settings used when none are configured
+func DefaultTokenConfig() TokenConfig {
+	return TokenConfig{
+		Issuer:   "nrf",
+		Lifetime: time.Hour,
+	}
+}
+
+// AccessTokenClaims are the claims of an SBI access token (TS 29.510 AccessTokenClaims)
+type AccessTokenClaims struct {
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// AccessTokenResponse is returned by the token endpoint (TS 29.510 AccessTokenRsp)
+type AccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// AccessTokenError is returned when no token can be issued (RFC 6749 section 5.2)
+type AccessTokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type tokenIssuer struct {
+	config TokenConfig
+	key    *ecdsa.PrivateKey
+	keyID  string
+}
+
+// newTokenIssuer loads or generates the key used to sign access tokens
+func newTokenIssuer(cfg TokenConfig) (*tokenIssuer, error) {
+	var key *ecdsa.PrivateKey
+	if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token signing key: %w", err)
+		}
+		key, err = jwt.ParseECPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token signing key: %w", err)
+		}
+	} else {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate token signing key: %w", err)
+		}
+		log.Println("No token signing key configured, using a generated key")
+	}
+
+	keyID, err := publicKeyID(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenIssuer{config: cfg, key: key, keyID: keyID}, nil
+}
+
+// publicKeyID derives a stable key ID from the public key
+func publicKeyID(key *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:8]), nil
+}
+
+// IssueAccessToken implements the Nnrf_AccessToken service. The request is
+// form encoded and carries the requester's NF instance ID and type, the
+// target NF type or instance and the requested service names as scope. The
+// requester authenticates with the TLS client certificate of its NF
+// instance, unless the NRF allows unauthenticated clients.
+func (s *Server) IssueAccessToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "only client_credentials is supported")
+		return
+	}
+
+	nfInstanceID := r.PostForm.Get("nfInstanceId")
+	nfType := r.PostForm.Get("nfType")
+	targetNFType := r.PostForm.Get("targetNfType")
+	targetNFInstanceID := r.PostForm.Get("targetNfInstanceId")
+	scope := strings.Join(strings.Fields(r.PostForm.Get("scope")), " ")
+	if nfInstanceID == "" || scope == "" || (targetNFType == "" && targetNFInstanceID == "") {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "nfInstanceId, scope and targetNfType or targetNfInstanceId are required")
+		return
+	}
+
+	if !s.issuer.config.AllowUnauthenticatedClients && !certifiesInstance(r.TLS, nfInstanceID) {
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client", "no client certificate of NF instance "+nfInstanceID)
+		return
+	}
+
+	// Only registered NFs get tokens, and only for their own NF type
+	requester, err := s.store.GetProfile(r.Context(), nfInstanceID)
+	if errors.Is(err, ErrNotFound) {
+		writeTokenError(w, http.StatusBadRequest, "invalid_client", "NF instance is not registered")
+		return
+	} else if err != nil {
+		writeTokenError(w, http.StatusInternalServerError, "server_error", "failed to load NF profile")
+		return
+	}
+	if nfType != "" && !strings.EqualFold(nfType, requester.NFType) {
+		writeTokenError(w, http.StatusBadRequest, "invalid_client", "nfType does not match the registered profile")
+		return
+	}
+
+	// The token is only issued when the NFs it is meant for accept the
+	// requester and offer every requested service to it
+	audience := strings.ToUpper(targetNFType)
+	var candidates []NFProfile
+	if targetNFInstanceID != "" {
+		target, err := s.store.GetProfile(r.Context(), targetNFInstanceID)
+		if err != nil {
+			writeTokenError(w, http.StatusBadRequest, "invalid_request", "target NF instance is not registered")
+			return
+		}
+		if targetNFType != "" && !strings.EqualFold(targetNFType, target.NFType) {
+			writeTokenError(w, http.StatusBadRequest, "invalid_request", "targetNfType does not match the target NF instance")
+			return
+		}
+		candidates = []NFProfile{*target}
+		audience = targetNFInstanceID
+	} else {
+		ids, err := s.store.FindNFInstanceIDs(r.Context(), [][]string{{nfTypeIndex(targetNFType)}})
+		if err == nil {
+			candidates, err = s.store.GetProfiles(r.Context(), ids)
+		}
+		if err != nil {
+			writeTokenError(w, http.StatusInternalServerError, "server_error", "failed to load target NF profiles")
+			return
+		}
+	}
+
+	allowed := candidates[:0]
+	for _, candidate := range candidates {
+		if allowsRequester(candidate, requester.NFType) {
+			allowed = append(allowed, candidate)
+		}
+	}
+	if len(allowed) == 0 {
+		writeTokenError(w, http.StatusBadRequest, "unauthorized_client", "no target NF accepts requests from "+requester.NFType)
+		return
+	}
+	for _, service := range strings.Fields(scope) {
+		if !offersService(allowed, service, requester.NFType) {
+			writeTokenError(w, http.StatusBadRequest, "invalid_scope", "no target NF offers "+service+" to "+requester.NFType)
+			return
+		}
+	}
+
+	now := time.Now()
+	claims := AccessTokenClaims{
+		Scope: scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer.config.Issuer,
+			Subject:   nfInstanceID,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.issuer.config.Lifetime)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = s.issuer.keyID
+	signed, err := token.SignedString(s.issuer.key)
+	if err != nil {
+		writeTokenError(w, http.StatusInternalServerError, "server_error", "failed to sign access token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(AccessTokenResponse{
+		AccessToken: signed,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.issuer.config.Lifetime.Seconds()),
+		Scope:       scope,
+	})
+}
+
+// certifiesInstance reports whether the verified client certificate of a
+// TLS connection belongs to an NF instance. Its ID is in a URI SAN as
+// urn:uuid:<id> (TS 33.310 6.1.3c), or in a DNS SAN for NFs identified by
+// their host name.
+func certifiesInstance(state *tls.ConnectionState, nfInstanceID string) bool {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return false
+	}
+	leaf := state.VerifiedChains[0][0]
+	for _, uri := range leaf.URIs {
+		if strings.EqualFold(uri.String(), "urn:uuid:"+nfInstanceID) {
+			return true
+		}
+	}
+	for _, name := range leaf.DNSNames {
+		if strings.EqualFold(name, nfInstanceID) {
+			return true
+		}
+	}
+	return false
+}
+
+// offersService reports whether one of the profiles offers the service to
+// the requester, as discovery would return it
+func offersService(profiles []NFProfile, serviceName, requesterNFType string) bool {
+	query := &DiscoveryQuery{ServiceNames: []string{serviceName}, RequesterNFType: requesterNFType}
+	for _, profile := range profiles {
+		if selectServices(&profile, query) {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenKeys publishes the public key used to verify access tokens as a JWK set
+func (s *Server) TokenKeys(w http.ResponseWriter, r *http.Request) {
+	pub := s.issuer.key.PublicKey
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"crv": "P-256",
+			"alg": "ES256",
+			"use": "sig",
+			"kid": s.issuer.keyID,
+			"x":   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			"y":   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jwks)
+}
+
+func writeTokenError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(AccessTokenError{Error: code, ErrorDescription: description})
+}
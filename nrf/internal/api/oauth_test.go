@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestIssueAccessTokenScope checks that tokens are only issued for the
+// services that the target NFs offer to the requester
+func TestIssueAccessTokenScope(t *testing.T) {
+	store := NewMemoryStore()
+	server, err := NewServer(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ctx := context.Background()
+	profiles := []NFProfile{
+		{NFID: "smf-1", NFType: "SMF", Status: statusRegistered},
+		{NFID: "amf-1", NFType: "AMF", Status: statusRegistered},
+		{NFID: "udm-1", NFType: "UDM", Status: statusRegistered, NFServices: []NFService{
+			{ServiceInstanceID: "sdm", ServiceName: "nudm-sdm"},
+			{ServiceInstanceID: "ueau", ServiceName: "nudm-ueau", AllowedNFTypes: []string{"AUSF"}},
+		}},
+		{NFID: "udr-1", NFType: "UDR", Status: statusRegistered, AllowedNFTypes: []string{"PCF"},
+			ServiceURLs: []string{"http://udr:8080/nudr-dr/v1"}},
+	}
+	for _, profile := range profiles {
+		profile.NFInstanceID = profile.NFID
+		if err := store.PutProfile(ctx, profile, nil); err != nil {
+			t.Fatalf("PutProfile: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+		code   string
+	}{
+		{"offered service", url.Values{"targetNfType": {"UDM"}, "scope": {"nudm-sdm"}}, http.StatusOK, ""},
+		{"offered service of the instance", url.Values{"targetNfInstanceId": {"udm-1"}, "scope": {"nudm-sdm"}}, http.StatusOK, ""},
+		{"service not offered", url.Values{"targetNfType": {"UDM"}, "scope": {"nudm-sdm nudm-uecm"}}, http.StatusBadRequest, "invalid_scope"},
+		{"service of another NF type", url.Values{"targetNfType": {"UDM"}, "scope": {"nudr-dr"}}, http.StatusBadRequest, "invalid_scope"},
+		{"service not allowed to the requester", url.Values{"targetNfType": {"UDM"}, "scope": {"nudm-ueau"}}, http.StatusBadRequest, "invalid_scope"},
+		{"NF type not allowed to the requester", url.Values{"targetNfType": {"UDR"}, "scope": {"nudr-dr"}}, http.StatusBadRequest, "unauthorized_client"},
+		{"instance not allowed to the requester", url.Values{"targetNfInstanceId": {"udr-1"}, "scope": {"nudr-dr"}}, http.StatusBadRequest, "unauthorized_client"},
+		{"instance of another NF type", url.Values{"targetNfType": {"AMF"}, "targetNfInstanceId": {"udm-1"}, "scope": {"nudm-sdm"}}, http.StatusBadRequest, "invalid_request"},
+		{"no NF of the type", url.Values{"targetNfType": {"PCF"}, "scope": {"npcf-smpolicycontrol"}}, http.StatusBadRequest, "unauthorized_client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"grant_type": {"client_credentials"}, "nfInstanceId": {"smf-1"}, "nfType": {"SMF"}}
+			for key, values := range tt.form {
+				form[key] = values
+			}
+			req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.TLS = clientCertificate(&x509.Certificate{DNSNames: []string{"smf-1"}})
+			rec := httptest.NewRecorder()
+			server.IssueAccessToken(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, expected %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.code != "" && !strings.Contains(rec.Body.String(), `"error":"`+tt.code+`"`) {
+				t.Errorf("body %s, expected error %s", rec.Body, tt.code)
+			}
+		})
+	}
+}
+
+// clientCertificate returns the state of a TLS connection on which the
+// client presented a verified certificate
+func clientCertificate(cert *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+// TestIssueAccessTokenClientAuthentication checks that tokens are only
+// issued to clients presenting the certificate of their NF instance
+func TestIssueAccessTokenClientAuthentication(t *testing.T) {
+	instanceURI, _ := url.Parse("urn:uuid:4947a69a-f61b-4bc1-b9da-47c9c5d14b64")
+	tests := []struct {
+		name            string
+		nfInstanceID    string
+		tls             *tls.ConnectionState
+		allowUnverified bool
+		status          int
+	}{
+		{"no certificate", "smf-1", nil, false, http.StatusUnauthorized},
+		{"unverified certificate", "smf-1", &tls.ConnectionState{}, false, http.StatusUnauthorized},
+		{"certificate of another NF", "smf-1", clientCertificate(&x509.Certificate{DNSNames: []string{"amf-1"}}), false, http.StatusUnauthorized},
+		{"instance in a DNS SAN", "smf-1", clientCertificate(&x509.Certificate{DNSNames: []string{"smf-1"}}), false, http.StatusOK},
+		{"instance in a URI SAN", "4947a69a-f61b-4bc1-b9da-47c9c5d14b64", clientCertificate(&x509.Certificate{URIs: []*url.URL{instanceURI}}), false, http.StatusOK},
+		{"unauthenticated clients allowed", "smf-1", nil, true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			cfg := DefaultConfig()
+			cfg.Token.AllowUnauthenticatedClients = tt.allowUnverified
+			server, err := NewServer(store, cfg)
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			ctx := context.Background()
+			for _, profile := range []NFProfile{
+				{NFID: tt.nfInstanceID, NFType: "SMF", Status: statusRegistered},
+				{NFID: "udm-1", NFType: "UDM", Status: statusRegistered, NFServices: []NFService{
+					{ServiceInstanceID: "sdm", ServiceName: "nudm-sdm"},
+				}},
+			} {
+				profile.NFInstanceID = profile.NFID
+				if err := store.PutProfile(ctx, profile, nil); err != nil {
+					t.Fatalf("PutProfile: %v", err)
+				}
+			}
+
+			form := url.Values{"grant_type": {"client_credentials"}, "nfInstanceId": {tt.nfInstanceID}, "nfType": {"SMF"},
+				"targetNfType": {"UDM"}, "scope": {"nudm-sdm"}}
+			req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.TLS = tt.tls
+			rec := httptest.NewRecorder()
+			server.IssueAccessToken(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, expected %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusUnauthorized && !strings.Contains(rec.Body.String(), `"error":"invalid_client"`) {
+				t.Errorf("body %s, expected error invalid_client", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	// errPreconditionFailed is returned when If-Match does not match the stored profile
+	errPreconditionFailed = errors.New("the NF profile was modified by another request")
+	// errInvalidPatch is returned when a JSON Patch cannot be applied to a profile
+	errInvalidPatch = errors.New("invalid patch")
+)
+
+// maxProfileUpdateAttempts bounds the retries of an update that keeps
+// conflicting with concurrent writers
+const maxProfileUpdateAttempts = 5
+
+// profileETag returns the entity tag of a profile, derived from its content
+func profileETag(profile NFProfile) string {
+	data, _ := json.Marshal(profile)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// sameProfileVersion reports whether two versions of a profile are identical;
+// nil stands for an unregistered NF
+func sameProfileVersion(a, b *NFProfile) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return profileETag(*a) == profileETag(*b)
+}
+
+// checkIfMatch evaluates the If-Match header of a request against the
+// stored profile, or nil when the NF is not registered (RFC 9110 section 13.1.1)
+func checkIfMatch(r *http.Request, current *NFProfile) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	if current == nil {
+		return errPreconditionFailed
+	}
+	if strings.TrimSpace(header) == "*" {
+		return nil
+	}
+
+	etag := profileETag(*current)
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return nil
+		}
+	}
+	return errPreconditionFailed
+}
+
+// matchesIfNoneMatch reports whether the If-None-Match header of a request
+// lists the entity tag, using the weak comparison of RFC 9110 section 13.1.2
+func matchesIfNoneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// readJSONPatch reads the JSON Patch carried by a PATCH request. An empty
+// body is an empty patch. On error it also returns the HTTP status to use.
+func readJSONPatch(r *http.Request) ([]PatchItem, int, error) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		// application/json is accepted from clients that predate JSON Patch support
+		if err != nil || (mediaType != "application/json-patch+json" && mediaType != "application/json") {
+			return nil, http.StatusUnsupportedMediaType, fmt.Errorf("expected application/json-patch+json")
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("failed to read request body")
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, 0, nil
+	}
+
+	var patch []PatchItem
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid JSON Patch document: %v", err)
+	}
+	return patch, 0, nil
+}
+
+// decodeProfile decodes a profile, rejecting unknown fields and values of the wrong type
+func decodeProfile(data []byte) (*NFProfile, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var profile NFProfile
+	if err := decoder.Decode(&profile); err != nil {
+		return nil, fmt.Errorf("invalid NF profile: %w", err)
+	}
+	return &profile, nil
+}
+
+// nfTypes are the NF types an NF may register as (TS 29.510 NFType)
+var nfTypes = map[string]bool{
+	"NRF": true, "UDM": true, "AMF": true, "SMF": true, "AUSF": true, "NEF": true,
+	"PCF": true, "SMSF": true, "NSSF": true, "UDR": true, "LMF": true, "GMLC": true,
+	"5G_EIR": true, "SEPP": true, "UPF": true, "N3IWF": true, "AF": true, "UDSF": true,
+	"BSF": true, "CHF": true, "NWDAF": true, "PCSCF": true, "CBCF": true, "HSS": true,
+	"UCMF": true, "SOR_AF": true, "SPAF": true, "MME": true, "SCSAS": true, "SCEF": true,
+	"SCP": true, "NSSAAF": true, "ICSCF": true, "SCSCF": true, "DRA": true, "IMS_AS": true,
+	"AANF": true, "5G_DDNMF": true, "NSACF": true, "MFAF": true, "EASDF": true, "DCCF": true,
+	"MB_SMF": true, "TSCTSF": true, "ADRF": true, "GBA_BSF": true, "CEF": true, "MB_UPF": true,
+}
+
+var (
+	mccPattern = regexp.MustCompile(`^[0-9]{3}$`)
+	mncPattern = regexp.MustCompile(`^[0-9]{2,3}$`)
+)
+
+// validateProfile checks a profile received for registration or produced by
+// a patch. The NF type is normalized to upper case.
+func validateProfile(profile *NFProfile) error {
+	if profile.NFID == "" {
+		return fmt.Errorf("nf_id is required")
+	}
+
+	profile.NFType = strings.ToUpper(profile.NFType)
+	if profile.NFType == "" {
+		return fmt.Errorf("nf_type is required")
+	}
+	if !nfTypes[profile.NFType] {
+		return fmt.Errorf("unknown nf_type %q", profile.NFType)
+	}
+
+	switch profile.Status {
+	case "":
+		return fmt.Errorf("status is required")
+	case statusRegistered, statusSuspended, statusUndiscoverable:
+	default:
+		return fmt.Errorf("status must be one of %s, %s or %s", statusRegistered, statusSuspended, statusUndiscoverable)
+	}
+
+	if len(profile.IPAddresses) == 0 && profile.FQDN == "" {
+		return fmt.Errorf("at least one of ip_addresses or fqdn is required")
+	}
+	for _, address := range profile.IPAddresses {
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("invalid IP address %q", address)
+		}
+	}
+
+	if len(profile.PLMNID) > 0 {
+		if err := validatePLMN(profile.PLMNID); err != nil {
+			return fmt.Errorf("plmn_id: %w", err)
+		}
+	}
+	for i, tai := range profile.TAIs {
+		if tai.PLMNID == nil {
+			continue
+		}
+		if err := validatePLMN(tai.PLMNID); err != nil {
+			return fmt.Errorf("tais[%d].plmn_id: %w", i, err)
+		}
+	}
+
+	if profile.HeartbeatTimer < 0 {
+		return fmt.Errorf("heartbeat_timer must not be negative")
+	}
+	return validateNFServices(profile)
+}
+
+// validatePLMN checks a PLMN ID made of a 3 digit MCC and a 2 or 3 digit MNC
+func validatePLMN(plmn map[string]string) error {
+	if !mccPattern.MatchString(plmn["mcc"]) {
+		return fmt.Errorf("mcc must be 3 digits, got %q", plmn["mcc"])
+	}
+	if !mncPattern.MatchString(plmn["mnc"]) {
+		return fmt.Errorf("mnc must be 2 or 3 digits, got %q", plmn["mnc"])
+	}
+	return nil
+}
+
+// patchProfile applies a JSON Patch to a profile and validates the result
+func patchProfile(profile NFProfile, patch []PatchItem) (*NFProfile, error) {
+	document, err := json.Marshal(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profile: %w", err)
+	}
+	patched, err := applyJSONPatch(document, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := decodeProfile(patched)
+	if err != nil {
+		return nil, err
+	}
+	if updated.NFID != profile.NFID {
+		return nil, fmt.Errorf("nf_id cannot be changed")
+	}
+	if err := validateProfile(updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// updateProfile saves the profile built by change from the stored one, which
+// is nil when the NF is not registered. If another request changes the
+// profile in between, change is called again with the new stored version.
+func (s *Server) updateProfile(ctx context.Context, nfInstanceID string, change func(current *NFProfile) (*NFProfile, error)) (updated, previous *NFProfile, err error) {
+	for attempt := 0; attempt < maxProfileUpdateAttempts; attempt++ {
+		current, err := s.store.GetProfile(ctx, nfInstanceID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, nil, err
+		}
+
+		updated, err := change(current)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = s.store.PutProfile(ctx, *updated, current)
+		if errors.Is(err, ErrConflict) {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		return updated, current, nil
+	}
+	return nil, nil, ErrConflict
+}
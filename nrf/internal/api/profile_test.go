@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// racingStore lets another writer save a profile right before each of the
+// first races saves of the store it wraps
+type racingStore struct {
+	*MemoryStore
+	races int
+	race  func(ctx context.Context, store *MemoryStore)
+	puts  int
+}
+
+func (s *racingStore) PutProfile(ctx context.Context, profile NFProfile, previous *NFProfile) error {
+	s.puts++
+	if s.puts <= s.races {
+		s.race(ctx, s.MemoryStore)
+	}
+	return s.MemoryStore.PutProfile(ctx, profile, previous)
+}
+
+// testProfile returns the profile of a registered AMF
+func testProfile() NFProfile {
+	return NFProfile{NFID: "amf-1", NFInstanceID: "amf-1", NFType: "AMF", Status: statusRegistered,
+		IPAddresses: []string{"10.0.0.1"}, HeartbeatTimer: 10}
+}
+
+// TestProfileIfMatch checks that registrations and updates carrying
+// If-Match only apply to the version of the profile they name
+func TestProfileIfMatch(t *testing.T) {
+	registered := testProfile()
+	etag := profileETag(registered)
+	profile, _ := json.Marshal(registered)
+	patch := `[{"op": "add", "path": "/locality", "value": "rack-2"}]`
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		ifMatch    string
+		registered bool
+		status     int
+	}{
+		{"replace current version", http.MethodPut, string(profile), etag, true, http.StatusOK},
+		{"replace stale version", http.MethodPut, string(profile), `"stale"`, true, http.StatusPreconditionFailed},
+		{"replace any version", http.MethodPut, string(profile), "*", true, http.StatusOK},
+		{"replace one of several versions", http.MethodPut, string(profile), `"stale", ` + etag, true, http.StatusOK},
+		{"replace unregistered NF", http.MethodPut, string(profile), "*", false, http.StatusPreconditionFailed},
+		{"register without If-Match", http.MethodPut, string(profile), "", false, http.StatusCreated},
+		{"patch current version", http.MethodPatch, patch, etag, true, http.StatusOK},
+		{"patch stale version", http.MethodPatch, patch, `"stale"`, true, http.StatusPreconditionFailed},
+		{"heartbeat of stale version", http.MethodPatch, "", `"stale"`, true, http.StatusPreconditionFailed},
+		{"heartbeat without If-Match", http.MethodPatch, "", "", true, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			server, err := NewServer(store, DefaultConfig())
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			ctx := context.Background()
+			if tt.registered {
+				if err := store.PutProfile(ctx, registered, nil); err != nil {
+					t.Fatalf("PutProfile: %v", err)
+				}
+			}
+
+			req := httptest.NewRequest(tt.method, "/nnrf-nfm/v1/nf-instances/amf-1", strings.NewReader(tt.body))
+			if tt.method == http.MethodPatch && tt.body != "" {
+				req.Header.Set("Content-Type", "application/json-patch+json")
+			}
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			server.SetupRouter().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, expected %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			stored, _ := store.GetProfile(ctx, "amf-1")
+			if rec.Code == http.StatusPreconditionFailed {
+				if tt.registered && stored.Locality != "" {
+					t.Errorf("profile updated despite the failed precondition")
+				}
+				return
+			}
+			if got := rec.Header().Get("ETag"); got != profileETag(*stored) {
+				t.Errorf("ETag %s, expected the one of the stored profile %s", got, profileETag(*stored))
+			}
+		})
+	}
+}
+
+// TestUpdateProfileConflicts checks that an update racing with another
+// writer is redone on the profile that writer saved
+func TestUpdateProfileConflicts(t *testing.T) {
+	registered := testProfile()
+	concurrentWrite := func(ctx context.Context, store *MemoryStore) {
+		current, err := store.GetProfile(ctx, "amf-1")
+		if err != nil {
+			t.Fatalf("GetProfile: %v", err)
+		}
+		updated := *current
+		load := 0
+		if current.Load != nil {
+			load = *current.Load
+		}
+		load += 10
+		updated.Load = &load
+		if err := store.PutProfile(ctx, updated, current); err != nil {
+			t.Fatalf("PutProfile: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		races   int
+		ifMatch string
+		status  int
+		puts    int
+	}{
+		{"no race", 0, "", http.StatusOK, 1},
+		{"one race", 1, "", http.StatusOK, 2},
+		{"race with If-Match", 1, profileETag(registered), http.StatusPreconditionFailed, 1},
+		{"racing on every attempt", maxProfileUpdateAttempts, "", http.StatusInternalServerError, maxProfileUpdateAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &racingStore{MemoryStore: NewMemoryStore(), races: tt.races, race: concurrentWrite}
+			server, err := NewServer(store, DefaultConfig())
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			ctx := context.Background()
+			if err := store.MemoryStore.PutProfile(ctx, registered, nil); err != nil {
+				t.Fatalf("PutProfile: %v", err)
+			}
+
+			patch := `[{"op": "add", "path": "/locality", "value": "rack-2"}]`
+			req := httptest.NewRequest(http.MethodPatch, "/nnrf-nfm/v1/nf-instances/amf-1", strings.NewReader(patch))
+			req.Header.Set("Content-Type", "application/json-patch+json")
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			server.SetupRouter().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, expected %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if store.puts != tt.puts {
+				t.Errorf("%d attempts to save the profile, expected %d", store.puts, tt.puts)
+			}
+			stored, _ := store.GetProfile(ctx, "amf-1")
+			if (stored.Locality == "rack-2") != (tt.status == http.StatusOK) {
+				t.Errorf("locality %q after status %d", stored.Locality, rec.Code)
+			}
+			// The concurrent writes are kept
+			if tt.races > 0 && (stored.Load == nil || *stored.Load != 10*tt.races) {
+				t.Errorf("load %v, expected the concurrent writes to be kept", stored.Load)
+			}
+		})
+	}
+}
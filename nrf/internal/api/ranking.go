@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+const (
+	// Ranking defaults for profiles and services that do not advertise a value.
+	// A lower priority value is preferred, as in TS 29.510.
+	defaultPriority = 65535
+	defaultCapacity = 100
+
+	// defaultMaxPayloadSize and maxPayloadSize bound the discovery response
+	// body in kilo-octets (TS 29.510 max-payload-size)
+	defaultMaxPayloadSize = 124
+	maxPayloadSize        = 2000
+)
+
+// validateRanking checks the priority, capacity and load advertised by an NF or service
+func validateRanking(priority, capacity, load *int) error {
+	if priority != nil && (*priority < 0 || *priority > 65535) {
+		return fmt.Errorf("priority must be between 0 and 65535")
+	}
+	if capacity != nil && (*capacity < 0 || *capacity > 65535) {
+		return fmt.Errorf("capacity must be between 0 and 65535")
+	}
+	if load != nil && (*load < 0 || *load > 100) {
+		return fmt.Errorf("load must be between 0 and 100")
+	}
+	return nil
+}
+
+// rankingAttributes returns the priority, capacity and load used to rank a
+// discovered profile. The values of its preferred selected service, if any,
+// take precedence over those of the profile.
+func rankingAttributes(profile NFProfile) (priority, capacity, load int) {
+	priority, capacity, load = defaultPriority, defaultCapacity, 0
+	if profile.Priority != nil {
+		priority = *profile.Priority
+	}
+	if profile.Capacity != nil {
+		capacity = *profile.Capacity
+	}
+	if profile.Load != nil {
+		load = *profile.Load
+	}
+
+	if len(profile.NFServices) > 0 {
+		service := profile.NFServices[0]
+		if service.Priority != nil {
+			priority = *service.Priority
+		}
+		if service.Capacity != nil {
+			capacity = *service.Capacity
+		}
+		if service.Load != nil {
+			load = *service.Load
+		}
+	}
+	return priority, capacity, load
+}
+
+// rankingWeight is the share of requests an NF should receive among NFs of
+// the same priority: its capacity, reduced by its current load
+func rankingWeight(capacity, load int) float64 {
+	if load > 100 {
+		load = 100
+	}
+	return float64(capacity) * float64(100-load) / 100
+}
+
+// rankProfiles orders the profiles by priority and, within a priority, by a
+// random draw weighted by capacity and load, so that consumers picking the
+// first result spread their requests across equivalent NFs
+func rankProfiles(profiles []NFProfile) {
+	for i := range profiles {
+		sortServices(profiles[i].NFServices)
+	}
+
+	type ranked struct {
+		priority int
+		key      float64
+	}
+	keys := make(map[string]ranked, len(profiles))
+	for _, profile := range profiles {
+		priority, capacity, load := rankingAttributes(profile)
+		keys[profile.NFID] = ranked{priority: priority, key: weightedKey(rankingWeight(capacity, load))}
+	}
+
+	sort.SliceStable(profiles, func(i, j int) bool {
+		a, b := keys[profiles[i].NFID], keys[profiles[j].NFID]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		return a.key > b.key
+	})
+}
+
+// sortServices orders the services of a profile by priority, preferred first
+func sortServices(services []NFService) {
+	sort.SliceStable(services, func(i, j int) bool {
+		return servicePriority(services[i]) < servicePriority(services[j])
+	})
+}
+
+func servicePriority(service NFService) int {
+	if service.Priority == nil {
+		return defaultPriority
+	}
+	return *service.Priority
+}
+
+// weightedKey draws a sort key for weighted random ordering (Efraimidis and
+// Spirakis): sorting by descending key picks items in proportion to weight
+func weightedKey(weight float64) float64 {
+	if weight <= 0 {
+		return 0
+	}
+	return math.Pow(rand.Float64(), 1/weight)
+}
+
+// limitResults applies the limit and max-payload-size discovery parameters
+func limitResults(profiles []NFProfile, limit, maxPayloadKB int) []NFProfile {
+	if limit > 0 && len(profiles) > limit {
+		profiles = profiles[:limit]
+	}
+
+	budget := maxPayloadKB * 1000
+	size := len(`{"validityPeriod":86400,"nfInstances":[]}`) // SearchResult around the profiles
+	for i, profile := range profiles {
+		data, err := json.Marshal(profile)
+		if err != nil {
+			return profiles[:i]
+		}
+		size += len(data)
+		if i > 0 {
+			size++ // Separating comma
+		}
+		if size > budget {
+			return profiles[:i]
+		}
+	}
+	return profiles
+}
+
+// parseLimits reads the limit and max-payload-size discovery parameters
+func parseLimits(query *DiscoveryQuery, limit, maxPayload string) error {
+	query.MaxPayloadSize = defaultMaxPayloadSize
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid limit %q", limit)
+		}
+		query.Limit = n
+	}
+	if maxPayload != "" {
+		n, err := strconv.Atoi(maxPayload)
+		if err != nil || n < 1 || n > maxPayloadSize {
+			return fmt.Errorf("invalid max-payload-size %q, expected 1 to %d", maxPayload, maxPayloadSize)
+		}
+		query.MaxPayloadSize = n
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func ranking(value int) *int { return &value }
+
+// TestDiscoveryPriority checks that discovery results come by priority, and
+// that the priority of the preferred service overrides the one of its NF
+func TestDiscoveryPriority(t *testing.T) {
+	router := newTestRouter(t, DefaultConfig())
+	profiles := []NFProfile{
+		{NFID: "smf-1", Priority: ranking(3)},
+		{NFID: "smf-2", Priority: ranking(1)},
+		{NFID: "smf-3", Locality: "east"},
+		{NFID: "smf-4", Priority: ranking(5), NFServices: []NFService{
+			{ServiceInstanceID: "pdu-backup", ServiceName: "nsmf-pdusession", Priority: ranking(9)},
+			{ServiceInstanceID: "pdu", ServiceName: "nsmf-pdusession", Priority: ranking(2)},
+		}},
+	}
+	for _, profile := range profiles {
+		profile.NFType, profile.Status, profile.IPAddresses = "SMF", statusRegistered, []string{"10.0.0.1"}
+		register(t, router, profile)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"by priority", "target-nf-type=SMF", []string{"smf-2", "smf-4", "smf-1", "smf-3"}},
+		{"preferred locality of a low priority NF", "target-nf-type=SMF&preferred-locality=east", []string{"smf-3", "smf-2", "smf-4", "smf-1"}},
+		{"limited", "target-nf-type=SMF&limit=2", []string{"smf-2", "smf-4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ids := discover(t, router, tt.query); !slices.Equal(ids, tt.expected) {
+				t.Errorf("discovered %v, expected %v", ids, tt.expected)
+			}
+		})
+	}
+}
+
+// TestDiscoveryPreferredLocality checks that the NFs of the preferred
+// locality come first, by priority among them
+func TestDiscoveryPreferredLocality(t *testing.T) {
+	router := newTestRouter(t, DefaultConfig())
+	for _, profile := range []NFProfile{
+		{NFID: "smf-1", Priority: ranking(1), Locality: "west"},
+		{NFID: "smf-2", Priority: ranking(3), Locality: "east"},
+		{NFID: "smf-3", Priority: ranking(2), Locality: "east"},
+	} {
+		profile.NFType, profile.Status, profile.IPAddresses = "SMF", statusRegistered, []string{"10.0.0.1"}
+		register(t, router, profile)
+	}
+	expected := []string{"smf-3", "smf-2", "smf-1"}
+	if ids := discover(t, router, "target-nf-type=SMF&preferred-locality=east"); !slices.Equal(ids, expected) {
+		t.Errorf("discovered %v, expected %v", ids, expected)
+	}
+}
+
+// TestDiscoveryServiceOrder checks that the services of a discovered NF come
+// by priority
+func TestDiscoveryServiceOrder(t *testing.T) {
+	router := newTestRouter(t, DefaultConfig())
+	register(t, router, NFProfile{NFID: "smf-1", NFType: "SMF", Status: statusRegistered, IPAddresses: []string{"10.0.0.1"},
+		NFServices: []NFService{
+			{ServiceInstanceID: "a", ServiceName: "nsmf-pdusession"},
+			{ServiceInstanceID: "b", ServiceName: "nsmf-pdusession", Priority: ranking(7)},
+			{ServiceInstanceID: "c", ServiceName: "nsmf-event-exposure", Priority: ranking(1)},
+		}})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nfs?target-nf-type=SMF", nil))
+	var result SearchResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil || len(result.NFInstances) != 1 {
+		t.Fatalf("discovered %+v: %v", result, err)
+	}
+	var ids []string
+	for _, service := range result.NFInstances[0].NFServices {
+		ids = append(ids, service.ServiceInstanceID)
+	}
+	if expected := []string{"c", "b", "a"}; !slices.Equal(ids, expected) {
+		t.Errorf("services %v, expected %v", ids, expected)
+	}
+}
+
+// TestDiscoveryLoadBalancing checks that NFs of the same priority come first
+// in proportion to their capacity left by their load
+func TestDiscoveryLoadBalancing(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles []NFProfile
+		share    float64 // expected share of the discoveries smf-1 comes first in
+	}{
+		{"equal capacities", []NFProfile{{NFID: "smf-1"}, {NFID: "smf-2"}}, 0.5},
+		{"capacity three times larger", []NFProfile{{NFID: "smf-1", Capacity: ranking(300)}, {NFID: "smf-2", Capacity: ranking(100)}}, 0.75},
+		{"capacity taken by load", []NFProfile{{NFID: "smf-1", Capacity: ranking(300), Load: ranking(50)}, {NFID: "smf-2", Capacity: ranking(100)}}, 0.6},
+		{"service capacity", []NFProfile{
+			{NFID: "smf-1", Capacity: ranking(100), NFServices: []NFService{{ServiceInstanceID: "pdu", ServiceName: "nsmf-pdusession", Capacity: ranking(400)}}},
+			{NFID: "smf-2", Capacity: ranking(100)}}, 0.8},
+		{"fully loaded", []NFProfile{{NFID: "smf-1", Load: ranking(100)}, {NFID: "smf-2", Load: ranking(99)}}, 0},
+		{"no capacity", []NFProfile{{NFID: "smf-1", Capacity: ranking(0)}, {NFID: "smf-2"}}, 0},
+	}
+	const discoveries = 2000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, DefaultConfig())
+			for _, profile := range tt.profiles {
+				profile.NFType, profile.Status, profile.IPAddresses = "SMF", statusRegistered, []string{"10.0.0.1"}
+				register(t, router, profile)
+			}
+
+			first := 0
+			for i := 0; i < discoveries; i++ {
+				if ids := discover(t, router, "target-nf-type=SMF"); ids[0] == "smf-1" {
+					first++
+				}
+			}
+			if share := float64(first) / discoveries; share < tt.share-0.05 || share > tt.share+0.05 {
+				t.Errorf("smf-1 first in %.2f of the discoveries, expected %.2f", share, tt.share)
+			}
+		})
+	}
+}
+
+// TestRankingValidation checks that out of range ranking attributes are
+// refused at registration
+func TestRankingValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile NFProfile
+		status  int
+	}{
+		{"in range", NFProfile{Priority: ranking(65535), Capacity: ranking(0), Load: ranking(100)}, http.StatusCreated},
+		{"negative priority", NFProfile{Priority: ranking(-1)}, http.StatusBadRequest},
+		{"capacity too large", NFProfile{Capacity: ranking(65536)}, http.StatusBadRequest},
+		{"load over 100", NFProfile{Load: ranking(101)}, http.StatusBadRequest},
+		{"service load over 100", NFProfile{NFServices: []NFService{{ServiceInstanceID: "pdu", ServiceName: "nsmf-pdusession", Load: ranking(101)}}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, DefaultConfig())
+			profile := tt.profile
+			profile.NFID, profile.NFType, profile.Status, profile.IPAddresses = "smf-1", "SMF", statusRegistered, []string{"10.0.0.1"}
+			body, _ := json.Marshal(profile)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/nnrf-nfm/v1/nf-instances/smf-1", strings.NewReader(string(body))))
+			if rec.Code != tt.status {
+				t.Errorf("status %d, expected %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+// TestDiscoveryPayloadSize checks that the results are cut to the
+// max-payload-size, best ranked first
+func TestDiscoveryPayloadSize(t *testing.T) {
+	router := newTestRouter(t, DefaultConfig())
+	padding := map[string]string{"padding": strings.Repeat("x", 150)}
+	for i, id := range []string{"smf-1", "smf-2", "smf-3"} {
+		register(t, router, NFProfile{NFID: id, NFType: "SMF", Status: statusRegistered, IPAddresses: []string{"10.0.0.1"},
+			Priority: ranking(i), AdditionalInfo: padding})
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"target-nf-type=SMF", []string{"smf-1", "smf-2", "smf-3"}},
+		{"target-nf-type=SMF&max-payload-size=1", []string{"smf-1", "smf-2"}},
+		{"target-nf-type=SMF&max-payload-size=1&limit=1", []string{"smf-1"}},
+	}
+	for _, tt := range tests {
+		if ids := discover(t, router, tt.query); !slices.Equal(ids, tt.expected) {
+			t.Errorf("%s: discovered %v, expected %v", tt.query, ids, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"time"
+)
+
+// NF status notification events (TS 29.510 NotificationEventType)
+const (
+	NFRegistered     = "NF_REGISTERED"
+	NFDeregistered   = "NF_DEREGISTERED"
+	NFProfileChanged = "NF_PROFILE_CHANGED"
+)
+
+const (
+	statusRegistered     = "REGISTERED"
+	statusSuspended      = "SUSPENDED"
+	statusUndiscoverable = "UNDISCOVERABLE"
+
+	// defaultHeartbeatTimer is used for profiles registered without a timer
+	defaultHeartbeatTimer = 60
+)
+
+// ReaperConfig controls how the NRF handles NFs that stop sending heartbeats
+type ReaperConfig struct {
+	Interval        time.Duration // How often expired heartbeats are checked
+	Grace           time.Duration // Allowed delay on top of the NF heartbeat timer
+	DeregisterAfter time.Duration // How long a suspended NF is kept before removal
+}
+
+// DefaultReaperConfig returns the reaper settings used when none are configured
+func DefaultReaperConfig() ReaperConfig {
+	return ReaperConfig{
+		Interval:        5 * time.Second,
+		Grace:           10 * time.Second,
+		DeregisterAfter: 5 * time.Minute,
+	}
+}
+
+// StartHeartbeatReaper periodically suspends NFs whose heartbeat timer has
+// lapsed and deregisters those that stay suspended. It blocks until runCtx is done.
+func (s *Server) StartHeartbeatReaper(runCtx context.Context) {
+	cfg := s.config.Reaper
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	log.Printf("Heartbeat reaper started (interval %v, grace %v, deregister after %v)",
+		cfg.Interval, cfg.Grace, cfg.DeregisterAfter)
+	for {
+		select {
+		case <-runCtx.Done():
+			log.Println("Heartbeat reaper stopped")
+			return
+		case now := <-ticker.C:
+			s.reapExpiredHeartbeats(runCtx, now)
+		}
+	}
+}
+
+// reapExpiredHeartbeats acts on every NF whose deadline is before now
+func (s *Server) reapExpiredHeartbeats(ctx context.Context, now time.Time) {
+	nfIDs, err := s.store.ExpiredHeartbeats(ctx, now)
+	if err != nil {
+		log.Printf("Failed to read heartbeat deadlines: %v", err)
+		return
+	}
+
+	for _, nfID := range nfIDs {
+		// Only one NRF process sharing the store can claim a given deadline,
+		// and a heartbeat received in the meantime keeps the NF in service
+		claimed, err := s.store.ClaimHeartbeatDeadline(ctx, nfID, now)
+		if err != nil {
+			log.Printf("Failed to claim heartbeat deadline of %s: %v", nfID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		profile, err := s.store.GetProfile(ctx, nfID)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				log.Printf("Failed to load profile %s: %v", nfID, err)
+				s.retryHeartbeatDeadline(ctx, nfID, now)
+			}
+			continue
+		}
+
+		if isReaperSuspended(*profile) {
+			s.deregisterExpiredNF(ctx, *profile, now)
+		} else {
+			s.suspendExpiredNF(ctx, *profile, now)
+		}
+	}
+}
+
+// suspendExpiredNF marks the NF as SUSPENDED and schedules its removal
+func (s *Server) suspendExpiredNF(ctx context.Context, profile NFProfile, now time.Time) {
+	// previous must keep the stored version for PutProfile to compare
+	previous := profile
+	profile.AdditionalInfo = maps.Clone(profile.AdditionalInfo)
+	if profile.AdditionalInfo == nil {
+		profile.AdditionalInfo = make(map[string]string)
+	}
+	profile.AdditionalInfo["status_before_suspension"] = profile.Status
+	profile.AdditionalInfo["suspended_at"] = now.UTC().Format(time.RFC3339)
+	profile.Status = statusSuspended
+
+	err := s.store.PutProfile(ctx, profile, &previous)
+	if errors.Is(err, ErrConflict) {
+		// The NF sent a heartbeat or was updated after its deadline was
+		// claimed, which gives it a new deadline
+		if err := s.scheduleHeartbeatExpiry(ctx, previous); err != nil {
+			log.Printf("Failed to schedule heartbeat expiry for %s: %v", profile.NFID, err)
+		}
+		return
+	} else if err != nil {
+		log.Printf("Failed to suspend NF %s: %v", profile.NFID, err)
+		s.retryHeartbeatDeadline(ctx, profile.NFID, now)
+		return
+	}
+
+	if err := s.store.SetHeartbeatDeadline(ctx, profile.NFID, now.Add(s.config.Reaper.DeregisterAfter)); err != nil {
+		log.Printf("Failed to schedule removal of NF %s: %v", profile.NFID, err)
+	}
+
+	log.Printf("NF %s (%s) missed its heartbeat and was suspended", profile.NFID, profile.NFType)
+	s.notifyNFStatus(ctx, NFProfileChanged, profile)
+	s.publishEvent(ctx, NFSuspended, profile)
+}
+
+// deregisterExpiredNF removes an NF that stayed suspended for too long
+func (s *Server) deregisterExpiredNF(ctx context.Context, profile NFProfile, now time.Time) {
+	if err := s.store.DeleteProfile(ctx, profile); err != nil {
+		log.Printf("Failed to deregister NF %s: %v", profile.NFID, err)
+		s.retryHeartbeatDeadline(ctx, profile.NFID, now)
+		return
+	}
+
+	log.Printf("NF %s (%s) stayed suspended and was deregistered", profile.NFID, profile.NFType)
+	s.notifyNFStatus(ctx, NFDeregistered, profile)
+	s.publishEvent(ctx, NFDeregistered, profile)
+}
+
+// retryHeartbeatDeadline puts back a claimed deadline that could not be
+// acted on, for the reaper to try again
+func (s *Server) retryHeartbeatDeadline(ctx context.Context, nfID string, deadline time.Time) {
+	if err := s.store.SetHeartbeatDeadline(ctx, nfID, deadline); err != nil {
+		log.Printf("Failed to restore heartbeat deadline of %s: %v", nfID, err)
+	}
+}
+
+// scheduleHeartbeatExpiry sets the deadline by which the NF must send its next heartbeat
+func (s *Server) scheduleHeartbeatExpiry(ctx context.Context, profile NFProfile) error {
+	timer := time.Duration(heartbeatTimer(profile)) * time.Second
+	return s.store.SetHeartbeatDeadline(ctx, profile.NFID, time.Now().Add(timer+s.config.Reaper.Grace))
+}
+
+// heartbeatTimer returns the heartbeat timer of a profile in seconds
+func heartbeatTimer(profile NFProfile) int {
+	if profile.HeartbeatTimer <= 0 {
+		return defaultHeartbeatTimer
+	}
+	return profile.HeartbeatTimer
+}
+
+// resumeIfSuspended restores the status of an NF suspended by the reaper
+func resumeIfSuspended(profile *NFProfile) bool {
+	if !isReaperSuspended(*profile) {
+		return false
+	}
+
+	profile.Status = profile.AdditionalInfo["status_before_suspension"]
+	if profile.Status == "" || profile.Status == statusSuspended {
+		profile.Status = statusRegistered
+	}
+	delete(profile.AdditionalInfo, "status_before_suspension")
+	delete(profile.AdditionalInfo, "suspended_at")
+	return true
+}
+
+// isReaperSuspended reports whether the NF was suspended for missing heartbeats
+func isReaperSuspended(profile NFProfile) bool {
+	if profile.Status != statusSuspended {
+		return false
+	}
+	_, ok := profile.AdditionalInfo["suspended_at"]
+	return ok
+}
+
+// isDiscoverable reports whether the NF may be returned by discovery
+func isDiscoverable(profile NFProfile) bool {
+	return profile.Status != statusSuspended && profile.Status != statusUndiscoverable
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestReaperSuspendsThenEvicts checks that an NF that stops sending
+// heartbeats is suspended once its heartbeat timer lapses, then removed
+// when it stays suspended
+func TestReaperSuspendsThenEvicts(t *testing.T) {
+	store := NewMemoryStore()
+	server, err := NewServer(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	cfg := server.config.Reaper
+
+	ctx := context.Background()
+	profile := NFProfile{
+		NFID:           "amf-1",
+		NFInstanceID:   "amf-1",
+		NFType:         "AMF",
+		Status:         statusRegistered,
+		HeartbeatTimer: 10,
+		AdditionalInfo: map[string]string{"last_heartbeat": time.Now().UTC().Format(time.RFC3339)},
+	}
+	if err := store.PutProfile(ctx, profile, nil); err != nil {
+		t.Fatalf("PutProfile: %v", err)
+	}
+	if err := server.scheduleHeartbeatExpiry(ctx, profile); err != nil {
+		t.Fatalf("scheduleHeartbeatExpiry: %v", err)
+	}
+	expiry := time.Now().Add(10*time.Second + cfg.Grace)
+
+	// Still within its heartbeat timer
+	server.reapExpiredHeartbeats(ctx, expiry.Add(-time.Second))
+	if stored, err := store.GetProfile(ctx, profile.NFID); err != nil || stored.Status != statusRegistered {
+		t.Fatalf("NF within its heartbeat timer: %+v, %v", stored, err)
+	}
+
+	suspendedAt := expiry.Add(time.Second)
+	server.reapExpiredHeartbeats(ctx, suspendedAt)
+	stored, err := store.GetProfile(ctx, profile.NFID)
+	if err != nil {
+		t.Fatalf("GetProfile after expiry: %v", err)
+	}
+	if stored.Status != statusSuspended || !isReaperSuspended(*stored) {
+		t.Fatalf("NF not suspended after its heartbeat timer lapsed: %+v", stored)
+	}
+	if stored.AdditionalInfo["status_before_suspension"] != statusRegistered {
+		t.Errorf("status_before_suspension %q, expected %s", stored.AdditionalInfo["status_before_suspension"], statusRegistered)
+	}
+	if ids, _ := store.FindNFInstanceIDs(ctx, [][]string{{nfTypeIndex("AMF")}}); len(ids) != 1 {
+		t.Errorf("suspended NF not indexed: %v", ids)
+	}
+
+	// Kept while suspended for less than DeregisterAfter
+	server.reapExpiredHeartbeats(ctx, suspendedAt.Add(cfg.DeregisterAfter-time.Second))
+	if _, err := store.GetProfile(ctx, profile.NFID); err != nil {
+		t.Fatalf("suspended NF removed early: %v", err)
+	}
+
+	server.reapExpiredHeartbeats(ctx, suspendedAt.Add(cfg.DeregisterAfter+time.Second))
+	if _, err := store.GetProfile(ctx, profile.NFID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("NF not removed after staying suspended: %v", err)
+	}
+	if ids, _ := store.ExpiredHeartbeats(ctx, suspendedAt.Add(24*time.Hour)); len(ids) != 0 {
+		t.Errorf("heartbeat deadlines left after removal: %v", ids)
+	}
+}
@@ -0,0 +1,557 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys of the NRF state
+const (
+	profileKeyPrefix      = "nrf:nf-instance:"
+	indexKeyPrefix        = "nrf:idx:"
+	subscriptionKeyPrefix = "subscription:"
+
+	// heartbeatExpiryKey is a sorted set of NF instance IDs scored by the
+	// Unix time at which the reaper should next act on them
+	heartbeatExpiryKey = "nrf:heartbeat-expiry"
+
+	// Each subscription has its own list of pending notifications, and the
+	// pending set holds the time (Unix ms) at which the head of each list is due
+	notifyQueueKeyPrefix = "nrf:notify:queue:"
+	notifyPendingKey     = "nrf:notify:pending"
+	notifyDeadLetterKey  = "nrf:notify:dead-letter"
+
+	// eventChannel is the pub/sub channel of the registry events
+	eventChannel = "nrf:events"
+
+	// A lease key holds the ID of the lease holder and expires with the lease
+	leaseKeyPrefix = "nrf:lease:"
+)
+
+func profileKey(nfInstanceID string) string {
+	return profileKeyPrefix + nfInstanceID
+}
+
+func indexKey(index string) string {
+	return indexKeyPrefix + index
+}
+
+func subscriptionKey(subscriptionID string) string {
+	return subscriptionKeyPrefix + subscriptionID
+}
+
+func notifyQueueKey(subscriptionID string) string {
+	return notifyQueueKeyPrefix + subscriptionID
+}
+
+// RedisStore keeps the NRF state in Redis, so that it survives restarts and
+// can be shared by several NRF processes
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to the Redis server at addr
+func NewRedisStore(ctx context.Context, addr string) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis at %s: %w", addr, err)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Close closes the connection to Redis
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// GetProfile reads an NF profile
+func (s *RedisStore) GetProfile(ctx context.Context, nfInstanceID string) (*NFProfile, error) {
+	data, err := s.client.Get(ctx, profileKey(nfInstanceID)).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var profile NFProfile
+	if err := json.Unmarshal([]byte(data), &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode profile %s: %w", nfInstanceID, err)
+	}
+	return &profile, nil
+}
+
+// GetProfiles fetches several NF profiles with a single MGET
+func (s *RedisStore) GetProfiles(ctx context.Context, nfInstanceIDs []string) ([]NFProfile, error) {
+	if len(nfInstanceIDs) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(nfInstanceIDs))
+	for i, id := range nfInstanceIDs {
+		keys[i] = profileKey(id)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]NFProfile, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var profile NFProfile
+		if err := json.Unmarshal([]byte(data), &profile); err == nil {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles, nil
+}
+
+// PutProfile saves an NF profile and updates its index entries in one
+// transaction, which fails if the stored profile changes after it is read
+func (s *RedisStore) PutProfile(ctx context.Context, profile NFProfile, previous *NFProfile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("failed to encode profile: %w", err)
+	}
+
+	key := profileKey(profile.NFID)
+	err = s.client.Watch(ctx, func(tx *redis.Tx) error {
+		var stored *NFProfile
+		current, err := tx.Get(ctx, key).Result()
+		if err == nil {
+			stored = &NFProfile{}
+			if err := json.Unmarshal([]byte(current), stored); err != nil {
+				return fmt.Errorf("failed to decode profile %s: %w", profile.NFID, err)
+			}
+		} else if err != redis.Nil {
+			return err
+		}
+		if !sameProfileVersion(stored, previous) {
+			return ErrConflict
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if previous != nil {
+				for _, index := range profileIndexes(*previous) {
+					pipe.SRem(ctx, indexKey(index), previous.NFID)
+				}
+			}
+			pipe.Set(ctx, key, data, 0)
+			for _, index := range profileIndexes(profile) {
+				pipe.SAdd(ctx, indexKey(index), profile.NFID)
+			}
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return ErrConflict
+	}
+	return err
+}
+
+// DeleteProfile removes an NF profile with its index entries and heartbeat deadline
+func (s *RedisStore) DeleteProfile(ctx context.Context, profile NFProfile) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, index := range profileIndexes(profile) {
+			pipe.SRem(ctx, indexKey(index), profile.NFID)
+		}
+		pipe.Del(ctx, profileKey(profile.NFID))
+		pipe.ZRem(ctx, heartbeatExpiryKey, profile.NFID)
+		return nil
+	})
+	return err
+}
+
+// FindNFInstanceIDs takes the SUNION of every group of indexes and intersects the results
+func (s *RedisStore) FindNFInstanceIDs(ctx context.Context, criteria [][]string) ([]string, error) {
+	return matchCriteria(criteria, func(indexes []string) ([]string, error) {
+		keys := make([]string, len(indexes))
+		for i, index := range indexes {
+			keys[i] = indexKey(index)
+		}
+		return s.client.SUnion(ctx, keys...).Result()
+	})
+}
+
+// GetSubscription reads a subscription
+func (s *RedisStore) GetSubscription(ctx context.Context, subscriptionID string) (*SubscriptionData, error) {
+	data, err := s.client.Get(ctx, subscriptionKey(subscriptionID)).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var subscription SubscriptionData
+	if err := json.Unmarshal([]byte(data), &subscription); err != nil {
+		return nil, fmt.Errorf("failed to decode subscription %s: %w", subscriptionID, err)
+	}
+	return &subscription, nil
+}
+
+// PutSubscription saves a subscription with a TTL ending at its validity time
+func (s *RedisStore) PutSubscription(ctx context.Context, subscription SubscriptionData) error {
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return fmt.Errorf("failed to encode subscription: %w", err)
+	}
+	ttl := time.Until(*subscription.ValidityTime)
+	if ttl <= 0 {
+		return fmt.Errorf("validityTime is in the past")
+	}
+	return s.client.Set(ctx, subscriptionKey(subscription.SubscriptionID), data, ttl).Err()
+}
+
+// DeleteSubscription removes a subscription
+func (s *RedisStore) DeleteSubscription(ctx context.Context, subscriptionID string) error {
+	deleted, err := s.client.Del(ctx, subscriptionKey(subscriptionID)).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListSubscriptions scans the subscription keys
+func (s *RedisStore) ListSubscriptions(ctx context.Context) ([]SubscriptionData, error) {
+	var subscriptions []SubscriptionData
+	iter := s.client.Scan(ctx, 0, subscriptionKeyPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		subscription, err := s.GetSubscription(ctx, strings.TrimPrefix(iter.Val(), subscriptionKeyPrefix))
+		if err != nil {
+			continue
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+	return subscriptions, iter.Err()
+}
+
+// SetHeartbeatDeadline sets the time at which the reaper should act on the NF
+func (s *RedisStore) SetHeartbeatDeadline(ctx context.Context, nfInstanceID string, deadline time.Time) error {
+	return s.client.ZAdd(ctx, heartbeatExpiryKey, &redis.Z{Score: float64(deadline.Unix()), Member: nfInstanceID}).Err()
+}
+
+// ExpiredHeartbeats lists the NFs whose deadline has passed
+func (s *RedisStore) ExpiredHeartbeats(ctx context.Context, now time.Time) ([]string, error) {
+	return s.client.ZRangeByScore(ctx, heartbeatExpiryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+}
+
+// claimHeartbeatScript removes a deadline that has passed, checking and
+// removing it in one step so that a concurrent heartbeat is never lost
+var claimHeartbeatScript = redis.NewScript(`
+local deadline = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if deadline and tonumber(deadline) <= tonumber(ARGV[2]) then
+	return redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0`)
+
+// ClaimHeartbeatDeadline removes an expired deadline, so that only one NRF
+// process sharing the Redis server acts on it. Heartbeats of other NFs do
+// not get in the way, as they would of a WATCH on the whole sorted set.
+func (s *RedisStore) ClaimHeartbeatDeadline(ctx context.Context, nfInstanceID string, now time.Time) (bool, error) {
+	removed, err := claimHeartbeatScript.Run(ctx, s.client, []string{heartbeatExpiryKey},
+		nfInstanceID, now.Unix()).Int()
+	if err != nil {
+		return false, err
+	}
+	return removed == 1, nil
+}
+
+// EnqueueNotification appends a job to its subscription's queue
+func (s *RedisStore) EnqueueNotification(ctx context.Context, job NotificationJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification job: %w", err)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, notifyQueueKey(job.SubscriptionID), data)
+		// NX keeps the due time of a queue that is already backing off
+		pipe.ZAddNX(ctx, notifyPendingKey, &redis.Z{
+			Score:  float64(time.Now().UnixMilli()),
+			Member: job.SubscriptionID,
+		})
+		return nil
+	})
+	return err
+}
+
+// DueNotificationQueues lists the subscriptions whose queue is due
+func (s *RedisStore) DueNotificationQueues(ctx context.Context, now time.Time) ([]string, error) {
+	return s.client.ZRangeByScore(ctx, notifyPendingKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+}
+
+// claimQueueScript moves the due time of a queue that is due to the end of
+// the lease, so that the queue stays in the pending set and EnqueueNotification
+// (ZADD NX) leaves it alone while it is claimed
+var claimQueueScript = redis.NewScript(`
+local due = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if due and tonumber(due) <= tonumber(ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+	return 1
+end
+return 0`)
+
+// releaseQueueScript schedules a claimed queue, or removes it from the
+// pending set once it is empty, in one step so that a job enqueued
+// meanwhile is not stranded
+var releaseQueueScript = redis.NewScript(`
+if redis.call('LLEN', KEYS[2]) > 0 then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+else
+	redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0`)
+
+// ClaimNotificationQueue leases a due queue until the given time. Claiming
+// keeps notifications in order, even with several NRF processes sharing
+// Redis, and the queue becomes due again if the claimer stops.
+func (s *RedisStore) ClaimNotificationQueue(ctx context.Context, subscriptionID string, now, until time.Time) (bool, error) {
+	claimed, err := claimQueueScript.Run(ctx, s.client, []string{notifyPendingKey},
+		subscriptionID, now.UnixMilli(), until.UnixMilli()).Int()
+	return claimed == 1, err
+}
+
+// PeekNotification returns the oldest queued notification, discarding malformed entries
+func (s *RedisStore) PeekNotification(ctx context.Context, subscriptionID string) (*NotificationJob, error) {
+	queueKey := notifyQueueKey(subscriptionID)
+	for {
+		data, err := s.client.LIndex(ctx, queueKey, 0).Result()
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+
+		var job NotificationJob
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			log.Printf("Discarding malformed notification for %s: %v", subscriptionID, err)
+			if err := s.client.LPop(ctx, queueKey).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return &job, nil
+	}
+}
+
+// UpdateNotification replaces the head of the job's queue
+func (s *RedisStore) UpdateNotification(ctx context.Context, job NotificationJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification job: %w", err)
+	}
+	return s.client.LSet(ctx, notifyQueueKey(job.SubscriptionID), 0, data).Err()
+}
+
+// PopNotification removes the head of the queue
+func (s *RedisStore) PopNotification(ctx context.Context, subscriptionID string) error {
+	err := s.client.LPop(ctx, notifyQueueKey(subscriptionID)).Err()
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+// ScheduleNotificationQueue releases a claimed queue, due at the given time
+// if it still holds notifications
+func (s *RedisStore) ScheduleNotificationQueue(ctx context.Context, subscriptionID string, at time.Time) error {
+	return releaseQueueScript.Run(ctx, s.client,
+		[]string{notifyPendingKey, notifyQueueKey(subscriptionID)},
+		subscriptionID, at.UnixMilli()).Err()
+}
+
+// DropNotificationQueue discards the notifications pending for a subscription
+func (s *RedisStore) DropNotificationQueue(ctx context.Context, subscriptionID string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, notifyQueueKey(subscriptionID))
+		pipe.ZRem(ctx, notifyPendingKey, subscriptionID)
+		return nil
+	})
+	return err
+}
+
+// RecoverNotificationQueues schedules every queue that is not in the pending set
+func (s *RedisStore) RecoverNotificationQueues(ctx context.Context) error {
+	iter := s.client.Scan(ctx, 0, notifyQueueKeyPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		subscriptionID := strings.TrimPrefix(iter.Val(), notifyQueueKeyPrefix)
+		s.client.ZAddNX(ctx, notifyPendingKey, &redis.Z{
+			Score:  float64(time.Now().UnixMilli()),
+			Member: subscriptionID,
+		})
+	}
+	return iter.Err()
+}
+
+// DeadLetterNotifications moves a failing subscription's notifications to
+// the dead-letter list and removes the subscription in one transaction
+func (s *RedisStore) DeadLetterNotifications(ctx context.Context, failed NotificationJob, limit int) error {
+	queueKey := notifyQueueKey(failed.SubscriptionID)
+	pending, err := s.client.LRange(ctx, queueKey, 1, -1).Result()
+	if err != nil {
+		return err
+	}
+	failedData, err := json.Marshal(failed)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification job: %w", err)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, notifyDeadLetterKey, failedData)
+		for _, data := range pending {
+			pipe.LPush(ctx, notifyDeadLetterKey, data)
+		}
+		pipe.LTrim(ctx, notifyDeadLetterKey, 0, int64(limit)-1)
+		pipe.Del(ctx, queueKey, subscriptionKey(failed.SubscriptionID))
+		pipe.ZRem(ctx, notifyPendingKey, failed.SubscriptionID)
+		return nil
+	})
+	return err
+}
+
+// ListDeadLetters returns the dead-lettered notifications, newest first
+func (s *RedisStore) ListDeadLetters(ctx context.Context) ([]NotificationJob, error) {
+	entries, err := s.client.LRange(ctx, notifyDeadLetterKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]NotificationJob, 0, len(entries))
+	for _, data := range entries {
+		var job NotificationJob
+		if err := json.Unmarshal([]byte(data), &job); err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// ClearDeadLetters empties the dead-letter list
+func (s *RedisStore) ClearDeadLetters(ctx context.Context) error {
+	return s.client.Del(ctx, notifyDeadLetterKey).Err()
+}
+
+// PublishEvent publishes the event to the subscribers of every NRF process
+func (s *RedisStore) PublishEvent(ctx context.Context, event RegistryEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	return s.client.Publish(ctx, eventChannel, data).Err()
+}
+
+// SubscribeEvents subscribes to the registry events until ctx is done
+func (s *RedisStore) SubscribeEvents(ctx context.Context) (<-chan RegistryEvent, error) {
+	pubsub := s.client.Subscribe(ctx, eventChannel)
+	// Wait for the subscription, so that no event published after the call is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	events := make(chan RegistryEvent, eventBufferSize)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event RegistryEvent
+				if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+					log.Printf("Discarding malformed registry event: %v", err)
+					continue
+				}
+				select {
+				case events <- event:
+				default:
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// AcquireLease takes a free lease with SET NX, or extends the lease of
+// holder. The check and the extension are atomic, so a lease that expired
+// and was taken by another process in between is never extended.
+func (s *RedisStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	key := leaseKeyPrefix + name
+	acquired, err := s.client.SetNX(ctx, key, holder, ttl).Result()
+	if err != nil || acquired {
+		return acquired, err
+	}
+
+	extended := false
+	err = s.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			// Expired since SET NX; the lease is taken on the next attempt
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if current != holder {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.PExpire(ctx, key, ttl)
+			return nil
+		})
+		extended = err == nil
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return false, nil
+	}
+	return extended, err
+}
+
+// ReleaseLease deletes the lease key if holder still has the lease
+func (s *RedisStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	key := leaseKeyPrefix + name
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil || (err == nil && current != holder) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		// The lease changed hands in the meantime
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Config holds the settings of the NRF services and background jobs
+type Config struct {
+	APIRoot    string // URI of the NRF advertised by bootstrapping, e.g. "http://nrf:8080"
+	// InstanceID identifies the NRF to its peers, which must each have a
+	// different one. NewServer generates a UUID when it is empty.
+	InstanceID string
+	Token      TokenConfig
+	Reaper     ReaperConfig
+	Dispatcher DispatcherConfig
+	Forwarding ForwardingConfig
+	Discovery  DiscoveryConfig
+	Leader     LeaderConfig
+}
+
+// DefaultConfig returns the settings used when none are configured
+func DefaultConfig() Config {
+	return Config{
+		Token:      DefaultTokenConfig(),
+		Reaper:     DefaultReaperConfig(),
+		Dispatcher: DefaultDispatcherConfig(),
+		Forwarding: DefaultForwardingConfig(),
+		Discovery:  DefaultDiscoveryConfig(),
+		Leader:     DefaultLeaderConfig(),
+	}
+}
+
+// Server implements the NRF services on top of a Store
+type Server struct {
+	store        Store
+	config       Config
+	issuer       *tokenIssuer
+	notifyClient *http.Client
+	peerClient   *http.Client
+	forwardCache *peerResultCache
+	results      *resultCache
+}
+
+// NewServer creates an NRF backed by the given store
+func NewServer(store Store, cfg Config) (*Server, error) {
+	if cfg.InstanceID == "" {
+		id, err := newUUID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate an NRF instance ID: %w", err)
+		}
+		log.Printf("No NRF instance ID configured, using %s", id)
+		cfg.InstanceID = id
+	}
+	issuer, err := newTokenIssuer(cfg.Token)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		store:        store,
+		config:       cfg,
+		issuer:       issuer,
+		notifyClient: &http.Client{Timeout: cfg.Dispatcher.RequestTimeout},
+		peerClient:   &http.Client{Timeout: cfg.Forwarding.RequestTimeout},
+		forwardCache: newPeerResultCache(),
+		results:      newResultCache(),
+	}, nil
+}
+
+// SetupRouter initializes the router and routes
+func (s *Server) SetupRouter() *mux.Router {
+	router := mux.NewRouter()
+
+	// Bootstrapping
+	router.HandleFunc("/bootstrapping", s.Bootstrapping).Methods("GET")
+
+	// NF Management
+	router.HandleFunc("/nnrf-nfm/v1/nf-instances", s.ListNFInstances).Methods("GET")
+	router.HandleFunc("/nnrf-nfm/v1/nf-instances/{nfInstanceID}", s.GetNFInstance).Methods("GET")
+	router.HandleFunc("/nnrf-nfm/v1/nf-instances/{nfInstanceID}", s.RegisterNF).Methods("PUT")
+	router.HandleFunc("/nnrf-nfm/v1/nf-instances/{nfInstanceID}", s.NFHeartBeat).Methods("PATCH")
+	router.HandleFunc("/nnrf-nfm/v1/nf-instances/{nf_id}", s.DeregisterNF).Methods("DELETE")
+
+	// NF Discovery
+	router.HandleFunc("/nnrf-disc/v1/nfs", s.DiscoverNFs).Methods("GET")
+
+	// Subscription Management
+	router.HandleFunc("/nnrf-nfm/v1/subscriptions", s.CreateSubscription).Methods("POST")
+	router.HandleFunc("/nnrf-nfm/v1/subscriptions/{subscriptionID}", s.UpdateSubscription).Methods("PATCH")
+	router.HandleFunc("/nnrf-nfm/v1/subscriptions/{subscriptionID}", s.RemoveSubscription).Methods("DELETE")
+	router.HandleFunc("/nnrf-sub/v1/subscriptions", s.CreateSubscription).Methods("POST")
+
+	// Access Token
+	router.HandleFunc("/oauth2/token", s.IssueAccessToken).Methods("POST")
+	router.HandleFunc("/oauth2/jwks", s.TokenKeys).Methods("GET")
+
+	// Administration
+	router.HandleFunc("/nrf-admin/v1/notifications/dead-letters", s.ListDeadLetters).Methods("GET")
+	router.HandleFunc("/nrf-admin/v1/notifications/dead-letters", s.ClearDeadLetters).Methods("DELETE")
+	router.HandleFunc("/nrf-admin/v1/events", s.WatchEvents).Methods("GET")
+
+	return router
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NFService describes one service instance offered by an NF (TS 29.510 NFService)
+type NFService struct {
+	ServiceInstanceID string           `json:"service_instance_id"`
+	ServiceName       string           `json:"service_name"`
+	Versions          []ServiceVersion `json:"versions"`
+	Scheme            string           `json:"scheme"`
+	Status            string           `json:"nf_service_status,omitempty"`
+	FQDN              string           `json:"fqdn,omitempty"`
+	IPEndPoints       []IPEndPoint     `json:"ip_end_points,omitempty"`
+	APIPrefix         string           `json:"api_prefix,omitempty"`
+	AllowedNFTypes    []string         `json:"allowed_nf_types,omitempty"`
+	Priority          *int             `json:"priority,omitempty"`
+	Capacity          *int             `json:"capacity,omitempty"`
+	Load              *int             `json:"load,omitempty"`
+}
+
+// ServiceVersion is an API version offered by a service (TS 29.510 NFServiceVersion)
+type ServiceVersion struct {
+	APIVersionInURI string `json:"api_version_in_uri"`
+	APIFullVersion  string `json:"api_full_version"`
+}
+
+// IPEndPoint is an address on which a service is reachable (TS 29.510 IpEndPoint)
+type IPEndPoint struct {
+	IPv4Address string `json:"ipv4_address,omitempty"`
+	IPv6Address string `json:"ipv6_address,omitempty"`
+	Transport   string `json:"transport,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+// validateNFServices checks the services of a profile and fills in defaults
+func validateNFServices(profile *NFProfile) error {
+	if err := validateRanking(profile.Priority, profile.Capacity, profile.Load); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(profile.NFServices))
+	for i := range profile.NFServices {
+		service := &profile.NFServices[i]
+		if service.ServiceInstanceID == "" || service.ServiceName == "" {
+			return fmt.Errorf("nf_services[%d]: service_instance_id and service_name are required", i)
+		}
+		if seen[service.ServiceInstanceID] {
+			return fmt.Errorf("nf_services[%d]: duplicate service_instance_id %q", i, service.ServiceInstanceID)
+		}
+		seen[service.ServiceInstanceID] = true
+
+		switch service.Scheme {
+		case "":
+			service.Scheme = "http"
+		case "http", "https":
+		default:
+			return fmt.Errorf("nf_services[%d]: unsupported scheme %q", i, service.Scheme)
+		}
+		for _, version := range service.Versions {
+			if version.APIVersionInURI == "" {
+				return fmt.Errorf("nf_services[%d]: versions require api_version_in_uri", i)
+			}
+		}
+		for _, endpoint := range service.IPEndPoints {
+			if endpoint.Port < 0 || endpoint.Port > 65535 {
+				return fmt.Errorf("nf_services[%d]: invalid port %d", i, endpoint.Port)
+			}
+		}
+		if err := validateRanking(service.Priority, service.Capacity, service.Load); err != nil {
+			return fmt.Errorf("nf_services[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// isServiceAvailable reports whether a service may be returned by discovery
+func isServiceAvailable(service NFService) bool {
+	return service.Status == "" || service.Status == statusRegistered
+}
+
+// allowsServiceRequester reports whether the service accepts requests from the given NF type
+func allowsServiceRequester(service NFService, requesterNFType string) bool {
+	if requesterNFType == "" || len(service.AllowedNFTypes) == 0 {
+		return true
+	}
+	for _, nfType := range service.AllowedNFTypes {
+		if strings.EqualFold(nfType, requesterNFType) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectServices trims a discovered profile to the services the requester
+// may use and, when the query names services, to those services only. It
+// reports false when none of the requested services is left.
+func selectServices(profile *NFProfile, query *DiscoveryQuery) bool {
+	wanted := make(map[string]bool, len(query.ServiceNames))
+	for _, name := range query.ServiceNames {
+		wanted[name] = true
+	}
+
+	declared := make(map[string]bool, len(profile.NFServices))
+	selected := make(map[string]bool, len(profile.NFServices))
+	services := make([]NFService, 0, len(profile.NFServices))
+	for _, service := range profile.NFServices {
+		declared[service.ServiceName] = true
+		if len(wanted) > 0 && !wanted[service.ServiceName] {
+			continue
+		}
+		if !isServiceAvailable(service) || !allowsServiceRequester(service, query.RequesterNFType) {
+			continue
+		}
+		services = append(services, service)
+		selected[service.ServiceName] = true
+	}
+	profile.NFServices = services
+
+	if len(wanted) == 0 {
+		return true
+	}
+
+	// Service URLs are kept for clients that predate NFService, unless the
+	// service they point to was filtered out above
+	var urls []string
+	for _, serviceURL := range profile.ServiceURLs {
+		name := serviceURLName(serviceURL)
+		if wanted[name] && (selected[name] || !declared[name]) {
+			urls = append(urls, serviceURL)
+		}
+	}
+	profile.ServiceURLs = urls
+	return len(services) > 0 || len(urls) > 0
+}
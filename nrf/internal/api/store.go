@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Errors returned by a Store
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("modified concurrently")
+)
+
+// Store persists the state of the NRF. The Redis implementation lets several
+// NRF processes share one state; the in-memory one serves tests and demos.
+type Store interface {
+	ProfileStore
+	SubscriptionStore
+	HeartbeatStore
+	NotificationStore
+	EventStore
+	LeaseStore
+}
+
+// ProfileStore holds NF profiles and the secondary indexes used by discovery
+type ProfileStore interface {
+	// GetProfile returns ErrNotFound for an unknown NF instance
+	GetProfile(ctx context.Context, nfInstanceID string) (*NFProfile, error)
+	// GetProfiles fetches several profiles at once, skipping missing ones
+	GetProfiles(ctx context.Context, nfInstanceIDs []string) ([]NFProfile, error)
+	// PutProfile saves a profile and moves it between indexes. previous is
+	// the stored version of the profile, or nil on first registration; if
+	// the stored version no longer matches it, nothing is saved and
+	// ErrConflict is returned.
+	PutProfile(ctx context.Context, profile NFProfile, previous *NFProfile) error
+	// DeleteProfile removes a profile with its index entries and heartbeat deadline
+	DeleteProfile(ctx context.Context, profile NFProfile) error
+	// FindNFInstanceIDs returns the sorted IDs of the NFs that are in at
+	// least one index of every group of criteria (see indexCriteria)
+	FindNFInstanceIDs(ctx context.Context, criteria [][]string) ([]string, error)
+}
+
+// SubscriptionStore holds NFStatusSubscribe subscriptions
+type SubscriptionStore interface {
+	// GetSubscription returns ErrNotFound for an unknown or expired subscription
+	GetSubscription(ctx context.Context, subscriptionID string) (*SubscriptionData, error)
+	// PutSubscription saves a subscription until its validityTime
+	PutSubscription(ctx context.Context, subscription SubscriptionData) error
+	// DeleteSubscription returns ErrNotFound for an unknown subscription
+	DeleteSubscription(ctx context.Context, subscriptionID string) error
+	// ListSubscriptions returns every subscription that has not expired
+	ListSubscriptions(ctx context.Context) ([]SubscriptionData, error)
+}
+
+// HeartbeatStore holds the time at which the reaper should next act on each NF
+type HeartbeatStore interface {
+	SetHeartbeatDeadline(ctx context.Context, nfInstanceID string, deadline time.Time) error
+	// ExpiredHeartbeats lists the NFs whose deadline is not after now
+	ExpiredHeartbeats(ctx context.Context, now time.Time) ([]string, error)
+	// ClaimHeartbeatDeadline removes an expired deadline, unless a heartbeat
+	// has moved it in the meantime. Only one caller can claim a deadline.
+	ClaimHeartbeatDeadline(ctx context.Context, nfInstanceID string, now time.Time) (bool, error)
+}
+
+// NotificationStore holds a queue of undelivered notifications for each
+// subscription, so that they are delivered in order, together with the time
+// at which the head of each queue is due, and a list of dead letters
+type NotificationStore interface {
+	// EnqueueNotification appends a job to its subscription's queue. The
+	// queue becomes due immediately unless it is already scheduled.
+	EnqueueNotification(ctx context.Context, job NotificationJob) error
+	// DueNotificationQueues lists the subscriptions whose queue is due at now
+	DueNotificationQueues(ctx context.Context, now time.Time) ([]string, error)
+	// ClaimNotificationQueue leases a queue that is due at now until the
+	// given time, or until ScheduleNotificationQueue releases it. Only one
+	// caller can claim it, and enqueueing does not make it due meanwhile.
+	ClaimNotificationQueue(ctx context.Context, subscriptionID string, now, until time.Time) (bool, error)
+	// PeekNotification returns the head of the queue, or ErrNotFound when it is empty
+	PeekNotification(ctx context.Context, subscriptionID string) (*NotificationJob, error)
+	// UpdateNotification replaces the head of the job's queue
+	UpdateNotification(ctx context.Context, job NotificationJob) error
+	// PopNotification removes the head of the queue
+	PopNotification(ctx context.Context, subscriptionID string) error
+	// ScheduleNotificationQueue releases a claimed queue, due at the given
+	// time if it is not empty
+	ScheduleNotificationQueue(ctx context.Context, subscriptionID string, at time.Time) error
+	// DropNotificationQueue discards the queue
+	DropNotificationQueue(ctx context.Context, subscriptionID string) error
+	// RecoverNotificationQueues schedules queues left unclaimed by a stopped NRF
+	RecoverNotificationQueues(ctx context.Context) error
+	// DeadLetterNotifications moves the failed job and the rest of its queue
+	// to the dead-letter list, keeping the newest limit entries, and removes
+	// the subscription
+	DeadLetterNotifications(ctx context.Context, failed NotificationJob, limit int) error
+	// ListDeadLetters returns the dead-lettered notifications, newest first
+	ListDeadLetters(ctx context.Context) ([]NotificationJob, error)
+	ClearDeadLetters(ctx context.Context) error
+}
+
+// EventStore carries registry events to the watchers of every NRF process
+// sharing the store. Delivery is best effort: a watcher that falls behind
+// misses events.
+type EventStore interface {
+	PublishEvent(ctx context.Context, event RegistryEvent) error
+	// SubscribeEvents returns the events published from now on. The channel
+	// is closed once ctx is done.
+	SubscribeEvents(ctx context.Context) (<-chan RegistryEvent, error)
+}
+
+// LeaseStore holds the leases that elect one NRF process among those
+// sharing the store
+type LeaseStore interface {
+	// AcquireLease takes the named lease for holder, or extends it if holder
+	// already has it. It returns false while another holder has the lease.
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease gives up the lease, if holder has it
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// matchCriteria intersects the groups of index criteria. union returns the
+// members of any of the indexes of a group.
+func matchCriteria(criteria [][]string, union func(indexes []string) ([]string, error)) ([]string, error) {
+	var matched map[string]bool
+	for _, indexes := range criteria {
+		members, err := union(indexes)
+		if err != nil {
+			return nil, err
+		}
+
+		next := make(map[string]bool, len(members))
+		for _, id := range members {
+			if matched == nil || matched[id] {
+				next[id] = true
+			}
+		}
+		matched = next
+		if len(matched) == 0 {
+			return nil, nil
+		}
+	}
+
+	ids := make([]string, 0, len(matched))
+	for id := range matched {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultSubscriptionValidity applies when a subscriber does not ask for a validityTime
+const defaultSubscriptionValidity = 24 * time.Hour
+
+// SubscriptionData represents an NFStatusSubscribe subscription (TS 29.510)
+type SubscriptionData struct {
+	SubscriptionID          string      `json:"subscriptionId"`
+	NFStatusNotificationURI string      `json:"nfStatusNotificationUri"`
+	NotificationURI         string      `json:"notificationUri,omitempty"` // Legacy name of nfStatusNotificationUri
+	SubscrCond              *SubscrCond `json:"subscrCond,omitempty"`
+	ReqNotifEvents          []string    `json:"reqNotifEvents,omitempty"`
+	ValidityTime            *time.Time  `json:"validityTime,omitempty"`
+	ReqNFType               string      `json:"reqNfType,omitempty"`
+	PeerSubscriptions       []string    `json:"peerSubscriptions,omitempty"` // Copies of the subscription at peer NRFs
+}
+
+// SubscrCond restricts a subscription to an NF instance, an NF type or a service name
+type SubscrCond struct {
+	NFInstanceID string `json:"nfInstanceId,omitempty"`
+	NFType       string `json:"nfType,omitempty"`
+	ServiceName  string `json:"serviceName,omitempty"`
+}
+
+// PatchItem is a single JSON Patch (RFC 6902) operation
+type PatchItem struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// newUUID returns a random UUID (version 4)
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// validateSubscription checks a subscription received from a subscriber
+func validateSubscription(subscription *SubscriptionData) error {
+	if subscription.NFStatusNotificationURI == "" {
+		subscription.NFStatusNotificationURI = subscription.NotificationURI
+	}
+	subscription.NotificationURI = ""
+	if subscription.NFStatusNotificationURI == "" {
+		return fmt.Errorf("nfStatusNotificationUri is required")
+	}
+
+	if cond := subscription.SubscrCond; cond != nil {
+		set := 0
+		for _, v := range []string{cond.NFInstanceID, cond.NFType, cond.ServiceName} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("subscrCond must contain exactly one of nfInstanceId, nfType or serviceName")
+		}
+	}
+
+	for _, event := range subscription.ReqNotifEvents {
+		switch event {
+		case NFRegistered, NFDeregistered, NFProfileChanged:
+		default:
+			return fmt.Errorf("unsupported notification event %q", event)
+		}
+	}
+	return nil
+}
+
+// CreateSubscription adds a new subscription
+func (s *Server) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var subscription SubscriptionData
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validateSubscription(&subscription); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	subscriptionID, err := newUUID()
+	if err != nil {
+		http.Error(w, "Failed to allocate subscription ID", http.StatusInternalServerError)
+		return
+	}
+	subscription.SubscriptionID = subscriptionID
+	subscription.PeerSubscriptions = nil
+
+	maxValidity := time.Now().Add(defaultSubscriptionValidity).UTC()
+	if subscription.ValidityTime == nil || subscription.ValidityTime.After(maxValidity) {
+		subscription.ValidityTime = &maxValidity
+	}
+	if s.shouldForwardSubscription(r, subscription) {
+		subscription.PeerSubscriptions = s.forwardSubscription(r.Context(), r, subscription)
+	}
+
+	if err := s.store.PutSubscription(r.Context(), subscription); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save subscription: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/nnrf-nfm/v1/subscriptions/"+subscriptionID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// UpdateSubscription extends or shortens a subscription. As in TS 29.510,
+// only the validityTime can be changed, using a JSON Patch document.
+func (s *Server) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := mux.Vars(r)["subscriptionID"]
+
+	subscription, err := s.store.GetSubscription(r.Context(), subscriptionID)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to load subscription", http.StatusInternalServerError)
+		return
+	}
+
+	var patch []PatchItem
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid JSON Patch document", http.StatusBadRequest)
+		return
+	}
+	for _, item := range patch {
+		if (item.Op != "replace" && item.Op != "add") || item.Path != "/validityTime" {
+			http.Error(w, fmt.Sprintf("Unsupported patch operation %s %s", item.Op, item.Path), http.StatusBadRequest)
+			return
+		}
+		var validityTime time.Time
+		if err := json.Unmarshal(item.Value, &validityTime); err != nil {
+			http.Error(w, "Invalid validityTime", http.StatusBadRequest)
+			return
+		}
+		subscription.ValidityTime = &validityTime
+	}
+
+	// The same bounds as at creation: a subscription cannot be extended
+	// beyond defaultSubscriptionValidity from now, nor expire in the past
+	now := time.Now().UTC()
+	if subscription.ValidityTime != nil {
+		if !subscription.ValidityTime.After(now) {
+			http.Error(w, "validityTime is in the past", http.StatusBadRequest)
+			return
+		}
+		if maxValidity := now.Add(defaultSubscriptionValidity); subscription.ValidityTime.After(maxValidity) {
+			subscription.ValidityTime = &maxValidity
+		}
+		// Peer NRFs get the validityTime granted here
+		value, _ := json.Marshal(subscription.ValidityTime)
+		patch = []PatchItem{{Op: "replace", Path: "/validityTime", Value: value}}
+	}
+
+	if err := s.store.PutSubscription(r.Context(), *subscription); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save subscription: %v", err), http.StatusBadRequest)
+		return
+	}
+	if body, err := json.Marshal(patch); err == nil {
+		s.updatePeerSubscriptions(r.Context(), r, *subscription, http.MethodPatch, body, "application/json-patch+json")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// RemoveSubscription deletes a subscription
+func (s *Server) RemoveSubscription(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := mux.Vars(r)["subscriptionID"]
+
+	subscription, err := s.store.GetSubscription(r.Context(), subscriptionID)
+	if err == nil {
+		err = s.store.DeleteSubscription(r.Context(), subscriptionID)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to remove subscription", http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.DropNotificationQueue(r.Context(), subscriptionID); err != nil {
+		log.Printf("Failed to drop notification queue of %s: %v", subscriptionID, err)
+	}
+	s.updatePeerSubscriptions(r.Context(), r, *subscription, http.MethodDelete, nil, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// matchesSubscription reports whether an event about the profile concerns the subscription
+func matchesSubscription(subscription SubscriptionData, event string, profile NFProfile) bool {
+	if len(subscription.ReqNotifEvents) > 0 {
+		requested := false
+		for _, e := range subscription.ReqNotifEvents {
+			if e == event {
+				requested = true
+				break
+			}
+		}
+		if !requested {
+			return false
+		}
+	}
+
+	cond := subscription.SubscrCond
+	switch {
+	case cond == nil:
+		return true
+	case cond.NFInstanceID != "":
+		return cond.NFInstanceID == profile.NFID
+	case cond.NFType != "":
+		return strings.EqualFold(cond.NFType, profile.NFType)
+	case cond.ServiceName != "":
+		for _, name := range serviceNames(profile) {
+			if name == cond.ServiceName {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// notifyNFStatus informs the matching subscribers about a change in an NF's
+// registration, and drops the cached discovery results it affects. The
+// notifications are queued even if ctx, usually that of the request causing
+// the change, is cancelled.
+func (s *Server) notifyNFStatus(ctx context.Context, event string, profile NFProfile) {
+	s.results.invalidate(profile)
+
+	ctx = context.WithoutCancel(ctx)
+	notification := map[string]interface{}{
+		"event":         event,
+		"nfInstanceUri": nfInstancePath(profile.NFID),
+	}
+	if event != NFDeregistered {
+		notification["nfProfile"] = profile
+	}
+
+	subscriptions, err := s.store.ListSubscriptions(ctx)
+	if err != nil {
+		log.Printf("Failed to list subscriptions for %s notification: %v", event, err)
+	}
+	for _, subscription := range subscriptions {
+		if !matchesSubscription(subscription, event, profile) {
+			continue
+		}
+		if err := s.enqueueNotification(ctx, subscription, notification); err != nil {
+			log.Printf("Failed to queue %s notification for %s: %v", event, subscription.SubscriptionID, err)
+		}
+	}
+}
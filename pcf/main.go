@@ -1,14 +1,29 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gorilla/mux"
 	"github.com/danipopa/mob5g/pcf/src"
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"github.com/danipopa/mob5g/sbi/oauth"
 )
 
 func main() {
+	// Register with the NRF, when NRF_URL is set, so that consumers find the PCF
+	nrfClient, profile, err := nrfagent.FromEnv("PCF", "http://pcf-service:8081", "npcf-am-policy-control")
+	if err != nil {
+		log.Fatalf("Failed to configure NRF registration: %v", err)
+	}
+	if nrfClient != nil {
+		pcf.UDR = nrfagent.NewEndpoint(nrfClient, "UDR", "nudr-dr", "http://udr-service:8080")
+	}
+
 	// Initialize storage (optional if policies are pre-configured)
 	storage := pcf.NewRedisStorage("redis-service:6379")
 
@@ -20,10 +35,35 @@ func main() {
 	router.HandleFunc("/npcf-am/v1/mobility-policy", handlers.N15Handler).Methods("POST")
 	router.HandleFunc("/npcf-am/v1/mobility-policy/update", handlers.N15UpdateHandler).Methods("PUT")
 
+	// Require SBI access tokens when the NRF token key is configured
+	validator, err := oauth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SBI authorization: %v", err)
+	}
+	if validator != nil {
+		router.Use(validator.Middleware)
+	}
+
+	var handler http.Handler = router
+	if nrfClient != nil {
+		handler = nrfClient.ServeNotifications(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start HTTP server
-	log.Println("Starting PCF service on port 8081...")
-	if err := http.ListenAndServe(":8081", router); err != nil {
-		log.Fatalf("Failed to start PCF service: %v", err)
+	go func() {
+		log.Println("Starting PCF service on port 8081...")
+		if err := http.ListenAndServe(":8081", handler); err != nil {
+			log.Fatalf("Failed to start PCF service: %v", err)
+		}
+	}()
+
+	// Stay registered with the NRF until SIGTERM, then deregister
+	if nrfClient == nil {
+		<-ctx.Done()
+	} else if err := nrfClient.Run(ctx, profile); err != nil {
+		log.Printf("PCF NRF agent stopped: %v", err)
 	}
 }
-
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"encoding/json"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 type UserSubscription struct {
@@ -12,10 +14,14 @@ type UserSubscription struct {
 	DataQuota   int    `json:"data_quota"` // Remaining data quota
 }
 
+// UDR locates the UDR holding the subscription data. main resolves it
+// through the NRF when one is configured.
+var UDR = nrfagent.NewEndpoint(nil, "UDR", "nudr-dr", "http://udr-service:8080")
+
 // RetrieveSubscriptionData queries UDR/UDM for subscription details.
 func RetrieveSubscriptionData(ueID string) (*UserSubscription, error) {
 	// Simulate an HTTP request to UDR/UDM
-	resp, err := http.Get(fmt.Sprintf("http://udr-service:8080/subscription/%s", ueID))
+	resp, err := UDR.Client().Get(fmt.Sprintf("%s/subscription/%s", UDR.URL(), ueID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query UDR/UDM: %w", err)
 	}
@@ -0,0 +1,5 @@
+module github.com/danipopa/mob5g/sbi
+
+go 1.23.4
+
+require github.com/golang-jwt/jwt/v5 v5.2.1
@@ -0,0 +1,349 @@
+// Package nrfagent registers an NF with the NRF and keeps it registered
+// with heartbeats, discovers the NFs it depends on, caching the results and
+// following their status changes, and resolves the URLs of their services
+// (TS 29.510 Nnrf_NFManagement and Nnrf_NFDiscovery).
+package nrfagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHeartbeatTimer applies until the NRF tells the heartbeat timer to use
+	defaultHeartbeatTimer = 60 * time.Second
+
+	// Registration is retried with exponential backoff between these delays
+	minRegisterBackoff = time.Second
+	maxRegisterBackoff = 30 * time.Second
+
+	// deregisterTimeout bounds the deregistration sent on shutdown
+	deregisterTimeout = 5 * time.Second
+)
+
+// NRFClient represents the NRF client for interacting with the NRF
+type NRFClient struct {
+	nrfURLs    []string // In order of preference
+	nfType     string
+	nfID       string
+	httpClient *http.Client
+	failover   chan struct{} // Signals that the NF must register with another NRF
+
+	mu              sync.Mutex
+	active          int           // Index in nrfURLs of the NRF in use
+	registeredWith  int           // Index in nrfURLs of the NRF holding the registration, -1 if none
+	heartbeatTimer  time.Duration // As decided by the NRF on registration
+	notificationURI string
+	discoveries     map[string]*cachedDiscovery // By NF type
+	subscriptions   map[string]subscription     // By NF type
+	handlers        map[string][]NFStatusHandlers
+	tokens          map[string]*cachedToken // By target NF type and scope
+}
+
+// NFProfile represents the NF profile for registration and updates
+type NFProfile struct {
+	NFID           string      `json:"nf_id"`
+	NFInstanceID   string      `json:"nf_instance_id"`
+	NFType         string      `json:"nf_type"`
+	Status         string      `json:"status"`
+	FQDN           string      `json:"fqdn"`
+	IPAddresses    []string    `json:"ip_addresses"`
+	ServiceURLs    []string    `json:"service_urls"`
+	NFServices     []NFService `json:"nf_services,omitempty"`
+	HeartbeatTimer int         `json:"heartbeat_timer"`
+	PLMNID         *PLMN       `json:"plmn_id,omitempty"`
+	SNSSAIs        []SNSSAI    `json:"snssais"`
+	AreaID         string      `json:"area_id,omitempty"`
+	DNNs           []string    `json:"dnns"`
+}
+
+// NFService is a service offered by an NF (TS 29.510 NFService)
+type NFService struct {
+	ServiceInstanceID string       `json:"service_instance_id"`
+	ServiceName       string       `json:"service_name"`
+	Scheme            string       `json:"scheme"`
+	FQDN              string       `json:"fqdn,omitempty"`
+	IPEndPoints       []IPEndPoint `json:"ip_end_points,omitempty"`
+	APIPrefix         string       `json:"api_prefix,omitempty"`
+}
+
+// IPEndPoint is an address on which a service is reachable (TS 29.510 IpEndPoint)
+type IPEndPoint struct {
+	IPv4Address string `json:"ipv4_address,omitempty"`
+	IPv6Address string `json:"ipv6_address,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+// PLMN represents the Public Land Mobile Network identifier
+type PLMN struct {
+	MCC string `json:"mcc"`
+	MNC string `json:"mnc"`
+}
+
+// SNSSAI represents the Single Network Slice Selection Assistance Information
+type SNSSAI struct {
+	SST string `json:"sst"`
+	SD  string `json:"sd"`
+}
+
+// SearchResult is the body of an NRF discovery response
+type SearchResult struct {
+	ValidityPeriod int         `json:"validityPeriod"`
+	NFInstances    []NFProfile `json:"nfInstances"`
+}
+
+// PatchItem is a single JSON Patch (RFC 6902) operation
+type PatchItem struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// StatusError is returned when the NRF answers with a status other than 2xx
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response to %s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// NewNRFClient initializes a new NRF client for the NF instance nfID of
+// type nfType
+func NewNRFClient(nrfURL, nfType, nfID string) *NRFClient {
+	return NewNRFClientWithFailover([]string{nrfURL}, nfType, nfID)
+}
+
+// NewNRFClientWithFailover initializes an NRF client for a list of NRFs in
+// order of preference. It fails over to the next NRF when the one in use
+// cannot be reached or answers with a 5xx status.
+func NewNRFClientWithFailover(nrfURLs []string, nfType, nfID string) *NRFClient {
+	urls := make([]string, len(nrfURLs))
+	for i, nrfURL := range nrfURLs {
+		urls[i] = strings.TrimSuffix(nrfURL, "/")
+	}
+	return &NRFClient{
+		nrfURLs:        urls,
+		nfType:         strings.ToUpper(nfType),
+		nfID:           nfID,
+		httpClient:     &http.Client{Timeout: 10 * time.Second},
+		failover:       make(chan struct{}, 1),
+		registeredWith: -1,
+		heartbeatTimer: defaultHeartbeatTimer,
+		discoveries:    make(map[string]*cachedDiscovery),
+		subscriptions:  make(map[string]subscription),
+		handlers:       make(map[string][]NFStatusHandlers),
+		tokens:         make(map[string]*cachedToken),
+	}
+}
+
+// Run registers the NF and subscribes for the NF types it watches, keeps
+// its registration alive until ctx is done, then unsubscribes and
+// deregisters it
+func (n *NRFClient) Run(ctx context.Context, profile NFProfile) error {
+	if err := n.RegisterWithRetry(ctx, profile); err != nil {
+		// Stopped before the NF could register: there is nothing to undo
+		return nil
+	}
+	n.subscribeWatchedTypes(ctx)
+
+	n.Heartbeat(ctx, profile)
+
+	deregisterCtx, cancel := context.WithTimeout(context.Background(), deregisterTimeout)
+	defer cancel()
+	n.unsubscribeAll(deregisterCtx)
+	return n.Deregister(deregisterCtx)
+}
+
+// Register registers the NF with the NRF and adopts the heartbeat timer the
+// NRF returns in the registered profile
+func (n *NRFClient) Register(ctx context.Context, profile NFProfile) error {
+	var registered NFProfile
+	if err := n.send(ctx, http.MethodPut, n.instancePath(), "application/json", profile, &registered); err != nil {
+		return err
+	}
+	n.registered()
+
+	timer := time.Duration(registered.HeartbeatTimer) * time.Second
+	if timer <= 0 {
+		timer = time.Duration(profile.HeartbeatTimer) * time.Second
+	}
+	if timer > 0 {
+		n.mu.Lock()
+		n.heartbeatTimer = timer
+		n.mu.Unlock()
+	}
+	return nil
+}
+
+// RegisterWithRetry registers the NF, retrying with exponential backoff
+// until it succeeds. It only fails once ctx is done.
+func (n *NRFClient) RegisterWithRetry(ctx context.Context, profile NFProfile) error {
+	backoff := minRegisterBackoff
+	for {
+		err := n.Register(ctx, profile)
+		if err == nil {
+			log.Printf("Registered %s with NRF %s, heartbeat every %v", n.nfID, n.NRFURL(), n.HeartbeatTimer())
+			return nil
+		}
+		log.Printf("Failed to register %s with NRF: %v. Retrying in %v...", n.nfID, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxRegisterBackoff {
+			backoff = maxRegisterBackoff
+		}
+	}
+}
+
+// HeartbeatTimer returns the interval between heartbeats agreed with the NRF
+func (n *NRFClient) HeartbeatTimer() time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.heartbeatTimer
+}
+
+// Deregister deregisters the NF from the NRF
+func (n *NRFClient) Deregister(ctx context.Context) error {
+	if err := n.send(ctx, http.MethodDelete, n.instancePath(), "", nil, nil); err != nil {
+		return fmt.Errorf("failed to deregister from NRF: %w", err)
+	}
+	n.mu.Lock()
+	n.registeredWith = -1
+	n.mu.Unlock()
+	log.Printf("Deregistered %s from NRF", n.nfID)
+	return nil
+}
+
+// Update updates the NF profile in the NRF. Each entry of updatedFields
+// sets the profile field of the same name, e.g. "load" or "ip_addresses".
+func (n *NRFClient) Update(updatedFields map[string]interface{}) error {
+	fields := make([]string, 0, len(updatedFields))
+	for field := range updatedFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	// "add" replaces a field that is already set and creates it otherwise
+	patch := make([]PatchItem, 0, len(fields))
+	for _, field := range fields {
+		patch = append(patch, PatchItem{Op: "add", Path: "/" + field, Value: updatedFields[field]})
+	}
+	return n.send(context.Background(), http.MethodPatch, n.instancePath(), "application/json-patch+json", patch, nil)
+}
+
+// Heartbeat sends a heartbeat to the NRF every heartbeat timer until ctx is
+// done. If the NRF no longer knows the NF, for instance after it was
+// deregistered for missing heartbeats, the NF registers again. So it does
+// with the NRF it failed over to when the one holding its registration
+// became unavailable. The status subscriptions of the NF are renewed along
+// with the heartbeats.
+func (n *NRFClient) Heartbeat(ctx context.Context, profile NFProfile) {
+	for {
+		timer := time.NewTimer(n.HeartbeatTimer())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-n.failover:
+			timer.Stop()
+			if err := n.reregister(ctx, profile); err != nil {
+				return
+			}
+			continue
+		case <-timer.C:
+		}
+
+		// An empty JSON Patch only restarts the heartbeat timer
+		err := n.send(ctx, http.MethodPatch, n.instancePath(), "application/json-patch+json", []PatchItem{}, nil)
+		switch {
+		case err == nil:
+		case isNotFoundError(err):
+			log.Printf("NRF no longer knows %s, registering again", n.nfID)
+			if err := n.RegisterWithRetry(ctx, profile); err != nil {
+				return
+			}
+		case ctx.Err() == nil:
+			log.Printf("Failed to send heartbeat: %v", err)
+		}
+
+		// Status subscriptions expiring before the next heartbeat are renewed
+		n.subscribeWatchedTypes(ctx)
+	}
+}
+
+func isNotFoundError(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// instancePath is the path of the NF profile in the NRF
+func (n *NRFClient) instancePath() string {
+	return nfInstancePath(n.nfID)
+}
+
+// nfInstancePath is the path of the profile of an NF instance in the NRF
+func nfInstancePath(nfInstanceID string) string {
+	return "/nnrf-nfm/v1/nf-instances/" + url.PathEscape(nfInstanceID)
+}
+
+// send sends a request for path, relative to the NRF API root, with payload
+// as its JSON body of the given content type unless it is nil. Any 2xx
+// status is a success; the response body, if any, is decoded into result
+// unless it is nil. Other statuses are returned as a *StatusError.
+func (n *NRFClient) send(ctx context.Context, method, path, contentType string, payload, result interface{}) error {
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+	}
+
+	resp, err := n.do(ctx, func(nrfURL string) (*http.Request, error) {
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(data)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, nrfURL+path, body)
+		if err != nil {
+			return nil, err
+		}
+		if payload != nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{Method: method, URL: resp.Request.URL.String(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
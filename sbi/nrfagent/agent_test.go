@@ -0,0 +1,218 @@
+package nrfagent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// eventually waits for a condition checked by polling
+func eventually(t *testing.T, condition func() bool, description string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// runHeartbeat sends heartbeats every few milliseconds until the test ends
+func runHeartbeat(t *testing.T, agent *NRFClient, profile NFProfile) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		agent.Heartbeat(ctx, profile)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// registeredAt reports whether an NRF holds a profile
+func (nrf *fakeNRF) registeredAt(nfInstanceID string) bool {
+	nrf.mu.Lock()
+	defer nrf.mu.Unlock()
+	_, ok := nrf.profiles[nfInstanceID]
+	return ok
+}
+
+// TestRegistrationAndHeartbeat checks that an NF registers, sends its
+// heartbeats, and registers again when the NRF no longer knows it
+func TestRegistrationAndHeartbeat(t *testing.T) {
+	nrf := newFakeNRF(t)
+	agent := NewNRFClient(nrf.URL, "AMF", "amf-1")
+	agent.heartbeatTimer = 10 * time.Millisecond
+	profile := NFProfile{NFID: "amf-1", NFInstanceID: "amf-1", NFType: "AMF", Status: "REGISTERED"}
+
+	if err := agent.Register(context.Background(), profile); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if !nrf.registeredAt("amf-1") {
+		t.Fatalf("NF not registered")
+	}
+
+	runHeartbeat(t, agent, profile)
+	eventually(t, func() bool { return nrf.received("PATCH /nnrf-nfm/v1/nf-instances/amf-1") >= 2 }, "heartbeats")
+
+	// Deregistered by the NRF, for instance for missing heartbeats
+	nrf.removeProfile("amf-1")
+	eventually(t, func() bool { return nrf.registeredAt("amf-1") }, "the NF to register again")
+	if registrations := nrf.received("PUT /nnrf-nfm/v1/nf-instances/amf-1"); registrations != 2 {
+		t.Errorf("%d registrations, expected 2", registrations)
+	}
+}
+
+// TestFailover checks that requests fail over to the next NRF on 5xx
+// answers, and that the NF registers with the NRF it failed over to
+func TestFailover(t *testing.T) {
+	primary, secondary := newFakeNRF(t), newFakeNRF(t)
+	agent := NewNRFClientWithFailover([]string{primary.URL, secondary.URL}, "AMF", "amf-1")
+	agent.heartbeatTimer = 10 * time.Millisecond
+	profile := NFProfile{NFID: "amf-1", NFInstanceID: "amf-1", NFType: "AMF", Status: "REGISTERED"}
+
+	primary.fail(http.StatusServiceUnavailable)
+	if err := agent.Register(context.Background(), profile); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if agent.NRFURL() != secondary.URL || !secondary.registeredAt("amf-1") {
+		t.Fatalf("registered with %s, expected the secondary NRF", agent.NRFURL())
+	}
+
+	// The heartbeats fail over back to the primary NRF, which does not
+	// hold the registration
+	runHeartbeat(t, agent, profile)
+	primary.fail(0)
+	secondary.fail(http.StatusInternalServerError)
+	eventually(t, func() bool { return primary.registeredAt("amf-1") }, "the NF to register with the primary NRF")
+	if agent.NRFURL() != primary.URL {
+		t.Errorf("using %s, expected the primary NRF", agent.NRFURL())
+	}
+
+	// Without any NRF answering, the last 5xx is returned
+	primary.fail(http.StatusBadGateway)
+	err := agent.Register(context.Background(), profile)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Register returned %v, expected the 500 of the secondary NRF", err)
+	}
+}
+
+// TestDiscoveryCache checks that discovery results are reused until their
+// validity period ends, then revalidated with their ETag
+func TestDiscoveryCache(t *testing.T) {
+	nrf := newFakeNRF(t)
+	nrf.setProfile(NFProfile{NFID: "udm-1", NFType: "UDM", Status: "REGISTERED"})
+	agent := NewNRFClient(nrf.URL, "AMF", "amf-1")
+	ctx := context.Background()
+	expire := func() {
+		agent.mu.Lock()
+		agent.discoveries["UDM"].expires = time.Now()
+		agent.mu.Unlock()
+	}
+	discover := func(expected ...string) {
+		t.Helper()
+		profiles, err := agent.DiscoverContext(ctx, "udm")
+		if err != nil {
+			t.Fatalf("Discover: %v", err)
+		}
+		var ids []string
+		for _, profile := range profiles {
+			ids = append(ids, profile.NFID)
+		}
+		if len(ids) != len(expected) || (len(ids) > 0 && ids[0] != expected[0]) || (len(ids) > 1 && ids[1] != expected[1]) {
+			t.Errorf("discovered %v, expected %v", ids, expected)
+		}
+	}
+	queries := func(expected int) {
+		t.Helper()
+		if got := nrf.received("GET /nnrf-disc/v1/nfs"); got != expected {
+			t.Errorf("%d discovery queries, expected %d", got, expected)
+		}
+	}
+
+	discover("udm-1")
+	discover("udm-1")
+	queries(1)
+
+	// Unchanged results are revalidated, changed ones replaced
+	expire()
+	discover("udm-1")
+	queries(2)
+	agent.mu.Lock()
+	etag := agent.discoveries["UDM"].etag
+	agent.mu.Unlock()
+	if etag == "" {
+		t.Errorf("revalidated result lost its ETag")
+	}
+	nrf.setProfile(NFProfile{NFID: "udm-2", NFType: "UDM", Status: "REGISTERED"})
+	discover("udm-1")
+	expire()
+	discover("udm-1", "udm-2")
+	queries(3)
+
+	// Failing to query the NRF does not leave stale results behind
+	expire()
+	nrf.fail(http.StatusServiceUnavailable)
+	if _, err := agent.DiscoverContext(ctx, "UDM"); err == nil {
+		t.Errorf("Discover succeeded without an NRF")
+	}
+}
+
+// TestAccessTokenCache checks that tokens are cached per target NF type and
+// scope, and so are refusals for a while
+func TestAccessTokenCache(t *testing.T) {
+	nrf := newFakeNRF(t)
+	nrf.setProfile(NFProfile{NFID: "udm-1", NFType: "UDM", Status: "REGISTERED", NFServices: []NFService{
+		{ServiceInstanceID: "sdm", ServiceName: "nudm-sdm"},
+		{ServiceInstanceID: "uecm", ServiceName: "nudm-uecm"},
+	}})
+	agent := NewNRFClient(nrf.URL, "AMF", "amf-1")
+	ctx := context.Background()
+	requests := 0
+	tests := []struct {
+		name         string
+		targetNFType string
+		scope        string
+		expire       bool // the cached token expired
+		requested    bool
+		refused      bool
+	}{
+		{"first token", "UDM", "nudm-sdm", false, true, false},
+		{"same scope", "UDM", "nudm-sdm", false, false, false},
+		{"same scope, type in lower case", "udm", "nudm-sdm", false, false, false},
+		{"other scope", "UDM", "nudm-uecm", false, true, false},
+		{"expired token", "UDM", "nudm-sdm", true, true, false},
+		{"refused scope", "UDM", "nudm-ueau", false, true, true},
+		{"refused scope again", "UDM", "nudm-ueau", false, false, true},
+	}
+	tokens := make(map[string]string)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expire {
+				agent.mu.Lock()
+				agent.tokens["UDM "+tt.scope].expires = time.Now()
+				agent.mu.Unlock()
+			}
+			token, err := agent.AccessToken(ctx, tt.targetNFType, tt.scope)
+			if tt.refused != (err != nil) {
+				t.Fatalf("AccessToken: %v, expected refused: %v", err, tt.refused)
+			}
+			if tt.requested {
+				requests++
+			}
+			if got := nrf.received("POST /oauth2/token"); got != requests {
+				t.Errorf("%d token requests, expected %d", got, requests)
+			}
+			if previous, ok := tokens[tt.scope]; ok && !tt.requested && token != previous {
+				t.Errorf("cached token not reused")
+			}
+			tokens[tt.scope] = token
+		})
+	}
+}
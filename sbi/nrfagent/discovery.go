@@ -0,0 +1,150 @@
+package nrfagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cachedDiscovery holds the profiles of one NF type returned by the NRF
+type cachedDiscovery struct {
+	profiles []NFProfile
+	etag     string
+	validity time.Duration
+	expires  time.Time
+}
+
+// Discover returns the NF instances of a type. Results are cached for the
+// validity period given by the NRF and kept up to date by status
+// notifications in the meantime. An expired result is revalidated with its
+// ETag, so an unchanged result is not transferred again.
+func (n *NRFClient) Discover(nfType string) ([]NFProfile, error) {
+	return n.DiscoverContext(context.Background(), nfType)
+}
+
+// DiscoverContext is Discover with a context for the request to the NRF
+func (n *NRFClient) DiscoverContext(ctx context.Context, nfType string) ([]NFProfile, error) {
+	nfType = strings.ToUpper(nfType)
+
+	n.mu.Lock()
+	cached := n.discoveries[nfType]
+	if cached != nil && time.Now().Before(cached.expires) {
+		profiles := append([]NFProfile(nil), cached.profiles...)
+		n.mu.Unlock()
+		return profiles, nil
+	}
+	n.mu.Unlock()
+
+	// Subscribe first, so that no change after the query goes unnoticed
+	n.ensureSubscribed(ctx, nfType)
+
+	result, err := n.queryNRF(ctx, nfType, cached)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query NRF: %w", err)
+	}
+
+	n.mu.Lock()
+	n.discoveries[nfType] = result
+	profiles := append([]NFProfile(nil), result.profiles...)
+	n.mu.Unlock()
+	return profiles, nil
+}
+
+// queryNRF sends a discovery request for an NF type. With a previous
+// result, the request is conditional and a 304 answer renews that result.
+func (n *NRFClient) queryNRF(ctx context.Context, nfType string, previous *cachedDiscovery) (*cachedDiscovery, error) {
+	query := url.Values{}
+	query.Set("target-nf-type", nfType)
+	query.Set("requester-nf-type", n.nfType)
+	resp, err := n.do(ctx, func(nrfURL string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, nrfURL+"/nnrf-disc/v1/nfs?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil && previous.etag != "" {
+			req.Header.Set("If-None-Match", previous.etag)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && previous != nil:
+		validity := maxAge(resp.Header.Get("Cache-Control"), previous.validity)
+		return &cachedDiscovery{
+			profiles: previous.profiles,
+			etag:     previous.etag,
+			validity: validity,
+			expires:  time.Now().Add(validity),
+		}, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, &StatusError{Method: http.MethodGet, URL: resp.Request.URL.String(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var result SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode NRF response: %w", err)
+	}
+	validity := time.Duration(result.ValidityPeriod) * time.Second
+	return &cachedDiscovery{
+		profiles: result.NFInstances,
+		etag:     resp.Header.Get("ETag"),
+		validity: validity,
+		expires:  time.Now().Add(validity),
+	}, nil
+}
+
+// maxAge reads the max-age directive of a Cache-Control header
+func maxAge(cacheControl string, fallback time.Duration) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if seconds, err := strconv.Atoi(value); err == nil {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return fallback
+}
+
+// applyToCache updates the cached discovery results after a status
+// notification. A profile that is no longer REGISTERED is not discoverable
+// and leaves the cache, as does a deregistered NF. A result changed this way
+// is no longer the one the NRF tagged, so its ETag is dropped. It returns
+// the NF type of the instance when known.
+func (n *NRFClient) applyToCache(event, nfInstanceID string, profile *NFProfile) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	nfType := ""
+	for cachedType, cached := range n.discoveries {
+		kept := cached.profiles[:0:0]
+		for _, p := range cached.profiles {
+			if p.NFID == nfInstanceID {
+				nfType = cachedType
+				cached.etag = ""
+				continue
+			}
+			kept = append(kept, p)
+		}
+		cached.profiles = kept
+	}
+	if profile == nil {
+		return nfType
+	}
+
+	nfType = strings.ToUpper(profile.NFType)
+	if cached := n.discoveries[nfType]; cached != nil && event != NFDeregistered && profile.Status == "REGISTERED" {
+		cached.profiles = append(cached.profiles, *profile)
+		cached.etag = ""
+	}
+	return nfType
+}
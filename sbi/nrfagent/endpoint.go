@@ -0,0 +1,165 @@
+package nrfagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrNoInstance is returned when the NRF knows no instance offering a service
+var ErrNoInstance = errors.New("no NF instance offers the service")
+
+// ServiceURL returns the API root of a service of an NF type, e.g.
+// http://10.0.0.5:8080, from the first instance offering it in the order
+// the NRF ranked them. serviceName may be empty to accept any instance.
+func (n *NRFClient) ServiceURL(ctx context.Context, nfType, serviceName string) (string, error) {
+	profiles, err := n.DiscoverContext(ctx, nfType)
+	if err != nil {
+		return "", err
+	}
+	for _, profile := range profiles {
+		if apiRoot, ok := serviceAPIRoot(profile, serviceName); ok {
+			return apiRoot, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s %s", ErrNoInstance, strings.ToUpper(nfType), serviceName)
+}
+
+// serviceAPIRoot builds the API root of a service from a profile. The
+// service declaration wins over the service URLs and addresses of the
+// profile; a profile declaring services but not this one does not offer it.
+func serviceAPIRoot(profile NFProfile, serviceName string) (string, bool) {
+	for _, service := range profile.NFServices {
+		if serviceName != "" && service.ServiceName != serviceName {
+			continue
+		}
+		scheme := service.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		host, port := service.FQDN, 0
+		if len(service.IPEndPoints) > 0 {
+			endpoint := service.IPEndPoints[0]
+			port = endpoint.Port
+			if host == "" {
+				host = endpoint.IPv4Address
+			}
+			if host == "" {
+				host = endpoint.IPv6Address
+			}
+		}
+		if host == "" {
+			host = profileHost(profile)
+		}
+		if host == "" {
+			continue
+		}
+		if port > 0 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		apiRoot := scheme + "://" + host
+		if prefix := strings.Trim(service.APIPrefix, "/"); prefix != "" {
+			apiRoot += "/" + prefix
+		}
+		return apiRoot, true
+	}
+	if serviceName != "" && len(profile.NFServices) > 0 {
+		return "", false
+	}
+
+	if len(profile.ServiceURLs) > 0 {
+		return strings.TrimSuffix(profile.ServiceURLs[0], "/"), true
+	}
+	if host := profileHost(profile); host != "" {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return "http://" + host, true
+	}
+	return "", false
+}
+
+// profileHost returns the FQDN of an NF, or else its first IP address
+func profileHost(profile NFProfile) string {
+	if profile.FQDN != "" {
+		return profile.FQDN
+	}
+	if len(profile.IPAddresses) > 0 {
+		return profile.IPAddresses[0]
+	}
+	return ""
+}
+
+// Endpoint locates a service of a producer NF. With an agent, every use
+// asks it for the best ranked instance, which is served from its discovery
+// cache; without one, or when the NRF cannot tell, Fallback is used.
+type Endpoint struct {
+	agent       *NRFClient
+	nfType      string
+	serviceName string
+	fallback    string
+	client      *http.Client
+}
+
+// NewEndpoint creates an endpoint for a service of an NF type. agent may be
+// nil when the NF does not use an NRF.
+func NewEndpoint(agent *NRFClient, nfType, serviceName, fallback string) *Endpoint {
+	e := &Endpoint{agent: agent, nfType: nfType, serviceName: serviceName, fallback: fallback}
+	e.client = &http.Client{Transport: &tokenTransport{endpoint: e, base: http.DefaultTransport}}
+	return e
+}
+
+// Client returns the HTTP client to send requests to the service with.
+// With an agent, it presents an access token for the service, whose name
+// is the scope, to producers that require one (TS 33.501 13.4.1).
+func (e *Endpoint) Client() *http.Client {
+	return e.client
+}
+
+// URL returns the API root of the service
+func (e *Endpoint) URL() string {
+	return e.URLContext(context.Background())
+}
+
+// URLContext is URL with a context for the discovery request to the NRF
+func (e *Endpoint) URLContext(ctx context.Context) string {
+	if e.agent == nil {
+		return e.fallback
+	}
+	apiRoot, err := e.agent.ServiceURL(ctx, e.nfType, e.serviceName)
+	if err != nil {
+		log.Printf("Failed to locate %s %s through NRF, using %s: %v", e.nfType, e.serviceName, e.fallback, err)
+		return e.fallback
+	}
+	return apiRoot
+}
+
+// tokenTransport adds the access token of an endpoint to its requests. A
+// request goes without a token when none can be had, for the producer to
+// refuse it if it requires one.
+type tokenTransport struct {
+	endpoint *Endpoint
+	base     http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := t.endpoint
+	if e.agent == nil || req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	token, err := e.agent.AccessToken(req.Context(), e.nfType, e.serviceName)
+	if err != nil {
+		log.Printf("Sending request to %s %s without an access token: %v", e.nfType, e.serviceName, err)
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,64 @@
+package nrfagent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danipopa/mob5g/sbi/oauth"
+)
+
+// TestEndpointTokenAcceptedByProducer checks that the token an endpoint
+// gets for its service is accepted by a producer requiring the service it
+// registered as scope, as the SMF microservices do
+func TestEndpointTokenAcceptedByProducer(t *testing.T) {
+	nrf := newFakeNRF(t)
+	ctx := context.Background()
+
+	const serviceName = "smf-n4"
+	t.Setenv("NRF_URL", nrf.URL)
+	t.Setenv("NF_INSTANCE_ID", "smf-n4-1")
+	t.Setenv("NF_API_ROOT", "http://smf-n4-service:8084")
+	t.Setenv("NF_PLMN", "")
+	producerAgent, profile, err := FromEnv("SMF", "", serviceName)
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if err := producerAgent.Register(ctx, profile); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	validator, err := oauth.NewValidator(oauth.Config{JWKSURL: nrf.URL + "/oauth2/jwks", Issuer: "nrf", Audience: []string{"SMF"}})
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	producer := httptest.NewServer(validator.RequireScope(serviceName)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	defer producer.Close()
+
+	consumerAgent := NewNRFClient(nrf.URL, "SMF", "smf-session-controller-1")
+	tests := []struct {
+		name        string
+		serviceName string
+		status      int
+	}{
+		{"registered service", serviceName, http.StatusNoContent},
+		// The NRF refuses the token, and the request goes without one
+		{"service the producer does not register", "nsmf-pdusession", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := NewEndpoint(consumerAgent, "SMF", tt.serviceName, producer.URL)
+			resp, err := endpoint.Client().Post(producer.URL+"/n4/establish-session", "application/json", nil)
+			if err != nil {
+				t.Fatalf("Post: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, expected %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package nrfagent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FromEnv creates an agent for an NF of type nfType offering the given
+// services, and the profile it registers. It reads:
+//   - NRF_URL, the NRF API root, or a comma separated list of them in order
+//     of preference. Without it FromEnv returns a nil agent, meaning that
+//     the NF does not use an NRF.
+//   - NF_INSTANCE_ID, which defaults to the host name, e.g. the pod name.
+//   - NF_API_ROOT, the URL on which other NFs reach this one, which
+//     defaults to defaultAPIRoot. NRF notifications are received on it too.
+//   - NF_PLMN, the PLMN of the NF as mcc-mnc, e.g. 001-01.
+//   - NF_TLS_CERT_FILE and NF_TLS_KEY_FILE, the client certificate of the
+//     NF instance, presented to the NRF over HTTPS. The NRF only issues
+//     access tokens to NFs authenticated by it.
+//   - NRF_CA_FILE, the CAs the NRF certificate is verified against, which
+//     default to the system ones.
+func FromEnv(nfType, defaultAPIRoot string, serviceNames ...string) (*NRFClient, NFProfile, error) {
+	var nrfURLs []string
+	for _, nrfURL := range strings.Split(os.Getenv("NRF_URL"), ",") {
+		if nrfURL = strings.TrimSpace(nrfURL); nrfURL != "" {
+			nrfURLs = append(nrfURLs, nrfURL)
+		}
+	}
+	if len(nrfURLs) == 0 {
+		return nil, NFProfile{}, nil
+	}
+
+	nfID := os.Getenv("NF_INSTANCE_ID")
+	if nfID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, NFProfile{}, fmt.Errorf("NF_INSTANCE_ID is not set and the host name is unknown: %w", err)
+		}
+		nfID = hostname
+	}
+
+	apiRoot := os.Getenv("NF_API_ROOT")
+	if apiRoot == "" {
+		apiRoot = defaultAPIRoot
+	}
+	apiRoot = strings.TrimSuffix(apiRoot, "/")
+	root, err := url.Parse(apiRoot)
+	if err != nil || (root.Scheme != "http" && root.Scheme != "https") || root.Hostname() == "" {
+		return nil, NFProfile{}, fmt.Errorf("invalid NF API root %q", apiRoot)
+	}
+
+	profile := NFProfile{
+		NFID:         nfID,
+		NFInstanceID: nfID,
+		NFType:       strings.ToUpper(nfType),
+		Status:       "REGISTERED",
+		ServiceURLs:  []string{apiRoot},
+	}
+
+	// The services are reachable on the host and port of the API root
+	var endpoint IPEndPoint
+	if port := root.Port(); port != "" {
+		endpoint.Port, _ = strconv.Atoi(port)
+	} else if root.Scheme == "https" {
+		endpoint.Port = 443
+	} else {
+		endpoint.Port = 80
+	}
+	serviceFQDN := ""
+	if ip := net.ParseIP(root.Hostname()); ip == nil {
+		profile.FQDN = root.Hostname()
+		serviceFQDN = root.Hostname()
+	} else {
+		profile.IPAddresses = []string{ip.String()}
+		if ip.To4() != nil {
+			endpoint.IPv4Address = ip.String()
+		} else {
+			endpoint.IPv6Address = ip.String()
+		}
+	}
+	for _, name := range serviceNames {
+		profile.NFServices = append(profile.NFServices, NFService{
+			ServiceInstanceID: name,
+			ServiceName:       name,
+			Scheme:            root.Scheme,
+			FQDN:              serviceFQDN,
+			IPEndPoints:       []IPEndPoint{endpoint},
+			APIPrefix:         strings.Trim(root.Path, "/"),
+		})
+	}
+
+	if plmn := os.Getenv("NF_PLMN"); plmn != "" {
+		mcc, mnc, ok := strings.Cut(plmn, "-")
+		if !ok {
+			return nil, NFProfile{}, fmt.Errorf("invalid NF_PLMN %q, expected mcc-mnc", plmn)
+		}
+		profile.PLMNID = &PLMN{MCC: mcc, MNC: mnc}
+	}
+
+	agent := NewNRFClientWithFailover(nrfURLs, nfType, nfID)
+	tlsConfig, err := tlsConfigFromEnv()
+	if err != nil {
+		return nil, NFProfile{}, err
+	}
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		agent.httpClient.Transport = transport
+	}
+	agent.SetNotificationURI(apiRoot + NotificationPath)
+	return agent, profile, nil
+}
+
+// tlsConfigFromEnv reads the client certificate of the NF and the CAs of
+// the NRF. It returns nil when neither is configured.
+func tlsConfigFromEnv() (*tls.Config, error) {
+	certFile, keyFile, caFile := os.Getenv("NF_TLS_CERT_FILE"), os.Getenv("NF_TLS_KEY_FILE"), os.Getenv("NRF_CA_FILE")
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the NF client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read NRF_CA_FILE: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,100 @@
+package nrfagent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// NRFURL returns the API root of the NRF in use
+func (n *NRFClient) NRFURL() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.nrfURLs[n.active]
+}
+
+// do sends a request built by newRequest for the API root of an NRF. It
+// starts with the NRF in use and, when an NRF cannot be reached or answers
+// with a 5xx status, fails over to the next one in the list, wrapping
+// around, until each was tried once. The NRF that answers becomes the one
+// in use. The 5xx response of the last NRF is returned when none answers
+// otherwise.
+func (n *NRFClient) do(ctx context.Context, newRequest func(nrfURL string) (*http.Request, error)) (*http.Response, error) {
+	n.mu.Lock()
+	first := n.active
+	n.mu.Unlock()
+
+	var lastErr error
+	for i := range n.nrfURLs {
+		index := (first + i) % len(n.nrfURLs)
+		req, err := newRequest(n.nrfURLs[index])
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := n.httpClient.Do(req)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		case err != nil:
+			lastErr = fmt.Errorf("failed to send request: %w", err)
+		case resp.StatusCode >= http.StatusInternalServerError && i < len(n.nrfURLs)-1:
+			resp.Body.Close()
+			lastErr = &StatusError{Method: req.Method, URL: req.URL.String(), StatusCode: resp.StatusCode, Status: resp.Status}
+		case resp.StatusCode >= http.StatusInternalServerError:
+			return resp, nil
+		default:
+			n.use(index)
+			return resp, nil
+		}
+		if len(n.nrfURLs) > 1 {
+			log.Printf("NRF %s is unavailable: %v", n.nrfURLs[index], lastErr)
+		}
+	}
+	return nil, lastErr
+}
+
+// use makes an NRF the one in use. When the NF is registered with another
+// NRF, the heartbeat loop is told to register it with this one.
+func (n *NRFClient) use(index int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if index == n.active {
+		return
+	}
+	log.Printf("Failing over from NRF %s to NRF %s", n.nrfURLs[n.active], n.nrfURLs[index])
+	n.active = index
+	if n.registeredWith >= 0 && n.registeredWith != index {
+		select {
+		case n.failover <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// registered records that the NRF in use holds the registration of the NF
+func (n *NRFClient) registered() {
+	n.mu.Lock()
+	n.registeredWith = n.active
+	n.mu.Unlock()
+
+	// A failover that happened while registering is already dealt with
+	select {
+	case <-n.failover:
+	default:
+	}
+}
+
+// reregister registers the NF with the NRF it failed over to, and moves its
+// status subscriptions there. The old subscriptions are removed through
+// the new NRF, which knows them when the NRFs share their state.
+func (n *NRFClient) reregister(ctx context.Context, profile NFProfile) error {
+	log.Printf("Registering %s with NRF %s after failover", n.nfID, n.NRFURL())
+	if err := n.RegisterWithRetry(ctx, profile); err != nil {
+		return err
+	}
+	n.unsubscribeAll(ctx)
+	n.subscribeWatchedTypes(ctx)
+	return nil
+}
@@ -0,0 +1,344 @@
+package nrfagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// NF status notification events (TS 29.510 NotificationEventType)
+const (
+	NFRegistered     = "NF_REGISTERED"
+	NFDeregistered   = "NF_DEREGISTERED"
+	NFProfileChanged = "NF_PROFILE_CHANGED"
+)
+
+// subscriptionsPath is the path of the status subscriptions in the NRF
+const subscriptionsPath = "/nnrf-nfm/v1/subscriptions"
+
+// requestedSubscriptionValidity is the validity asked for on renewal
+const requestedSubscriptionValidity = 24 * time.Hour
+
+// NotificationPath is the path, relative to the API root of the NF, on
+// which ServeNotifications receives NF status notifications
+const NotificationPath = "/nrf-notifications"
+
+// NotificationData is an NF status notification sent by the NRF
+type NotificationData struct {
+	Event         string     `json:"event"`
+	NFInstanceURI string     `json:"nfInstanceUri"`
+	NFProfile     *NFProfile `json:"nfProfile,omitempty"`
+}
+
+// NFStatusHandlers are called when the NRF reports a change of an NF of the
+// type they were registered for. Any of them may be nil.
+type NFStatusHandlers struct {
+	OnRegistered     func(profile NFProfile)
+	OnProfileChanged func(profile NFProfile)
+	// OnDeregistered receives the last profile of the NF known to the agent.
+	// NFs the agent never discovered are not reported, their type is unknown.
+	OnDeregistered func(profile NFProfile)
+}
+
+// subscription is a status subscription of the agent for one NF type
+type subscription struct {
+	path         string // Relative to the NRF API root
+	validityTime time.Time
+}
+
+// SetNotificationURI sets the URI on which the NF receives NF status
+// notifications, served by HandleNotification. Without it the agent does
+// not subscribe and its cache only relies on validity periods.
+func (n *NRFClient) SetNotificationURI(uri string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notificationURI = uri
+}
+
+// OnNFStatus registers the handlers called on changes of NFs of a type.
+// The agent subscribes for that type when it registers, or on the next
+// discovery if it is already registered.
+func (n *NRFClient) OnNFStatus(nfType string, handlers NFStatusHandlers) {
+	nfType = strings.ToUpper(nfType)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers[nfType] = append(n.handlers[nfType], handlers)
+}
+
+// Subscribe subscribes to notifications from the NRF
+func (n *NRFClient) Subscribe(subscriptionPayload map[string]interface{}) error {
+	return n.send(context.Background(), http.MethodPost, subscriptionsPath, "application/json", subscriptionPayload, nil)
+}
+
+// subscribeWatchedTypes subscribes for every NF type that has handlers,
+// and renews the subscriptions about to expire, including those made on
+// discovery
+func (n *NRFClient) subscribeWatchedTypes(ctx context.Context) {
+	n.mu.Lock()
+	nfTypes := make([]string, 0, len(n.handlers)+len(n.subscriptions))
+	for nfType := range n.handlers {
+		nfTypes = append(nfTypes, nfType)
+	}
+	for nfType := range n.subscriptions {
+		if _, watched := n.handlers[nfType]; !watched {
+			nfTypes = append(nfTypes, nfType)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, nfType := range nfTypes {
+		n.ensureSubscribed(ctx, nfType)
+	}
+}
+
+// ensureSubscribed subscribes for status changes of an NF type, unless a
+// subscription exists that stays valid for more than a heartbeat timer.
+// One that expires sooner is renewed, so that no change goes unnoticed
+// between heartbeats. Failures are logged: the cache then relies on
+// validity periods alone.
+func (n *NRFClient) ensureSubscribed(ctx context.Context, nfType string) {
+	now := time.Now()
+	n.mu.Lock()
+	notificationURI := n.notificationURI
+	current, subscribed := n.subscriptions[nfType]
+	renewBefore := n.heartbeatTimer
+	n.mu.Unlock()
+	if notificationURI == "" || (subscribed && current.validityTime.Sub(now) > renewBefore) {
+		return
+	}
+
+	if subscribed && now.Before(current.validityTime) {
+		err := n.renewSubscription(ctx, nfType, current)
+		switch {
+		case err == nil, ctx.Err() != nil:
+			return
+		case !isNotFoundError(err):
+			// Retried on the next heartbeat while the subscription lasts
+			log.Printf("Failed to renew subscription to %s status changes: %v", nfType, err)
+			return
+		}
+		log.Printf("NRF no longer knows the subscription to %s status changes, subscribing again", nfType)
+	}
+
+	payload := map[string]interface{}{
+		"nfStatusNotificationUri": notificationURI,
+		"subscrCond":              map[string]string{"nfType": nfType},
+		"reqNotifEvents":          []string{NFRegistered, NFDeregistered, NFProfileChanged},
+		"reqNfType":               n.nfType,
+	}
+	var created struct {
+		SubscriptionID string    `json:"subscriptionId"`
+		ValidityTime   time.Time `json:"validityTime"`
+	}
+	if err := n.send(ctx, http.MethodPost, subscriptionsPath, "application/json", payload, &created); err != nil {
+		log.Printf("Failed to subscribe to %s status changes: %v", nfType, err)
+		return
+	}
+
+	n.mu.Lock()
+	n.subscriptions[nfType] = subscription{
+		path:         subscriptionsPath + "/" + url.PathEscape(created.SubscriptionID),
+		validityTime: created.ValidityTime,
+	}
+	n.mu.Unlock()
+	log.Printf("Subscribed to %s status changes until %s", nfType, created.ValidityTime.Format(time.RFC3339))
+}
+
+// renewSubscription extends the validity of a subscription. The NRF grants
+// at most its own maximum validity, which the agent asks for.
+func (n *NRFClient) renewSubscription(ctx context.Context, nfType string, current subscription) error {
+	patch := []PatchItem{{Op: "replace", Path: "/validityTime", Value: time.Now().Add(requestedSubscriptionValidity).UTC()}}
+	var renewed struct {
+		ValidityTime time.Time `json:"validityTime"`
+	}
+	if err := n.send(ctx, http.MethodPatch, current.path, "application/json-patch+json", patch, &renewed); err != nil {
+		return err
+	}
+	if renewed.ValidityTime.IsZero() {
+		return fmt.Errorf("NRF returned no validityTime")
+	}
+
+	n.mu.Lock()
+	if s, ok := n.subscriptions[nfType]; ok && s.path == current.path {
+		s.validityTime = renewed.ValidityTime
+		n.subscriptions[nfType] = s
+	}
+	n.mu.Unlock()
+	log.Printf("Renewed subscription to %s status changes until %s", nfType, renewed.ValidityTime.Format(time.RFC3339))
+	return nil
+}
+
+// unsubscribeAll removes the subscriptions of the agent. Subscriptions
+// the NRF no longer knows are simply forgotten.
+func (n *NRFClient) unsubscribeAll(ctx context.Context) {
+	n.mu.Lock()
+	subscriptions := n.subscriptions
+	n.subscriptions = make(map[string]subscription)
+	n.mu.Unlock()
+
+	for nfType, s := range subscriptions {
+		if err := n.send(ctx, http.MethodDelete, s.path, "", nil, nil); err != nil && !isNotFoundError(err) {
+			log.Printf("Failed to unsubscribe from %s status changes: %v", nfType, err)
+		}
+	}
+}
+
+// HandleNotification processes incoming notifications from the NRF: it
+// updates the discovery cache and calls the handlers of the NF type.
+// Notifications are not authenticated, so they only tell the agent which NF
+// to look up: its profile is read from the NRF, and notifications about NF
+// types the agent is not subscribed to are rejected.
+func (n *NRFClient) HandleNotification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var notification NotificationData
+	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+		http.Error(w, "Failed to parse notification payload", http.StatusBadRequest)
+		return
+	}
+
+	switch notification.Event {
+	case NFRegistered, NFProfileChanged, NFDeregistered:
+	default:
+		http.Error(w, "Unsupported event "+notification.Event, http.StatusBadRequest)
+		return
+	}
+	nfInstanceID := path.Base(notification.NFInstanceURI)
+	if nfInstanceID == "" || nfInstanceID == "." || nfInstanceID == "/" {
+		http.Error(w, "nfInstanceUri is required", http.StatusBadRequest)
+		return
+	}
+
+	// The NF type is the notified one, or for a deregistration the one of
+	// the last known profile
+	last := n.cachedProfile(nfInstanceID)
+	nfType := ""
+	switch {
+	case notification.NFProfile != nil:
+		nfType = strings.ToUpper(notification.NFProfile.NFType)
+	case last != nil:
+		nfType = strings.ToUpper(last.NFType)
+	case notification.Event == NFDeregistered:
+		// An NF the agent never discovered: there is nothing to forget
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !n.subscribedTo(nfType) {
+		http.Error(w, "No subscription to "+nfType+" status changes", http.StatusForbidden)
+		return
+	}
+
+	profile, err := n.fetchProfile(r.Context(), nfInstanceID)
+	if err != nil {
+		// The NRF retries the notification
+		log.Printf("Failed to read the profile of %s notified as %s: %v", nfInstanceID, notification.Event, err)
+		http.Error(w, "Failed to read the NF profile from the NRF", http.StatusServiceUnavailable)
+		return
+	}
+	if profile != nil && strings.ToUpper(profile.NFType) != nfType {
+		nfType = strings.ToUpper(profile.NFType)
+		if !n.subscribedTo(nfType) {
+			http.Error(w, "No subscription to "+nfType+" status changes", http.StatusForbidden)
+			return
+		}
+	}
+	if (profile == nil) != (notification.Event == NFDeregistered) {
+		// Outdated, or not sent by the NRF: the cache follows the NRF, but
+		// the handlers are not called
+		if profile == nil {
+			n.applyToCache(NFDeregistered, nfInstanceID, nil)
+		} else {
+			n.applyToCache(NFProfileChanged, nfInstanceID, profile)
+		}
+		log.Printf("Ignoring %s for %s, which the NRF does not confirm", notification.Event, nfInstanceID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	n.applyToCache(notification.Event, nfInstanceID, profile)
+	log.Printf("NRF reported %s for %s %s", notification.Event, nfType, nfInstanceID)
+
+	n.mu.Lock()
+	handlers := append([]NFStatusHandlers(nil), n.handlers[nfType]...)
+	n.mu.Unlock()
+	for _, h := range handlers {
+		switch {
+		case notification.Event == NFRegistered && h.OnRegistered != nil:
+			h.OnRegistered(*profile)
+		case notification.Event == NFProfileChanged && h.OnProfileChanged != nil:
+			h.OnProfileChanged(*profile)
+		case notification.Event == NFDeregistered && h.OnDeregistered != nil:
+			deregistered := NFProfile{NFID: nfInstanceID, NFType: nfType}
+			if last != nil {
+				deregistered = *last
+			}
+			h.OnDeregistered(deregistered)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// subscribedTo reports whether the agent holds a valid subscription to
+// status changes of an NF type
+func (n *NRFClient) subscribedTo(nfType string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s, ok := n.subscriptions[nfType]
+	return ok && time.Now().Before(s.validityTime)
+}
+
+// fetchProfile reads the profile of an NF instance from the NRF. It returns
+// nil when the NRF does not know the NF.
+func (n *NRFClient) fetchProfile(ctx context.Context, nfInstanceID string) (*NFProfile, error) {
+	var profile NFProfile
+	err := n.send(ctx, http.MethodGet, nfInstancePath(nfInstanceID), "", nil, &profile)
+	if isNotFoundError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// ServeNotifications serves NRF notifications on the path of the
+// notification URI, NotificationPath by default, and hands every other
+// request to next. It wraps the authorization of the SBI server, as the NRF
+// does not present access tokens with its notifications.
+func (n *NRFClient) ServeNotifications(next http.Handler) http.Handler {
+	n.mu.Lock()
+	notificationPath := NotificationPath
+	if uri, err := url.Parse(n.notificationURI); err == nil && uri.Path != "" {
+		notificationPath = uri.Path
+	}
+	n.mu.Unlock()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == notificationPath {
+			n.HandleNotification(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cachedProfile returns the cached profile of an NF instance, if any
+func (n *NRFClient) cachedProfile(nfInstanceID string) *NFProfile {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, cached := range n.discoveries {
+		for _, profile := range cached.profiles {
+			if profile.NFID == nfInstanceID {
+				return &profile
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package nrfagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHandleNotification checks that notifications only change the cache
+// and reach the handlers as far as the NRF confirms them
+func TestHandleNotification(t *testing.T) {
+	udm1 := NFProfile{NFID: "udm-1", NFInstanceID: "udm-1", NFType: "UDM", Status: "REGISTERED", FQDN: "udm-1.example"}
+	udm2 := NFProfile{NFID: "udm-2", NFInstanceID: "udm-2", NFType: "UDM", Status: "REGISTERED", FQDN: "udm-2.example"}
+	smf1 := NFProfile{NFID: "smf-1", NFInstanceID: "smf-1", NFType: "SMF", Status: "REGISTERED", FQDN: "smf-1.example"}
+	forged := func(profile NFProfile, fqdn string) *NFProfile {
+		profile.FQDN = fqdn
+		return &profile
+	}
+
+	tests := []struct {
+		name         string
+		atNRF        func(nrf *fakeNRF)
+		notification NotificationData
+		status       int
+		events       []string          // "event nfID fqdn" reported to the handlers
+		cached       map[string]string // FQDNs of the cached UDMs, "" when not cached
+		lookups      int               // profiles read from the NRF
+	}{
+		{
+			name:         "registration",
+			atNRF:        func(nrf *fakeNRF) { nrf.setProfile(udm2) },
+			notification: NotificationData{Event: NFRegistered, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/udm-2", NFProfile: forged(udm2, "evil.example")},
+			status:       http.StatusNoContent,
+			events:       []string{"NF_REGISTERED udm-2 udm-2.example"},
+			cached:       map[string]string{"udm-1": "udm-1.example", "udm-2": "udm-2.example"},
+			lookups:      1,
+		},
+		{
+			name:         "registration unknown to the NRF",
+			notification: NotificationData{Event: NFRegistered, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/udm-2", NFProfile: &udm2},
+			status:       http.StatusNoContent,
+			cached:       map[string]string{"udm-1": "udm-1.example", "udm-2": ""},
+			lookups:      1,
+		},
+		{
+			name:         "profile change",
+			atNRF:        func(nrf *fakeNRF) { nrf.setProfile(*forged(udm1, "udm-1.moved.example")) },
+			notification: NotificationData{Event: NFProfileChanged, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/udm-1", NFProfile: forged(udm1, "evil.example")},
+			status:       http.StatusNoContent,
+			events:       []string{"NF_PROFILE_CHANGED udm-1 udm-1.moved.example"},
+			cached:       map[string]string{"udm-1": "udm-1.moved.example"},
+			lookups:      1,
+		},
+		{
+			name:         "deregistration",
+			atNRF:        func(nrf *fakeNRF) { nrf.removeProfile("udm-1") },
+			notification: NotificationData{Event: NFDeregistered, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/udm-1"},
+			status:       http.StatusNoContent,
+			events:       []string{"NF_DEREGISTERED udm-1 udm-1.example"},
+			cached:       map[string]string{"udm-1": ""},
+			lookups:      1,
+		},
+		{
+			name:         "deregistration of an NF still registered",
+			notification: NotificationData{Event: NFDeregistered, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/udm-1"},
+			status:       http.StatusNoContent,
+			cached:       map[string]string{"udm-1": "udm-1.example"},
+			lookups:      1,
+		},
+		{
+			name:         "deregistration of an NF never discovered",
+			notification: NotificationData{Event: NFDeregistered, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/udm-2"},
+			status:       http.StatusNoContent,
+			cached:       map[string]string{"udm-1": "udm-1.example"},
+		},
+		{
+			name:         "NF type not subscribed",
+			atNRF:        func(nrf *fakeNRF) { nrf.setProfile(smf1) },
+			notification: NotificationData{Event: NFRegistered, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/smf-1", NFProfile: &smf1},
+			status:       http.StatusForbidden,
+			cached:       map[string]string{"udm-1": "udm-1.example"},
+		},
+		{
+			name:         "NF type not subscribed, notified as subscribed",
+			atNRF:        func(nrf *fakeNRF) { nrf.setProfile(smf1) },
+			notification: NotificationData{Event: NFRegistered, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/smf-1", NFProfile: &NFProfile{NFID: "smf-1", NFType: "UDM"}},
+			status:       http.StatusForbidden,
+			cached:       map[string]string{"udm-1": "udm-1.example", "smf-1": ""},
+			lookups:      1,
+		},
+		{
+			name:         "NRF unavailable",
+			atNRF:        func(nrf *fakeNRF) { nrf.fail(http.StatusServiceUnavailable) },
+			notification: NotificationData{Event: NFProfileChanged, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/udm-1", NFProfile: forged(udm1, "evil.example")},
+			status:       http.StatusServiceUnavailable,
+			cached:       map[string]string{"udm-1": "udm-1.example"},
+			lookups:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrf := newFakeNRF(t)
+			nrf.setProfile(udm1)
+			agent := NewNRFClient(nrf.URL, "AMF", "amf-1")
+			agent.SetNotificationURI("http://amf:8080" + NotificationPath)
+			var events []string
+			record := func(event string) func(NFProfile) {
+				return func(profile NFProfile) { events = append(events, event+" "+profile.NFID+" "+profile.FQDN) }
+			}
+			for _, nfType := range []string{"UDM", "SMF"} {
+				agent.OnNFStatus(nfType, NFStatusHandlers{
+					OnRegistered:     record(NFRegistered),
+					OnProfileChanged: record(NFProfileChanged),
+					OnDeregistered:   record(NFDeregistered),
+				})
+			}
+			// Discovering the UDMs subscribes to their changes, not to the SMFs'
+			if _, err := agent.Discover("UDM"); err != nil {
+				t.Fatalf("Discover: %v", err)
+			}
+			if tt.atNRF != nil {
+				tt.atNRF(nrf)
+			}
+
+			body, _ := json.Marshal(tt.notification)
+			req := httptest.NewRequest(http.MethodPost, NotificationPath, bytes.NewReader(body))
+			rec := httptest.NewRecorder()
+			agent.ServeNotifications(http.NotFoundHandler()).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, expected %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if len(events) != len(tt.events) || (len(events) > 0 && events[0] != tt.events[0]) {
+				t.Errorf("handlers received %v, expected %v", events, tt.events)
+			}
+			for id, fqdn := range tt.cached {
+				cached := ""
+				if profile := agent.cachedProfile(id); profile != nil {
+					cached = profile.FQDN
+				}
+				if cached != fqdn {
+					t.Errorf("cached %s at %q, expected %q", id, cached, fqdn)
+				}
+			}
+			lookups := 0
+			for _, id := range []string{"udm-1", "udm-2", "smf-1"} {
+				lookups += nrf.received("GET /nnrf-nfm/v1/nf-instances/" + id)
+			}
+			if lookups != tt.lookups {
+				t.Errorf("%d profiles read from the NRF, expected %d", lookups, tt.lookups)
+			}
+		})
+	}
+}
+
+// TestNotificationTriggersRediscovery checks that a notified NF is
+// discovered from the cache without querying the NRF again
+func TestNotificationTriggersRediscovery(t *testing.T) {
+	nrf := newFakeNRF(t)
+	agent := NewNRFClient(nrf.URL, "AMF", "amf-1")
+	agent.SetNotificationURI("http://amf:8080" + NotificationPath)
+	ctx := context.Background()
+	if profiles, err := agent.DiscoverContext(ctx, "UDM"); err != nil || len(profiles) != 0 {
+		t.Fatalf("Discover: %v, %v", profiles, err)
+	}
+
+	udm := NFProfile{NFID: "udm-1", NFInstanceID: "udm-1", NFType: "UDM", Status: "REGISTERED"}
+	nrf.setProfile(udm)
+	body, _ := json.Marshal(NotificationData{Event: NFRegistered, NFInstanceURI: "/nnrf-nfm/v1/nf-instances/udm-1", NFProfile: &udm})
+	rec := httptest.NewRecorder()
+	agent.HandleNotification(rec, httptest.NewRequest(http.MethodPost, NotificationPath, bytes.NewReader(body)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	profiles, err := agent.DiscoverContext(ctx, "UDM")
+	if err != nil || len(profiles) != 1 || profiles[0].NFID != "udm-1" {
+		t.Errorf("discovered %v, %v, expected udm-1", profiles, err)
+	}
+	if queries := nrf.received("GET /nnrf-disc/v1/nfs"); queries != 1 {
+		t.Errorf("%d discovery queries, expected 1", queries)
+	}
+}
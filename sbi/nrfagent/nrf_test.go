@@ -0,0 +1,268 @@
+package nrfagent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeNRF serves the parts of the NRF APIs the agent uses, keeping the
+// registered profiles in memory
+type fakeNRF struct {
+	*httptest.Server
+	key *ecdsa.PrivateKey
+
+	mu            sync.Mutex
+	profiles      map[string]NFProfile
+	subscriptions map[string]string // NF types by subscription ID
+	requests      []string          // "METHOD path" of every request received
+	validity      int               // Validity period of discovery results, in seconds
+	failure       int               // Status answered to every request when not 0
+}
+
+func newFakeNRF(t *testing.T) *fakeNRF {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	nrf := &fakeNRF{key: key, profiles: make(map[string]NFProfile), subscriptions: make(map[string]string), validity: 60}
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /nnrf-nfm/v1/nf-instances/{id}", nrf.register)
+	mux.HandleFunc("GET /nnrf-nfm/v1/nf-instances/{id}", nrf.getProfile)
+	mux.HandleFunc("PATCH /nnrf-nfm/v1/nf-instances/{id}", nrf.heartbeat)
+	mux.HandleFunc("DELETE /nnrf-nfm/v1/nf-instances/{id}", nrf.deregister)
+	mux.HandleFunc("GET /nnrf-disc/v1/nfs", nrf.discover)
+	mux.HandleFunc("POST /nnrf-nfm/v1/subscriptions", nrf.subscribe)
+	mux.HandleFunc("PATCH /nnrf-nfm/v1/subscriptions/{id}", nrf.renewSubscription)
+	mux.HandleFunc("DELETE /nnrf-nfm/v1/subscriptions/{id}", nrf.unsubscribe)
+	mux.HandleFunc("POST /oauth2/token", nrf.issueToken)
+	mux.HandleFunc("GET /oauth2/jwks", nrf.tokenKeys)
+	nrf.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nrf.mu.Lock()
+		nrf.requests = append(nrf.requests, r.Method+" "+r.URL.Path)
+		failure := nrf.failure
+		nrf.mu.Unlock()
+		if failure != 0 {
+			http.Error(w, http.StatusText(failure), failure)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(nrf.Close)
+	return nrf
+}
+
+// received returns the requests received matching "METHOD path"
+func (nrf *fakeNRF) received(request string) int {
+	nrf.mu.Lock()
+	defer nrf.mu.Unlock()
+	count := 0
+	for _, r := range nrf.requests {
+		if r == request {
+			count++
+		}
+	}
+	return count
+}
+
+// fail makes the NRF answer every request with status, or serve them
+// again when status is 0
+func (nrf *fakeNRF) fail(status int) {
+	nrf.mu.Lock()
+	defer nrf.mu.Unlock()
+	nrf.failure = status
+}
+
+// setProfile registers or replaces a profile behind the back of the agents
+func (nrf *fakeNRF) setProfile(profile NFProfile) {
+	nrf.mu.Lock()
+	defer nrf.mu.Unlock()
+	nrf.profiles[profile.NFID] = profile
+}
+
+// removeProfile deregisters an NF behind the back of the agents
+func (nrf *fakeNRF) removeProfile(nfInstanceID string) {
+	nrf.mu.Lock()
+	defer nrf.mu.Unlock()
+	delete(nrf.profiles, nfInstanceID)
+}
+
+func (nrf *fakeNRF) register(w http.ResponseWriter, r *http.Request) {
+	var profile NFProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	nrf.mu.Lock()
+	nrf.profiles[r.PathValue("id")] = profile
+	nrf.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(profile)
+}
+
+func (nrf *fakeNRF) getProfile(w http.ResponseWriter, r *http.Request) {
+	nrf.mu.Lock()
+	profile, ok := nrf.profiles[r.PathValue("id")]
+	nrf.mu.Unlock()
+	if !ok {
+		http.Error(w, "NF not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+func (nrf *fakeNRF) heartbeat(w http.ResponseWriter, r *http.Request) {
+	nrf.mu.Lock()
+	_, ok := nrf.profiles[r.PathValue("id")]
+	nrf.mu.Unlock()
+	if !ok {
+		http.Error(w, "NF not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (nrf *fakeNRF) deregister(w http.ResponseWriter, r *http.Request) {
+	nrf.removeProfile(r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// discover returns the registered NFs of the target type, with an ETag
+// derived from them
+func (nrf *fakeNRF) discover(w http.ResponseWriter, r *http.Request) {
+	targetNFType := r.URL.Query().Get("target-nf-type")
+	nrf.mu.Lock()
+	result := SearchResult{ValidityPeriod: nrf.validity, NFInstances: []NFProfile{}}
+	for _, profile := range nrf.profiles {
+		if strings.EqualFold(profile.NFType, targetNFType) && profile.Status == "REGISTERED" {
+			result.NFInstances = append(result.NFInstances, profile)
+		}
+	}
+	nrf.mu.Unlock()
+	sort.Slice(result.NFInstances, func(i, j int) bool { return result.NFInstances[i].NFID < result.NFInstances[j].NFID })
+
+	data, _ := json.Marshal(result.NFInstances)
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", result.ValidityPeriod))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (nrf *fakeNRF) subscribe(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		SubscrCond struct {
+			NFType string `json:"nfType"`
+		} `json:"subscrCond"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	nrf.mu.Lock()
+	id := fmt.Sprintf("sub-%d", len(nrf.subscriptions)+1)
+	nrf.subscriptions[id] = request.SubscrCond.NFType
+	nrf.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/nnrf-nfm/v1/subscriptions/"+id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subscriptionId": id,
+		"validityTime":   time.Now().Add(time.Hour).UTC(),
+	})
+}
+
+func (nrf *fakeNRF) renewSubscription(w http.ResponseWriter, r *http.Request) {
+	nrf.mu.Lock()
+	_, ok := nrf.subscriptions[r.PathValue("id")]
+	nrf.mu.Unlock()
+	if !ok {
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"validityTime": time.Now().Add(time.Hour).UTC()})
+}
+
+func (nrf *fakeNRF) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	nrf.mu.Lock()
+	delete(nrf.subscriptions, r.PathValue("id"))
+	nrf.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// issueToken grants a service of an NF type as scope when a registered NF
+// of that type offers it, as the NRF does
+func (nrf *fakeNRF) issueToken(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	targetNFType, scope := r.PostForm.Get("targetNfType"), r.PostForm.Get("scope")
+	offered := false
+	nrf.mu.Lock()
+	for _, profile := range nrf.profiles {
+		for _, service := range profile.NFServices {
+			offered = offered || (strings.EqualFold(profile.NFType, targetNFType) && service.ServiceName == scope)
+		}
+	}
+	nrf.mu.Unlock()
+	if !offered {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_scope"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss":   "nrf",
+		"sub":   r.PostForm.Get("nfInstanceId"),
+		"aud":   targetNFType,
+		"scope": scope,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "nrf-key"
+	signed, err := token.SignedString(nrf.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": signed,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"scope":        scope,
+	})
+}
+
+func (nrf *fakeNRF) tokenKeys(w http.ResponseWriter, r *http.Request) {
+	pub := nrf.key.PublicKey
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"crv": "P-256",
+			"kid": "nrf-key",
+			"x":   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+		}},
+	})
+}
@@ -0,0 +1,104 @@
+package nrfagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// tokenRenewMargin is how long before its expiry a token is replaced
+	tokenRenewMargin = 30 * time.Second
+	// tokenRetryInterval is how long a failure to get a token is remembered,
+	// so that requests do not each ask the NRF again
+	tokenRetryInterval = 30 * time.Second
+)
+
+// cachedToken is an access token, or the error the NRF answered with
+type cachedToken struct {
+	token   string
+	err     error
+	expires time.Time
+}
+
+// AccessToken returns an access token for a service of an NF type, from
+// the Nnrf_AccessToken service of the NRF (TS 29.510 5.4). Tokens are
+// cached until shortly before they expire.
+func (n *NRFClient) AccessToken(ctx context.Context, targetNFType, scope string) (string, error) {
+	key := strings.ToUpper(targetNFType) + " " + scope
+	now := time.Now()
+	n.mu.Lock()
+	cached := n.tokens[key]
+	n.mu.Unlock()
+	if cached != nil && now.Before(cached.expires) {
+		return cached.token, cached.err
+	}
+
+	token, expiresIn, err := n.requestAccessToken(ctx, targetNFType, scope)
+	if ctx.Err() != nil {
+		return "", err
+	}
+	cached = &cachedToken{token: token, err: err, expires: now.Add(tokenRetryInterval)}
+	if err == nil {
+		cached.expires = now.Add(max(expiresIn-tokenRenewMargin, expiresIn/2))
+	}
+	n.mu.Lock()
+	n.tokens[key] = cached
+	n.mu.Unlock()
+	return token, err
+}
+
+// requestAccessToken asks the NRF for a token with the client credentials
+// grant, the NF being identified by its instance ID and type
+func (n *NRFClient) requestAccessToken(ctx context.Context, targetNFType, scope string) (string, time.Duration, error) {
+	form := url.Values{
+		"grant_type":   {"client_credentials"},
+		"nfInstanceId": {n.nfID},
+		"nfType":       {n.nfType},
+		"targetNfType": {strings.ToUpper(targetNFType)},
+		"scope":        {scope},
+	}
+	body := form.Encode()
+
+	resp, err := n.do(ctx, func(nrfURL string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, nrfURL+"/oauth2/token", strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var tokenErr struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		json.NewDecoder(resp.Body).Decode(&tokenErr)
+		if tokenErr.Error != "" {
+			return "", 0, fmt.Errorf("NRF refused an access token for %s: %s: %s", scope, tokenErr.Error, tokenErr.ErrorDescription)
+		}
+		return "", 0, &StatusError{Method: http.MethodPost, URL: resp.Request.URL.String(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", 0, fmt.Errorf("failed to decode access token: %w", err)
+	}
+	if token.AccessToken == "" || !strings.EqualFold(token.TokenType, "Bearer") {
+		return "", 0, fmt.Errorf("NRF returned no bearer token for %s", scope)
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
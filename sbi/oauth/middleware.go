@@ -0,0 +1,296 @@
+// Package oauth validates the OAuth2 access tokens that the NRF issues to NF
+// service consumers (TS 33.501 section 13.4.1, TS 29.510 Nnrf_AccessToken).
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config controls how access tokens are verified
+type Config struct {
+	JWKSURL  string   // NRF JWK set endpoint, e.g. http://nrf-service/oauth2/jwks
+	KeyFile  string   // PEM encoded NRF public key, used instead of JWKSURL
+	Issuer   string   // Expected token issuer (NRF instance ID); any issuer when empty
+	Audience []string // NF type and/or NF instance ID of this NF; any audience when empty
+}
+
+// Claims are the claims of a validated access token
+type Claims struct {
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// HasScope reports whether the token grants access to the given service
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returned by Validate
+var (
+	ErrMissingToken      = errors.New("missing access token")
+	ErrInvalidToken      = errors.New("invalid access token")
+	ErrInsufficientScope = errors.New("access token does not grant the required scope")
+)
+
+// keyRefreshInterval limits how often an unknown key ID triggers a JWK set download
+const keyRefreshInterval = 30 * time.Second
+
+// Validator verifies access tokens presented to an SBI server
+type Validator struct {
+	config     Config
+	httpClient *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*ecdsa.PublicKey
+	staticKey *ecdsa.PublicKey
+	lastFetch time.Time
+}
+
+// NewValidator creates a validator using either the NRF JWK set or a key file
+func NewValidator(cfg Config) (*Validator, error) {
+	v := &Validator{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		keys:       make(map[string]*ecdsa.PublicKey),
+	}
+
+	switch {
+	case cfg.KeyFile != "":
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token verification key: %w", err)
+		}
+		key, err := jwt.ParseECPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token verification key: %w", err)
+		}
+		v.staticKey = key
+	case cfg.JWKSURL == "":
+		return nil, errors.New("either a JWK set URL or a key file is required")
+	}
+	return v, nil
+}
+
+// FromEnv creates a validator from SBI_AUTH_JWKS_URL or SBI_AUTH_KEY_FILE,
+// SBI_AUTH_ISSUER and SBI_AUTH_AUDIENCE (comma separated). It returns nil
+// when neither a JWK set URL nor a key file is configured, meaning that
+// authorization is disabled.
+//
+// Only enable it on an NF once all its consumers present tokens. Consumers
+// sending their requests with the client of an nrfagent.Endpoint do, with
+// the endpoint service name as scope; others, such as the UDM client of
+// the AMF, do not yet. The NRF only issues tokens to NFs authenticated by
+// their TLS client certificate, see nrfagent.FromEnv.
+func FromEnv() (*Validator, error) {
+	cfg := Config{
+		JWKSURL: os.Getenv("SBI_AUTH_JWKS_URL"),
+		KeyFile: os.Getenv("SBI_AUTH_KEY_FILE"),
+		Issuer:  os.Getenv("SBI_AUTH_ISSUER"),
+	}
+	if cfg.JWKSURL == "" && cfg.KeyFile == "" {
+		return nil, nil
+	}
+	for _, aud := range strings.Split(os.Getenv("SBI_AUTH_AUDIENCE"), ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			cfg.Audience = append(cfg.Audience, aud)
+		}
+	}
+	return NewValidator(cfg)
+}
+
+// Validate parses the token and checks its signature, expiry, issuer,
+// audience and, when scope is not empty, that it grants the scope
+func (v *Validator) Validate(tokenString, scope string) (*Claims, error) {
+	if tokenString == "" {
+		return nil, ErrMissingToken
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if v.config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(v.config.Issuer))
+	}
+
+	var claims Claims
+	if _, err := jwt.ParseWithClaims(tokenString, &claims, v.keyFunc, options...); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if len(v.config.Audience) > 0 && !v.acceptsAudience(claims.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience %v", ErrInvalidToken, claims.Audience)
+	}
+	if scope != "" && !claims.HasScope(scope) {
+		return &claims, ErrInsufficientScope
+	}
+	return &claims, nil
+}
+
+func (v *Validator) acceptsAudience(audience jwt.ClaimStrings) bool {
+	for _, aud := range audience {
+		for _, accepted := range v.config.Audience {
+			if strings.EqualFold(aud, accepted) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keyFunc returns the NRF key that signed the token
+func (v *Validator) keyFunc(token *jwt.Token) (interface{}, error) {
+	if v.staticKey != nil {
+		return v.staticKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if key := v.cachedKey(kid); key != nil {
+		return key, nil
+	}
+	if err := v.refreshKeys(); err != nil {
+		return nil, err
+	}
+	if key := v.cachedKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (v *Validator) cachedKey(kid string) *ecdsa.PublicKey {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key
+		}
+	}
+	return v.keys[kid]
+}
+
+// refreshKeys downloads the NRF JWK set, at most once per keyRefreshInterval
+func (v *Validator) refreshKeys() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if time.Since(v.lastFetch) < keyRefreshInterval {
+		return nil
+	}
+	v.lastFetch = time.Now()
+
+	resp, err := v.httpClient.Get(v.config.JWKSURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch NRF keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from NRF key endpoint: %s", resp.Status)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			Kid string `json:"kid"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return fmt.Errorf("failed to decode NRF keys: %w", err)
+	}
+
+	keys := make(map[string]*ecdsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "EC" || k.Crv != "P-256" {
+			continue
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			continue
+		}
+		keys[k.Kid] = &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+	}
+	v.keys = keys
+	return nil
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the token claims of a request accepted by the middleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Middleware checks the bearer token of every request. The required scope
+// is the service name taken from the first path segment, following the
+// {apiRoot}/{serviceName}/{version} resource URI layout of TS 29.501. It
+// can be passed to gorilla/mux Router.Use.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return v.protect(next, func(r *http.Request) string {
+		return strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+	})
+}
+
+// RequireScope returns a middleware that requires the given scope on every
+// request, for routers whose paths do not start with the service name
+func (v *Validator) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return v.protect(next, func(*http.Request) string { return scope })
+	}
+}
+
+func (v *Validator) protect(next http.Handler, scopeOf func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		claims, err := v.Validate(token, scopeOf(r))
+		switch {
+		case errors.Is(err, ErrMissingToken):
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			http.Error(w, "Access token required", http.StatusUnauthorized)
+			return
+		case errors.Is(err, ErrInsufficientScope):
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	})
+}
+
+// bearerToken extracts the token from the Authorization header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
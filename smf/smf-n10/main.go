@@ -1,21 +1,64 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"github.com/danipopa/mob5g/sbi/oauth"
 	"github.com/danipopa/mob5g/smf/smf-n10/src"
 )
 
+// serviceName is the service SMF-N10 registers with the NRF. Consumers ask
+// the NRF for access tokens with it as scope, so it is also the scope
+// required of their requests.
+const serviceName = "smf-n10"
+
 func main() {
+	// Register with the NRF, when NRF_URL is set, and locate the UDM through it
+	nrfClient, profile, err := nrfagent.FromEnv("SMF", "http://smf-n10-service:8086", serviceName)
+	if err != nil {
+		log.Fatalf("Failed to configure NRF registration: %v", err)
+	}
+
 	// Initialize API handlers
-	handlers := smfn10.NewHandlers("http://udm-service:8084")
+	handlers := smfn10.NewHandlers(nrfagent.NewEndpoint(nrfClient, "UDM", "nudm-sdm", "http://udm-service:8084"))
 
 	// Define routes
 	http.HandleFunc("/n10/subscription-data", handlers.GetSubscriptionDataHandler)
 
+	// Require SBI access tokens when the NRF token key is configured
+	var handler http.Handler = http.DefaultServeMux
+	validator, err := oauth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SBI authorization: %v", err)
+	}
+	if validator != nil {
+		handler = validator.RequireScope(serviceName)(handler)
+	}
+
+	if nrfClient != nil {
+		handler = nrfClient.ServeNotifications(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start the server
-	log.Println("Starting SMF-N10 service on port 8082...")
-	log.Fatal(http.ListenAndServe(":8082", nil))
+	go func() {
+		log.Println("Starting SMF-N10 service on port 8082...")
+		log.Fatal(http.ListenAndServe(":8082", handler))
+	}()
+
+	// Stay registered with the NRF until SIGTERM, then deregister
+	if nrfClient == nil {
+		<-ctx.Done()
+	} else if err := nrfClient.Run(ctx, profile); err != nil {
+		log.Printf("SMF-N10 NRF agent stopped: %v", err)
+	}
 }
 
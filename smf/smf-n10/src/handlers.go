@@ -3,6 +3,8 @@ package smfn10
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 // Handlers contains the logic for handling N10 API requests
@@ -11,9 +13,9 @@ type Handlers struct {
 }
 
 // NewHandlers initializes a new Handlers instance
-func NewHandlers(udmBaseURL string) *Handlers {
+func NewHandlers(udm *nrfagent.Endpoint) *Handlers {
 	return &Handlers{
-		UDMClient: &UDMClient{BaseURL: udmBaseURL},
+		UDMClient: &UDMClient{UDM: udm},
 	}
 }
 
@@ -4,17 +4,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 // UDMClient represents the client for UDM interactions
 type UDMClient struct {
-	BaseURL string // UDM Base URL
+	UDM *nrfagent.Endpoint // Locates the UDM
 }
 
 // GetSubscriptionData retrieves subscription data for a given UEID from the UDM
 func (c *UDMClient) GetSubscriptionData(ueID string) (*SubscriptionData, error) {
-	url := fmt.Sprintf("%s/subscription-data/%s", c.BaseURL, ueID)
-	resp, err := http.Get(url)
+	url := fmt.Sprintf("%s/subscription-data/%s", c.UDM.URL(), ueID)
+	resp, err := c.UDM.Client().Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to contact UDM: %w", err)
 	}
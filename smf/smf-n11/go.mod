@@ -1,3 +1,9 @@
 module github.com/danipopa/mob5g/smf/smf-n11
 
 go 1.23.4
+
+require github.com/danipopa/mob5g/sbi v0.0.0
+
+require github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
+
+replace github.com/danipopa/mob5g/sbi => ../../sbi
@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"github.com/danipopa/mob5g/sbi/oauth"
 	"github.com/danipopa/mob5g/smf/smf-n11/src"
 )
 
+// serviceName is the service SMF-N11 registers with the NRF. Consumers ask
+// the NRF for access tokens with it as scope, so it is also the scope
+// required of their requests.
+const serviceName = "smf-n11"
+
 func main() {
-	handlers := smfn11.NewHandlers()
+	// Register with the NRF, when NRF_URL is set, and locate the AMF through it
+	nrfClient, profile, err := nrfagent.FromEnv("SMF", "http://smf-n11-service:8086", serviceName)
+	if err != nil {
+		log.Fatalf("Failed to configure NRF registration: %v", err)
+	}
+
+	handlers := smfn11.NewHandlers(nrfagent.NewEndpoint(nrfClient, "AMF", "namf-comm", "http://amf-service:8080"))
 
 	// Define unique endpoints
 	http.HandleFunc("/sm-contexts", handlers.CreateSessionHandler)                // POST for session creation
@@ -16,7 +33,33 @@ func main() {
 	http.HandleFunc("/sm-contexts/release", handlers.ReleaseSessionHandler)       // DELETE for session release
 	http.HandleFunc("/sm-contexts/notify", handlers.HandleSMFEventNotification)   // POST for notifications
 
-	log.Println("Starting SMF-N11 service on port 8081...")
-	log.Fatal(http.ListenAndServe(":8081", nil))
+	// Require SBI access tokens when the NRF token key is configured
+	var handler http.Handler = http.DefaultServeMux
+	validator, err := oauth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SBI authorization: %v", err)
+	}
+	if validator != nil {
+		handler = validator.RequireScope(serviceName)(handler)
+	}
+
+	if nrfClient != nil {
+		handler = nrfClient.ServeNotifications(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Println("Starting SMF-N11 service on port 8081...")
+		log.Fatal(http.ListenAndServe(":8081", handler))
+	}()
+
+	// Stay registered with the NRF until SIGTERM, then deregister
+	if nrfClient == nil {
+		<-ctx.Done()
+	} else if err := nrfClient.Run(ctx, profile); err != nil {
+		log.Printf("SMF-N11 NRF agent stopped: %v", err)
+	}
 }
 
@@ -5,18 +5,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 type AMFClient struct {
-	BaseURL string
+	AMF *nrfagent.Endpoint // Locates the AMF
 }
 
 // SendResponse sends a response back to the AMF
 func (c *AMFClient) SendResponse(response *PDUResponse) error {
-	url := fmt.Sprintf("%s/amf/response", c.BaseURL)
+	url := fmt.Sprintf("%s/amf/response", c.AMF.URL())
 	payload, _ := json.Marshal(response)
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	resp, err := c.AMF.Client().Post(url, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("failed to send response to AMF: %w", err)
 	}
@@ -31,10 +33,10 @@ func (c *AMFClient) SendResponse(response *PDUResponse) error {
 
 // NotifyUE sends session-related updates to the UE
 func (c *AMFClient) NotifyUE(notification map[string]interface{}) error {
-	url := fmt.Sprintf("%s/ue-notification", c.BaseURL)
+	url := fmt.Sprintf("%s/ue-notification", c.AMF.URL())
 	payload, _ := json.Marshal(notification)
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	resp, err := c.AMF.Client().Post(url, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("failed to send notification to UE: %w", err)
 	}
@@ -49,10 +51,10 @@ func (c *AMFClient) NotifyUE(notification map[string]interface{}) error {
 
 // SendNotification sends notifications to the AMF
 func (c *AMFClient) SendNotification(notification *GenericRequest) error {
-	url := fmt.Sprintf("%s/notify", c.BaseURL)
+	url := fmt.Sprintf("%s/notify", c.AMF.URL())
 	payload, _ := json.Marshal(notification)
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	resp, err := c.AMF.Client().Post(url, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("failed to send notification to AMF: %w", err)
 	}
@@ -3,6 +3,8 @@ package smfn11
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 type Handlers struct {
@@ -10,10 +12,10 @@ type Handlers struct {
 	AMFClient      *AMFClient // Add the AMFClient field
 }
 
-func NewHandlers() *Handlers {
+func NewHandlers(amf *nrfagent.Endpoint) *Handlers {
 	return &Handlers{
 		SessionManager: &SessionManager{},
-		AMFClient:      &AMFClient{BaseURL: "http://amf-service:8080"}, // Initialize AMFClient with base URLvi
+		AMFClient:      &AMFClient{AMF: amf},
 	}
 }
 
@@ -1,13 +1,30 @@
 package main
 
 import (
+	"context"
 	"log"
 	"time"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"github.com/danipopa/mob5g/sbi/oauth"
 	"github.com/danipopa/mob5g/smf/smf-n4/src"
 )
 
+// serviceName is the service SMF-N4 registers with the NRF. Consumers ask
+// the NRF for access tokens with it as scope, so it is also the scope
+// required of their requests.
+const serviceName = "smf-n4"
+
 func main() {
+	// Register with the NRF, when NRF_URL is set, so that the session controller finds SMF-N4
+	nrfClient, profile, err := nrfagent.FromEnv("SMF", "http://smf-n4-service:8084", serviceName)
+	if err != nil {
+		log.Fatalf("Failed to configure NRF registration: %v", err)
+	}
+
 	// Initialize components
 	pfcpClient := &src.PFCPClient{UPFAddress: "127.0.0.1:8805"}
 	sessionHandler := &src.SessionHandler{PFCPClient: pfcpClient}
@@ -22,8 +39,34 @@ func main() {
 	// Start heartbeat goroutine
 	go src.StartHeartbeat(pfcpClient, 10*time.Second)
 
+	// Require SBI access tokens when the NRF token key is configured
+	var handler http.Handler = http.DefaultServeMux
+	validator, err := oauth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SBI authorization: %v", err)
+	}
+	if validator != nil {
+		handler = validator.RequireScope(serviceName)(handler)
+	}
+
+	if nrfClient != nil {
+		handler = nrfClient.ServeNotifications(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start HTTP server
-	log.Println("Starting SMF-N4 service on port 8084...")
-	log.Fatal(http.ListenAndServe(":8084", nil))
+	go func() {
+		log.Println("Starting SMF-N4 service on port 8084...")
+		log.Fatal(http.ListenAndServe(":8084", handler))
+	}()
+
+	// Stay registered with the NRF until SIGTERM, then deregister
+	if nrfClient == nil {
+		<-ctx.Done()
+	} else if err := nrfClient.Run(ctx, profile); err != nil {
+		log.Printf("SMF-N4 NRF agent stopped: %v", err)
+	}
 }
 
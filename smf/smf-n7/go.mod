@@ -7,3 +7,9 @@ require (
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/go-redis/redis/v8 v8.11.5 // indirect
 )
+
+require github.com/danipopa/mob5g/sbi v0.0.0
+
+require github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
+
+replace github.com/danipopa/mob5g/sbi => ../../sbi
@@ -1,21 +1,64 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"github.com/danipopa/mob5g/sbi/oauth"
 	"github.com/danipopa/mob5g/smf/smf-n7/src"
 )
 
+// serviceName is the service SMF-N7 registers with the NRF. Consumers ask
+// the NRF for access tokens with it as scope, so it is also the scope
+// required of their requests.
+const serviceName = "smf-n7"
+
 func main() {
-	handlers := smfn7.NewHandlers("http://pcf-service:8080") // PCF base URL
+	// Register with the NRF, when NRF_URL is set, and locate the PCF through it
+	nrfClient, profile, err := nrfagent.FromEnv("SMF", "http://smf-n7-service:8087", serviceName)
+	if err != nil {
+		log.Fatalf("Failed to configure NRF registration: %v", err)
+	}
+
+	handlers := smfn7.NewHandlers(nrfagent.NewEndpoint(nrfClient, "PCF", "npcf-smpolicycontrol", "http://pcf-service:8080"))
 
 	http.HandleFunc("/n7/policy-association", handlers.HandlePolicyAssociation) // POST
 	http.HandleFunc("/n7/policy-termination", handlers.HandlePolicyTermination) // DELETE
 	http.HandleFunc("/n7/event-reporting", handlers.HandleEventReporting) // POST for event reporting
 	http.HandleFunc("/n7/policy-update", handlers.HandlePolicyUpdate) // PUT for policy updates
 
-	log.Println("Starting SMF-N7 service on port 8082...")
-	log.Fatal(http.ListenAndServe(":8082", nil))
+	// Require SBI access tokens when the NRF token key is configured
+	var handler http.Handler = http.DefaultServeMux
+	validator, err := oauth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SBI authorization: %v", err)
+	}
+	if validator != nil {
+		handler = validator.RequireScope(serviceName)(handler)
+	}
+
+	if nrfClient != nil {
+		handler = nrfClient.ServeNotifications(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Println("Starting SMF-N7 service on port 8082...")
+		log.Fatal(http.ListenAndServe(":8082", handler))
+	}()
+
+	// Stay registered with the NRF until SIGTERM, then deregister
+	if nrfClient == nil {
+		<-ctx.Done()
+	} else if err := nrfClient.Run(ctx, profile); err != nil {
+		log.Printf("SMF-N7 NRF agent stopped: %v", err)
+	}
 }
 
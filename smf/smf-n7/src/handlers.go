@@ -4,16 +4,18 @@ package smfn7
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 type Handlers struct {
 	N7Service *N7Service
 }
 
-func NewHandlers(pcfBaseURL string) *Handlers {
+func NewHandlers(pcf *nrfagent.Endpoint) *Handlers {
 	return &Handlers{
 		N7Service: &N7Service{
-			PCFClient: &PCFClient{BaseURL: pcfBaseURL},
+			PCFClient: &PCFClient{PCF: pcf},
 		},
 	}
 }
@@ -7,18 +7,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 type PCFClient struct {
-	BaseURL string
+	PCF *nrfagent.Endpoint // Locates the PCF
 }
 
 // SendPolicyRequest sends a policy request to the PCF
 func (c *PCFClient) SendPolicyRequest(contextData SMPolicyContextData) (*SMPolicyDecision, error) {
-	url := fmt.Sprintf("%s/sm-policies", c.BaseURL)
+	url := fmt.Sprintf("%s/sm-policies", c.PCF.URL())
 	payload, _ := json.Marshal(contextData)
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	resp, err := c.PCF.Client().Post(url, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, fmt.Errorf("failed to contact PCF: %w", err)
 	}
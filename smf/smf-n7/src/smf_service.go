@@ -18,14 +18,13 @@ func (s *N7Service) CreatePolicyAssociation(contextData SMPolicyContextData) (*S
 
 // DeletePolicyAssociation handles policy termination
 func (s *N7Service) DeletePolicyAssociation(policyID string) error {
-	url := fmt.Sprintf("%s/sm-policies/%s", s.PCFClient.BaseURL, policyID)
+	url := fmt.Sprintf("%s/sm-policies/%s", s.PCFClient.PCF.URL(), policyID)
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create delete request: %w", err)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.PCFClient.PCF.Client().Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to contact PCF: %w", err)
 	}
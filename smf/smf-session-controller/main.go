@@ -1,17 +1,35 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"github.com/danipopa/mob5g/sbi/oauth"
 	"github.com/danipopa/mob5g/smf/smf-session-controller/src"
 )
 
+// serviceName is the service the session controller registers with the NRF. Consumers ask
+// the NRF for access tokens with it as scope, so it is also the scope
+// required of their requests.
+const serviceName = "nsmf-pdusession"
+
 func main() {
+	// Register with the NRF, when NRF_URL is set, so that the AMF finds the SMF,
+	// and locate the SMF microservices through it
+	nrfClient, profile, err := nrfagent.FromEnv("SMF", "http://smf-session-controller:8085", serviceName)
+	if err != nil {
+		log.Fatalf("Failed to configure NRF registration: %v", err)
+	}
+
 	// Initialize Redis client
 	redisClient := src.NewRedisClient("redis-service:6379")
 
 	// Initialize Session Manager
-	sessionManager := src.NewSessionManager(redisClient)
+	sessionManager := src.NewSessionManager(redisClient, nrfClient)
 
 	// Initialize Handlers
 	handlers := src.NewHandlers(sessionManager)
@@ -21,8 +39,34 @@ func main() {
 	http.HandleFunc("/sessions/", handlers.ModifySessionHandler) // PUT
 	http.HandleFunc("/sessions/", handlers.DeleteSessionHandler) // DELETE
 
+	// Require SBI access tokens when the NRF token key is configured
+	var handler http.Handler = http.DefaultServeMux
+	validator, err := oauth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SBI authorization: %v", err)
+	}
+	if validator != nil {
+		handler = validator.RequireScope(serviceName)(handler)
+	}
+
+	if nrfClient != nil {
+		handler = nrfClient.ServeNotifications(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start HTTP server
-	log.Println("Starting SMF Session Controller on port 8085...")
-	log.Fatal(http.ListenAndServe(":8085", nil))
+	go func() {
+		log.Println("Starting SMF Session Controller on port 8085...")
+		log.Fatal(http.ListenAndServe(":8085", handler))
+	}()
+
+	// Stay registered with the NRF until SIGTERM, then deregister
+	if nrfClient == nil {
+		<-ctx.Done()
+	} else if err := nrfClient.Run(ctx, profile); err != nil {
+		log.Printf("SMF Session Controller NRF agent stopped: %v", err)
+	}
 }
 
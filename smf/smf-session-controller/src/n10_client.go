@@ -3,22 +3,24 @@ package src
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 // N10Client communicates with SMF-N10-Service
 type N10Client struct {
-	BaseURL string
+	Endpoint *nrfagent.Endpoint // Locates SMF-N10
 }
 
 // NewN10Client initializes an N10 client
-func NewN10Client(baseURL string) *N10Client {
-	return &N10Client{BaseURL: baseURL}
+func NewN10Client(endpoint *nrfagent.Endpoint) *N10Client {
+	return &N10Client{Endpoint: endpoint}
 }
 
 // FetchSubscriptionData retrieves subscription data from SMF-N10
 func (c *N10Client) FetchSubscriptionData(ueID string) error {
-	url := fmt.Sprintf("%s/subscriptions/%s", c.BaseURL, ueID)
-	resp, err := http.Get(url)
+	url := fmt.Sprintf("%s/subscriptions/%s", c.Endpoint.URL(), ueID)
+	resp, err := c.Endpoint.Client().Get(url)
 	if err != nil {
 		return fmt.Errorf("failed to fetch subscription data: %w", err)
 	}
@@ -5,27 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 // N11Client handles communication with SMF-N11-Service
 type N11Client struct {
-	BaseURL string
+	Endpoint *nrfagent.Endpoint // Locates SMF-N11
 }
 
 // NewN11Client initializes a new N11 client
-func NewN11Client(baseURL string) *N11Client {
-	return &N11Client{BaseURL: baseURL}
+func NewN11Client(endpoint *nrfagent.Endpoint) *N11Client {
+	return &N11Client{Endpoint: endpoint}
 }
 
 // NotifyAMF sends a notification to the AMF via smf-n11-service
 func (c *N11Client) NotifyAMF(notification *AMFNotification) error {
-	url := fmt.Sprintf("%s/amf-notify", c.BaseURL)
+	url := fmt.Sprintf("%s/amf-notify", c.Endpoint.URL())
 	payload, err := json.Marshal(notification)
 	if err != nil {
 		return fmt.Errorf("failed to encode notification: %w", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	resp, err := c.Endpoint.Client().Post(url, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("failed to send notification to AMF: %w", err)
 	}
@@ -40,8 +42,8 @@ func (c *N11Client) NotifyAMF(notification *AMFNotification) error {
 
 // QueryAMF queries the AMF for specific session-related information
 func (c *N11Client) QueryAMF(sessionID string) (*AMFResponse, error) {
-	url := fmt.Sprintf("%s/sm-contexts/%s", c.BaseURL, sessionID)
-	resp, err := http.Get(url)
+	url := fmt.Sprintf("%s/sm-contexts/%s", c.Endpoint.URL(), sessionID)
+	resp, err := c.Endpoint.Client().Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query AMF: %w", err)
 	}
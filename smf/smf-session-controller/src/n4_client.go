@@ -5,27 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 // N4Client communicates with SMF-N4-Service
 type N4Client struct {
-	BaseURL string
+	Endpoint *nrfagent.Endpoint // Locates SMF-N4
 }
 
 // NewN4Client initializes an N4 client
-func NewN4Client(baseURL string) *N4Client {
-	return &N4Client{BaseURL: baseURL}
+func NewN4Client(endpoint *nrfagent.Endpoint) *N4Client {
+	return &N4Client{Endpoint: endpoint}
 }
 
 // CreateSessionInUPF sends a session creation request to SMF-N4
 func (c *N4Client) CreateSessionInUPF(session *Session) error {
-	url := fmt.Sprintf("%s/sm-contexts", c.BaseURL)
+	url := fmt.Sprintf("%s/sm-contexts", c.Endpoint.URL())
 	payload, err := json.Marshal(session)
 	if err != nil {
 		return fmt.Errorf("failed to encode session for SMF-N4: %w", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	resp, err := c.Endpoint.Client().Post(url, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("failed to communicate with SMF-N4: %w", err)
 	}
@@ -40,14 +42,13 @@ func (c *N4Client) CreateSessionInUPF(session *Session) error {
 
 // ReleaseSessionInUPF sends a session deletion request to the UPF via SMF-N4
 func (c *N4Client) ReleaseSessionInUPF(sessionID string) error {
-	url := fmt.Sprintf("%s/sm-contexts/%s", c.BaseURL, sessionID)
+	url := fmt.Sprintf("%s/sm-contexts/%s", c.Endpoint.URL(), sessionID)
 	req, err := http.NewRequest(http.MethodDelete, url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request for session deletion: %w", err)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.Endpoint.Client().Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to communicate with SMF-N4: %w", err)
 	}
@@ -62,7 +63,7 @@ func (c *N4Client) ReleaseSessionInUPF(sessionID string) error {
 
 // ModifySessionInUPF sends a session modification request to the UPF via SMF-N4
 func (c *N4Client) ModifySessionInUPF(session *Session) error {
-	url := fmt.Sprintf("%s/sm-contexts/%s", c.BaseURL, session.SessionID)
+	url := fmt.Sprintf("%s/sm-contexts/%s", c.Endpoint.URL(), session.SessionID)
 	payload, err := json.Marshal(session)
 	if err != nil {
 		return fmt.Errorf("failed to encode session for modification: %w", err)
@@ -74,8 +75,7 @@ func (c *N4Client) ModifySessionInUPF(session *Session) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.Endpoint.Client().Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to communicate with SMF-N4: %w", err)
 	}
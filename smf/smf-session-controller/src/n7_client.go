@@ -5,27 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 // N7Client communicates with SMF-N7-Service
 type N7Client struct {
-	BaseURL string
+	Endpoint *nrfagent.Endpoint // Locates SMF-N7
 }
 
 // NewN7Client initializes an N7 client
-func NewN7Client(baseURL string) *N7Client {
-	return &N7Client{BaseURL: baseURL}
+func NewN7Client(endpoint *nrfagent.Endpoint) *N7Client {
+	return &N7Client{Endpoint: endpoint}
 }
 
 // FetchPolicyData retrieves policy data from SMF-N7
 func (c *N7Client) FetchPolicyData(session *Session) error {
-	url := fmt.Sprintf("%s/policies", c.BaseURL)
+	url := fmt.Sprintf("%s/policies", c.Endpoint.URL())
 	payload, err := json.Marshal(session)
 	if err != nil {
 		return fmt.Errorf("failed to encode session for SMF-N7: %w", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	resp, err := c.Endpoint.Client().Post(url, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("failed to fetch policy data: %w", err)
 	}
@@ -2,6 +2,8 @@ package src
 
 import (
 	"fmt"
+
+	"github.com/danipopa/mob5g/sbi/nrfagent"
 )
 
 // SessionManager handles session lifecycle management
@@ -13,14 +15,24 @@ type SessionManager struct {
 	n11Client   *N11Client
 }
 
-// NewSessionManager initializes a new SessionManager
-func NewSessionManager(redisClient *RedisClient) *SessionManager {
+// Services of the SMF microservices, as registered with the NRF
+const (
+	N4ServiceName  = "smf-n4"
+	N7ServiceName  = "smf-n7"
+	N10ServiceName = "smf-n10"
+	N11ServiceName = "smf-n11"
+)
+
+// NewSessionManager initializes a new SessionManager. The SMF microservices
+// are located through nrfClient, or at their Kubernetes service names when
+// it is nil or the NRF knows no instance.
+func NewSessionManager(redisClient *RedisClient, nrfClient *nrfagent.NRFClient) *SessionManager {
 	return &SessionManager{
 		redisClient: redisClient,
-		n4Client:    NewN4Client("http://smf-n4-service:8084"),
-		n10Client:   NewN10Client("http://smf-n10-service:8086"),
-		n7Client:    NewN7Client("http://smf-n7-service:8087"),
-		n11Client:   NewN11Client("http://smf-n11-service:8086"),
+		n4Client:    NewN4Client(nrfagent.NewEndpoint(nrfClient, "SMF", N4ServiceName, "http://smf-n4-service:8084")),
+		n10Client:   NewN10Client(nrfagent.NewEndpoint(nrfClient, "SMF", N10ServiceName, "http://smf-n10-service:8086")),
+		n7Client:    NewN7Client(nrfagent.NewEndpoint(nrfClient, "SMF", N7ServiceName, "http://smf-n7-service:8087")),
+		n11Client:   NewN11Client(nrfagent.NewEndpoint(nrfClient, "SMF", N11ServiceName, "http://smf-n11-service:8086")),
 	}
 }
 
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"github.com/danipopa/mob5g/sbi/oauth"
 	"github.com/danipopa/mob5g/udm/udm"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	// Register with the NRF, when NRF_URL is set, so that consumers find the UDM
+	nrfClient, profile, err := nrfagent.FromEnv("UDM", "http://udm-service:8080", "nudm-sdm", "nudm-ueau")
+	if err != nil {
+		log.Fatalf("Failed to configure NRF registration: %v", err)
+	}
+
 	// Initialize Redis storage
 	storage := udm.NewRedisStorage("redis-service:6379")
 
@@ -20,11 +32,40 @@ func main() {
 	router := mux.NewRouter()
 	router.HandleFunc("/nudm-sdm/v1/subscription-data/{ueId}", handlers.GetSubscriptionData).Methods("GET")
 	router.HandleFunc("/nudm-auth/v1/auth-vectors/{ueId}", handlers.GetAuthVector).Methods("GET")
+	router.HandleFunc("/nudm-ueau/v1/{supiOrSuci}/security-information/generate-auth-data", handlers.GenerateAuthData).Methods("POST")
+	router.HandleFunc("/nudm-sdm/v2/{supi}/sdm-subscriptions", handlers.SubscribeSDM).Methods("POST")
+	router.HandleFunc("/nudm-sdm/v2/{supi}/sdm-subscriptions/{subscriptionId}", handlers.UnsubscribeSDM).Methods("DELETE")
+	router.HandleFunc("/nudm-sdm/v2/{supi}/{resource}", handlers.GetSDMResource).Methods("GET")
+
+	// Require SBI access tokens when the NRF token key is configured
+	validator, err := oauth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SBI authorization: %v", err)
+	}
+	if validator != nil {
+		router.Use(validator.Middleware)
+	}
+
+	var handler http.Handler = router
+	if nrfClient != nil {
+		handler = nrfClient.ServeNotifications(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Start HTTP server
-	log.Println("Starting UDM service on port 8080...")
-	if err := http.ListenAndServe(":8080", router); err != nil {
-		log.Fatalf("Failed to start UDM service: %v", err)
+	go func() {
+		log.Println("Starting UDM service on port 8080...")
+		if err := http.ListenAndServe(":8080", handler); err != nil {
+			log.Fatalf("Failed to start UDM service: %v", err)
+		}
+	}()
+
+	// Stay registered with the NRF until SIGTERM, then deregister
+	if nrfClient == nil {
+		<-ctx.Done()
+	} else if err := nrfClient.Run(ctx, profile); err != nil {
+		log.Printf("UDM NRF agent stopped: %v", err)
 	}
 }
-
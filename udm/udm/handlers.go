@@ -2,12 +2,24 @@ package udm
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
 
+// Authentication methods and vector types (TS 29.503 AuthType, AvType)
+const (
+	authType5GAKA       = "5G_AKA"
+	authTypeEAPAKAPrime = "EAP_AKA_PRIME"
+	avType5GHeAKA       = "5G_HE_AKA"
+	avTypeEAPAKAPrime   = "EAP_AKA_PRIME"
+)
+
 type Handlers struct {
 	storage Storage
 }
@@ -47,3 +59,126 @@ func (h *Handlers) GetAuthVector(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(vector)
 }
 
+// GenerateAuthData implements Nudm_UEAU_Get for a UE identified by its
+// SUPI or a SUCI of the null protection scheme. The vectors are provisioned
+// for the UE and each is used once; this UDM holds no long-term keys, so it
+// can neither de-conceal other SUCIs nor resynchronize the SQN.
+func (h *Handlers) GenerateAuthData(w http.ResponseWriter, r *http.Request) {
+	supi, err := resolveSUPI(mux.Vars(r)["supiOrSuci"])
+	if err != nil {
+		writeProblem(w, http.StatusNotImplemented, "", err.Error())
+		return
+	}
+
+	var request AuthenticationInfoRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ServingNetworkName == "" {
+		writeProblem(w, http.StatusBadRequest, "MANDATORY_IE_MISSING", "servingNetworkName is required")
+		return
+	}
+	if request.ResynchronizationInfo != nil {
+		writeProblem(w, http.StatusNotImplemented, "", "resynchronization is not supported")
+		return
+	}
+	authType, avType := authType5GAKA, avType5GHeAKA
+	switch request.AuthType {
+	case "", authType5GAKA:
+	case authTypeEAPAKAPrime:
+		authType, avType = authTypeEAPAKAPrime, avTypeEAPAKAPrime
+	default:
+		writeProblem(w, http.StatusBadRequest, "INVALID_QUERY_PARAM", "unsupported authType "+request.AuthType)
+		return
+	}
+
+	vector, err := h.storage.NextAuthenticationVector(supi, avType)
+	if errors.Is(err, ErrNotFound) {
+		writeProblem(w, http.StatusNotFound, "USER_NOT_FOUND", err.Error())
+		return
+	} else if err != nil {
+		log.Printf("Failed to get an authentication vector for %s: %v", supi, err)
+		writeProblem(w, http.StatusInternalServerError, "", "failed to get an authentication vector")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthenticationInfoResult{AuthType: authType, AuthenticationVector: vector, SUPI: supi})
+}
+
+// GetSDMResource implements Nudm_SDM_Get for a subscription data resource
+// of a UE, e.g. am-data, nssai or smf-select-data
+func (h *Handlers) GetSDMResource(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	data, err := h.storage.GetSDMResource(vars["supi"], vars["resource"])
+	if errors.Is(err, ErrNotFound) {
+		writeProblem(w, http.StatusNotFound, "DATA_NOT_FOUND", err.Error())
+		return
+	} else if err != nil {
+		log.Printf("Failed to get %s of %s: %v", vars["resource"], vars["supi"], err)
+		writeProblem(w, http.StatusInternalServerError, "", "failed to get subscription data")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// SubscribeSDM implements Nudm_SDM_Subscribe. Subscriptions are recorded
+// and can be removed; this UDM has no provisioning interface that changes
+// the data, so it sends no notifications.
+func (h *Handlers) SubscribeSDM(w http.ResponseWriter, r *http.Request) {
+	supi := mux.Vars(r)["supi"]
+	var subscription SDMSubscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		writeProblem(w, http.StatusBadRequest, "", "invalid SDM subscription")
+		return
+	}
+	if subscription.NFInstanceID == "" || subscription.CallbackReference == "" || len(subscription.MonitoredResourceURIs) == 0 {
+		writeProblem(w, http.StatusBadRequest, "MANDATORY_IE_MISSING", "nfInstanceId, callbackReference and monitoredResourceUris are required")
+		return
+	}
+
+	if err := h.storage.CreateSDMSubscription(supi, &subscription); err != nil {
+		log.Printf("Failed to save SDM subscription of %s: %v", supi, err)
+		writeProblem(w, http.StatusInternalServerError, "", "failed to save the subscription")
+		return
+	}
+
+	w.Header().Set("Location", r.URL.Path+"/"+url.PathEscape(subscription.SubscriptionID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// UnsubscribeSDM implements Nudm_SDM_Unsubscribe
+func (h *Handlers) UnsubscribeSDM(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	err := h.storage.DeleteSDMSubscription(vars["supi"], vars["subscriptionId"])
+	if errors.Is(err, ErrNotFound) {
+		writeProblem(w, http.StatusNotFound, "SUBSCRIPTION_NOT_FOUND", err.Error())
+		return
+	} else if err != nil {
+		log.Printf("Failed to delete SDM subscription %s of %s: %v", vars["subscriptionId"], vars["supi"], err)
+		writeProblem(w, http.StatusInternalServerError, "", "failed to delete the subscription")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resolveSUPI returns the SUPI of a SUPI or of a SUCI of the null scheme,
+// suci-0-{mcc}-{mnc}-{routingIndicator}-0-0-{msin} (TS 23.003 2.2B)
+func resolveSUPI(supiOrSuci string) (string, error) {
+	if !strings.HasPrefix(supiOrSuci, "suci-") {
+		return supiOrSuci, nil
+	}
+	parts := strings.SplitN(supiOrSuci, "-", 8)
+	if len(parts) != 8 || parts[1] != "0" || parts[5] != "0" {
+		return "", fmt.Errorf("cannot de-conceal %s: only IMSI based SUCIs of the null scheme are supported", supiOrSuci)
+	}
+	return "imsi-" + parts[2] + parts[3] + parts[7], nil
+}
+
+// writeProblem sends an error as ProblemDetails
+func writeProblem(w http.ResponseWriter, status int, cause, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ProblemDetails{Title: http.StatusText(status), Status: status, Detail: detail, Cause: cause})
+}
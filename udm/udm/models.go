@@ -1,5 +1,7 @@
 package udm
 
+import "time"
+
 type SubscriptionData struct {
 	UEID                string   `json:"ue_id"`
 	AllowedPLMNs        []PLMN   `json:"allowed_plmns"`
@@ -24,3 +26,57 @@ type SNSSAI struct {
 	SD  string `json:"sd"`
 }
 
+// AuthenticationInfoRequest is the body of generate-auth-data
+// (TS 29.503 AuthenticationInfoRequest)
+type AuthenticationInfoRequest struct {
+	ServingNetworkName    string                 `json:"servingNetworkName"`
+	ResynchronizationInfo *ResynchronizationInfo `json:"resynchronizationInfo,omitempty"`
+	AusfInstanceID        string                 `json:"ausfInstanceId,omitempty"`
+	AuthType              string                 `json:"authType,omitempty"`
+}
+
+// ResynchronizationInfo carries the RAND and AUTS of a synchronization failure
+type ResynchronizationInfo struct {
+	RAND string `json:"rand"`
+	AUTS string `json:"auts"`
+}
+
+// AuthenticationInfoResult is the answer to generate-auth-data
+// (TS 29.503 AuthenticationInfoResult)
+type AuthenticationInfoResult struct {
+	AuthType             string                `json:"authType"`
+	AuthenticationVector *AuthenticationVector `json:"authenticationVector,omitempty"`
+	SUPI                 string                `json:"supi,omitempty"`
+}
+
+// AuthenticationVector is a 5G HE AV or an EAP-AKA' vector, as told by
+// AvType. Hex encoded fields.
+type AuthenticationVector struct {
+	AvType   string `json:"avType"`
+	RAND     string `json:"rand"`
+	AUTN     string `json:"autn"`
+	XRESStar string `json:"xresStar,omitempty"`
+	KAUSF    string `json:"kausf,omitempty"`
+	XRES     string `json:"xres,omitempty"`
+	CKPrime  string `json:"ckPrime,omitempty"`
+	IKPrime  string `json:"ikPrime,omitempty"`
+}
+
+// SDMSubscription is a subscription to changes of subscription data
+// (TS 29.503 SdmSubscription)
+type SDMSubscription struct {
+	NFInstanceID          string     `json:"nfInstanceId"`
+	CallbackReference     string     `json:"callbackReference"`
+	MonitoredResourceURIs []string   `json:"monitoredResourceUris"`
+	ImplicitUnsubscribe   bool       `json:"implicitUnsubscribe,omitempty"`
+	Expires               *time.Time `json:"expires,omitempty"`
+	SubscriptionID        string     `json:"subscriptionId,omitempty"`
+}
+
+// ProblemDetails is the error body of the Nudm services (TS 29.571)
+type ProblemDetails struct {
+	Title  string `json:"title,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	Cause  string `json:"cause,omitempty"`
+}
@@ -3,14 +3,28 @@ package udm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// ErrNotFound is returned when the UDM holds no such data
+var ErrNotFound = errors.New("not found")
+
 type Storage interface {
 	GetSubscriptionData(ueID string) (*SubscriptionData, error)
 	GetAuthVector(ueID string) (*AuthVector, error)
+	// GetSDMResource returns a subscription data resource of a UE, e.g.
+	// am-data, as JSON
+	GetSDMResource(supi, resource string) (json.RawMessage, error)
+	// NextAuthenticationVector takes the next authentication vector of a
+	// type provisioned for a UE. Each vector is used once.
+	NextAuthenticationVector(supi, avType string) (*AuthenticationVector, error)
+	// CreateSDMSubscription saves a subscription and assigns its ID
+	CreateSDMSubscription(supi string, subscription *SDMSubscription) error
+	DeleteSDMSubscription(supi, subscriptionID string) error
 }
 
 type RedisStorage struct {
@@ -64,3 +78,65 @@ func (r *RedisStorage) GetAuthVector(ueID string) (*AuthVector, error) {
 	return &vector, nil
 }
 
+// GetSDMResource retrieves a subscription data resource of a UE from Redis,
+// where it is provisioned as JSON under sdm:{supi}:{resource}
+func (r *RedisStorage) GetSDMResource(supi, resource string) (json.RawMessage, error) {
+	data, err := r.client.Get(r.ctx, fmt.Sprintf("sdm:%s:%s", supi, resource)).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("%w: %s of UE %s", ErrNotFound, resource, supi)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to retrieve %s: %w", resource, err)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("invalid %s stored for UE %s", resource, supi)
+	}
+	return data, nil
+}
+
+// NextAuthenticationVector pops a vector from the list provisioned under
+// auth-data:{supi}:{avType}
+func (r *RedisStorage) NextAuthenticationVector(supi, avType string) (*AuthenticationVector, error) {
+	data, err := r.client.LPop(r.ctx, fmt.Sprintf("auth-data:%s:%s", supi, avType)).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("%w: %s vector for UE %s", ErrNotFound, avType, supi)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to retrieve authentication vector: %w", err)
+	}
+
+	var vector AuthenticationVector
+	if err := json.Unmarshal(data, &vector); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal authentication vector: %w", err)
+	}
+	vector.AvType = avType
+	return &vector, nil
+}
+
+// CreateSDMSubscription saves a subscription in the sdm-subscriptions:{supi} hash
+func (r *RedisStorage) CreateSDMSubscription(supi string, subscription *SDMSubscription) error {
+	id, err := r.client.Incr(r.ctx, "sdm-subscription-id").Result()
+	if err != nil {
+		return fmt.Errorf("failed to assign subscription ID: %w", err)
+	}
+	subscription.SubscriptionID = strconv.FormatInt(id, 10)
+
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription: %w", err)
+	}
+	if err := r.client.HSet(r.ctx, "sdm-subscriptions:"+supi, subscription.SubscriptionID, data).Err(); err != nil {
+		return fmt.Errorf("failed to save subscription: %w", err)
+	}
+	return nil
+}
+
+// DeleteSDMSubscription removes a subscription of a UE
+func (r *RedisStorage) DeleteSDMSubscription(supi, subscriptionID string) error {
+	removed, err := r.client.HDel(r.ctx, "sdm-subscriptions:"+supi, subscriptionID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("%w: subscription %s of UE %s", ErrNotFound, subscriptionID, supi)
+	}
+	return nil
+}
@@ -1,12 +1,25 @@
 package main
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/danipopa/mob5g/sbi/nrfagent"
+	"github.com/danipopa/mob5g/sbi/oauth"
 	"github.com/danipopa/mob5g/udr/src"
 )
 
 func main() {
+	// Register with the NRF, when NRF_URL is set, so that consumers find the UDR
+	nrfClient, profile, err := nrfagent.FromEnv("UDR", "http://udr-service:8080", "nudr-dr")
+	if err != nil {
+		log.Fatalf("Failed to configure NRF registration: %v", err)
+	}
+
 	// Initialize Redis storage
 	storage := udr.NewRedisStorage("redis-service:6379")
 
@@ -18,7 +31,29 @@ func main() {
 	router.HandleFunc("/nudr-dr/v1/subscriptions", handlers.GetSubscription)
 	router.HandleFunc("/nudr-dr/v1/subscriptions/save", handlers.SaveSubscription)
 
+	// Require SBI access tokens when the NRF token key is configured
+	var handler http.Handler = router
+	validator, err := oauth.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure SBI authorization: %v", err)
+	}
+	if validator != nil {
+		handler = validator.Middleware(router)
+	}
+	if nrfClient != nil {
+		handler = nrfClient.ServeNotifications(handler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start HTTPS server
-	udr.StartServer(router)
-}
+	go udr.StartServer(handler)
 
+	// Stay registered with the NRF until SIGTERM, then deregister
+	if nrfClient == nil {
+		<-ctx.Done()
+	} else if err := nrfClient.Run(ctx, profile); err != nil {
+		log.Printf("UDR NRF agent stopped: %v", err)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"net/http"
 )
 
-func StartServer(router *http.ServeMux) {
+func StartServer(router http.Handler) {
 	log.Println("Starting UDR service on port 8080...")
 	err := http.ListenAndServe(":8080", router) // Use plain HTTP
 	if err != nil {
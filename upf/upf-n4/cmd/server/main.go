@@ -1,20 +1,81 @@
 package main
 
 import (
-	"upf-n4/internal/pfcp"
-	"upf-n4/internal/transport"
+	"fmt"
 	"log"
+	"net"
+	"os"
+
+	"github.com/danipopa/mob5g/upf/upf-n4/internal/pfcp"
+	"github.com/danipopa/mob5g/upf/upf-n4/internal/transport"
 )
 
 func main() {
 	log.Println("Starting UPF-N4 PFCP server...")
 
+	if err := configureAddresses(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	log.Printf("N4 address %s, N3 addresses %v %v", pfcp.N4Address, pfcp.N3Address, pfcp.N3AddressIPv6)
+
 	// Initialize Redis
 	pfcp.InitializeRedis("localhost:6379")
 
-	// Start listening for PFCP messages
-	err := transport.ListenForPFCPMessages(8805, pfcp.HandleMessage)
+	// Start listening for PFCP messages, and answer them from the same socket
+	server, err := transport.ListenForPFCPMessages(8805)
 	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+	pfcp.Responder = server.Send
+	if err := server.Serve(pfcp.HandleMessage); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
+
+// configureAddresses sets the addresses the UPF gives the CP functions
+// from UPF_N4_ADDRESS, and UPF_N3_ADDRESS and UPF_N3_ADDRESS_IPV6. The N4
+// address and an N3 address of either family are required: the CP
+// functions and the RAN could not reach a UPF announcing anything else.
+func configureAddresses() error {
+	n4, err := ipFromEnv("UPF_N4_ADDRESS")
+	if err != nil {
+		return err
+	}
+	if n4 == nil {
+		return fmt.Errorf("UPF_N4_ADDRESS is not set")
+	}
+	n3, err := ipFromEnv("UPF_N3_ADDRESS")
+	if err != nil {
+		return err
+	}
+	if n3 != nil && n3.To4() == nil {
+		return fmt.Errorf("UPF_N3_ADDRESS: %s is not an IPv4 address", n3)
+	}
+	n3IPv6, err := ipFromEnv("UPF_N3_ADDRESS_IPV6")
+	if err != nil {
+		return err
+	}
+	if n3IPv6 != nil && n3IPv6.To4() != nil {
+		return fmt.Errorf("UPF_N3_ADDRESS_IPV6: %s is not an IPv6 address", n3IPv6)
+	}
+	if n3 == nil && n3IPv6 == nil {
+		return fmt.Errorf("neither UPF_N3_ADDRESS nor UPF_N3_ADDRESS_IPV6 is set")
+	}
+
+	pfcp.N4Address, pfcp.N3Address, pfcp.N3AddressIPv6 = n4, n3.To4(), n3IPv6
+	return nil
+}
+
+// ipFromEnv reads an IP address from an environment variable, nil when it
+// is not set
+func ipFromEnv(name string) (net.IP, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("%s: invalid IP address %q", name, value)
+	}
+	return ip, nil
 }
@@ -1,19 +1,39 @@
 package pfcp
 
-// PFCP Message Types
+// PFCP Message Types (TS 29.244 7.3)
 const (
-	PFCPAssociationSetupRequest        uint8 = 1
-	PFCPAssociationSetupResponse       uint8 = 2
-	PFCPAssociationUpdateRequest       uint8 = 3
-	PFCPAssociationUpdateResponse      uint8 = 4
-	PFCPAssociationReleaseRequest      uint8 = 5
-	PFCPAssociationReleaseResponse     uint8 = 6
-	PFCPSessionEstablishmentRequest    uint8 = 50
-	PFCPSessionEstablishmentResponse   uint8 = 51
-	PFCPSessionModificationRequest     uint8 = 52
-	PFCPSessionModificationResponse    uint8 = 53
-	PFCPSessionDeletionRequest         uint8 = 54
-	PFCPSessionDeletionResponse        uint8 = 55
-	PFCPHeartbeatRequest               uint8 = 56
-	PFCPHeartbeatResponse              uint8 = 57
+	PFCPHeartbeatRequest             uint8 = 1
+	PFCPHeartbeatResponse            uint8 = 2
+	PFCPAssociationSetupRequest      uint8 = 5
+	PFCPAssociationSetupResponse     uint8 = 6
+	PFCPAssociationUpdateRequest     uint8 = 7
+	PFCPAssociationUpdateResponse    uint8 = 8
+	PFCPAssociationReleaseRequest    uint8 = 9
+	PFCPAssociationReleaseResponse   uint8 = 10
+	PFCPVersionNotSupportedResponse  uint8 = 11
+	PFCPSessionEstablishmentRequest  uint8 = 50
+	PFCPSessionEstablishmentResponse uint8 = 51
+	PFCPSessionModificationRequest   uint8 = 52
+	PFCPSessionModificationResponse  uint8 = 53
+	PFCPSessionDeletionRequest       uint8 = 54
+	PFCPSessionDeletionResponse      uint8 = 55
+	PFCPSessionReportRequest         uint8 = 56
+	PFCPSessionReportResponse        uint8 = 57
 )
+
+// IsRequest reports whether a message type is a request, which its peer
+// retransmits until it gets the response (TS 29.244 6.4)
+func IsRequest(messageType uint8) bool {
+	switch messageType {
+	case PFCPHeartbeatRequest,
+		PFCPAssociationSetupRequest,
+		PFCPAssociationUpdateRequest,
+		PFCPAssociationReleaseRequest,
+		PFCPSessionEstablishmentRequest,
+		PFCPSessionModificationRequest,
+		PFCPSessionDeletionRequest,
+		PFCPSessionReportRequest:
+		return true
+	}
+	return false
+}
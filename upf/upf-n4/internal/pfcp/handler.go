@@ -1,8 +1,25 @@
 package pfcp
 
 import (
-	"log"
 	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/danipopa/mob5g/upf/upf-n4/internal/pfcp/ie"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// LocalNodeID is the Node ID of the UPF in its messages
+	LocalNodeID = ie.NodeID{Type: ie.NodeIDFQDN, FQDN: "upf-n4-service"}
+	// recoveryTimeStamp tells peers when the UPF started, so that they
+	// notice it restarted and lost its sessions
+	recoveryTimeStamp = ie.RecoveryTimeStamp{Time: time.Now()}
+
+	// Responder sends a serialized response to the peer of a request, from
+	// the socket the request came in on
+	Responder func(data []byte, addr string) error
 )
 
 // Association data structure
@@ -44,22 +61,31 @@ func HandleMessage(data []byte, addr string) {
 func handleAssociationSetupRequest(msg *PFCPMessage, addr string) {
 	log.Printf("Handling PFCP Association Setup Request from %s", addr)
 
-	// Parse Node ID from the payload (simplified example)
-	nodeID := string(msg.Payload[:8]) // Assume Node ID is 8 bytes
-	association := Association{
-		NodeID:   nodeID,
-		NodeType: "UPF",
-	}
-
-	// Save to Redis
-	data, _ := json.Marshal(association)
-	err := SaveAssociation(nodeID, string(data))
+	cause := ie.CauseRequestAccepted
+	nodeID, err := nodeIDOf(msg)
 	if err != nil {
-		log.Printf("Failed to save association: %v", err)
+		log.Printf("Rejecting PFCP Association Setup Request from %s: %v", addr, err)
+		cause = causeOf(err)
+	} else {
+		association := Association{
+			NodeID:   nodeID.String(),
+			NodeType: "UPF",
+		}
+
+		// Save to Redis
+		data, _ := json.Marshal(association)
+		if err := SaveAssociation(association.NodeID, string(data)); err != nil {
+			log.Printf("Failed to save association: %v", err)
+			cause = ie.CauseSystemFailure
+		}
 	}
 
 	// Respond with PFCP Association Setup Response
-	response := CreateAssociationSetupResponse(msg.SequenceNumber)
+	response, err := CreateAssociationSetupResponse(msg.SequenceNumber, cause)
+	if err != nil {
+		log.Printf("Failed to create PFCP Association Setup Response: %v", err)
+		return
+	}
 	sendResponse(response, addr)
 }
 
@@ -67,8 +93,13 @@ func handleAssociationUpdateRequest(msg *PFCPMessage, addr string) {
 	log.Printf("Handling PFCP Association Update Request from %s", addr)
 
 	// Example: Update association in Redis
-	nodeID := string(msg.Payload[:8]) // Assume Node ID is 8 bytes
-	_, err := GetAssociation(nodeID)
+	peer, err := nodeIDOf(msg)
+	if err != nil {
+		log.Printf("Invalid PFCP Association Update Request from %s: %v", addr, err)
+		return
+	}
+	nodeID := peer.String()
+	_, err = GetAssociation(nodeID)
 	if err != nil {
 		log.Printf("No existing association found for Node ID %s", nodeID)
 		return
@@ -89,8 +120,13 @@ func handleAssociationReleaseRequest(msg *PFCPMessage, addr string) {
 	log.Printf("Handling PFCP Association Release Request from %s", addr)
 
 	// Example: Delete association from Redis
-	nodeID := string(msg.Payload[:8]) // Assume Node ID is 8 bytes
-	err := DeleteAssociation(nodeID)
+	peer, err := nodeIDOf(msg)
+	if err != nil {
+		log.Printf("Invalid PFCP Association Release Request from %s: %v", addr, err)
+		return
+	}
+	nodeID := peer.String()
+	err = DeleteAssociation(nodeID)
 	if err != nil {
 		log.Printf("Failed to delete association for Node ID %s", nodeID)
 		return
@@ -101,22 +137,291 @@ func handleAssociationReleaseRequest(msg *PFCPMessage, addr string) {
 
 func handleSessionEstablishmentRequest(msg *PFCPMessage, addr string) {
 	log.Printf("Handling PFCP Session Establishment Request from %s", addr)
-	// TODO: Implement session establishment logic
+
+	var response *PFCPMessage
+	request, cpSEID, err := decodeSessionEstablishmentRequest(msg)
+	if err == nil {
+		var s *Session
+		var created []ie.CreatedPDR
+		if s, created, err = establishSession(request); err == nil {
+			log.Printf("Established PFCP session %#x for %s with %d PDRs", s.LocalSEID, request.NodeID, len(s.PDRs))
+			values := []ie.Value{localFSEID(s.LocalSEID)}
+			for _, pdr := range created {
+				values = append(values, pdr)
+			}
+			response, err = CreateSessionEstablishmentResponse(msg.SequenceNumber, cpSEID, ie.CauseRequestAccepted, values...)
+		}
+	}
+	if r, ok := err.(*rejection); ok {
+		log.Printf("Rejecting PFCP Session Establishment Request from %s: %v", addr, r)
+		response, err = CreateSessionEstablishmentResponse(msg.SequenceNumber, cpSEID, r.Cause, r.values()...)
+	}
+	if err != nil {
+		log.Printf("Failed to create PFCP Session Establishment Response: %v", err)
+		return
+	}
+	sendResponse(response, addr)
 }
 
 func handleSessionModificationRequest(msg *PFCPMessage, addr string) {
 	log.Printf("Handling PFCP Session Modification Request from %s", addr)
-	// TODO: Implement session modification logic
+
+	// Without a session the SEID of the CP function is unknown, and the
+	// response has SEID 0 (TS 29.244 7.2.2.4.2)
+	var cpSEID uint64
+	var response *PFCPMessage
+	var err error
+	if s := sessions.Get(msg.SEID); s == nil {
+		err = reject(ie.CauseSessionContextNotFound, "no session with SEID %#x", msg.SEID)
+	} else {
+		cpSEID = s.CPFSEID.SEID
+		var cpFSEID *ie.FSEID
+		var changes *ruleChanges
+		if cpFSEID, changes, err = decodeSessionModificationRequest(msg); err == nil {
+			var created []ie.CreatedPDR
+			var reports []ie.UsageReport
+			var r *rejection
+			s, created, reports, r = sessions.Modify(msg.SEID, cpFSEID, changes)
+			if s != nil {
+				cpSEID = s.CPFSEID.SEID
+			}
+			if r != nil {
+				err = r
+			} else {
+				log.Printf("Modified PFCP session %#x, now with %d PDRs", s.LocalSEID, len(s.PDRs))
+				var values []ie.Value
+				for _, pdr := range created {
+					values = append(values, pdr)
+				}
+				for _, report := range reports {
+					values = append(values, ie.ModificationUsageReport(report))
+				}
+				response, err = CreateSessionModificationResponse(msg.SequenceNumber, cpSEID, ie.CauseRequestAccepted, values...)
+			}
+		}
+	}
+	if r, ok := err.(*rejection); ok {
+		log.Printf("Rejecting PFCP Session Modification Request from %s: %v", addr, r)
+		response, err = CreateSessionModificationResponse(msg.SequenceNumber, cpSEID, r.Cause, r.values()...)
+	}
+	if err != nil {
+		log.Printf("Failed to create PFCP Session Modification Response: %v", err)
+		return
+	}
+	sendResponse(response, addr)
 }
 
 func handleSessionDeletionRequest(msg *PFCPMessage, addr string) {
 	log.Printf("Handling PFCP Session Deletion Request from %s", addr)
-	// TODO: Implement session deletion logic
+
+	var response *PFCPMessage
+	var err error
+	s, reports, r := sessions.Delete(msg.SEID)
+	if r != nil {
+		log.Printf("Rejecting PFCP Session Deletion Request from %s: %v", addr, r)
+		response, err = CreateSessionDeletionResponse(msg.SequenceNumber, 0, r.Cause, r.values()...)
+	} else {
+		log.Printf("Deleted PFCP session %#x", s.LocalSEID)
+		var values []ie.Value
+		for _, report := range reports {
+			values = append(values, ie.DeletionUsageReport(report))
+		}
+		response, err = CreateSessionDeletionResponse(msg.SequenceNumber, s.CPFSEID.SEID, ie.CauseRequestAccepted, values...)
+	}
+	if err != nil {
+		log.Printf("Failed to create PFCP Session Deletion Response: %v", err)
+		return
+	}
+	sendResponse(response, addr)
 }
 
 func handleHeartbeatRequest(msg *PFCPMessage, addr string) {
 	log.Printf("Handling PFCP Heartbeat Request from %s", addr)
-	response := CreateHeartbeatResponse(msg.SequenceNumber)
+	response, err := CreateHeartbeatResponse(msg.SequenceNumber)
+	if err != nil {
+		log.Printf("Failed to create PFCP Heartbeat Response: %v", err)
+		return
+	}
 	sendResponse(response, addr)
 }
 
+// sessionEstablishmentRequest holds the IEs of a Session Establishment
+// Request the UPF handles (TS 29.244 7.5.2)
+type sessionEstablishmentRequest struct {
+	NodeID  ie.NodeID
+	CPFSEID ie.FSEID
+	Rules   ruleSet
+}
+
+// decodeSessionEstablishmentRequest decodes a Session Establishment Request,
+// and returns the SEID of the CP function to answer with, 0 when unknown
+func decodeSessionEstablishmentRequest(msg *PFCPMessage) (*sessionEstablishmentRequest, uint64, error) {
+	ies, err := ie.Parse(msg.Payload)
+	if err != nil {
+		return nil, 0, rejectDecoding(err)
+	}
+	request := &sessionEstablishmentRequest{}
+	if err := ie.DecodeMandatory(ies, &request.NodeID); err != nil {
+		return nil, 0, rejectDecoding(err)
+	}
+	if err := ie.DecodeMandatory(ies, &request.CPFSEID); err != nil {
+		return nil, 0, rejectDecoding(err)
+	}
+	cpSEID := request.CPFSEID.SEID
+
+	rules, err := decodeRuleSet(ies)
+	if err == nil {
+		switch {
+		case len(rules.PDRs) == 0:
+			err = &ie.Error{Type: ie.TypeCreatePDR, Err: ie.ErrMissing}
+		case len(rules.FARs) == 0:
+			err = &ie.Error{Type: ie.TypeCreateFAR, Err: ie.ErrMissing}
+		}
+	}
+	if err != nil {
+		return nil, cpSEID, rejectDecoding(err)
+	}
+	request.Rules = rules
+	return request, cpSEID, nil
+}
+
+// decodeRuleSet decodes the Create PDR, FAR, URR and QER IEs of a request
+func decodeRuleSet(ies []*ie.IE) (ruleSet, error) {
+	var rules ruleSet
+	var err error
+	if rules.PDRs, err = ie.DecodeAll[ie.CreatePDR](ies); err != nil {
+		return rules, err
+	}
+	if rules.FARs, err = ie.DecodeAll[ie.CreateFAR](ies); err != nil {
+		return rules, err
+	}
+	if rules.URRs, err = ie.DecodeAll[ie.CreateURR](ies); err != nil {
+		return rules, err
+	}
+	rules.QERs, err = ie.DecodeAll[ie.CreateQER](ies)
+	return rules, err
+}
+
+// decodeSessionModificationRequest decodes a Session Modification Request
+// (TS 29.244 7.5.4), and returns the new F-SEID of the CP function if it
+// changed
+func decodeSessionModificationRequest(msg *PFCPMessage) (*ie.FSEID, *ruleChanges, error) {
+	ies, err := ie.Parse(msg.Payload)
+	if err != nil {
+		return nil, nil, rejectDecoding(err)
+	}
+	var cpFSEID *ie.FSEID
+	var fseid ie.FSEID
+	if found, err := ie.DecodeOptional(ies, &fseid); err != nil {
+		return nil, nil, rejectDecoding(err)
+	} else if found {
+		cpFSEID = &fseid
+	}
+
+	changes := &ruleChanges{}
+	if changes.Create, err = decodeRuleSet(ies); err == nil {
+		err = decodeRuleUpdates(ies, changes)
+	}
+	if err != nil {
+		return nil, nil, rejectDecoding(err)
+	}
+	return cpFSEID, changes, nil
+}
+
+// decodeRuleUpdates decodes the Remove and Update IEs of the rules of a
+// request
+func decodeRuleUpdates(ies []*ie.IE, changes *ruleChanges) error {
+	var err error
+	if changes.RemovePDRs, err = ie.DecodeAll[ie.RemovePDR](ies); err != nil {
+		return err
+	}
+	if changes.RemoveFARs, err = ie.DecodeAll[ie.RemoveFAR](ies); err != nil {
+		return err
+	}
+	if changes.RemoveURRs, err = ie.DecodeAll[ie.RemoveURR](ies); err != nil {
+		return err
+	}
+	if changes.RemoveQERs, err = ie.DecodeAll[ie.RemoveQER](ies); err != nil {
+		return err
+	}
+	if changes.UpdatePDRs, err = ie.DecodeAll[ie.UpdatePDR](ies); err != nil {
+		return err
+	}
+	if changes.UpdateFARs, err = ie.DecodeAll[ie.UpdateFAR](ies); err != nil {
+		return err
+	}
+	if changes.UpdateURRs, err = ie.DecodeAll[ie.UpdateURR](ies); err != nil {
+		return err
+	}
+	changes.UpdateQERs, err = ie.DecodeAll[ie.UpdateQER](ies)
+	return err
+}
+
+// establishSession creates the session of a request from a CP function
+// the UPF has an association with
+func establishSession(request *sessionEstablishmentRequest) (*Session, []ie.CreatedPDR, error) {
+	cpNodeID := request.NodeID.String()
+	if _, err := GetAssociation(cpNodeID); errors.Is(err, redis.Nil) {
+		return nil, nil, reject(ie.CauseNoEstablishedPFCPAssociation, "no PFCP association with %s", cpNodeID)
+	} else if err != nil {
+		return nil, nil, reject(ie.CauseSystemFailure, "failed to look up the association with %s: %v", cpNodeID, err)
+	}
+
+	s, created, r := sessions.Establish(cpNodeID, request.CPFSEID, request.Rules)
+	if r != nil {
+		return nil, nil, r
+	}
+	return s, created, nil
+}
+
+// localFSEID returns the F-SEID of a session of the UPF, carrying its N4
+// address
+func localFSEID(seid uint64) ie.FSEID {
+	if N4Address.To4() != nil {
+		return ie.FSEID{SEID: seid, IPv4: N4Address}
+	}
+	return ie.FSEID{SEID: seid, IPv6: N4Address}
+}
+
+// sendResponse serializes a response and sends it to the peer of the
+// request
+func sendResponse(msg *PFCPMessage, addr string) {
+	data, err := SerializePFCPMessage(msg)
+	if err != nil {
+		log.Printf("Failed to serialize PFCP message type %d: %v", msg.MessageType, err)
+		return
+	}
+	if Responder == nil {
+		log.Printf("No responder to send PFCP message type %d to %s", msg.MessageType, addr)
+		return
+	}
+	if err := Responder(data, addr); err != nil {
+		log.Printf("Failed to send PFCP message type %d to %s: %v", msg.MessageType, addr, err)
+	}
+}
+
+// nodeIDOf decodes the Node ID of a node related message
+func nodeIDOf(msg *PFCPMessage) (ie.NodeID, error) {
+	var nodeID ie.NodeID
+	ies, err := ie.Parse(msg.Payload)
+	if err == nil {
+		err = ie.DecodeMandatory(ies, &nodeID)
+	}
+	return nodeID, err
+}
+
+// causeOf returns the cause that rejects a request whose IEs cannot be
+// decoded (TS 29.244 7.6.2)
+func causeOf(err error) ie.Cause {
+	switch {
+	case errors.Is(err, ie.ErrMissing):
+		return ie.CauseMandatoryIEMissing
+	case errors.Is(err, ie.ErrInvalidLength), errors.Is(err, ie.ErrTruncated):
+		return ie.CauseInvalidLength
+	case errors.Is(err, ie.ErrInvalidValue), errors.Is(err, ie.ErrUnexpectedType):
+		return ie.CauseMandatoryIEIncorrect
+	default:
+		return ie.CauseRequestRejected
+	}
+}
+
@@ -0,0 +1,58 @@
+package pfcp
+
+import (
+	"testing"
+
+	"github.com/danipopa/mob5g/upf/upf-n4/internal/pfcp/ie"
+)
+
+// TestUnknownSessionResponses checks that requests for an unknown session
+// are answered with SEID 0, as the SEID of the CP function is unknown
+func TestUnknownSessionResponses(t *testing.T) {
+	var responses [][]byte
+	defer func(responder func([]byte, string) error) { Responder = responder }(Responder)
+	Responder = func(data []byte, addr string) error {
+		responses = append(responses, data)
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		request  uint8
+		handle   func(*PFCPMessage, string)
+		response uint8
+	}{
+		{"modification", PFCPSessionModificationRequest, handleSessionModificationRequest, PFCPSessionModificationResponse},
+		{"deletion", PFCPSessionDeletionRequest, handleSessionDeletionRequest, PFCPSessionDeletionResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses = nil
+			msg := &PFCPMessage{MessageType: tt.request, HasSEID: true, SEID: 0xdead, SequenceNumber: 7}
+			tt.handle(msg, "192.0.2.10:8805")
+			if len(responses) != 1 {
+				t.Fatalf("%d responses, expected 1", len(responses))
+			}
+
+			response, err := DeserializePFCPMessage(responses[0])
+			if err != nil {
+				t.Fatalf("DeserializePFCPMessage: %v", err)
+			}
+			if response.MessageType != tt.response || !response.HasSEID || response.SEID != 0 || response.SequenceNumber != 7 {
+				t.Errorf("response type %d, SEID %#x, sequence number %d; expected type %d, SEID 0, sequence number 7",
+					response.MessageType, response.SEID, response.SequenceNumber, tt.response)
+			}
+			ies, err := ie.Parse(response.Payload)
+			if err != nil {
+				t.Fatalf("ie.Parse: %v", err)
+			}
+			var cause ie.Cause
+			if err := ie.DecodeMandatory(ies, &cause); err != nil {
+				t.Fatalf("Cause: %v", err)
+			}
+			if cause != ie.CauseSessionContextNotFound {
+				t.Errorf("cause %d, expected %d", cause, ie.CauseSessionContextNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,578 @@
+package ie
+
+import (
+	"fmt"
+	"net"
+)
+
+// readIP reads an IPv4 (4 octets) or IPv6 (16 octets) address at the start
+// of b and returns the rest
+func readIP(b []byte, length int) (net.IP, []byte, error) {
+	if len(b) < length {
+		return nil, nil, fmt.Errorf("%w: %d octets left for an address of %d", ErrInvalidLength, len(b), length)
+	}
+	return append(net.IP(nil), b[:length]...), b[length:], nil
+}
+
+// appendIPv4 appends an IPv4 address, which must be one
+func appendIPv4(b []byte, ip net.IP) ([]byte, error) {
+	v4 := ip.To4()
+	if v4 == nil {
+		return nil, fmt.Errorf("%w: %v is not an IPv4 address", ErrInvalidValue, ip)
+	}
+	return append(b, v4...), nil
+}
+
+// appendIPv6 appends an IPv6 address, which must be one
+func appendIPv6(b []byte, ip net.IP) ([]byte, error) {
+	if len(ip) != net.IPv6len || ip.To4() != nil {
+		return nil, fmt.Errorf("%w: %v is not an IPv6 address", ErrInvalidValue, ip)
+	}
+	return append(b, ip...), nil
+}
+
+// Node ID types
+const (
+	NodeIDIPv4 uint8 = 0
+	NodeIDIPv6 uint8 = 1
+	NodeIDFQDN uint8 = 2
+)
+
+// NodeID identifies a PFCP entity by its address or FQDN (TS 29.244 8.2.38)
+type NodeID struct {
+	Type uint8
+	IP   net.IP // For NodeIDIPv4 and NodeIDIPv6
+	FQDN string // For NodeIDFQDN
+}
+
+func (NodeID) IEType() uint16 { return TypeNodeID }
+
+func (n NodeID) MarshalValue() ([]byte, error) {
+	b := []byte{n.Type}
+	switch n.Type {
+	case NodeIDIPv4:
+		return appendIPv4(b, n.IP)
+	case NodeIDIPv6:
+		return appendIPv6(b, n.IP)
+	case NodeIDFQDN:
+		name, err := encodeLabels(n.FQDN)
+		return append(b, name...), err
+	default:
+		return nil, fmt.Errorf("%w: Node ID type %d", ErrInvalidValue, n.Type)
+	}
+}
+
+func (n *NodeID) UnmarshalValue(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("%w: empty Node ID", ErrInvalidLength)
+	}
+	*n = NodeID{Type: b[0] & 0x0f}
+	var err error
+	switch n.Type {
+	case NodeIDIPv4:
+		n.IP, _, err = readIP(b[1:], net.IPv4len)
+	case NodeIDIPv6:
+		n.IP, _, err = readIP(b[1:], net.IPv6len)
+	case NodeIDFQDN:
+		var ok bool
+		if n.FQDN, ok = decodeLabels(b[1:]); !ok {
+			err = fmt.Errorf("%w: invalid FQDN", ErrInvalidValue)
+		}
+	default:
+		err = fmt.Errorf("%w: Node ID type %d", ErrInvalidValue, n.Type)
+	}
+	return err
+}
+
+// String returns the address or FQDN of the node
+func (n NodeID) String() string {
+	if n.Type == NodeIDFQDN {
+		return n.FQDN
+	}
+	return n.IP.String()
+}
+
+const (
+	flagV6 = 0x01
+	flagV4 = 0x02
+)
+
+// FSEID is the SEID a PFCP entity allocated for a session, with its address
+// (TS 29.244 8.2.37)
+type FSEID struct {
+	SEID uint64
+	IPv4 net.IP
+	IPv6 net.IP
+}
+
+func (FSEID) IEType() uint16 { return TypeFSEID }
+
+func (f FSEID) MarshalValue() ([]byte, error) {
+	if f.IPv4 == nil && f.IPv6 == nil {
+		return nil, fmt.Errorf("%w: F-SEID without address", ErrInvalidValue)
+	}
+	b := []byte{0}
+	b = appendUint(b, f.SEID, 8)
+	var err error
+	if f.IPv4 != nil {
+		b[0] |= flagV4
+		if b, err = appendIPv4(b, f.IPv4); err != nil {
+			return nil, err
+		}
+	}
+	if f.IPv6 != nil {
+		b[0] |= flagV6
+		if b, err = appendIPv6(b, f.IPv6); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (f *FSEID) UnmarshalValue(b []byte) error {
+	if len(b) < 9 {
+		return fmt.Errorf("%w: %d octets, expected at least 9", ErrInvalidLength, len(b))
+	}
+	flags := b[0]
+	*f = FSEID{}
+	f.SEID, _ = readUint(b[1:], 8)
+	b = b[9:]
+	var err error
+	if flags&flagV4 != 0 {
+		if f.IPv4, b, err = readIP(b, net.IPv4len); err != nil {
+			return err
+		}
+	}
+	if flags&flagV6 != 0 {
+		if f.IPv6, _, err = readIP(b, net.IPv6len); err != nil {
+			return err
+		}
+	}
+	if f.IPv4 == nil && f.IPv6 == nil {
+		return fmt.Errorf("%w: F-SEID without address", ErrInvalidValue)
+	}
+	return nil
+}
+
+const (
+	fteidV4   = 0x01
+	fteidV6   = 0x02
+	fteidCH   = 0x04
+	fteidCHID = 0x08
+)
+
+// FTEID is a GTP-U tunnel endpoint (TS 29.244 8.2.3). With Choose the CP
+// function asks the UP function to allocate the TEID and the addresses of
+// the families told by ChooseIPv4 and ChooseIPv6, the same for the PDRs
+// with the same ChooseID when HasChooseID.
+type FTEID struct {
+	TEID uint32
+	IPv4 net.IP
+	IPv6 net.IP
+
+	Choose      bool
+	ChooseIPv4  bool
+	ChooseIPv6  bool
+	HasChooseID bool
+	ChooseID    uint8
+}
+
+func (FTEID) IEType() uint16 { return TypeFTEID }
+
+func (f FTEID) MarshalValue() ([]byte, error) {
+	if f.Choose {
+		b := []byte{fteidCH}
+		if f.ChooseIPv4 {
+			b[0] |= fteidV4
+		}
+		if f.ChooseIPv6 {
+			b[0] |= fteidV6
+		}
+		if f.HasChooseID {
+			b[0] |= fteidCHID
+			b = append(b, f.ChooseID)
+		}
+		return b, nil
+	}
+
+	if f.IPv4 == nil && f.IPv6 == nil {
+		return nil, fmt.Errorf("%w: F-TEID without address", ErrInvalidValue)
+	}
+	b := []byte{0}
+	b = appendUint(b, uint64(f.TEID), 4)
+	var err error
+	if f.IPv4 != nil {
+		b[0] |= fteidV4
+		if b, err = appendIPv4(b, f.IPv4); err != nil {
+			return nil, err
+		}
+	}
+	if f.IPv6 != nil {
+		b[0] |= fteidV6
+		if b, err = appendIPv6(b, f.IPv6); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (f *FTEID) UnmarshalValue(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("%w: empty F-TEID", ErrInvalidLength)
+	}
+	flags := b[0]
+	*f = FTEID{}
+	if flags&fteidCH != 0 {
+		f.Choose = true
+		f.ChooseIPv4 = flags&fteidV4 != 0
+		f.ChooseIPv6 = flags&fteidV6 != 0
+		if flags&fteidCHID != 0 {
+			if len(b) < 2 {
+				return fmt.Errorf("%w: F-TEID without its Choose ID", ErrInvalidLength)
+			}
+			f.HasChooseID, f.ChooseID = true, b[1]
+		}
+		return nil
+	}
+
+	teid, err := readUint(b[1:], 4)
+	if err != nil {
+		return err
+	}
+	f.TEID = uint32(teid)
+	b = b[5:]
+	if flags&fteidV4 != 0 {
+		if f.IPv4, b, err = readIP(b, net.IPv4len); err != nil {
+			return err
+		}
+	}
+	if flags&fteidV6 != 0 {
+		if f.IPv6, _, err = readIP(b, net.IPv6len); err != nil {
+			return err
+		}
+	}
+	if f.IPv4 == nil && f.IPv6 == nil {
+		return fmt.Errorf("%w: F-TEID without address", ErrInvalidValue)
+	}
+	return nil
+}
+
+const (
+	ueIPV6   = 0x01
+	ueIPV4   = 0x02
+	ueIPSD   = 0x04
+	ueIPV6D  = 0x08
+	ueIPCHV4 = 0x10
+	ueIPCHV6 = 0x20
+	ueIPV6PL = 0x40
+)
+
+// UEIPAddress is the address of a UE, or a request to the UP function to
+// allocate one (TS 29.244 8.2.62)
+type UEIPAddress struct {
+	IPv4 net.IP
+	IPv6 net.IP
+	// Destination is the S/D flag: the address is the destination of the
+	// packets, in downlink PDRs
+	Destination bool
+	// IPv6PrefixDelegationBits is the number of bits of the delegated IPv6
+	// prefix, from 64 (IPv6D)
+	IPv6PrefixDelegationBits *uint8
+	// ChooseIPv4 and ChooseIPv6 ask the UP function to allocate the address
+	ChooseIPv4 bool
+	ChooseIPv6 bool
+	// IPv6PrefixLength is the length of the prefix of IPv6 (IP6PL)
+	IPv6PrefixLength *uint8
+}
+
+func (UEIPAddress) IEType() uint16 { return TypeUEIPAddress }
+
+func (u UEIPAddress) MarshalValue() ([]byte, error) {
+	b := []byte{0}
+	var err error
+	if u.Destination {
+		b[0] |= ueIPSD
+	}
+	if u.ChooseIPv4 {
+		b[0] |= ueIPCHV4
+	} else if u.IPv4 != nil {
+		b[0] |= ueIPV4
+		if b, err = appendIPv4(b, u.IPv4); err != nil {
+			return nil, err
+		}
+	}
+	if u.ChooseIPv6 {
+		b[0] |= ueIPCHV6
+	} else if u.IPv6 != nil {
+		b[0] |= ueIPV6
+		if b, err = appendIPv6(b, u.IPv6); err != nil {
+			return nil, err
+		}
+	}
+	if u.IPv6PrefixDelegationBits != nil {
+		b[0] |= ueIPV6D
+		b = append(b, *u.IPv6PrefixDelegationBits)
+	}
+	if u.IPv6PrefixLength != nil {
+		b[0] |= ueIPV6PL
+		b = append(b, *u.IPv6PrefixLength)
+	}
+	return b, nil
+}
+
+func (u *UEIPAddress) UnmarshalValue(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("%w: empty UE IP Address", ErrInvalidLength)
+	}
+	flags, b := b[0], b[1:]
+	*u = UEIPAddress{
+		Destination: flags&ueIPSD != 0,
+		ChooseIPv4:  flags&ueIPCHV4 != 0,
+		ChooseIPv6:  flags&ueIPCHV6 != 0,
+	}
+	var err error
+	if flags&ueIPV4 != 0 {
+		if u.IPv4, b, err = readIP(b, net.IPv4len); err != nil {
+			return err
+		}
+	}
+	if flags&ueIPV6 != 0 {
+		if u.IPv6, b, err = readIP(b, net.IPv6len); err != nil {
+			return err
+		}
+	}
+	for _, field := range []struct {
+		flag  byte
+		value **uint8
+	}{{ueIPV6D, &u.IPv6PrefixDelegationBits}, {ueIPV6PL, &u.IPv6PrefixLength}} {
+		if flags&field.flag == 0 {
+			continue
+		}
+		if len(b) < 1 {
+			return fmt.Errorf("%w: UE IP Address truncated", ErrInvalidLength)
+		}
+		value := b[0]
+		*field.value = &value
+		b = b[1:]
+	}
+	return nil
+}
+
+// OuterHeaderCreation tells a FAR to encapsulate packets, as told by the
+// OuterHeaderCreation description flags (TS 29.244 8.2.56)
+type OuterHeaderCreation struct {
+	Description uint16
+	TEID        uint32 // For GTP-U
+	IPv4        net.IP
+	IPv6        net.IP
+	Port        uint16 // For UDP
+	CTag        uint32 // 3 octets
+	STag        uint32 // 3 octets
+}
+
+const (
+	ohcGTPU = OuterHeaderCreationGTPUUDPIPv4 | OuterHeaderCreationGTPUUDPIPv6
+	ohcIPv4 = OuterHeaderCreationGTPUUDPIPv4 | OuterHeaderCreationUDPIPv4 | OuterHeaderCreationIPv4
+	ohcIPv6 = OuterHeaderCreationGTPUUDPIPv6 | OuterHeaderCreationUDPIPv6 | OuterHeaderCreationIPv6
+	ohcUDP  = OuterHeaderCreationUDPIPv4 | OuterHeaderCreationUDPIPv6
+)
+
+func (OuterHeaderCreation) IEType() uint16 { return TypeOuterHeaderCreation }
+
+func (o OuterHeaderCreation) MarshalValue() ([]byte, error) {
+	b := appendUint(nil, uint64(o.Description), 2)
+	var err error
+	if o.Description&ohcGTPU != 0 {
+		b = appendUint(b, uint64(o.TEID), 4)
+	}
+	if o.Description&ohcIPv4 != 0 {
+		if b, err = appendIPv4(b, o.IPv4); err != nil {
+			return nil, err
+		}
+	}
+	if o.Description&ohcIPv6 != 0 {
+		if b, err = appendIPv6(b, o.IPv6); err != nil {
+			return nil, err
+		}
+	}
+	if o.Description&ohcUDP != 0 {
+		b = appendUint(b, uint64(o.Port), 2)
+	}
+	if o.Description&OuterHeaderCreationCTag != 0 {
+		b = appendUint(b, uint64(o.CTag), 3)
+	}
+	if o.Description&OuterHeaderCreationSTag != 0 {
+		b = appendUint(b, uint64(o.STag), 3)
+	}
+	return b, nil
+}
+
+func (o *OuterHeaderCreation) UnmarshalValue(b []byte) error {
+	description, err := readUint(b, 2)
+	if err != nil {
+		return err
+	}
+	*o = OuterHeaderCreation{Description: uint16(description)}
+	b = b[2:]
+
+	for _, field := range []struct {
+		flags  uint16
+		length int
+		value  func(v uint64)
+	}{
+		{ohcGTPU, 4, func(v uint64) { o.TEID = uint32(v) }},
+		{ohcIPv4, net.IPv4len, nil},
+		{ohcIPv6, net.IPv6len, nil},
+		{ohcUDP, 2, func(v uint64) { o.Port = uint16(v) }},
+		{OuterHeaderCreationCTag, 3, func(v uint64) { o.CTag = uint32(v) }},
+		{OuterHeaderCreationSTag, 3, func(v uint64) { o.STag = uint32(v) }},
+	} {
+		if o.Description&field.flags == 0 {
+			continue
+		}
+		switch field.flags {
+		case ohcIPv4:
+			o.IPv4, b, err = readIP(b, field.length)
+		case ohcIPv6:
+			o.IPv6, b, err = readIP(b, field.length)
+		default:
+			var v uint64
+			if v, err = readUint(b, field.length); err == nil {
+				field.value(v)
+				b = b[field.length:]
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OuterHeaderRemoval tells a PDR to decapsulate packets, as told by the
+// OuterHeaderRemoval description (TS 29.244 8.2.64)
+type OuterHeaderRemoval struct {
+	Description uint8
+	// ExtensionHeaderDeletion, when not nil, tells which GTP-U extension
+	// headers to remove; bit 1 is the PDU Session Container
+	ExtensionHeaderDeletion *uint8
+}
+
+func (OuterHeaderRemoval) IEType() uint16 { return TypeOuterHeaderRemoval }
+
+func (o OuterHeaderRemoval) MarshalValue() ([]byte, error) {
+	b := []byte{o.Description}
+	if o.ExtensionHeaderDeletion != nil {
+		b = append(b, *o.ExtensionHeaderDeletion)
+	}
+	return b, nil
+}
+
+func (o *OuterHeaderRemoval) UnmarshalValue(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("%w: empty Outer Header Removal", ErrInvalidLength)
+	}
+	*o = OuterHeaderRemoval{Description: b[0]}
+	if len(b) > 1 {
+		deletion := b[1]
+		o.ExtensionHeaderDeletion = &deletion
+	}
+	return nil
+}
+
+const (
+	sdfFD  = 0x01
+	sdfTTC = 0x02
+	sdfSPI = 0x04
+	sdfFL  = 0x08
+	sdfBID = 0x10
+)
+
+// SDFFilter describes the packets of a service data flow (TS 29.244
+// 8.2.5). Each part is present when set.
+type SDFFilter struct {
+	// FlowDescription is an IPFilterRule of RFC 6733, e.g.
+	// "permit out ip from any to assigned"
+	FlowDescription        string
+	ToSTrafficClass        *uint16
+	SecurityParameterIndex *uint32
+	FlowLabel              *uint32 // 3 octets
+	FilterID               *uint32
+}
+
+func (SDFFilter) IEType() uint16 { return TypeSDFFilter }
+
+func (s SDFFilter) MarshalValue() ([]byte, error) {
+	b := []byte{0, 0} // Flags and a spare octet
+	if s.FlowDescription != "" {
+		if len(s.FlowDescription) > 0xffff {
+			return nil, fmt.Errorf("%w: flow description too long", ErrInvalidValue)
+		}
+		b[0] |= sdfFD
+		b = appendUint(b, uint64(len(s.FlowDescription)), 2)
+		b = append(b, s.FlowDescription...)
+	}
+	if s.ToSTrafficClass != nil {
+		b[0] |= sdfTTC
+		b = appendUint(b, uint64(*s.ToSTrafficClass), 2)
+	}
+	if s.SecurityParameterIndex != nil {
+		b[0] |= sdfSPI
+		b = appendUint(b, uint64(*s.SecurityParameterIndex), 4)
+	}
+	if s.FlowLabel != nil {
+		b[0] |= sdfFL
+		b = appendUint(b, uint64(*s.FlowLabel), 3)
+	}
+	if s.FilterID != nil {
+		b[0] |= sdfBID
+		b = appendUint(b, uint64(*s.FilterID), 4)
+	}
+	return b, nil
+}
+
+func (s *SDFFilter) UnmarshalValue(b []byte) error {
+	if len(b) < 2 {
+		return fmt.Errorf("%w: %d octets, expected at least 2", ErrInvalidLength, len(b))
+	}
+	flags := b[0]
+	b = b[2:]
+	*s = SDFFilter{}
+	if flags&sdfFD != 0 {
+		length, err := readUint(b, 2)
+		if err != nil {
+			return err
+		}
+		if len(b) < 2+int(length) {
+			return fmt.Errorf("%w: flow description truncated", ErrInvalidLength)
+		}
+		s.FlowDescription = string(b[2 : 2+length])
+		b = b[2+length:]
+	}
+	if flags&sdfTTC != 0 {
+		v, err := readUint(b, 2)
+		if err != nil {
+			return err
+		}
+		tc := uint16(v)
+		s.ToSTrafficClass = &tc
+		b = b[2:]
+	}
+	for _, field := range []struct {
+		flag   byte
+		length int
+		value  **uint32
+	}{{sdfSPI, 4, &s.SecurityParameterIndex}, {sdfFL, 3, &s.FlowLabel}, {sdfBID, 4, &s.FilterID}} {
+		if flags&field.flag == 0 {
+			continue
+		}
+		v, err := readUint(b, field.length)
+		if err != nil {
+			return err
+		}
+		value := uint32(v)
+		*field.value = &value
+		b = b[field.length:]
+	}
+	return nil
+}
@@ -0,0 +1,632 @@
+package ie
+
+// group decodes the IEs grouped in an IE. The first error is kept, and
+// later calls do nothing once there is one.
+type group struct {
+	children []*IE
+	err      error
+}
+
+func parseGroup(b []byte) *group {
+	children, err := Parse(b)
+	return &group{children: children, err: err}
+}
+
+// ValuePointer is a pointer to a typed value of an IE
+type ValuePointer[T any] interface {
+	*T
+	ValueUnmarshaler
+}
+
+// DecodeAll decodes all the IEs of the type of T, for those that may be
+// repeated
+func DecodeAll[T any, P ValuePointer[T]](ies []*IE) ([]T, error) {
+	g := &group{children: ies}
+	values := repeated[T, P](g)
+	return values, g.err
+}
+
+// mandatory decodes the first child of the type of v, which must be present
+func mandatory(g *group, v ValueUnmarshaler) {
+	if g.err == nil {
+		g.err = DecodeMandatory(g.children, v)
+	}
+}
+
+// optional decodes the first child of a type, and returns nil without one
+func optional[T any, P ValuePointer[T]](g *group) *T {
+	if g.err != nil {
+		return nil
+	}
+	v := P(new(T))
+	found, err := DecodeOptional(g.children, v)
+	if !found || err != nil {
+		g.err = err
+		return nil
+	}
+	return (*T)(v)
+}
+
+// repeated decodes all the children of a type
+func repeated[T any, P ValuePointer[T]](g *group) []T {
+	if g.err != nil {
+		return nil
+	}
+	var values []T
+	for _, child := range FindAll(g.children, P(new(T)).IEType()) {
+		v := P(new(T))
+		if g.err = child.Decode(v); g.err != nil {
+			return nil
+		}
+		values = append(values, *(*T)(v))
+	}
+	return values
+}
+
+// builder encodes the IEs grouped in an IE. The first error is kept, and
+// later calls do nothing once there is one.
+type builder struct {
+	b   []byte
+	err error
+}
+
+func (b *builder) add(v Value) {
+	if b.err != nil {
+		return
+	}
+	var ie *IE
+	if ie, b.err = New(v); b.err == nil {
+		b.b, b.err = ie.AppendTo(b.b)
+	}
+}
+
+// addOptional adds a value when it is not nil
+func addOptional[T Value](b *builder, v *T) {
+	if v != nil {
+		b.add(*v)
+	}
+}
+
+// addRepeated adds each of the values
+func addRepeated[T Value](b *builder, values []T) {
+	for _, v := range values {
+		b.add(v)
+	}
+}
+
+func (b *builder) bytes() ([]byte, error) {
+	return b.b, b.err
+}
+
+// PDI tells the packets a PDR detects (TS 29.244 7.5.2.2-2)
+type PDI struct {
+	SourceInterface SourceInterface
+	LocalFTEID      *FTEID
+	NetworkInstance *NetworkInstance
+	UEIPAddress     *UEIPAddress
+	SDFFilters      []SDFFilter
+	ApplicationID   *ApplicationID
+	QFIs            []QFI
+}
+
+func (PDI) IEType() uint16 { return TypePDI }
+
+func (p PDI) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(p.SourceInterface)
+	addOptional(b, p.LocalFTEID)
+	addOptional(b, p.NetworkInstance)
+	addOptional(b, p.UEIPAddress)
+	addRepeated(b, p.SDFFilters)
+	addOptional(b, p.ApplicationID)
+	addRepeated(b, p.QFIs)
+	return b.bytes()
+}
+
+func (p *PDI) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*p = PDI{}
+	mandatory(g, &p.SourceInterface)
+	p.LocalFTEID = optional[FTEID](g)
+	p.NetworkInstance = optional[NetworkInstance](g)
+	p.UEIPAddress = optional[UEIPAddress](g)
+	p.SDFFilters = repeated[SDFFilter](g)
+	p.ApplicationID = optional[ApplicationID](g)
+	p.QFIs = repeated[QFI](g)
+	return g.err
+}
+
+// CreatePDR is a packet detection rule to create (TS 29.244 7.5.2.2)
+type CreatePDR struct {
+	PDRID              PDRID
+	Precedence         Precedence
+	PDI                PDI
+	OuterHeaderRemoval *OuterHeaderRemoval
+	FARID              *FARID
+	URRIDs             []URRID
+	QERIDs             []QERID
+}
+
+func (CreatePDR) IEType() uint16 { return TypeCreatePDR }
+
+func (p CreatePDR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(p.PDRID)
+	b.add(p.Precedence)
+	b.add(p.PDI)
+	addOptional(b, p.OuterHeaderRemoval)
+	addOptional(b, p.FARID)
+	addRepeated(b, p.URRIDs)
+	addRepeated(b, p.QERIDs)
+	return b.bytes()
+}
+
+func (p *CreatePDR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*p = CreatePDR{}
+	mandatory(g, &p.PDRID)
+	mandatory(g, &p.Precedence)
+	mandatory(g, &p.PDI)
+	p.OuterHeaderRemoval = optional[OuterHeaderRemoval](g)
+	p.FARID = optional[FARID](g)
+	p.URRIDs = repeated[URRID](g)
+	p.QERIDs = repeated[QERID](g)
+	return g.err
+}
+
+// UpdatePDR changes the parts of a PDR that are set (TS 29.244 7.5.4.2)
+type UpdatePDR struct {
+	PDRID              PDRID
+	OuterHeaderRemoval *OuterHeaderRemoval
+	Precedence         *Precedence
+	PDI                *PDI
+	FARID              *FARID
+	URRIDs             []URRID
+	QERIDs             []QERID
+}
+
+func (UpdatePDR) IEType() uint16 { return TypeUpdatePDR }
+
+func (p UpdatePDR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(p.PDRID)
+	addOptional(b, p.OuterHeaderRemoval)
+	addOptional(b, p.Precedence)
+	addOptional(b, p.PDI)
+	addOptional(b, p.FARID)
+	addRepeated(b, p.URRIDs)
+	addRepeated(b, p.QERIDs)
+	return b.bytes()
+}
+
+func (p *UpdatePDR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*p = UpdatePDR{}
+	mandatory(g, &p.PDRID)
+	p.OuterHeaderRemoval = optional[OuterHeaderRemoval](g)
+	p.Precedence = optional[Precedence](g)
+	p.PDI = optional[PDI](g)
+	p.FARID = optional[FARID](g)
+	p.URRIDs = repeated[URRID](g)
+	p.QERIDs = repeated[QERID](g)
+	return g.err
+}
+
+// RemovePDR removes a PDR (TS 29.244 7.5.4.6)
+type RemovePDR struct {
+	PDRID PDRID
+}
+
+func (RemovePDR) IEType() uint16 { return TypeRemovePDR }
+
+func (p RemovePDR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(p.PDRID)
+	return b.bytes()
+}
+
+func (p *RemovePDR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	mandatory(g, &p.PDRID)
+	return g.err
+}
+
+// CreatedPDR tells the CP function the F-TEID the UP function allocated
+// for a PDR (TS 29.244 7.5.3.2)
+type CreatedPDR struct {
+	PDRID      PDRID
+	LocalFTEID *FTEID
+}
+
+func (CreatedPDR) IEType() uint16 { return TypeCreatedPDR }
+
+func (p CreatedPDR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(p.PDRID)
+	addOptional(b, p.LocalFTEID)
+	return b.bytes()
+}
+
+func (p *CreatedPDR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*p = CreatedPDR{}
+	mandatory(g, &p.PDRID)
+	p.LocalFTEID = optional[FTEID](g)
+	return g.err
+}
+
+// ForwardingParameters tells where a FAR forwards packets
+// (TS 29.244 7.5.2.3-2)
+type ForwardingParameters struct {
+	DestinationInterface DestinationInterface
+	NetworkInstance      *NetworkInstance
+	OuterHeaderCreation  *OuterHeaderCreation
+}
+
+func (ForwardingParameters) IEType() uint16 { return TypeForwardingParameters }
+
+func (f ForwardingParameters) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(f.DestinationInterface)
+	addOptional(b, f.NetworkInstance)
+	addOptional(b, f.OuterHeaderCreation)
+	return b.bytes()
+}
+
+func (f *ForwardingParameters) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*f = ForwardingParameters{}
+	mandatory(g, &f.DestinationInterface)
+	f.NetworkInstance = optional[NetworkInstance](g)
+	f.OuterHeaderCreation = optional[OuterHeaderCreation](g)
+	return g.err
+}
+
+// UpdateForwardingParameters changes the forwarding parameters of a FAR
+// that are set (TS 29.244 7.5.4.3-2)
+type UpdateForwardingParameters struct {
+	DestinationInterface *DestinationInterface
+	NetworkInstance      *NetworkInstance
+	OuterHeaderCreation  *OuterHeaderCreation
+}
+
+func (UpdateForwardingParameters) IEType() uint16 { return TypeUpdateForwardingParameters }
+
+func (f UpdateForwardingParameters) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	addOptional(b, f.DestinationInterface)
+	addOptional(b, f.NetworkInstance)
+	addOptional(b, f.OuterHeaderCreation)
+	return b.bytes()
+}
+
+func (f *UpdateForwardingParameters) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*f = UpdateForwardingParameters{}
+	f.DestinationInterface = optional[DestinationInterface](g)
+	f.NetworkInstance = optional[NetworkInstance](g)
+	f.OuterHeaderCreation = optional[OuterHeaderCreation](g)
+	return g.err
+}
+
+// CreateFAR is a forwarding action rule to create (TS 29.244 7.5.2.3)
+type CreateFAR struct {
+	FARID                FARID
+	ApplyAction          ApplyAction
+	ForwardingParameters *ForwardingParameters
+}
+
+func (CreateFAR) IEType() uint16 { return TypeCreateFAR }
+
+func (f CreateFAR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(f.FARID)
+	b.add(f.ApplyAction)
+	addOptional(b, f.ForwardingParameters)
+	return b.bytes()
+}
+
+func (f *CreateFAR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*f = CreateFAR{}
+	mandatory(g, &f.FARID)
+	mandatory(g, &f.ApplyAction)
+	f.ForwardingParameters = optional[ForwardingParameters](g)
+	return g.err
+}
+
+// UpdateFAR changes the parts of a FAR that are set (TS 29.244 7.5.4.3)
+type UpdateFAR struct {
+	FARID                      FARID
+	ApplyAction                *ApplyAction
+	UpdateForwardingParameters *UpdateForwardingParameters
+}
+
+func (UpdateFAR) IEType() uint16 { return TypeUpdateFAR }
+
+func (f UpdateFAR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(f.FARID)
+	addOptional(b, f.ApplyAction)
+	addOptional(b, f.UpdateForwardingParameters)
+	return b.bytes()
+}
+
+func (f *UpdateFAR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*f = UpdateFAR{}
+	mandatory(g, &f.FARID)
+	f.ApplyAction = optional[ApplyAction](g)
+	f.UpdateForwardingParameters = optional[UpdateForwardingParameters](g)
+	return g.err
+}
+
+// RemoveFAR removes a FAR (TS 29.244 7.5.4.7)
+type RemoveFAR struct {
+	FARID FARID
+}
+
+func (RemoveFAR) IEType() uint16 { return TypeRemoveFAR }
+
+func (f RemoveFAR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(f.FARID)
+	return b.bytes()
+}
+
+func (f *RemoveFAR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	mandatory(g, &f.FARID)
+	return g.err
+}
+
+// CreateURR is a usage reporting rule to create (TS 29.244 7.5.2.4)
+type CreateURR struct {
+	URRID             URRID
+	MeasurementMethod MeasurementMethod
+	ReportingTriggers ReportingTriggers
+	MeasurementPeriod *MeasurementPeriod
+	VolumeThreshold   *VolumeThreshold
+	VolumeQuota       *VolumeQuota
+	TimeThreshold     *TimeThreshold
+	TimeQuota         *TimeQuota
+}
+
+func (CreateURR) IEType() uint16 { return TypeCreateURR }
+
+func (u CreateURR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(u.URRID)
+	b.add(u.MeasurementMethod)
+	b.add(u.ReportingTriggers)
+	addOptional(b, u.MeasurementPeriod)
+	addOptional(b, u.VolumeThreshold)
+	addOptional(b, u.VolumeQuota)
+	addOptional(b, u.TimeThreshold)
+	addOptional(b, u.TimeQuota)
+	return b.bytes()
+}
+
+func (u *CreateURR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*u = CreateURR{}
+	mandatory(g, &u.URRID)
+	mandatory(g, &u.MeasurementMethod)
+	mandatory(g, &u.ReportingTriggers)
+	u.MeasurementPeriod = optional[MeasurementPeriod](g)
+	u.VolumeThreshold = optional[VolumeThreshold](g)
+	u.VolumeQuota = optional[VolumeQuota](g)
+	u.TimeThreshold = optional[TimeThreshold](g)
+	u.TimeQuota = optional[TimeQuota](g)
+	return g.err
+}
+
+// UpdateURR changes the parts of a URR that are set (TS 29.244 7.5.4.4)
+type UpdateURR struct {
+	URRID             URRID
+	MeasurementMethod *MeasurementMethod
+	ReportingTriggers *ReportingTriggers
+	MeasurementPeriod *MeasurementPeriod
+	VolumeThreshold   *VolumeThreshold
+	VolumeQuota       *VolumeQuota
+	TimeThreshold     *TimeThreshold
+	TimeQuota         *TimeQuota
+}
+
+func (UpdateURR) IEType() uint16 { return TypeUpdateURR }
+
+func (u UpdateURR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(u.URRID)
+	addOptional(b, u.MeasurementMethod)
+	addOptional(b, u.ReportingTriggers)
+	addOptional(b, u.MeasurementPeriod)
+	addOptional(b, u.VolumeThreshold)
+	addOptional(b, u.VolumeQuota)
+	addOptional(b, u.TimeThreshold)
+	addOptional(b, u.TimeQuota)
+	return b.bytes()
+}
+
+func (u *UpdateURR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*u = UpdateURR{}
+	mandatory(g, &u.URRID)
+	u.MeasurementMethod = optional[MeasurementMethod](g)
+	u.ReportingTriggers = optional[ReportingTriggers](g)
+	u.MeasurementPeriod = optional[MeasurementPeriod](g)
+	u.VolumeThreshold = optional[VolumeThreshold](g)
+	u.VolumeQuota = optional[VolumeQuota](g)
+	u.TimeThreshold = optional[TimeThreshold](g)
+	u.TimeQuota = optional[TimeQuota](g)
+	return g.err
+}
+
+// RemoveURR removes a URR (TS 29.244 7.5.4.8)
+type RemoveURR struct {
+	URRID URRID
+}
+
+func (RemoveURR) IEType() uint16 { return TypeRemoveURR }
+
+func (u RemoveURR) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(u.URRID)
+	return b.bytes()
+}
+
+func (u *RemoveURR) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	mandatory(g, &u.URRID)
+	return g.err
+}
+
+// UsageReport is the usage a URR measured. The IE has a type per message
+// it is in, so it is encoded as one of the types below.
+type UsageReport struct {
+	URRID               URRID
+	URSEQN              URSEQN
+	Trigger             UsageReportTrigger
+	StartTime           *StartTime
+	EndTime             *EndTime
+	VolumeMeasurement   *VolumeMeasurement
+	DurationMeasurement *DurationMeasurement
+}
+
+func (u UsageReport) marshal() ([]byte, error) {
+	b := &builder{}
+	b.add(u.URRID)
+	b.add(u.URSEQN)
+	b.add(u.Trigger)
+	addOptional(b, u.StartTime)
+	addOptional(b, u.EndTime)
+	addOptional(b, u.VolumeMeasurement)
+	addOptional(b, u.DurationMeasurement)
+	return b.bytes()
+}
+
+func (u *UsageReport) unmarshal(data []byte) error {
+	g := parseGroup(data)
+	*u = UsageReport{}
+	mandatory(g, &u.URRID)
+	mandatory(g, &u.URSEQN)
+	mandatory(g, &u.Trigger)
+	u.StartTime = optional[StartTime](g)
+	u.EndTime = optional[EndTime](g)
+	u.VolumeMeasurement = optional[VolumeMeasurement](g)
+	u.DurationMeasurement = optional[DurationMeasurement](g)
+	return g.err
+}
+
+// ModificationUsageReport is a Usage Report in a Session Modification
+// Response (TS 29.244 7.5.5.2)
+type ModificationUsageReport UsageReport
+
+func (ModificationUsageReport) IEType() uint16 { return TypeUsageReportModification }
+
+func (u ModificationUsageReport) MarshalValue() ([]byte, error) { return UsageReport(u).marshal() }
+
+func (u *ModificationUsageReport) UnmarshalValue(data []byte) error {
+	return (*UsageReport)(u).unmarshal(data)
+}
+
+// DeletionUsageReport is a Usage Report in a Session Deletion Response
+// (TS 29.244 7.5.7.2)
+type DeletionUsageReport UsageReport
+
+func (DeletionUsageReport) IEType() uint16 { return TypeUsageReportDeletion }
+
+func (u DeletionUsageReport) MarshalValue() ([]byte, error) { return UsageReport(u).marshal() }
+
+func (u *DeletionUsageReport) UnmarshalValue(data []byte) error {
+	return (*UsageReport)(u).unmarshal(data)
+}
+
+// CreateQER is a QoS enforcement rule to create (TS 29.244 7.5.2.5)
+type CreateQER struct {
+	QERID            QERID
+	QERCorrelationID *QERCorrelationID
+	GateStatus       GateStatus
+	MBR              *MBR
+	GBR              *GBR
+	QFI              *QFI
+}
+
+func (CreateQER) IEType() uint16 { return TypeCreateQER }
+
+func (q CreateQER) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(q.QERID)
+	addOptional(b, q.QERCorrelationID)
+	b.add(q.GateStatus)
+	addOptional(b, q.MBR)
+	addOptional(b, q.GBR)
+	addOptional(b, q.QFI)
+	return b.bytes()
+}
+
+func (q *CreateQER) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*q = CreateQER{}
+	mandatory(g, &q.QERID)
+	q.QERCorrelationID = optional[QERCorrelationID](g)
+	mandatory(g, &q.GateStatus)
+	q.MBR = optional[MBR](g)
+	q.GBR = optional[GBR](g)
+	q.QFI = optional[QFI](g)
+	return g.err
+}
+
+// UpdateQER changes the parts of a QER that are set (TS 29.244 7.5.4.5)
+type UpdateQER struct {
+	QERID            QERID
+	QERCorrelationID *QERCorrelationID
+	GateStatus       *GateStatus
+	MBR              *MBR
+	GBR              *GBR
+	QFI              *QFI
+}
+
+func (UpdateQER) IEType() uint16 { return TypeUpdateQER }
+
+func (q UpdateQER) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(q.QERID)
+	addOptional(b, q.QERCorrelationID)
+	addOptional(b, q.GateStatus)
+	addOptional(b, q.MBR)
+	addOptional(b, q.GBR)
+	addOptional(b, q.QFI)
+	return b.bytes()
+}
+
+func (q *UpdateQER) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	*q = UpdateQER{}
+	mandatory(g, &q.QERID)
+	q.QERCorrelationID = optional[QERCorrelationID](g)
+	q.GateStatus = optional[GateStatus](g)
+	q.MBR = optional[MBR](g)
+	q.GBR = optional[GBR](g)
+	q.QFI = optional[QFI](g)
+	return g.err
+}
+
+// RemoveQER removes a QER (TS 29.244 7.5.4.9)
+type RemoveQER struct {
+	QERID QERID
+}
+
+func (RemoveQER) IEType() uint16 { return TypeRemoveQER }
+
+func (q RemoveQER) MarshalValue() ([]byte, error) {
+	b := &builder{}
+	b.add(q.QERID)
+	return b.bytes()
+}
+
+func (q *RemoveQER) UnmarshalValue(data []byte) error {
+	g := parseGroup(data)
+	mandatory(g, &q.QERID)
+	return g.err
+}
@@ -0,0 +1,226 @@
+// Package ie encodes and decodes PFCP information elements (TS 29.244 8.1),
+// the TLV encoded contents of PFCP messages
+package ie
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	headerLength       = 4 // Type and length
+	enterpriseIDLength = 2
+	vendorSpecificBit  = 0x8000
+)
+
+// Errors of IEs that cannot be decoded or encoded, wrapped in an *Error
+var (
+	ErrTruncated      = errors.New("IE truncated")
+	ErrInvalidLength  = errors.New("invalid IE length")
+	ErrInvalidValue   = errors.New("invalid IE value")
+	ErrMissing        = errors.New("mandatory IE missing")
+	ErrUnexpectedType = errors.New("unexpected IE type")
+)
+
+// Error is returned for an IE that cannot be decoded or encoded. Type is
+// the innermost IE at fault, e.g. the PDR ID missing from a Create PDR.
+type Error struct {
+	Type uint16
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("IE type %d: %v", e.Type, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// wrapError attributes an error to an IE type, unless it is already
+// attributed to an IE grouped in it
+func wrapError(ieType uint16, err error) error {
+	var ieErr *Error
+	if errors.As(err, &ieErr) {
+		return err
+	}
+	return &Error{Type: ieType, Err: err}
+}
+
+// IE is an information element as found in a PFCP message
+type IE struct {
+	Type uint16
+	// EnterpriseID identifies the vendor of a vendor specific IE, whose type
+	// has the most significant bit set
+	EnterpriseID uint16
+	Payload      []byte // The value, after the enterprise ID
+}
+
+// IsVendorSpecific reports whether an IE type is vendor specific, and so
+// carries an enterprise ID
+func IsVendorSpecific(ieType uint16) bool {
+	return ieType&vendorSpecificBit != 0
+}
+
+// Len returns the length of the encoded IE
+func (ie *IE) Len() int {
+	if IsVendorSpecific(ie.Type) {
+		return headerLength + enterpriseIDLength + len(ie.Payload)
+	}
+	return headerLength + len(ie.Payload)
+}
+
+// AppendTo appends the encoded IE to b
+func (ie *IE) AppendTo(b []byte) ([]byte, error) {
+	length := ie.Len() - headerLength
+	if length > 0xffff {
+		return nil, &Error{Type: ie.Type, Err: fmt.Errorf("%w: %d octets", ErrInvalidLength, length)}
+	}
+	b = binary.BigEndian.AppendUint16(b, ie.Type)
+	b = binary.BigEndian.AppendUint16(b, uint16(length))
+	if IsVendorSpecific(ie.Type) {
+		b = binary.BigEndian.AppendUint16(b, ie.EnterpriseID)
+	}
+	return append(b, ie.Payload...), nil
+}
+
+// Marshal encodes IEs one after the other, as in a message or grouped IE
+func Marshal(ies ...*IE) ([]byte, error) {
+	var b []byte
+	for _, ie := range ies {
+		var err error
+		if b, err = ie.AppendTo(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Parse decodes the IEs of a message or grouped IE
+func Parse(b []byte) ([]*IE, error) {
+	var ies []*IE
+	for len(b) > 0 {
+		if len(b) < headerLength {
+			return nil, &Error{Err: fmt.Errorf("%w: %d octets left for an IE header", ErrTruncated, len(b))}
+		}
+		ie := &IE{Type: binary.BigEndian.Uint16(b[0:2])}
+		length := int(binary.BigEndian.Uint16(b[2:4]))
+		b = b[headerLength:]
+		if len(b) < length {
+			return nil, &Error{Type: ie.Type, Err: fmt.Errorf("%w: length %d, %d octets left", ErrTruncated, length, len(b))}
+		}
+		value := b[:length]
+		b = b[length:]
+
+		if IsVendorSpecific(ie.Type) {
+			if len(value) < enterpriseIDLength {
+				return nil, &Error{Type: ie.Type, Err: fmt.Errorf("%w: no enterprise ID", ErrInvalidLength)}
+			}
+			ie.EnterpriseID = binary.BigEndian.Uint16(value)
+			value = value[enterpriseIDLength:]
+		}
+		ie.Payload = append([]byte(nil), value...)
+		ies = append(ies, ie)
+	}
+	return ies, nil
+}
+
+// Find returns the first standard IE of a type, or nil
+func Find(ies []*IE, ieType uint16) *IE {
+	for _, ie := range ies {
+		if ie.Type == ieType {
+			return ie
+		}
+	}
+	return nil
+}
+
+// FindAll returns the IEs of a type, for those that may be repeated
+func FindAll(ies []*IE, ieType uint16) []*IE {
+	var found []*IE
+	for _, ie := range ies {
+		if ie.Type == ieType {
+			found = append(found, ie)
+		}
+	}
+	return found
+}
+
+// FindVendorSpecific returns the first vendor specific IE of a type
+// defined by an enterprise, or nil
+func FindVendorSpecific(ies []*IE, enterpriseID, ieType uint16) *IE {
+	for _, ie := range ies {
+		if ie.Type == ieType && ie.EnterpriseID == enterpriseID && IsVendorSpecific(ie.Type) {
+			return ie
+		}
+	}
+	return nil
+}
+
+// Value is the typed value of an IE, which encodes itself
+type Value interface {
+	IEType() uint16
+	MarshalValue() ([]byte, error)
+}
+
+// ValueUnmarshaler is the typed value of an IE, which decodes itself. The
+// octets an IE may be extended with in later releases are ignored.
+type ValueUnmarshaler interface {
+	IEType() uint16
+	UnmarshalValue(b []byte) error
+}
+
+// New encodes a typed value into an IE
+func New(v Value) (*IE, error) {
+	payload, err := v.MarshalValue()
+	if err != nil {
+		return nil, wrapError(v.IEType(), err)
+	}
+	return &IE{Type: v.IEType(), Payload: payload}, nil
+}
+
+// NewGrouped creates a grouped IE holding other IEs
+func NewGrouped(ieType uint16, children ...*IE) (*IE, error) {
+	payload, err := Marshal(children...)
+	if err != nil {
+		return nil, err
+	}
+	return &IE{Type: ieType, Payload: payload}, nil
+}
+
+// Decode decodes the value of the IE into v, which must be of its type
+func (ie *IE) Decode(v ValueUnmarshaler) error {
+	if ie.Type != v.IEType() {
+		return &Error{Type: ie.Type, Err: fmt.Errorf("%w: expected %d", ErrUnexpectedType, v.IEType())}
+	}
+	if err := v.UnmarshalValue(ie.Payload); err != nil {
+		return wrapError(ie.Type, err)
+	}
+	return nil
+}
+
+// Children decodes the IEs grouped in the IE
+func (ie *IE) Children() ([]*IE, error) {
+	return Parse(ie.Payload)
+}
+
+// DecodeMandatory decodes the first IE of the type of v, failing with
+// ErrMissing when there is none
+func DecodeMandatory(ies []*IE, v ValueUnmarshaler) error {
+	ie := Find(ies, v.IEType())
+	if ie == nil {
+		return &Error{Type: v.IEType(), Err: ErrMissing}
+	}
+	return ie.Decode(v)
+}
+
+// DecodeOptional decodes the first IE of the type of v, when there is one,
+// and reports whether there was
+func DecodeOptional(ies []*IE, v ValueUnmarshaler) (bool, error) {
+	ie := Find(ies, v.IEType())
+	if ie == nil {
+		return false, nil
+	}
+	return true, ie.Decode(v)
+}
@@ -0,0 +1,370 @@
+package ie
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+var (
+	ipv4 = net.ParseIP("192.0.2.1").To4()
+	ipv6 = net.ParseIP("2001:db8::1")
+)
+
+// roundTripCases holds a value of every IE
+var roundTripCases = []struct {
+	name  string
+	value Value
+}{
+	{"Cause", CauseRequestAccepted},
+	{"PDR ID", PDRID(7)},
+	{"FAR ID", FARID(0x01020304)},
+	{"URR ID", URRID(3)},
+	{"QER ID", QERID(4)},
+	{"QER Correlation ID", QERCorrelationID(9)},
+	{"Precedence", Precedence(255)},
+	{"Source Interface", SourceInterface(InterfaceAccess)},
+	{"Destination Interface", DestinationInterface(InterfaceCore)},
+	{"QFI", QFI(9)},
+	{"Apply Action", ApplyActionFORW},
+	{"Apply Action two octets", ApplyActionBUFF | ApplyActionNOCP | ApplyActionDDPN},
+	{"Measurement Method", MeasurementMethodVOLUM | MeasurementMethodDURAT},
+	{"Reporting Triggers", ReportingTriggerVOLTH | ReportingTriggerPERIO | ReportingTriggerVOLQU},
+	{"Reporting Triggers three octets", ReportingTriggerTIMTH | ReportingTriggerUPINT},
+	{"Measurement Period", MeasurementPeriod(60)},
+	{"Time Threshold", TimeThreshold(3600)},
+	{"Time Quota", TimeQuota(7200)},
+	{"Volume Threshold", VolumeThreshold{Total: ptr(uint64(1 << 40)), Downlink: ptr(uint64(5))}},
+	{"Volume Quota", VolumeQuota{Uplink: ptr(uint64(1000))}},
+	{"Gate Status", GateStatus{UL: GateOpen, DL: GateClosed}},
+	{"MBR", MBR{UL: 100000, DL: 1 << 39}},
+	{"GBR", GBR{UL: 64, DL: 128}},
+	{"Application ID", ApplicationID("app-1")},
+	{"Network Instance", NetworkInstance("internet")},
+	{"Recovery Time Stamp", RecoveryTimeStamp{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}},
+	{"Recovery Time Stamp after 2036", RecoveryTimeStamp{Time: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)}},
+	{"Node ID IPv4", NodeID{Type: NodeIDIPv4, IP: ipv4}},
+	{"Node ID IPv6", NodeID{Type: NodeIDIPv6, IP: ipv6}},
+	{"Node ID FQDN", NodeID{Type: NodeIDFQDN, FQDN: "smf.5gc.mnc001.mcc001.3gppnetwork.org"}},
+	{"F-SEID IPv4", FSEID{SEID: 0x0102030405060708, IPv4: ipv4}},
+	{"F-SEID dual stack", FSEID{SEID: 1, IPv4: ipv4, IPv6: ipv6}},
+	{"F-TEID", FTEID{TEID: 0xdeadbeef, IPv4: ipv4}},
+	{"F-TEID IPv6", FTEID{TEID: 1, IPv6: ipv6}},
+	{"F-TEID choose", FTEID{Choose: true, ChooseIPv4: true}},
+	{"F-TEID choose ID", FTEID{Choose: true, ChooseIPv4: true, ChooseIPv6: true, HasChooseID: true, ChooseID: 5}},
+	{"UE IP Address", UEIPAddress{IPv4: ipv4, Destination: true}},
+	{"UE IP Address IPv6 prefix", UEIPAddress{IPv6: ipv6, IPv6PrefixDelegationBits: ptr(uint8(8)), IPv6PrefixLength: ptr(uint8(64))}},
+	{"UE IP Address choose", UEIPAddress{ChooseIPv4: true, ChooseIPv6: true}},
+	{"SDF Filter", SDFFilter{FlowDescription: "permit out ip from any to assigned"}},
+	{"SDF Filter all parts", SDFFilter{
+		FlowDescription:        "permit out 17 from 198.51.100.0/24 to assigned 5000",
+		ToSTrafficClass:        ptr(uint16(0x2eff)),
+		SecurityParameterIndex: ptr(uint32(0x11223344)),
+		FlowLabel:              ptr(uint32(0x0abcde)),
+		FilterID:               ptr(uint32(12)),
+	}},
+	{"Outer Header Creation GTP-U", OuterHeaderCreation{Description: OuterHeaderCreationGTPUUDPIPv4, TEID: 0x100, IPv4: ipv4}},
+	{"Outer Header Creation UDP IPv6", OuterHeaderCreation{Description: OuterHeaderCreationUDPIPv6, IPv6: ipv6, Port: 2152}},
+	{"Outer Header Creation tags", OuterHeaderCreation{
+		Description: OuterHeaderCreationIPv4 | OuterHeaderCreationCTag | OuterHeaderCreationSTag | OuterHeaderCreationN6,
+		IPv4:        ipv4, CTag: 0x010203, STag: 0x040506,
+	}},
+	{"Outer Header Removal", OuterHeaderRemoval{Description: OuterHeaderRemovalGTPUUDPIPv4}},
+	{"Outer Header Removal extension headers", OuterHeaderRemoval{Description: OuterHeaderRemovalGTPUUDPIP, ExtensionHeaderDeletion: ptr(uint8(1))}},
+	{"PDI", PDI{
+		SourceInterface: SourceInterface(InterfaceAccess),
+		LocalFTEID:      &FTEID{Choose: true, ChooseIPv4: true},
+		NetworkInstance: ptr(NetworkInstance("internet")),
+		UEIPAddress:     &UEIPAddress{IPv4: ipv4},
+		SDFFilters:      []SDFFilter{{FlowDescription: "permit out ip from any to assigned"}, {FilterID: ptr(uint32(1))}},
+		ApplicationID:   ptr(ApplicationID("app")),
+		QFIs:            []QFI{1, 2},
+	}},
+	{"Create PDR", CreatePDR{
+		PDRID:              1,
+		Precedence:         100,
+		PDI:                PDI{SourceInterface: SourceInterface(InterfaceAccess), LocalFTEID: &FTEID{TEID: 1, IPv4: ipv4}},
+		OuterHeaderRemoval: &OuterHeaderRemoval{Description: OuterHeaderRemovalGTPUUDPIPv4},
+		FARID:              ptr(FARID(1)),
+		URRIDs:             []URRID{1, 2},
+		QERIDs:             []QERID{1},
+	}},
+	{"Create PDR minimal", CreatePDR{PDRID: 2, Precedence: 200, PDI: PDI{SourceInterface: SourceInterface(InterfaceCore)}}},
+	{"Update PDR", UpdatePDR{PDRID: 1, Precedence: ptr(Precedence(10)), FARID: ptr(FARID(2)), URRIDs: []URRID{3}}},
+	{"Update PDR PDI", UpdatePDR{PDRID: 1, PDI: &PDI{SourceInterface: SourceInterface(InterfaceCore), UEIPAddress: &UEIPAddress{IPv4: ipv4, Destination: true}}}},
+	{"Remove PDR", RemovePDR{PDRID: 1}},
+	{"Created PDR", CreatedPDR{PDRID: 1, LocalFTEID: &FTEID{TEID: 0x10, IPv4: ipv4}}},
+	{"Offending IE", OffendingIE(TypeCreatePDR)},
+	{"Failed Rule ID PDR", FailedRuleID{RuleType: RuleTypePDR, RuleID: 0xffff}},
+	{"Failed Rule ID FAR", FailedRuleID{RuleType: RuleTypeFAR, RuleID: 0x01020304}},
+	{"Failed Rule ID BAR", FailedRuleID{RuleType: RuleTypeBAR, RuleID: 3}},
+	{"Forwarding Parameters", ForwardingParameters{
+		DestinationInterface: DestinationInterface(InterfaceAccess),
+		NetworkInstance:      ptr(NetworkInstance("access")),
+		OuterHeaderCreation:  &OuterHeaderCreation{Description: OuterHeaderCreationGTPUUDPIPv4, TEID: 9, IPv4: ipv4},
+	}},
+	{"Update Forwarding Parameters", UpdateForwardingParameters{
+		OuterHeaderCreation: &OuterHeaderCreation{Description: OuterHeaderCreationGTPUUDPIPv6, TEID: 10, IPv6: ipv6},
+	}},
+	{"Create FAR", CreateFAR{
+		FARID:                1,
+		ApplyAction:          ApplyActionFORW,
+		ForwardingParameters: &ForwardingParameters{DestinationInterface: DestinationInterface(InterfaceCore)},
+	}},
+	{"Create FAR drop", CreateFAR{FARID: 2, ApplyAction: ApplyActionDROP}},
+	{"Update FAR", UpdateFAR{
+		FARID:                      1,
+		ApplyAction:                ptr(ApplyActionBUFF | ApplyActionNOCP),
+		UpdateForwardingParameters: &UpdateForwardingParameters{DestinationInterface: ptr(DestinationInterface(InterfaceAccess))},
+	}},
+	{"Remove FAR", RemoveFAR{FARID: 1}},
+	{"Create URR", CreateURR{
+		URRID:             1,
+		MeasurementMethod: MeasurementMethodVOLUM,
+		ReportingTriggers: ReportingTriggerVOLTH | ReportingTriggerPERIO,
+		MeasurementPeriod: ptr(MeasurementPeriod(60)),
+		VolumeThreshold:   &VolumeThreshold{Total: ptr(uint64(1 << 30))},
+		VolumeQuota:       &VolumeQuota{Total: ptr(uint64(1 << 31))},
+		TimeThreshold:     ptr(TimeThreshold(600)),
+		TimeQuota:         ptr(TimeQuota(1200)),
+	}},
+	{"Update URR", UpdateURR{URRID: 1, VolumeThreshold: &VolumeThreshold{Uplink: ptr(uint64(10))}}},
+	{"Remove URR", RemoveURR{URRID: 1}},
+	{"Usage Report Trigger", UsageReportTriggerTERMR},
+	{"Usage Report Trigger three octets", UsageReportTriggerPERIO | UsageReportTriggerUPINT},
+	{"UR-SEQN", URSEQN(12)},
+	{"Start Time", StartTime{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}},
+	{"End Time", EndTime{Time: time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)}},
+	{"Volume Measurement", VolumeMeasurement{Total: ptr(uint64(30)), Uplink: ptr(uint64(10)), Downlink: ptr(uint64(20))}},
+	{"Duration Measurement", DurationMeasurement(3600)},
+	{"Usage Report in Session Modification Response", ModificationUsageReport{URRID: 1, URSEQN: 2, Trigger: UsageReportTriggerTERMR}},
+	{"Usage Report in Session Deletion Response", DeletionUsageReport{
+		URRID:               1,
+		Trigger:             UsageReportTriggerTERMR,
+		StartTime:           &StartTime{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		EndTime:             &EndTime{Time: time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)},
+		VolumeMeasurement:   &VolumeMeasurement{Total: ptr(uint64(3)), Uplink: ptr(uint64(1)), Downlink: ptr(uint64(2))},
+		DurationMeasurement: ptr(DurationMeasurement(3600)),
+	}},
+	{"Create QER", CreateQER{
+		QERID:            1,
+		QERCorrelationID: ptr(QERCorrelationID(2)),
+		GateStatus:       GateStatus{UL: GateOpen, DL: GateOpen},
+		MBR:              &MBR{UL: 1000, DL: 2000},
+		GBR:              &GBR{UL: 100, DL: 200},
+		QFI:              ptr(QFI(5)),
+	}},
+	{"Update QER", UpdateQER{QERID: 1, GateStatus: &GateStatus{UL: GateClosed, DL: GateClosed}, MBR: &MBR{UL: 1, DL: 2}}},
+	{"Remove QER", RemoveQER{QERID: 1}},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range roundTripCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded, err := New(tc.value)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			data, err := Marshal(encoded)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			ies, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(ies) != 1 || ies[0].Type != tc.value.IEType() {
+				t.Fatalf("Parse returned %+v, expected one IE of type %d", ies, tc.value.IEType())
+			}
+
+			decoded := reflect.New(reflect.TypeOf(tc.value))
+			if err := ies[0].Decode(decoded.Interface().(ValueUnmarshaler)); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got := decoded.Elem().Interface(); !reflect.DeepEqual(got, tc.value) {
+				t.Errorf("decoded %+v, expected %+v", got, tc.value)
+			}
+		})
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value Value
+		data  []byte
+	}{
+		{"Cause", CauseSessionContextNotFound, []byte{0, 19, 0, 1, 65}},
+		{"Node ID IPv4", NodeID{Type: NodeIDIPv4, IP: ipv4}, []byte{0, 60, 0, 5, 0, 192, 0, 2, 1}},
+		{"Node ID FQDN", NodeID{Type: NodeIDFQDN, FQDN: "upf.lab"}, []byte{0, 60, 0, 9, 2, 3, 'u', 'p', 'f', 3, 'l', 'a', 'b'}},
+		{"Recovery Time Stamp", RecoveryTimeStamp{Time: time.Unix(0, 0)}, []byte{0, 96, 0, 4, 0x83, 0xaa, 0x7e, 0x80}},
+		{"F-SEID", FSEID{SEID: 1, IPv4: ipv4}, []byte{0, 57, 0, 13, 0x02, 0, 0, 0, 0, 0, 0, 0, 1, 192, 0, 2, 1}},
+		{"F-TEID", FTEID{TEID: 2, IPv4: ipv4}, []byte{0, 21, 0, 9, 0x01, 0, 0, 0, 2, 192, 0, 2, 1}},
+		{"F-TEID choose", FTEID{Choose: true, ChooseIPv4: true}, []byte{0, 21, 0, 1, 0x05}},
+		{"UE IP Address", UEIPAddress{IPv4: ipv4, Destination: true}, []byte{0, 93, 0, 5, 0x06, 192, 0, 2, 1}},
+		{"Apply Action", ApplyActionFORW, []byte{0, 44, 0, 1, 0x02}},
+		{"Outer Header Creation", OuterHeaderCreation{Description: OuterHeaderCreationGTPUUDPIPv4, TEID: 1, IPv4: ipv4},
+			[]byte{0, 84, 0, 10, 0x01, 0x00, 0, 0, 0, 1, 192, 0, 2, 1}},
+		{"Outer Header Removal", OuterHeaderRemoval{Description: OuterHeaderRemovalGTPUUDPIPv4}, []byte{0, 95, 0, 1, 0}},
+		{"SDF Filter", SDFFilter{FlowDescription: "ab"}, []byte{0, 23, 0, 6, 0x01, 0, 0, 2, 'a', 'b'}},
+		{"Remove PDR", RemovePDR{PDRID: 3}, []byte{0, 15, 0, 6, 0, 56, 0, 2, 0, 3}},
+		{"Failed Rule ID", FailedRuleID{RuleType: RuleTypeURR, RuleID: 5}, []byte{0, 114, 0, 5, 3, 0, 0, 0, 5}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ie, err := New(tc.value)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			data, err := Marshal(ie)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if !bytes.Equal(data, tc.data) {
+				t.Errorf("encoded % x, expected % x", data, tc.data)
+			}
+		})
+	}
+}
+
+func TestVendorSpecific(t *testing.T) {
+	ies := []*IE{
+		{Type: 0x8001, EnterpriseID: 10415, Payload: []byte{1, 2, 3}},
+		{Type: TypeCause, Payload: []byte{byte(CauseRequestAccepted)}},
+	}
+	data, err := Marshal(ies...)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Equal(data[:8], []byte{0x80, 0x01, 0, 5, 0x28, 0xaf, 1, 2}) {
+		t.Errorf("encoded % x, expected the enterprise ID counted in the length", data)
+	}
+
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, ies) {
+		t.Errorf("parsed %+v, expected %+v", parsed, ies)
+	}
+	if FindVendorSpecific(parsed, 10415, 0x8001) != parsed[0] || FindVendorSpecific(parsed, 1, 0x8001) != nil {
+		t.Error("FindVendorSpecific does not match the enterprise ID")
+	}
+
+	if _, err := Parse([]byte{0x80, 0x01, 0, 1, 0x28}); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("vendor specific IE without enterprise ID: got %v, expected ErrInvalidLength", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"truncated header", []byte{0, 19, 0}, ErrTruncated},
+		{"truncated value", []byte{0, 19, 0, 2, 1}, ErrTruncated},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse(tc.data); !errors.Is(err, tc.err) {
+				t.Errorf("got %v, expected %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		ie      *IE
+		value   ValueUnmarshaler
+		err     error
+		errType uint16
+	}{
+		{"empty Cause", &IE{Type: TypeCause}, new(Cause), ErrInvalidLength, TypeCause},
+		{"short F-SEID", &IE{Type: TypeFSEID, Payload: []byte{0x02, 0, 0, 0, 0, 0, 0, 0, 1, 192}}, new(FSEID), ErrInvalidLength, TypeFSEID},
+		{"F-SEID without address", &IE{Type: TypeFSEID, Payload: make([]byte, 9)}, new(FSEID), ErrInvalidValue, TypeFSEID},
+		{"short F-TEID", &IE{Type: TypeFTEID, Payload: []byte{0x01, 0, 0}}, new(FTEID), ErrInvalidLength, TypeFTEID},
+		{"unknown Node ID type", &IE{Type: TypeNodeID, Payload: []byte{3, 1}}, new(NodeID), ErrInvalidValue, TypeNodeID},
+		{"short Node ID", &IE{Type: TypeNodeID, Payload: []byte{0, 192, 0}}, new(NodeID), ErrInvalidLength, TypeNodeID},
+		{"truncated SDF Filter", &IE{Type: TypeSDFFilter, Payload: []byte{0x01, 0, 0, 5, 'a'}}, new(SDFFilter), ErrInvalidLength, TypeSDFFilter},
+		{"wrong type", &IE{Type: TypeCause, Payload: []byte{1}}, new(PDRID), ErrUnexpectedType, TypeCause},
+		{
+			"Create PDR without PDI",
+			&IE{Type: TypeCreatePDR, Payload: []byte{0, 56, 0, 2, 0, 1, 0, 29, 0, 4, 0, 0, 0, 1}},
+			new(CreatePDR), ErrMissing, TypePDI,
+		},
+		{
+			"Create FAR with a short FAR ID",
+			&IE{Type: TypeCreateFAR, Payload: []byte{0, 108, 0, 2, 0, 1, 0, 44, 0, 1, 2}},
+			new(CreateFAR), ErrInvalidLength, TypeFARID,
+		},
+		{
+			"PDI without Source Interface in a Create PDR",
+			&IE{Type: TypeCreatePDR, Payload: []byte{0, 56, 0, 2, 0, 1, 0, 29, 0, 4, 0, 0, 0, 1, 0, 2, 0, 0}},
+			new(CreatePDR), ErrMissing, TypeSourceInterface,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.ie.Decode(tc.value)
+			var ieErr *Error
+			if !errors.Is(err, tc.err) || !errors.As(err, &ieErr) {
+				t.Fatalf("got %v, expected an *Error wrapping %v", err, tc.err)
+			}
+			if ieErr.Type != tc.errType {
+				t.Errorf("error attributed to IE type %d, expected %d", ieErr.Type, tc.errType)
+			}
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value Value
+	}{
+		{"Node ID IPv4 with IPv6 address", NodeID{Type: NodeIDIPv4, IP: ipv6}},
+		{"Node ID with an empty label", NodeID{Type: NodeIDFQDN, FQDN: "upf..lab"}},
+		{"F-SEID without address", FSEID{SEID: 1}},
+		{"QFI over 6 bits", QFI(64)},
+		{"MBR over 5 octets", MBR{UL: 1 << 40}},
+		{"Failed Rule ID over the PDR ID length", FailedRuleID{RuleType: RuleTypePDR, RuleID: 1 << 16}},
+		{"Create PDR with an invalid F-TEID", CreatePDR{PDI: PDI{LocalFTEID: &FTEID{TEID: 1}}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := New(tc.value); !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("got %v, expected ErrInvalidValue", err)
+			}
+		})
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	var ies []*IE
+	for _, id := range []URRID{1, 2} {
+		encoded, err := New(id)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		ies = append(ies, encoded, &IE{Type: TypeCause, Payload: []byte{1}})
+	}
+	ids, err := DecodeAll[URRID](ies)
+	if err != nil || !reflect.DeepEqual(ids, []URRID{1, 2}) {
+		t.Errorf("DecodeAll returned %v, %v, expected [1 2]", ids, err)
+	}
+}
+
+func TestNetworkInstanceLabels(t *testing.T) {
+	var n NetworkInstance
+	if err := (&IE{Type: TypeNetworkInstance, Payload: []byte{8, 'i', 'n', 't', 'e', 'r', 'n', 'e', 't'}}).Decode(&n); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if n != "internet" {
+		t.Errorf("decoded %q, expected the DNN encoded as labels", n)
+	}
+}
@@ -0,0 +1,207 @@
+package ie
+
+// IE types (TS 29.244 8.1.2)
+const (
+	TypeCreatePDR                  uint16 = 1
+	TypePDI                        uint16 = 2
+	TypeCreateFAR                  uint16 = 3
+	TypeForwardingParameters       uint16 = 4
+	TypeCreateURR                  uint16 = 6
+	TypeCreateQER                  uint16 = 7
+	TypeCreatedPDR                 uint16 = 8
+	TypeUpdatePDR                  uint16 = 9
+	TypeUpdateFAR                  uint16 = 10
+	TypeUpdateForwardingParameters uint16 = 11
+	TypeUpdateURR                  uint16 = 13
+	TypeUpdateQER                  uint16 = 14
+	TypeRemovePDR                  uint16 = 15
+	TypeRemoveFAR                  uint16 = 16
+	TypeRemoveURR                  uint16 = 17
+	TypeRemoveQER                  uint16 = 18
+	TypeCause                      uint16 = 19
+	TypeSourceInterface            uint16 = 20
+	TypeFTEID                      uint16 = 21
+	TypeNetworkInstance            uint16 = 22
+	TypeSDFFilter                  uint16 = 23
+	TypeApplicationID              uint16 = 24
+	TypeGateStatus                 uint16 = 25
+	TypeMBR                        uint16 = 26
+	TypeGBR                        uint16 = 27
+	TypeQERCorrelationID           uint16 = 28
+	TypePrecedence                 uint16 = 29
+	TypeVolumeThreshold            uint16 = 31
+	TypeTimeThreshold              uint16 = 32
+	TypeReportingTriggers          uint16 = 37
+	TypeOffendingIE                uint16 = 40
+	TypeDestinationInterface       uint16 = 42
+	TypeApplyAction                uint16 = 44
+	TypePDRID                      uint16 = 56
+	TypeFSEID                      uint16 = 57
+	TypeNodeID                     uint16 = 60
+	TypeMeasurementMethod          uint16 = 62
+	TypeUsageReportTrigger         uint16 = 63
+	TypeMeasurementPeriod          uint16 = 64
+	TypeVolumeMeasurement          uint16 = 66
+	TypeDurationMeasurement        uint16 = 67
+	TypeVolumeQuota                uint16 = 73
+	TypeTimeQuota                  uint16 = 74
+	TypeStartTime                  uint16 = 75
+	TypeEndTime                    uint16 = 76
+	TypeUsageReportModification    uint16 = 78
+	TypeUsageReportDeletion        uint16 = 79
+	TypeURRID                      uint16 = 81
+	TypeOuterHeaderCreation        uint16 = 84
+	TypeUEIPAddress                uint16 = 93
+	TypeOuterHeaderRemoval         uint16 = 95
+	TypeRecoveryTimeStamp          uint16 = 96
+	TypeURSEQN                     uint16 = 104
+	TypeFARID                      uint16 = 108
+	TypeQERID                      uint16 = 109
+	TypeFailedRuleID               uint16 = 114
+	TypeQFI                        uint16 = 124
+)
+
+// Cause values (TS 29.244 8.2.1)
+const (
+	CauseRequestAccepted                 Cause = 1
+	CauseRequestRejected                 Cause = 64 // Reason not specified
+	CauseSessionContextNotFound          Cause = 65
+	CauseMandatoryIEMissing              Cause = 66
+	CauseConditionalIEMissing            Cause = 67
+	CauseInvalidLength                   Cause = 68
+	CauseMandatoryIEIncorrect            Cause = 69
+	CauseInvalidForwardingPolicy         Cause = 70
+	CauseInvalidFTEIDAllocationOption    Cause = 71
+	CauseNoEstablishedPFCPAssociation    Cause = 72
+	CauseRuleCreationModificationFailure Cause = 73
+	CausePFCPEntityInCongestion          Cause = 74
+	CauseNoResourcesAvailable            Cause = 75
+	CauseServiceNotSupported             Cause = 76
+	CauseSystemFailure                   Cause = 77
+)
+
+// Interface values of Source Interface and Destination Interface
+// (TS 29.244 8.2.2, 8.2.24)
+const (
+	InterfaceAccess       uint8 = 0
+	InterfaceCore         uint8 = 1
+	InterfaceSGiLAN       uint8 = 2 // SGi-LAN or N6-LAN
+	InterfaceCPFunction   uint8 = 3
+	Interface5GVNInternal uint8 = 4
+)
+
+// Apply Action flags (TS 29.244 8.2.26). The first octet holds the low
+// byte, the optional second octet the high byte.
+const (
+	ApplyActionDROP ApplyAction = 1 << iota
+	ApplyActionFORW
+	ApplyActionBUFF
+	ApplyActionNOCP
+	ApplyActionDUPL
+	ApplyActionIPMA
+	ApplyActionIPMD
+	ApplyActionDFRT
+	ApplyActionEDRT
+	ApplyActionBDPN
+	ApplyActionDDPN
+)
+
+// Outer Header Creation descriptions (TS 29.244 8.2.56). The first octet
+// holds the high byte.
+const (
+	OuterHeaderCreationN19         uint16 = 0x0001
+	OuterHeaderCreationN6          uint16 = 0x0002
+	OuterHeaderCreationGTPUUDPIPv4 uint16 = 0x0100
+	OuterHeaderCreationGTPUUDPIPv6 uint16 = 0x0200
+	OuterHeaderCreationUDPIPv4     uint16 = 0x0400
+	OuterHeaderCreationUDPIPv6     uint16 = 0x0800
+	OuterHeaderCreationIPv4        uint16 = 0x1000
+	OuterHeaderCreationIPv6        uint16 = 0x2000
+	OuterHeaderCreationCTag        uint16 = 0x4000
+	OuterHeaderCreationSTag        uint16 = 0x8000
+)
+
+// Outer Header Removal descriptions (TS 29.244 8.2.64)
+const (
+	OuterHeaderRemovalGTPUUDPIPv4 uint8 = 0
+	OuterHeaderRemovalGTPUUDPIPv6 uint8 = 1
+	OuterHeaderRemovalUDPIPv4     uint8 = 2
+	OuterHeaderRemovalUDPIPv6     uint8 = 3
+	OuterHeaderRemovalIPv4        uint8 = 4
+	OuterHeaderRemovalIPv6        uint8 = 5
+	OuterHeaderRemovalGTPUUDPIP   uint8 = 6
+	OuterHeaderRemovalVLANSTag    uint8 = 7
+	OuterHeaderRemovalSTagCTag    uint8 = 8
+)
+
+// Rule types of Failed Rule ID (TS 29.244 8.2.80)
+const (
+	RuleTypePDR uint8 = 0
+	RuleTypeFAR uint8 = 1
+	RuleTypeQER uint8 = 2
+	RuleTypeURR uint8 = 3
+	RuleTypeBAR uint8 = 4
+)
+
+// Gate status values (TS 29.244 8.2.7)
+const (
+	GateOpen   uint8 = 0
+	GateClosed uint8 = 1
+)
+
+// Measurement Method flags (TS 29.244 8.2.40)
+const (
+	MeasurementMethodDURAT MeasurementMethod = 1 << iota
+	MeasurementMethodVOLUM
+	MeasurementMethodEVENT
+)
+
+// Reporting Triggers flags (TS 29.244 8.2.19). Octet 5 is the low byte,
+// octet 6 the next and the optional octet 7 the third.
+const (
+	ReportingTriggerPERIO ReportingTriggers = 1 << iota
+	ReportingTriggerVOLTH
+	ReportingTriggerTIMTH
+	ReportingTriggerQUHTI
+	ReportingTriggerSTART
+	ReportingTriggerSTOPT
+	ReportingTriggerDROTH
+	ReportingTriggerLIUSA
+	ReportingTriggerVOLQU
+	ReportingTriggerTIMQU
+	ReportingTriggerENVCL
+	ReportingTriggerMACAR
+	ReportingTriggerEVETH
+	ReportingTriggerEVEQU
+	ReportingTriggerIPMJL
+	ReportingTriggerQUVTI
+	ReportingTriggerREEMR
+	ReportingTriggerUPINT
+)
+
+// Usage Report Trigger flags (TS 29.244 8.2.41). Octet 5 is the low byte,
+// octet 6 the next and the optional octet 7 the third.
+const (
+	UsageReportTriggerPERIO UsageReportTrigger = 1 << iota
+	UsageReportTriggerVOLTH
+	UsageReportTriggerTIMTH
+	UsageReportTriggerQUHTI
+	UsageReportTriggerSTART
+	UsageReportTriggerSTOPT
+	UsageReportTriggerDROTH
+	UsageReportTriggerIMMER
+	UsageReportTriggerVOLQU
+	UsageReportTriggerTIMQU
+	UsageReportTriggerLIUSA
+	UsageReportTriggerTERMR
+	UsageReportTriggerMONIT
+	UsageReportTriggerENVCL
+	UsageReportTriggerMACAR
+	UsageReportTriggerEVETH
+	UsageReportTriggerEVEQU
+	UsageReportTriggerTEBUR
+	UsageReportTriggerIPMJL
+	UsageReportTriggerQUVTI
+	UsageReportTriggerEMRRE
+	UsageReportTriggerUPINT
+)
@@ -0,0 +1,673 @@
+package ie
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// appendUint appends the n low octets of v, big endian
+func appendUint(b []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+// readUint reads an n octet big endian integer at the start of b
+func readUint(b []byte, n int) (uint64, error) {
+	if len(b) < n {
+		return 0, fmt.Errorf("%w: %d octets, expected %d", ErrInvalidLength, len(b), n)
+	}
+	var v uint64
+	for _, octet := range b[:n] {
+		v = v<<8 | uint64(octet)
+	}
+	return v, nil
+}
+
+// Cause tells the result of a request (TS 29.244 8.2.1)
+type Cause uint8
+
+func (Cause) IEType() uint16 { return TypeCause }
+
+func (c Cause) MarshalValue() ([]byte, error) { return []byte{byte(c)}, nil }
+
+func (c *Cause) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 1)
+	*c = Cause(v)
+	return err
+}
+
+// Accepted reports whether the cause is a success
+func (c Cause) Accepted() bool {
+	return c >= 1 && c < 64
+}
+
+// OffendingIE is the type of the IE a request was rejected for
+// (TS 29.244 8.2.22)
+type OffendingIE uint16
+
+func (OffendingIE) IEType() uint16 { return TypeOffendingIE }
+
+func (o OffendingIE) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(o), 2), nil }
+
+func (o *OffendingIE) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 2)
+	*o = OffendingIE(v)
+	return err
+}
+
+// FailedRuleID is the rule that could not be created or modified, of one of
+// the RuleType types (TS 29.244 8.2.80)
+type FailedRuleID struct {
+	RuleType uint8
+	RuleID   uint32
+}
+
+func (FailedRuleID) IEType() uint16 { return TypeFailedRuleID }
+
+// ruleIDLength returns the length of the ID of a type of rule
+func ruleIDLength(ruleType uint8) (int, error) {
+	switch ruleType {
+	case RuleTypePDR:
+		return 2, nil
+	case RuleTypeFAR, RuleTypeQER, RuleTypeURR:
+		return 4, nil
+	case RuleTypeBAR:
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("%w: rule type %d", ErrInvalidValue, ruleType)
+	}
+}
+
+func (f FailedRuleID) MarshalValue() ([]byte, error) {
+	length, err := ruleIDLength(f.RuleType)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(f.RuleID) >= 1<<(8*length) {
+		return nil, fmt.Errorf("%w: rule ID %d exceeds %d octets", ErrInvalidValue, f.RuleID, length)
+	}
+	return appendUint([]byte{f.RuleType}, uint64(f.RuleID), length), nil
+}
+
+func (f *FailedRuleID) UnmarshalValue(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("%w: empty Failed Rule ID", ErrInvalidLength)
+	}
+	f.RuleType = b[0] & 0x1f
+	length, err := ruleIDLength(f.RuleType)
+	if err != nil {
+		return err
+	}
+	id, err := readUint(b[1:], length)
+	f.RuleID = uint32(id)
+	return err
+}
+
+// PDRID identifies a PDR in a session (TS 29.244 8.2.36)
+type PDRID uint16
+
+func (PDRID) IEType() uint16 { return TypePDRID }
+
+func (id PDRID) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(id), 2), nil }
+
+func (id *PDRID) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 2)
+	*id = PDRID(v)
+	return err
+}
+
+// FARID identifies a FAR in a session (TS 29.244 8.2.74)
+type FARID uint32
+
+func (FARID) IEType() uint16 { return TypeFARID }
+
+func (id FARID) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(id), 4), nil }
+
+func (id *FARID) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*id = FARID(v)
+	return err
+}
+
+// URRID identifies a URR in a session (TS 29.244 8.2.54)
+type URRID uint32
+
+func (URRID) IEType() uint16 { return TypeURRID }
+
+func (id URRID) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(id), 4), nil }
+
+func (id *URRID) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*id = URRID(v)
+	return err
+}
+
+// QERID identifies a QER in a session (TS 29.244 8.2.75)
+type QERID uint32
+
+func (QERID) IEType() uint16 { return TypeQERID }
+
+func (id QERID) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(id), 4), nil }
+
+func (id *QERID) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*id = QERID(v)
+	return err
+}
+
+// QERCorrelationID correlates QERs of several sessions (TS 29.244 8.2.10)
+type QERCorrelationID uint32
+
+func (QERCorrelationID) IEType() uint16 { return TypeQERCorrelationID }
+
+func (id QERCorrelationID) MarshalValue() ([]byte, error) {
+	return appendUint(nil, uint64(id), 4), nil
+}
+
+func (id *QERCorrelationID) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*id = QERCorrelationID(v)
+	return err
+}
+
+// Precedence orders the PDRs matching a packet, lowest first
+// (TS 29.244 8.2.11)
+type Precedence uint32
+
+func (Precedence) IEType() uint16 { return TypePrecedence }
+
+func (p Precedence) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(p), 4), nil }
+
+func (p *Precedence) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*p = Precedence(v)
+	return err
+}
+
+// SourceInterface is where the packets a PDR detects come from, one of the
+// Interface values (TS 29.244 8.2.2)
+type SourceInterface uint8
+
+func (SourceInterface) IEType() uint16 { return TypeSourceInterface }
+
+func (i SourceInterface) MarshalValue() ([]byte, error) { return []byte{byte(i) & 0x0f}, nil }
+
+func (i *SourceInterface) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 1)
+	*i = SourceInterface(v & 0x0f)
+	return err
+}
+
+// DestinationInterface is where a FAR forwards packets, one of the
+// Interface values (TS 29.244 8.2.24)
+type DestinationInterface uint8
+
+func (DestinationInterface) IEType() uint16 { return TypeDestinationInterface }
+
+func (i DestinationInterface) MarshalValue() ([]byte, error) { return []byte{byte(i) & 0x0f}, nil }
+
+func (i *DestinationInterface) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 1)
+	*i = DestinationInterface(v & 0x0f)
+	return err
+}
+
+// QFI is a QoS flow identifier (TS 29.244 8.2.89)
+type QFI uint8
+
+func (QFI) IEType() uint16 { return TypeQFI }
+
+func (q QFI) MarshalValue() ([]byte, error) {
+	if q > 0x3f {
+		return nil, fmt.Errorf("%w: QFI %d exceeds 6 bits", ErrInvalidValue, q)
+	}
+	return []byte{byte(q)}, nil
+}
+
+func (q *QFI) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 1)
+	*q = QFI(v & 0x3f)
+	return err
+}
+
+// ApplyAction tells what a FAR does with packets, as ApplyAction flags
+// (TS 29.244 8.2.26)
+type ApplyAction uint16
+
+func (ApplyAction) IEType() uint16 { return TypeApplyAction }
+
+func (a ApplyAction) MarshalValue() ([]byte, error) {
+	if a>>8 == 0 {
+		return []byte{byte(a)}, nil
+	}
+	return []byte{byte(a), byte(a >> 8)}, nil
+}
+
+func (a *ApplyAction) UnmarshalValue(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("%w: empty Apply Action", ErrInvalidLength)
+	}
+	*a = ApplyAction(b[0])
+	if len(b) > 1 {
+		*a |= ApplyAction(b[1]) << 8
+	}
+	return nil
+}
+
+// Has reports whether the flags are all set
+func (a ApplyAction) Has(flags ApplyAction) bool {
+	return a&flags == flags
+}
+
+// MeasurementMethod tells what a URR measures, as MeasurementMethod flags
+// (TS 29.244 8.2.40)
+type MeasurementMethod uint8
+
+func (MeasurementMethod) IEType() uint16 { return TypeMeasurementMethod }
+
+func (m MeasurementMethod) MarshalValue() ([]byte, error) { return []byte{byte(m)}, nil }
+
+func (m *MeasurementMethod) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 1)
+	*m = MeasurementMethod(v)
+	return err
+}
+
+// ReportingTriggers tells when a URR is reported, as ReportingTrigger flags
+// (TS 29.244 8.2.19)
+type ReportingTriggers uint32
+
+func (ReportingTriggers) IEType() uint16 { return TypeReportingTriggers }
+
+func (r ReportingTriggers) MarshalValue() ([]byte, error) { return marshalTriggers(uint32(r)), nil }
+
+func (r *ReportingTriggers) UnmarshalValue(b []byte) error {
+	v, err := unmarshalTriggers(b)
+	*r = ReportingTriggers(v)
+	return err
+}
+
+// UsageReportTrigger tells why a usage report was sent, as
+// UsageReportTrigger flags (TS 29.244 8.2.41)
+type UsageReportTrigger uint32
+
+func (UsageReportTrigger) IEType() uint16 { return TypeUsageReportTrigger }
+
+func (u UsageReportTrigger) MarshalValue() ([]byte, error) { return marshalTriggers(uint32(u)), nil }
+
+func (u *UsageReportTrigger) UnmarshalValue(b []byte) error {
+	v, err := unmarshalTriggers(b)
+	*u = UsageReportTrigger(v)
+	return err
+}
+
+// marshalTriggers encodes trigger flags in two octets, or three when the
+// third is used
+func marshalTriggers(v uint32) []byte {
+	b := []byte{byte(v), byte(v >> 8)}
+	if third := byte(v >> 16); third != 0 {
+		b = append(b, third)
+	}
+	return b
+}
+
+func unmarshalTriggers(b []byte) (uint32, error) {
+	if len(b) < 2 {
+		return 0, fmt.Errorf("%w: %d octets, expected at least 2", ErrInvalidLength, len(b))
+	}
+	v := uint32(b[0]) | uint32(b[1])<<8
+	if len(b) > 2 {
+		v |= uint32(b[2]) << 16
+	}
+	return v, nil
+}
+
+// MeasurementPeriod is the period of periodic usage reports, in seconds
+// (TS 29.244 8.2.41)
+type MeasurementPeriod uint32
+
+func (MeasurementPeriod) IEType() uint16 { return TypeMeasurementPeriod }
+
+func (p MeasurementPeriod) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(p), 4), nil }
+
+func (p *MeasurementPeriod) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*p = MeasurementPeriod(v)
+	return err
+}
+
+// TimeThreshold is the usage time after which a URR is reported, in
+// seconds (TS 29.244 8.2.14)
+type TimeThreshold uint32
+
+func (TimeThreshold) IEType() uint16 { return TypeTimeThreshold }
+
+func (t TimeThreshold) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(t), 4), nil }
+
+func (t *TimeThreshold) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*t = TimeThreshold(v)
+	return err
+}
+
+// TimeQuota is the usage time after which the traffic of a URR is stopped,
+// in seconds (TS 29.244 8.2.51)
+type TimeQuota uint32
+
+func (TimeQuota) IEType() uint16 { return TypeTimeQuota }
+
+func (t TimeQuota) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(t), 4), nil }
+
+func (t *TimeQuota) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*t = TimeQuota(v)
+	return err
+}
+
+// DurationMeasurement is the usage time a URR measured, in seconds
+// (TS 29.244 8.2.43)
+type DurationMeasurement uint32
+
+func (DurationMeasurement) IEType() uint16 { return TypeDurationMeasurement }
+
+func (d DurationMeasurement) MarshalValue() ([]byte, error) {
+	return appendUint(nil, uint64(d), 4), nil
+}
+
+func (d *DurationMeasurement) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*d = DurationMeasurement(v)
+	return err
+}
+
+// URSEQN is the sequence number of the usage reports of a URR, from 0
+// (TS 29.244 8.2.77)
+type URSEQN uint32
+
+func (URSEQN) IEType() uint16 { return TypeURSEQN }
+
+func (u URSEQN) MarshalValue() ([]byte, error) { return appendUint(nil, uint64(u), 4), nil }
+
+func (u *URSEQN) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 4)
+	*u = URSEQN(v)
+	return err
+}
+
+// Volume is the layout shared by the volume IEs of URRs: each of the
+// total, uplink and downlink volumes in octets is present when not nil
+type Volume struct {
+	Total    *uint64
+	Uplink   *uint64
+	Downlink *uint64
+}
+
+const (
+	volumeTotal    = 0x01 // TOVOL
+	volumeUplink   = 0x02 // ULVOL
+	volumeDownlink = 0x04 // DLVOL
+)
+
+func (v Volume) marshal() []byte {
+	b := []byte{0}
+	for _, field := range []struct {
+		flag  byte
+		value *uint64
+	}{{volumeTotal, v.Total}, {volumeUplink, v.Uplink}, {volumeDownlink, v.Downlink}} {
+		if field.value != nil {
+			b[0] |= field.flag
+			b = appendUint(b, *field.value, 8)
+		}
+	}
+	return b
+}
+
+func (v *Volume) unmarshal(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("%w: empty volume", ErrInvalidLength)
+	}
+	flags, b := b[0], b[1:]
+	*v = Volume{}
+	for _, field := range []struct {
+		flag  byte
+		value **uint64
+	}{{volumeTotal, &v.Total}, {volumeUplink, &v.Uplink}, {volumeDownlink, &v.Downlink}} {
+		if flags&field.flag == 0 {
+			continue
+		}
+		value, err := readUint(b, 8)
+		if err != nil {
+			return err
+		}
+		*field.value = &value
+		b = b[8:]
+	}
+	return nil
+}
+
+// VolumeThreshold is the traffic volume after which a URR is reported
+// (TS 29.244 8.2.13)
+type VolumeThreshold Volume
+
+func (VolumeThreshold) IEType() uint16 { return TypeVolumeThreshold }
+
+func (v VolumeThreshold) MarshalValue() ([]byte, error) { return Volume(v).marshal(), nil }
+
+func (v *VolumeThreshold) UnmarshalValue(b []byte) error { return (*Volume)(v).unmarshal(b) }
+
+// VolumeQuota is the traffic volume after which the traffic of a URR is
+// stopped (TS 29.244 8.2.50)
+type VolumeQuota Volume
+
+func (VolumeQuota) IEType() uint16 { return TypeVolumeQuota }
+
+func (v VolumeQuota) MarshalValue() ([]byte, error) { return Volume(v).marshal(), nil }
+
+func (v *VolumeQuota) UnmarshalValue(b []byte) error { return (*Volume)(v).unmarshal(b) }
+
+// VolumeMeasurement is the traffic volume a URR measured
+// (TS 29.244 8.2.44)
+type VolumeMeasurement Volume
+
+func (VolumeMeasurement) IEType() uint16 { return TypeVolumeMeasurement }
+
+func (v VolumeMeasurement) MarshalValue() ([]byte, error) { return Volume(v).marshal(), nil }
+
+func (v *VolumeMeasurement) UnmarshalValue(b []byte) error { return (*Volume)(v).unmarshal(b) }
+
+// GateStatus tells whether a QER lets the traffic through, with the
+// GateOpen and GateClosed values (TS 29.244 8.2.7)
+type GateStatus struct {
+	UL uint8
+	DL uint8
+}
+
+func (GateStatus) IEType() uint16 { return TypeGateStatus }
+
+func (g GateStatus) MarshalValue() ([]byte, error) {
+	if g.UL > 3 || g.DL > 3 {
+		return nil, fmt.Errorf("%w: gate status %d/%d", ErrInvalidValue, g.UL, g.DL)
+	}
+	return []byte{g.UL<<2 | g.DL}, nil
+}
+
+func (g *GateStatus) UnmarshalValue(b []byte) error {
+	v, err := readUint(b, 1)
+	g.UL, g.DL = uint8(v>>2)&0x03, uint8(v)&0x03
+	return err
+}
+
+// MBR is the maximum bit rate of a QER, in kbps (TS 29.244 8.2.8)
+type MBR struct {
+	UL uint64
+	DL uint64
+}
+
+func (MBR) IEType() uint16 { return TypeMBR }
+
+func (r MBR) MarshalValue() ([]byte, error) { return marshalBitRate(r.UL, r.DL) }
+
+func (r *MBR) UnmarshalValue(b []byte) error { return unmarshalBitRate(b, &r.UL, &r.DL) }
+
+// GBR is the guaranteed bit rate of a QER, in kbps (TS 29.244 8.2.9)
+type GBR struct {
+	UL uint64
+	DL uint64
+}
+
+func (GBR) IEType() uint16 { return TypeGBR }
+
+func (r GBR) MarshalValue() ([]byte, error) { return marshalBitRate(r.UL, r.DL) }
+
+func (r *GBR) UnmarshalValue(b []byte) error { return unmarshalBitRate(b, &r.UL, &r.DL) }
+
+const maxBitRate = 1<<40 - 1 // 5 octets
+
+func marshalBitRate(ul, dl uint64) ([]byte, error) {
+	if ul > maxBitRate || dl > maxBitRate {
+		return nil, fmt.Errorf("%w: bit rate exceeds 5 octets", ErrInvalidValue)
+	}
+	return appendUint(appendUint(nil, ul, 5), dl, 5), nil
+}
+
+func unmarshalBitRate(b []byte, ul, dl *uint64) error {
+	if len(b) < 10 {
+		return fmt.Errorf("%w: %d octets, expected 10", ErrInvalidLength, len(b))
+	}
+	*ul, _ = readUint(b, 5)
+	*dl, _ = readUint(b[5:], 5)
+	return nil
+}
+
+// ApplicationID identifies an application detected by a PDR
+// (TS 29.244 8.2.6)
+type ApplicationID string
+
+func (ApplicationID) IEType() uint16 { return TypeApplicationID }
+
+func (a ApplicationID) MarshalValue() ([]byte, error) { return []byte(a), nil }
+
+func (a *ApplicationID) UnmarshalValue(b []byte) error {
+	*a = ApplicationID(b)
+	return nil
+}
+
+// NetworkInstance identifies the network, e.g. the DNN, a PDR or FAR
+// applies to (TS 29.244 8.2.4). It is encoded as is, and decoded from DNS
+// labels when the peer encoded it as a DNN.
+type NetworkInstance string
+
+func (NetworkInstance) IEType() uint16 { return TypeNetworkInstance }
+
+func (n NetworkInstance) MarshalValue() ([]byte, error) { return []byte(n), nil }
+
+func (n *NetworkInstance) UnmarshalValue(b []byte) error {
+	if name, ok := decodeLabels(b); ok {
+		*n = NetworkInstance(name)
+	} else {
+		*n = NetworkInstance(b)
+	}
+	return nil
+}
+
+// encodeLabels encodes a domain name as DNS labels (RFC 1035 3.1), without
+// the terminating empty label, as FQDNs are in TS 23.003
+func encodeLabels(name string) ([]byte, error) {
+	if name == "" || len(name) > 255 {
+		return nil, fmt.Errorf("%w: invalid FQDN %q", ErrInvalidValue, name)
+	}
+	var b []byte
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("%w: invalid FQDN %q", ErrInvalidValue, name)
+		}
+		b = append(append(b, byte(len(label))), label...)
+	}
+	return b, nil
+}
+
+// decodeLabels decodes DNS labels, and reports whether b held labels
+func decodeLabels(b []byte) (string, bool) {
+	var labels []string
+	for len(b) > 0 {
+		length := int(b[0])
+		if length == 0 && len(b) == 1 {
+			break // Terminating empty label
+		}
+		if length == 0 || length > 63 || len(b) < 1+length {
+			return "", false
+		}
+		labels = append(labels, string(b[1:1+length]))
+		b = b[1+length:]
+	}
+	return strings.Join(labels, "."), len(labels) > 0
+}
+
+// ntpEpochOffset is the number of seconds from 1900, the NTP epoch, to
+// 1970
+const ntpEpochOffset = 2208988800
+
+// RecoveryTimeStamp is the time a PFCP entity started (TS 29.244 8.2.65),
+// with a precision of a second
+type RecoveryTimeStamp struct {
+	Time time.Time
+}
+
+func (RecoveryTimeStamp) IEType() uint16 { return TypeRecoveryTimeStamp }
+
+func (r RecoveryTimeStamp) MarshalValue() ([]byte, error) { return marshalTime(r.Time), nil }
+
+func (r *RecoveryTimeStamp) UnmarshalValue(b []byte) (err error) {
+	r.Time, err = unmarshalTime(b)
+	return err
+}
+
+// StartTime is the time a usage report starts at (TS 29.244 8.2.45)
+type StartTime struct {
+	Time time.Time
+}
+
+func (StartTime) IEType() uint16 { return TypeStartTime }
+
+func (t StartTime) MarshalValue() ([]byte, error) { return marshalTime(t.Time), nil }
+
+func (t *StartTime) UnmarshalValue(b []byte) (err error) {
+	t.Time, err = unmarshalTime(b)
+	return err
+}
+
+// EndTime is the time a usage report ends at (TS 29.244 8.2.46)
+type EndTime struct {
+	Time time.Time
+}
+
+func (EndTime) IEType() uint16 { return TypeEndTime }
+
+func (t EndTime) MarshalValue() ([]byte, error) { return marshalTime(t.Time), nil }
+
+func (t *EndTime) UnmarshalValue(b []byte) (err error) {
+	t.Time, err = unmarshalTime(b)
+	return err
+}
+
+// marshalTime encodes a time as the seconds of an NTP timestamp
+func marshalTime(t time.Time) []byte {
+	// Wraps around in 2036, when the NTP era changes (RFC 5905)
+	return appendUint(nil, uint64(t.Unix()+ntpEpochOffset), 4)
+}
+
+func unmarshalTime(b []byte) (time.Time, error) {
+	v, err := readUint(b, 4)
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds := int64(v) - ntpEpochOffset
+	if v < 1<<31 {
+		// The most significant bit is clear from 2036 (RFC 4330 3)
+		seconds += 1 << 32
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
@@ -1,77 +1,322 @@
 package pfcp
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+
+	"github.com/danipopa/mob5g/upf/upf-n4/internal/pfcp/ie"
+)
+
+// PFCP header layout (TS 29.244 7.2.2)
+const (
+	PFCPVersion = 1
+
+	// Mandatory part of the header: flags, message type and length, which
+	// does not count it
+	headerPrefixLength = 4
+	// Header of node related messages: the prefix, a 3 octet sequence
+	// number and a spare octet
+	NodeHeaderLength = 8
+	// Header of session related messages, which carry the SEID before the
+	// sequence number and the message priority in the last octet
+	SessionHeaderLength = 16
+
+	MaxSequenceNumber   = 1<<24 - 1
+	MaxMessagePriority  = 15
+	flagSEID            = 0x01 // S
+	flagMessagePriority = 0x02 // MP
+	flagFollowOn        = 0x04 // FO
+)
+
+// Errors of malformed or truncated messages, wrapped in a *HeaderError
+var (
+	ErrHeaderTruncated     = errors.New("PFCP header truncated")
+	ErrUnsupportedVersion  = errors.New("unsupported PFCP version")
+	ErrInvalidLength       = errors.New("invalid PFCP message length")
+	ErrMessageTruncated    = errors.New("PFCP message truncated")
+	ErrTrailingData        = errors.New("data after PFCP message")
+	ErrUnexpectedSEID      = errors.New("SEID flag does not match message type")
+	ErrInvalidHeaderFields = errors.New("invalid PFCP header fields")
 )
 
+// HeaderError is returned for a message whose header cannot be decoded or
+// encoded. Err is one of the errors above.
+type HeaderError struct {
+	Err    error
+	Detail string
+}
+
+func (e *HeaderError) Error() string {
+	if e.Detail == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Err, e.Detail)
+}
+
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
+
+func headerError(err error, format string, args ...interface{}) *HeaderError {
+	return &HeaderError{Err: err, Detail: fmt.Sprintf(format, args...)}
+}
+
 // PFCPMessage represents a PFCP message.
 type PFCPMessage struct {
-	Version       uint8
-	MessageType   uint8
-	SequenceNumber uint32
+	Version     uint8
+	MessageType uint8
+	// HasSEID is the S flag, set for session related messages
+	HasSEID bool
+	SEID    uint64
+	// HasPriority is the MP flag. Only session related messages carry a
+	// priority, from 0 (highest) to 15.
+	HasPriority     bool
+	MessagePriority uint8
+	// FollowOn is the FO flag, set when another message follows in the
+	// same datagram
+	FollowOn       bool
+	SequenceNumber uint32 // 24 bits
+	// MessageLength counts the octets after the mandatory first 4 of the
+	// header. It is computed by SerializePFCPMessage.
 	MessageLength uint16
 	Payload       []byte
 }
 
+// IsSessionMessage reports whether a message type is session related, and
+// so has an SEID in its header (TS 29.244 7.2.2.1)
+func IsSessionMessage(messageType uint8) bool {
+	return messageType >= PFCPSessionEstablishmentRequest
+}
+
+// HeaderLength returns the length of the header of the message
+func (msg *PFCPMessage) HeaderLength() int {
+	if msg.HasSEID {
+		return SessionHeaderLength
+	}
+	return NodeHeaderLength
+}
+
 // SerializePFCPMessage serializes a PFCP message into a byte slice.
+// The version defaults to 1, and MessageLength is set from the payload.
 func SerializePFCPMessage(msg *PFCPMessage) ([]byte, error) {
-	buf := new(bytes.Buffer)
+	if msg.Version == 0 {
+		msg.Version = PFCPVersion
+	}
+	switch {
+	case msg.Version != PFCPVersion:
+		return nil, headerError(ErrUnsupportedVersion, "version %d", msg.Version)
+	case msg.SequenceNumber > MaxSequenceNumber:
+		return nil, headerError(ErrInvalidHeaderFields, "sequence number %d exceeds 24 bits", msg.SequenceNumber)
+	case msg.HasPriority && !msg.HasSEID:
+		return nil, headerError(ErrInvalidHeaderFields, "message priority without SEID")
+	case msg.MessagePriority > MaxMessagePriority:
+		return nil, headerError(ErrInvalidHeaderFields, "message priority %d exceeds 4 bits", msg.MessagePriority)
+	case msg.HasSEID != IsSessionMessage(msg.MessageType):
+		return nil, headerError(ErrUnexpectedSEID, "message type %d", msg.MessageType)
+	}
 
-	// Serialize header
-	buf.WriteByte(msg.Version)
-	buf.WriteByte(msg.MessageType)
-	binary.Write(buf, binary.BigEndian, msg.SequenceNumber)
-	binary.Write(buf, binary.BigEndian, msg.MessageLength)
+	headerLength := msg.HeaderLength()
+	length := headerLength - headerPrefixLength + len(msg.Payload)
+	if length > 0xffff {
+		return nil, headerError(ErrInvalidLength, "payload of %d octets", len(msg.Payload))
+	}
+	msg.MessageLength = uint16(length)
 
-	// Serialize payload
-	if len(msg.Payload) > 0 {
-		buf.Write(msg.Payload)
+	data := make([]byte, headerLength+len(msg.Payload))
+	data[0] = msg.Version << 5
+	if msg.FollowOn {
+		data[0] |= flagFollowOn
 	}
+	if msg.HasPriority {
+		data[0] |= flagMessagePriority
+	}
+	if msg.HasSEID {
+		data[0] |= flagSEID
+	}
+	data[1] = msg.MessageType
+	binary.BigEndian.PutUint16(data[2:4], msg.MessageLength)
 
-	return buf.Bytes(), nil
+	seq := data[4:]
+	if msg.HasSEID {
+		binary.BigEndian.PutUint64(data[4:12], msg.SEID)
+		seq = data[12:]
+	}
+	seq[0] = byte(msg.SequenceNumber >> 16)
+	seq[1] = byte(msg.SequenceNumber >> 8)
+	seq[2] = byte(msg.SequenceNumber)
+	if msg.HasPriority {
+		seq[3] = msg.MessagePriority << 4
+	}
+
+	copy(data[headerLength:], msg.Payload)
+	return data, nil
 }
 
 // DeserializePFCPMessage deserializes a byte slice into a PFCPMessage.
+// The data must hold exactly one message, or messages chained with the FO
+// flag of which the first is returned.
 func DeserializePFCPMessage(data []byte) (*PFCPMessage, error) {
-	if len(data) < 8 {
-		return nil, errors.New("data too short for PFCP message")
+	msg, rest, err := decodePFCPMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 && !msg.FollowOn {
+		return nil, headerError(ErrTrailingData, "%d octets", len(rest))
 	}
+	return msg, nil
+}
 
-	buf := bytes.NewReader(data)
-	msg := &PFCPMessage{}
+// DeserializePFCPMessages deserializes all the messages of a datagram,
+// chained with the FO flag
+func DeserializePFCPMessages(data []byte) ([]*PFCPMessage, error) {
+	var msgs []*PFCPMessage
+	for {
+		msg, rest, err := decodePFCPMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+		if !msg.FollowOn {
+			if len(rest) > 0 {
+				return nil, headerError(ErrTrailingData, "%d octets", len(rest))
+			}
+			return msgs, nil
+		}
+		data = rest
+	}
+}
 
-	// Read header
-	binary.Read(buf, binary.BigEndian, &msg.Version)
-	binary.Read(buf, binary.BigEndian, &msg.MessageType)
-	binary.Read(buf, binary.BigEndian, &msg.SequenceNumber)
-	binary.Read(buf, binary.BigEndian, &msg.MessageLength)
+// decodePFCPMessage decodes the message at the start of data and returns
+// the data after it
+func decodePFCPMessage(data []byte) (*PFCPMessage, []byte, error) {
+	if len(data) < headerPrefixLength {
+		return nil, nil, headerError(ErrHeaderTruncated, "%d octets", len(data))
+	}
+	msg := &PFCPMessage{
+		Version:       data[0] >> 5,
+		FollowOn:      data[0]&flagFollowOn != 0,
+		HasPriority:   data[0]&flagMessagePriority != 0,
+		HasSEID:       data[0]&flagSEID != 0,
+		MessageType:   data[1],
+		MessageLength: binary.BigEndian.Uint16(data[2:4]),
+	}
+	if msg.Version != PFCPVersion {
+		return nil, nil, headerError(ErrUnsupportedVersion, "version %d", msg.Version)
+	}
 
-	// Read payload
-	msg.Payload = make([]byte, buf.Len())
-	buf.Read(msg.Payload)
+	headerLength := msg.HeaderLength()
+	if len(data) < headerLength {
+		return nil, nil, headerError(ErrHeaderTruncated, "%d octets, expected %d", len(data), headerLength)
+	}
+	if int(msg.MessageLength) < headerLength-headerPrefixLength {
+		return nil, nil, headerError(ErrInvalidLength, "length %d shorter than the header", msg.MessageLength)
+	}
+	end := headerPrefixLength + int(msg.MessageLength)
+	if len(data) < end {
+		return nil, nil, headerError(ErrMessageTruncated, "length %d, %d octets received", msg.MessageLength, len(data)-headerPrefixLength)
+	}
+	if msg.HasSEID != IsSessionMessage(msg.MessageType) {
+		return nil, nil, headerError(ErrUnexpectedSEID, "message type %d", msg.MessageType)
+	}
+	if msg.HasPriority && !msg.HasSEID {
+		return nil, nil, headerError(ErrInvalidHeaderFields, "message priority without SEID")
+	}
 
-	return msg, nil
+	seq := data[4:]
+	if msg.HasSEID {
+		msg.SEID = binary.BigEndian.Uint64(data[4:12])
+		seq = data[12:]
+	}
+	msg.SequenceNumber = uint32(seq[0])<<16 | uint32(seq[1])<<8 | uint32(seq[2])
+	if msg.HasPriority {
+		msg.MessagePriority = seq[3] >> 4
+	}
+
+	msg.Payload = append([]byte(nil), data[headerLength:end]...)
+	return msg, data[end:], nil
 }
 
+// newPayload encodes the IEs of a message
+func newPayload(values ...ie.Value) ([]byte, error) {
+	ies := make([]*ie.IE, 0, len(values))
+	for _, v := range values {
+		encoded, err := ie.New(v)
+		if err != nil {
+			return nil, err
+		}
+		ies = append(ies, encoded)
+	}
+	return ie.Marshal(ies...)
+}
 
-func CreateAssociationSetupResponse(sequenceNumber uint32) *PFCPMessage {
+// CreateAssociationSetupResponse answers an Association Setup Request with
+// the Node ID and recovery time of the UPF (TS 29.244 7.4.4.2)
+func CreateAssociationSetupResponse(sequenceNumber uint32, cause ie.Cause) (*PFCPMessage, error) {
+	payload, err := newPayload(LocalNodeID, cause, recoveryTimeStamp)
+	if err != nil {
+		return nil, err
+	}
 	return &PFCPMessage{
-		Version:       1,
-		MessageType:   PFCPAssociationSetupResponse,
+		Version:        PFCPVersion,
+		MessageType:    PFCPAssociationSetupResponse,
 		SequenceNumber: sequenceNumber,
-		MessageLength: uint16(8), // Example length
-		Payload:       []byte{0x01, 0x02}, // Dummy payload
-	}
+		Payload:        payload,
+	}, nil
 }
 
-func CreateHeartbeatResponse(sequenceNumber uint32) *PFCPMessage {
+// CreateHeartbeatResponse answers a Heartbeat Request with the recovery
+// time of the UPF (TS 29.244 7.4.2.2)
+func CreateHeartbeatResponse(sequenceNumber uint32) (*PFCPMessage, error) {
+	payload, err := newPayload(recoveryTimeStamp)
+	if err != nil {
+		return nil, err
+	}
 	return &PFCPMessage{
-		Version:       1,
-		MessageType:   PFCPHeartbeatResponse,
+		Version:        PFCPVersion,
+		MessageType:    PFCPHeartbeatResponse,
 		SequenceNumber: sequenceNumber,
-		MessageLength: uint16(8),
-		Payload:       []byte{},
+		Payload:        payload,
+	}, nil
+}
+
+// newSessionResponse creates a response of a session related message to
+// the peer with an SEID
+func newSessionResponse(messageType uint8, sequenceNumber uint32, seid uint64, values ...ie.Value) (*PFCPMessage, error) {
+	payload, err := newPayload(values...)
+	if err != nil {
+		return nil, err
 	}
+	return &PFCPMessage{
+		Version:        PFCPVersion,
+		MessageType:    messageType,
+		HasSEID:        true,
+		SEID:           seid,
+		SequenceNumber: sequenceNumber,
+		Payload:        payload,
+	}, nil
+}
+
+// CreateSessionEstablishmentResponse answers a Session Establishment
+// Request, to the CP function with an SEID (TS 29.244 7.5.3). The values
+// are the conditional IEs after the cause, in order.
+func CreateSessionEstablishmentResponse(sequenceNumber uint32, seid uint64, cause ie.Cause, values ...ie.Value) (*PFCPMessage, error) {
+	return newSessionResponse(PFCPSessionEstablishmentResponse, sequenceNumber, seid,
+		append([]ie.Value{LocalNodeID, cause}, values...)...)
+}
+
+// CreateSessionModificationResponse answers a Session Modification
+// Request, to the CP function with an SEID (TS 29.244 7.5.5). The values
+// are the conditional IEs after the cause, in order.
+func CreateSessionModificationResponse(sequenceNumber uint32, seid uint64, cause ie.Cause, values ...ie.Value) (*PFCPMessage, error) {
+	return newSessionResponse(PFCPSessionModificationResponse, sequenceNumber, seid,
+		append([]ie.Value{cause}, values...)...)
+}
+
+// CreateSessionDeletionResponse answers a Session Deletion Request, to the
+// CP function with an SEID (TS 29.244 7.5.7). The values are the
+// conditional IEs after the cause, in order.
+func CreateSessionDeletionResponse(sequenceNumber uint32, seid uint64, cause ie.Cause, values ...ie.Value) (*PFCPMessage, error) {
+	return newSessionResponse(PFCPSessionDeletionResponse, sequenceNumber, seid,
+		append([]ie.Value{cause}, values...)...)
 }
@@ -0,0 +1,190 @@
+package pfcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSerializeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    PFCPMessage
+		header []byte // Expected header
+	}{
+		{
+			name:   "node message",
+			msg:    PFCPMessage{MessageType: PFCPHeartbeatRequest, SequenceNumber: 0x010203, Payload: []byte{0, 96, 0, 4, 1, 2, 3, 4}},
+			header: []byte{0x20, 1, 0, 12, 1, 2, 3, 0},
+		},
+		{
+			name:   "node message without payload",
+			msg:    PFCPMessage{MessageType: PFCPAssociationReleaseRequest, SequenceNumber: 1},
+			header: []byte{0x20, 9, 0, 4, 0, 0, 1, 0},
+		},
+		{
+			name:   "largest sequence number",
+			msg:    PFCPMessage{MessageType: PFCPHeartbeatResponse, SequenceNumber: 0xFFFFFF},
+			header: []byte{0x20, 2, 0, 4, 0xff, 0xff, 0xff, 0},
+		},
+		{
+			name:   "session message",
+			msg:    PFCPMessage{MessageType: PFCPSessionDeletionRequest, HasSEID: true, SEID: 0x0102030405060708, SequenceNumber: 42, Payload: []byte{1, 2}},
+			header: []byte{0x21, 54, 0, 14, 1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 42, 0},
+		},
+		{
+			name:   "session message with priority",
+			msg:    PFCPMessage{MessageType: PFCPSessionModificationRequest, HasSEID: true, SEID: 1, HasPriority: true, MessagePriority: 15, SequenceNumber: 0xFFFFFF},
+			header: []byte{0x23, 52, 0, 12, 0, 0, 0, 0, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xf0},
+		},
+		{
+			name:   "follow on",
+			msg:    PFCPMessage{MessageType: PFCPHeartbeatRequest, FollowOn: true, SequenceNumber: 7},
+			header: []byte{0x24, 1, 0, 4, 0, 0, 7, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := tt.msg
+			data, err := SerializePFCPMessage(&msg)
+			if err != nil {
+				t.Fatalf("SerializePFCPMessage: %v", err)
+			}
+			if header := data[:msg.HeaderLength()]; !bytes.Equal(header, tt.header) {
+				t.Errorf("header % x, expected % x", header, tt.header)
+			}
+			if !bytes.Equal(data[msg.HeaderLength():], tt.msg.Payload) {
+				t.Errorf("payload % x, expected % x", data[msg.HeaderLength():], tt.msg.Payload)
+			}
+			if want := len(data) - headerPrefixLength; int(msg.MessageLength) != want || int(binary.BigEndian.Uint16(data[2:4])) != want {
+				t.Errorf("length %d (encoded %d), expected %d", msg.MessageLength, binary.BigEndian.Uint16(data[2:4]), want)
+			}
+			if msg.Version != PFCPVersion {
+				t.Errorf("version %d, expected %d", msg.Version, PFCPVersion)
+			}
+
+			if msg.FollowOn {
+				// A chained message cannot be last in a datagram
+				return
+			}
+			decoded, err := DeserializePFCPMessage(data)
+			if err != nil {
+				t.Fatalf("DeserializePFCPMessage: %v", err)
+			}
+			if decoded.Payload == nil {
+				decoded.Payload = msg.Payload
+			}
+			if !reflect.DeepEqual(*decoded, msg) {
+				t.Errorf("decoded %+v, expected %+v", *decoded, msg)
+			}
+		})
+	}
+}
+
+func TestDeserializeFollowOn(t *testing.T) {
+	first := PFCPMessage{MessageType: PFCPHeartbeatRequest, FollowOn: true, SequenceNumber: 1, Payload: []byte{0, 96, 0, 4, 1, 2, 3, 4}}
+	second := PFCPMessage{MessageType: PFCPSessionDeletionRequest, HasSEID: true, SEID: 9, FollowOn: true, SequenceNumber: 2}
+	last := PFCPMessage{MessageType: PFCPHeartbeatResponse, SequenceNumber: 3, Payload: []byte{}}
+	var datagram []byte
+	for _, msg := range []*PFCPMessage{&first, &second, &last} {
+		data, err := SerializePFCPMessage(msg)
+		if err != nil {
+			t.Fatalf("SerializePFCPMessage: %v", err)
+		}
+		datagram = append(datagram, data...)
+	}
+
+	msgs, err := DeserializePFCPMessages(datagram)
+	if err != nil {
+		t.Fatalf("DeserializePFCPMessages: %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("%d messages decoded, expected 3", len(msgs))
+	}
+	for i, want := range []PFCPMessage{first, second, last} {
+		got := *msgs[i]
+		if got.Payload == nil {
+			got.Payload = []byte{}
+		}
+		if want.Payload == nil {
+			want.Payload = []byte{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("message %d: %+v, expected %+v", i, got, want)
+		}
+	}
+
+	msg, err := DeserializePFCPMessage(datagram)
+	if err != nil {
+		t.Fatalf("DeserializePFCPMessage of a chain: %v", err)
+	}
+	if msg.SequenceNumber != 1 {
+		t.Errorf("first message of the chain has sequence number %d, expected 1", msg.SequenceNumber)
+	}
+
+	// The chain ends with a message flagged FO
+	if _, err := DeserializePFCPMessages(datagram[:len(datagram)-8]); !errors.Is(err, ErrHeaderTruncated) {
+		t.Errorf("chain without its last message: %v, expected %v", err, ErrHeaderTruncated)
+	}
+}
+
+func TestDeserializeErrors(t *testing.T) {
+	heartbeat := []byte{0x20, 1, 0, 4, 0, 0, 1, 0}
+	session := []byte{0x21, 54, 0, 12, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 0}
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrHeaderTruncated},
+		{"shorter than the mandatory header", heartbeat[:3], ErrHeaderTruncated},
+		{"node header truncated", heartbeat[:6], ErrHeaderTruncated},
+		{"session header truncated", session[:12], ErrHeaderTruncated},
+		{"length shorter than the header", []byte{0x20, 1, 0, 3, 0, 0, 1, 0}, ErrInvalidLength},
+		{"session length shorter than the header", []byte{0x21, 54, 0, 8, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 0}, ErrInvalidLength},
+		{"payload truncated", []byte{0x20, 1, 0, 8, 0, 0, 1, 0, 0, 96}, ErrMessageTruncated},
+		{"trailing data", append(append([]byte(nil), heartbeat...), 0), ErrTrailingData},
+		{"node message with SEID", []byte{0x21, 1, 0, 12, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 0}, ErrUnexpectedSEID},
+		{"session message without SEID", []byte{0x20, 54, 0, 4, 0, 0, 1, 0}, ErrUnexpectedSEID},
+		{"unsupported version", []byte{0x40, 1, 0, 4, 0, 0, 1, 0}, ErrUnsupportedVersion},
+		{"priority without SEID", []byte{0x22, 1, 0, 4, 0, 0, 1, 0}, ErrInvalidHeaderFields},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DeserializePFCPMessage(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, expected %v", err, tt.err)
+			}
+			var headerErr *HeaderError
+			if !errors.As(err, &headerErr) {
+				t.Errorf("error %T is not a *HeaderError", err)
+			}
+		})
+	}
+}
+
+func TestSerializeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  PFCPMessage
+		err  error
+	}{
+		{"sequence number over 24 bits", PFCPMessage{MessageType: PFCPHeartbeatRequest, SequenceNumber: 1 << 24}, ErrInvalidHeaderFields},
+		{"priority without SEID", PFCPMessage{MessageType: PFCPHeartbeatRequest, HasPriority: true}, ErrInvalidHeaderFields},
+		{"priority over 4 bits", PFCPMessage{MessageType: PFCPSessionDeletionRequest, HasSEID: true, HasPriority: true, MessagePriority: 16}, ErrInvalidHeaderFields},
+		{"node message with SEID", PFCPMessage{MessageType: PFCPHeartbeatRequest, HasSEID: true}, ErrUnexpectedSEID},
+		{"session message without SEID", PFCPMessage{MessageType: PFCPSessionDeletionRequest}, ErrUnexpectedSEID},
+		{"unsupported version", PFCPMessage{Version: 2, MessageType: PFCPHeartbeatRequest}, ErrUnsupportedVersion},
+		{"payload too long", PFCPMessage{MessageType: PFCPHeartbeatRequest, Payload: make([]byte, 0xffff)}, ErrInvalidLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := tt.msg
+			if _, err := SerializePFCPMessage(&msg); !errors.Is(err, tt.err) {
+				t.Errorf("error %v, expected %v", err, tt.err)
+			}
+		})
+	}
+}
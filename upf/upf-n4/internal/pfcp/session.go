@@ -0,0 +1,641 @@
+package pfcp
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danipopa/mob5g/upf/upf-n4/internal/pfcp/ie"
+)
+
+var (
+	// N4Address is the address of the UPF in the F-SEIDs it allocates, of
+	// either family. It must be set before serving.
+	N4Address net.IP
+	// N3Address and N3AddressIPv6 are the addresses of the GTP-U tunnel
+	// endpoints the UPF allocates. Requests for an F-TEID of a family
+	// without an address are rejected.
+	N3Address     net.IP
+	N3AddressIPv6 net.IP
+
+	// sessions holds the PFCP sessions of the UPF
+	sessions = NewSessionTable()
+)
+
+// Session is a PFCP session: the rules a CP function installed for a PDU
+// session (TS 29.244 5.2). A session in the table is never changed, so
+// that it can be read without locking; changes replace it with a copy.
+type Session struct {
+	LocalSEID uint64
+	CPFSEID   ie.FSEID
+	CPNodeID  string
+
+	PDRs map[ie.PDRID]*ie.CreatePDR
+	FARs map[ie.FARID]*ie.CreateFAR
+	URRs map[ie.URRID]*URR
+	QERs map[ie.QERID]*ie.CreateQER
+}
+
+// URR is a usage reporting rule and the measurement it started
+type URR struct {
+	ie.CreateURR
+	StartTime time.Time
+	// Usage is shared by the copies of the URR as the session changes
+	Usage *Usage
+}
+
+// Usage is the traffic a URR measured, counted by the data path
+type Usage struct {
+	UplinkVolume   atomic.Uint64
+	DownlinkVolume atomic.Uint64
+	// reports is the number of usage reports sent, the next UR-SEQN
+	reports atomic.Uint32
+}
+
+// report returns the usage the URR measured up to now
+func (u *URR) report(trigger ie.UsageReportTrigger, now time.Time) ie.UsageReport {
+	report := ie.UsageReport{
+		URRID:     u.URRID,
+		URSEQN:    ie.URSEQN(u.Usage.reports.Add(1) - 1),
+		Trigger:   trigger,
+		StartTime: &ie.StartTime{Time: u.StartTime},
+		EndTime:   &ie.EndTime{Time: now},
+	}
+	if u.MeasurementMethod&ie.MeasurementMethodVOLUM != 0 {
+		uplink, downlink := u.Usage.UplinkVolume.Load(), u.Usage.DownlinkVolume.Load()
+		total := uplink + downlink
+		report.VolumeMeasurement = &ie.VolumeMeasurement{Total: &total, Uplink: &uplink, Downlink: &downlink}
+	}
+	if u.MeasurementMethod&ie.MeasurementMethodDURAT != 0 {
+		duration := ie.DurationMeasurement(now.Sub(u.StartTime) / time.Second)
+		report.DurationMeasurement = &duration
+	}
+	return report
+}
+
+// ruleSet holds the rules to create in a session
+type ruleSet struct {
+	PDRs []ie.CreatePDR
+	FARs []ie.CreateFAR
+	URRs []ie.CreateURR
+	QERs []ie.CreateQER
+}
+
+// ruleChanges holds the rules to remove, create and update in a session,
+// applied in that order
+type ruleChanges struct {
+	RemovePDRs []ie.RemovePDR
+	RemoveFARs []ie.RemoveFAR
+	RemoveURRs []ie.RemoveURR
+	RemoveQERs []ie.RemoveQER
+	Create     ruleSet
+	UpdatePDRs []ie.UpdatePDR
+	UpdateFARs []ie.UpdateFAR
+	UpdateURRs []ie.UpdateURR
+	UpdateQERs []ie.UpdateQER
+}
+
+func newSession(cpNodeID string, cpFSEID ie.FSEID) *Session {
+	return &Session{
+		CPFSEID:  cpFSEID,
+		CPNodeID: cpNodeID,
+		PDRs:     make(map[ie.PDRID]*ie.CreatePDR),
+		FARs:     make(map[ie.FARID]*ie.CreateFAR),
+		URRs:     make(map[ie.URRID]*URR),
+		QERs:     make(map[ie.QERID]*ie.CreateQER),
+	}
+}
+
+// rejection is the error of a session request the UPF rejects, with the IE
+// or the rule at fault when known (TS 29.244 7.5.3.1)
+type rejection struct {
+	Cause        ie.Cause
+	OffendingIE  *ie.OffendingIE
+	FailedRuleID *ie.FailedRuleID
+	Reason       string
+}
+
+func (r *rejection) Error() string {
+	return fmt.Sprintf("%s (cause %d)", r.Reason, r.Cause)
+}
+
+// values returns the IEs that tell the CP function what was at fault
+func (r *rejection) values() []ie.Value {
+	var values []ie.Value
+	if r.OffendingIE != nil {
+		values = append(values, *r.OffendingIE)
+	}
+	if r.FailedRuleID != nil {
+		values = append(values, *r.FailedRuleID)
+	}
+	return values
+}
+
+func reject(cause ie.Cause, format string, args ...interface{}) *rejection {
+	return &rejection{Cause: cause, Reason: fmt.Sprintf(format, args...)}
+}
+
+// rejectIE rejects a request for one of its IEs
+func rejectIE(cause ie.Cause, ieType uint16, format string, args ...interface{}) *rejection {
+	offending := ie.OffendingIE(ieType)
+	return &rejection{Cause: cause, OffendingIE: &offending, Reason: fmt.Sprintf(format, args...)}
+}
+
+// rejectRule rejects a request for a rule that cannot be created or changed
+func rejectRule(ruleType uint8, ruleID uint32, format string, args ...interface{}) *rejection {
+	return &rejection{
+		Cause:        ie.CauseRuleCreationModificationFailure,
+		FailedRuleID: &ie.FailedRuleID{RuleType: ruleType, RuleID: ruleID},
+		Reason:       fmt.Sprintf(format, args...),
+	}
+}
+
+// rejectDecoding rejects a request whose IEs cannot be decoded
+func rejectDecoding(err error) *rejection {
+	r := &rejection{Cause: causeOf(err), Reason: err.Error()}
+	var ieErr *ie.Error
+	if errors.As(err, &ieErr) {
+		offending := ie.OffendingIE(ieErr.Type)
+		r.OffendingIE = &offending
+	}
+	return r
+}
+
+// create adds rules to the session, which must not already have their IDs
+func (s *Session) create(rules ruleSet, now time.Time) *rejection {
+	for _, pdr := range rules.PDRs {
+		if _, ok := s.PDRs[pdr.PDRID]; ok {
+			return rejectRule(ie.RuleTypePDR, uint32(pdr.PDRID), "PDR %d already exists", pdr.PDRID)
+		}
+		s.PDRs[pdr.PDRID] = &pdr
+	}
+	for _, far := range rules.FARs {
+		if _, ok := s.FARs[far.FARID]; ok {
+			return rejectRule(ie.RuleTypeFAR, uint32(far.FARID), "FAR %d already exists", far.FARID)
+		}
+		s.FARs[far.FARID] = &far
+	}
+	for _, urr := range rules.URRs {
+		if _, ok := s.URRs[urr.URRID]; ok {
+			return rejectRule(ie.RuleTypeURR, uint32(urr.URRID), "URR %d already exists", urr.URRID)
+		}
+		s.URRs[urr.URRID] = &URR{CreateURR: urr, StartTime: now, Usage: &Usage{}}
+	}
+	for _, qer := range rules.QERs {
+		if _, ok := s.QERs[qer.QERID]; ok {
+			return rejectRule(ie.RuleTypeQER, uint32(qer.QERID), "QER %d already exists", qer.QERID)
+		}
+		s.QERs[qer.QERID] = &qer
+	}
+	return nil
+}
+
+// clone returns a copy of the session to change. The rules are shared, and
+// are copied before they are changed.
+func (s *Session) clone() *Session {
+	c := *s
+	c.PDRs = maps.Clone(s.PDRs)
+	c.FARs = maps.Clone(s.FARs)
+	c.URRs = maps.Clone(s.URRs)
+	c.QERs = maps.Clone(s.QERs)
+	return &c
+}
+
+// remove removes rules from the session, and returns the URRs removed
+func (s *Session) remove(changes *ruleChanges) ([]*URR, *rejection) {
+	for _, remove := range changes.RemovePDRs {
+		if s.PDRs[remove.PDRID] == nil {
+			return nil, rejectRule(ie.RuleTypePDR, uint32(remove.PDRID), "PDR %d does not exist", remove.PDRID)
+		}
+		delete(s.PDRs, remove.PDRID)
+	}
+	for _, remove := range changes.RemoveFARs {
+		if s.FARs[remove.FARID] == nil {
+			return nil, rejectRule(ie.RuleTypeFAR, uint32(remove.FARID), "FAR %d does not exist", remove.FARID)
+		}
+		delete(s.FARs, remove.FARID)
+	}
+	var removed []*URR
+	for _, remove := range changes.RemoveURRs {
+		urr := s.URRs[remove.URRID]
+		if urr == nil {
+			return nil, rejectRule(ie.RuleTypeURR, uint32(remove.URRID), "URR %d does not exist", remove.URRID)
+		}
+		delete(s.URRs, remove.URRID)
+		removed = append(removed, urr)
+	}
+	for _, remove := range changes.RemoveQERs {
+		if s.QERs[remove.QERID] == nil {
+			return nil, rejectRule(ie.RuleTypeQER, uint32(remove.QERID), "QER %d does not exist", remove.QERID)
+		}
+		delete(s.QERs, remove.QERID)
+	}
+	return removed, nil
+}
+
+// update changes the rules of the session with the parts of the updates
+// that are set (TS 29.244 7.5.4.2 to 7.5.4.5)
+func (s *Session) update(changes *ruleChanges) *rejection {
+	for _, update := range changes.UpdatePDRs {
+		old := s.PDRs[update.PDRID]
+		if old == nil {
+			return rejectRule(ie.RuleTypePDR, uint32(update.PDRID), "PDR %d does not exist", update.PDRID)
+		}
+		pdr := *old
+		if update.OuterHeaderRemoval != nil {
+			pdr.OuterHeaderRemoval = update.OuterHeaderRemoval
+		}
+		if update.Precedence != nil {
+			pdr.Precedence = *update.Precedence
+		}
+		if update.PDI != nil {
+			pdr.PDI = *update.PDI
+		}
+		if update.FARID != nil {
+			pdr.FARID = update.FARID
+		}
+		if len(update.URRIDs) > 0 {
+			pdr.URRIDs = update.URRIDs
+		}
+		if len(update.QERIDs) > 0 {
+			pdr.QERIDs = update.QERIDs
+		}
+		s.PDRs[pdr.PDRID] = &pdr
+	}
+
+	for _, update := range changes.UpdateFARs {
+		old := s.FARs[update.FARID]
+		if old == nil {
+			return rejectRule(ie.RuleTypeFAR, uint32(update.FARID), "FAR %d does not exist", update.FARID)
+		}
+		far := *old
+		if update.ApplyAction != nil {
+			far.ApplyAction = *update.ApplyAction
+		}
+		if params := update.UpdateForwardingParameters; params != nil {
+			var forwarding ie.ForwardingParameters
+			if far.ForwardingParameters != nil {
+				forwarding = *far.ForwardingParameters
+			} else if params.DestinationInterface == nil {
+				return rejectIE(ie.CauseConditionalIEMissing, ie.TypeDestinationInterface,
+					"FAR %d has no Forwarding Parameters to update", far.FARID)
+			}
+			if params.DestinationInterface != nil {
+				forwarding.DestinationInterface = *params.DestinationInterface
+			}
+			if params.NetworkInstance != nil {
+				forwarding.NetworkInstance = params.NetworkInstance
+			}
+			if params.OuterHeaderCreation != nil {
+				forwarding.OuterHeaderCreation = params.OuterHeaderCreation
+			}
+			far.ForwardingParameters = &forwarding
+		}
+		s.FARs[far.FARID] = &far
+	}
+
+	for _, update := range changes.UpdateURRs {
+		old := s.URRs[update.URRID]
+		if old == nil {
+			return rejectRule(ie.RuleTypeURR, uint32(update.URRID), "URR %d does not exist", update.URRID)
+		}
+		urr := *old
+		if update.MeasurementMethod != nil {
+			urr.MeasurementMethod = *update.MeasurementMethod
+		}
+		if update.ReportingTriggers != nil {
+			urr.ReportingTriggers = *update.ReportingTriggers
+		}
+		if update.MeasurementPeriod != nil {
+			urr.MeasurementPeriod = update.MeasurementPeriod
+		}
+		if update.VolumeThreshold != nil {
+			urr.VolumeThreshold = update.VolumeThreshold
+		}
+		if update.VolumeQuota != nil {
+			urr.VolumeQuota = update.VolumeQuota
+		}
+		if update.TimeThreshold != nil {
+			urr.TimeThreshold = update.TimeThreshold
+		}
+		if update.TimeQuota != nil {
+			urr.TimeQuota = update.TimeQuota
+		}
+		s.URRs[urr.URRID] = &urr
+	}
+
+	for _, update := range changes.UpdateQERs {
+		old := s.QERs[update.QERID]
+		if old == nil {
+			return rejectRule(ie.RuleTypeQER, uint32(update.QERID), "QER %d does not exist", update.QERID)
+		}
+		qer := *old
+		if update.QERCorrelationID != nil {
+			qer.QERCorrelationID = update.QERCorrelationID
+		}
+		if update.GateStatus != nil {
+			qer.GateStatus = *update.GateStatus
+		}
+		if update.MBR != nil {
+			qer.MBR = update.MBR
+		}
+		if update.GBR != nil {
+			qer.GBR = update.GBR
+		}
+		if update.QFI != nil {
+			qer.QFI = update.QFI
+		}
+		s.QERs[qer.QERID] = &qer
+	}
+	return nil
+}
+
+// teids returns the TEIDs of the PDRs of the session
+func (s *Session) teids() map[uint32]bool {
+	teids := make(map[uint32]bool)
+	for _, pdr := range s.PDRs {
+		if fteid := pdr.PDI.LocalFTEID; fteid != nil && !fteid.Choose {
+			teids[fteid.TEID] = true
+		}
+	}
+	return teids
+}
+
+// SessionTable holds the sessions of the UPF, indexed by their local SEID
+// and by the TEIDs of their PDRs
+type SessionTable struct {
+	mu       sync.RWMutex
+	bySEID   map[uint64]*Session
+	byTEID   map[uint32]*Session
+	lastSEID uint64
+	lastTEID uint32
+}
+
+func NewSessionTable() *SessionTable {
+	return &SessionTable{
+		bySEID: make(map[uint64]*Session),
+		byTEID: make(map[uint32]*Session),
+	}
+}
+
+// Get returns the session with a local SEID, or nil
+func (t *SessionTable) Get(seid uint64) *Session {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.bySEID[seid]
+}
+
+// GetByTEID returns the session a GTP-U TEID of the UPF belongs to, or nil
+func (t *SessionTable) GetByTEID(teid uint32) *Session {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.byTEID[teid]
+}
+
+// Establish creates a session with rules, allocating its local SEID and
+// the F-TEIDs the CP function asked for with the CH flag. It returns the
+// PDRs with an allocated F-TEID, to be told to the CP function.
+func (t *SessionTable) Establish(cpNodeID string, cpFSEID ie.FSEID, rules ruleSet) (*Session, []ie.CreatedPDR, *rejection) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := newSession(cpNodeID, cpFSEID)
+	if r := s.create(rules, time.Now()); r != nil {
+		return nil, nil, r
+	}
+	var pdrIDs []ie.PDRID
+	for _, pdr := range rules.PDRs {
+		pdrIDs = append(pdrIDs, pdr.PDRID)
+	}
+	created, r := t.allocateFTEIDs(s, pdrIDs)
+	if r != nil {
+		return nil, nil, r
+	}
+	if r := t.validate(s); r != nil {
+		return nil, nil, r
+	}
+	seid, ok := t.allocateSEID()
+	if !ok {
+		return nil, nil, reject(ie.CauseNoResourcesAvailable, "no SEID left")
+	}
+	s.LocalSEID = seid
+	t.insert(s)
+	return s, created, nil
+}
+
+// Modify applies changes to the rules of a session with a local SEID, and
+// to the F-SEID of its CP function when cpFSEID is not nil. Either all the
+// changes are applied or, on the first that fails, none. It returns the
+// PDRs with an allocated F-TEID and the usage reports of the URRs removed.
+func (t *SessionTable) Modify(seid uint64, cpFSEID *ie.FSEID, changes *ruleChanges) (*Session, []ie.CreatedPDR, []ie.UsageReport, *rejection) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	old := t.bySEID[seid]
+	if old == nil {
+		return nil, nil, nil, reject(ie.CauseSessionContextNotFound, "no session with SEID %#x", seid)
+	}
+	// Changes are made to a copy, so that a rejection leaves the session
+	// as it was
+	s := old.clone()
+	if cpFSEID != nil {
+		s.CPFSEID = *cpFSEID
+	}
+	removedURRs, r := s.remove(changes)
+	if r != nil {
+		return old, nil, nil, r
+	}
+	now := time.Now()
+	if r := s.create(changes.Create, now); r != nil {
+		return old, nil, nil, r
+	}
+	if r := s.update(changes); r != nil {
+		return old, nil, nil, r
+	}
+
+	var pdrIDs []ie.PDRID
+	for _, pdr := range changes.Create.PDRs {
+		pdrIDs = append(pdrIDs, pdr.PDRID)
+	}
+	for _, pdr := range changes.UpdatePDRs {
+		if pdr.PDI != nil {
+			pdrIDs = append(pdrIDs, pdr.PDRID)
+		}
+	}
+	created, r := t.allocateFTEIDs(s, pdrIDs)
+	if r != nil {
+		return old, nil, nil, r
+	}
+	if r := t.validate(s); r != nil {
+		return old, nil, nil, r
+	}
+	t.insert(s)
+
+	var reports []ie.UsageReport
+	for _, urr := range removedURRs {
+		reports = append(reports, urr.report(ie.UsageReportTriggerTERMR, now))
+	}
+	return s, created, reports, nil
+}
+
+// Delete removes the session with a local SEID, and returns it with the
+// final usage reports of its URRs
+func (t *SessionTable) Delete(seid uint64) (*Session, []ie.UsageReport, *rejection) {
+	t.mu.Lock()
+	s := t.bySEID[seid]
+	if s != nil {
+		t.remove(s)
+	}
+	t.mu.Unlock()
+	if s == nil {
+		return nil, nil, reject(ie.CauseSessionContextNotFound, "no session with SEID %#x", seid)
+	}
+
+	now := time.Now()
+	var reports []ie.UsageReport
+	for _, id := range slices.Sorted(maps.Keys(s.URRs)) {
+		reports = append(reports, s.URRs[id].report(ie.UsageReportTriggerTERMR, now))
+	}
+	return s, reports, nil
+}
+
+// insert adds a session to the table, or replaces the one with its SEID.
+// t.mu must be held.
+func (t *SessionTable) insert(s *Session) {
+	if old := t.bySEID[s.LocalSEID]; old != nil {
+		t.remove(old)
+	}
+	t.bySEID[s.LocalSEID] = s
+	for teid := range s.teids() {
+		t.byTEID[teid] = s
+	}
+}
+
+// remove removes a session from the table. t.mu must be held.
+func (t *SessionTable) remove(s *Session) {
+	delete(t.bySEID, s.LocalSEID)
+	for teid := range s.teids() {
+		if t.byTEID[teid] == s {
+			delete(t.byTEID, teid)
+		}
+	}
+}
+
+// allocateSEID returns an SEID no session has. SEID 0 is never allocated,
+// as it tells that the SEID of the peer is unknown (TS 29.244 7.2.2.4.2).
+// t.mu must be held.
+func (t *SessionTable) allocateSEID() (uint64, bool) {
+	for range len(t.bySEID) + 2 {
+		t.lastSEID++
+		if t.lastSEID != 0 && t.bySEID[t.lastSEID] == nil {
+			return t.lastSEID, true
+		}
+	}
+	return 0, false
+}
+
+// allocateTEID returns a TEID that neither a session nor the TEIDs in use
+// have. TEID 0 is never allocated (TS 29.281 5.1). t.mu must be held.
+func (t *SessionTable) allocateTEID(inUse map[uint32]bool) (uint32, bool) {
+	for range len(t.byTEID) + len(inUse) + 2 {
+		t.lastTEID++
+		if t.lastTEID != 0 && t.byTEID[t.lastTEID] == nil && !inUse[t.lastTEID] {
+			return t.lastTEID, true
+		}
+	}
+	return 0, false
+}
+
+// allocateFTEIDs allocates the local F-TEIDs of the PDRs that ask for one
+// with the CH flag, the same for the PDRs with the same Choose ID
+// (TS 29.244 5.5.3). t.mu must be held.
+func (t *SessionTable) allocateFTEIDs(s *Session, pdrIDs []ie.PDRID) ([]ie.CreatedPDR, *rejection) {
+	var created []ie.CreatedPDR
+	inUse := s.teids()
+	chosen := make(map[uint8]*ie.FTEID)
+	for _, id := range pdrIDs {
+		pdr := s.PDRs[id]
+		fteid := pdr.PDI.LocalFTEID
+		if fteid == nil || !fteid.Choose {
+			continue
+		}
+
+		allocated := chosen[fteid.ChooseID]
+		if allocated == nil || !fteid.HasChooseID {
+			allocated = &ie.FTEID{}
+			if fteid.ChooseIPv4 && N3Address != nil {
+				allocated.IPv4 = N3Address
+			}
+			if fteid.ChooseIPv6 && N3AddressIPv6 != nil {
+				allocated.IPv6 = N3AddressIPv6
+			}
+			if allocated.IPv4 == nil && allocated.IPv6 == nil {
+				return nil, rejectIE(ie.CauseInvalidFTEIDAllocationOption, ie.TypeFTEID,
+					"PDR %d asks for an F-TEID of no family the UPF has", pdr.PDRID)
+			}
+			teid, ok := t.allocateTEID(inUse)
+			if !ok {
+				return nil, reject(ie.CauseNoResourcesAvailable, "no TEID left")
+			}
+			allocated.TEID = teid
+			inUse[teid] = true
+			if fteid.HasChooseID {
+				chosen[fteid.ChooseID] = allocated
+			}
+		}
+
+		pdr.PDI.LocalFTEID = allocated
+		created = append(created, ie.CreatedPDR{PDRID: pdr.PDRID, LocalFTEID: allocated})
+	}
+	return created, nil
+}
+
+// validate checks that the rules of a session are complete and refer to
+// rules it has, and that its TEIDs belong to no other session. t.mu must
+// be held.
+func (t *SessionTable) validate(s *Session) *rejection {
+	for _, id := range slices.Sorted(maps.Keys(s.FARs)) {
+		far := s.FARs[id]
+		switch far.ApplyAction & (ie.ApplyActionDROP | ie.ApplyActionFORW | ie.ApplyActionBUFF) {
+		case ie.ApplyActionDROP, ie.ApplyActionBUFF:
+		case ie.ApplyActionFORW:
+			if far.ForwardingParameters == nil {
+				return rejectIE(ie.CauseConditionalIEMissing, ie.TypeForwardingParameters,
+					"FAR %d forwards without Forwarding Parameters", id)
+			}
+		default:
+			return rejectRule(ie.RuleTypeFAR, uint32(id), "FAR %d has Apply Action %#x", id, far.ApplyAction)
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(s.PDRs)) {
+		pdr := s.PDRs[id]
+		if pdr.FARID == nil {
+			return rejectIE(ie.CauseConditionalIEMissing, ie.TypeFARID, "PDR %d has no FAR", id)
+		}
+		if s.FARs[*pdr.FARID] == nil {
+			return rejectRule(ie.RuleTypePDR, uint32(id), "PDR %d refers to unknown FAR %d", id, *pdr.FARID)
+		}
+		for _, urrID := range pdr.URRIDs {
+			if s.URRs[urrID] == nil {
+				return rejectRule(ie.RuleTypePDR, uint32(id), "PDR %d refers to unknown URR %d", id, urrID)
+			}
+		}
+		for _, qerID := range pdr.QERIDs {
+			if s.QERs[qerID] == nil {
+				return rejectRule(ie.RuleTypePDR, uint32(id), "PDR %d refers to unknown QER %d", id, qerID)
+			}
+		}
+		if fteid := pdr.PDI.LocalFTEID; fteid != nil && !fteid.Choose {
+			if other := t.byTEID[fteid.TEID]; other != nil && other.LocalSEID != s.LocalSEID {
+				return rejectRule(ie.RuleTypePDR, uint32(id), "TEID %#x of PDR %d belongs to another session", fteid.TEID, id)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package pfcp
+
+import (
+	"maps"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/danipopa/mob5g/upf/upf-n4/internal/pfcp/ie"
+)
+
+var testCPFSEID = ie.FSEID{SEID: 0x1000, IPv4: net.IPv4(192, 0, 2, 10)}
+
+func TestMain(m *testing.M) {
+	// The addresses the UPF is configured with
+	N4Address = net.IPv4(192, 0, 2, 1)
+	N3Address = net.IPv4(198, 51, 100, 1)
+	os.Exit(m.Run())
+}
+
+func farID(id ie.FARID) *ie.FARID { return &id }
+
+// uplinkPDR matches the traffic of the access side on a local F-TEID and
+// applies a FAR to it
+func uplinkPDR(id ie.PDRID, far ie.FARID, fteid *ie.FTEID) ie.CreatePDR {
+	return ie.CreatePDR{
+		PDRID:      id,
+		Precedence: 100,
+		PDI:        ie.PDI{SourceInterface: ie.SourceInterface(ie.InterfaceAccess), LocalFTEID: fteid},
+		FARID:      farID(far),
+	}
+}
+
+func forwardFAR(id ie.FARID) ie.CreateFAR {
+	return ie.CreateFAR{
+		FARID:                id,
+		ApplyAction:          ie.ApplyActionFORW,
+		ForwardingParameters: &ie.ForwardingParameters{DestinationInterface: ie.DestinationInterface(ie.InterfaceCore)},
+	}
+}
+
+// chooseFTEID asks the UPF for an IPv4 F-TEID, shared by the PDRs with the
+// same Choose ID when chid is not negative
+func chooseFTEID(chid int) *ie.FTEID {
+	fteid := &ie.FTEID{Choose: true, ChooseIPv4: true}
+	if chid >= 0 {
+		fteid.HasChooseID = true
+		fteid.ChooseID = uint8(chid)
+	}
+	return fteid
+}
+
+// checkRejection checks the cause of a rejection and what it blames
+func checkRejection(t *testing.T, r *rejection, cause ie.Cause, offendingIE uint16, failedRule *ie.FailedRuleID) {
+	t.Helper()
+	if r == nil {
+		t.Fatalf("accepted, expected cause %d", cause)
+	}
+	if r.Cause != cause {
+		t.Errorf("cause %d (%s), expected %d", r.Cause, r.Reason, cause)
+	}
+	switch {
+	case offendingIE == 0 && r.OffendingIE != nil:
+		t.Errorf("Offending IE %d, expected none", *r.OffendingIE)
+	case offendingIE != 0 && (r.OffendingIE == nil || uint16(*r.OffendingIE) != offendingIE):
+		t.Errorf("Offending IE %v, expected %d", r.OffendingIE, offendingIE)
+	}
+	switch {
+	case failedRule == nil && r.FailedRuleID != nil:
+		t.Errorf("Failed Rule ID %+v, expected none", *r.FailedRuleID)
+	case failedRule != nil && (r.FailedRuleID == nil || *r.FailedRuleID != *failedRule):
+		t.Errorf("Failed Rule ID %+v, expected %+v", r.FailedRuleID, *failedRule)
+	}
+}
+
+func TestEstablishAllocatesFTEIDs(t *testing.T) {
+	table := NewSessionTable()
+	rules := ruleSet{
+		PDRs: []ie.CreatePDR{
+			uplinkPDR(1, 1, chooseFTEID(5)),
+			uplinkPDR(2, 1, chooseFTEID(5)),
+			uplinkPDR(3, 1, chooseFTEID(6)),
+			uplinkPDR(4, 1, chooseFTEID(-1)),
+			uplinkPDR(5, 1, nil),
+		},
+		FARs: []ie.CreateFAR{forwardFAR(1)},
+	}
+	s, created, r := table.Establish("smf", testCPFSEID, rules)
+	if r != nil {
+		t.Fatalf("Establish: %v", r)
+	}
+	if s.LocalSEID == 0 || table.Get(s.LocalSEID) != s {
+		t.Fatalf("session with SEID %#x not in the table", s.LocalSEID)
+	}
+
+	teids := make(map[ie.PDRID]uint32)
+	for _, pdr := range created {
+		fteid := pdr.LocalFTEID
+		if fteid == nil || fteid.TEID == 0 || !fteid.IPv4.Equal(N3Address) || fteid.IPv6 != nil || fteid.Choose {
+			t.Errorf("PDR %d: allocated F-TEID %+v", pdr.PDRID, fteid)
+			continue
+		}
+		if stored := s.PDRs[pdr.PDRID].PDI.LocalFTEID; stored == nil || stored.TEID != fteid.TEID {
+			t.Errorf("PDR %d: F-TEID %+v in the session, %+v allocated", pdr.PDRID, stored, fteid)
+		}
+		if table.GetByTEID(fteid.TEID) != s {
+			t.Errorf("PDR %d: TEID %#x does not lead to the session", pdr.PDRID, fteid.TEID)
+		}
+		teids[pdr.PDRID] = fteid.TEID
+	}
+	if len(created) != 4 {
+		t.Fatalf("%d Created PDRs, expected 4 for the PDRs with CH", len(created))
+	}
+	if teids[1] != teids[2] {
+		t.Errorf("PDRs with the same CHID got TEIDs %#x and %#x", teids[1], teids[2])
+	}
+	if teids[3] == teids[1] || teids[4] == teids[1] || teids[4] == teids[3] {
+		t.Errorf("PDRs with other CHIDs or none share a TEID: %v", teids)
+	}
+}
+
+func TestEstablishTEIDConflict(t *testing.T) {
+	table := NewSessionTable()
+	first, _, r := table.Establish("smf", testCPFSEID, ruleSet{
+		PDRs: []ie.CreatePDR{uplinkPDR(1, 1, &ie.FTEID{TEID: 1, IPv4: N3Address})},
+		FARs: []ie.CreateFAR{forwardFAR(1)},
+	})
+	if r != nil {
+		t.Fatalf("Establish: %v", r)
+	}
+
+	// A TEID the CP function allocated is not given to another session
+	second, created, r := table.Establish("smf", testCPFSEID, ruleSet{
+		PDRs: []ie.CreatePDR{uplinkPDR(1, 1, chooseFTEID(-1))},
+		FARs: []ie.CreateFAR{forwardFAR(1)},
+	})
+	if r != nil {
+		t.Fatalf("Establish: %v", r)
+	}
+	if len(created) != 1 || created[0].LocalFTEID.TEID == 1 {
+		t.Errorf("allocated %+v, a TEID of another session", created)
+	}
+
+	// Nor can another session claim it
+	_, _, r = table.Establish("smf", testCPFSEID, ruleSet{
+		PDRs: []ie.CreatePDR{uplinkPDR(7, 1, &ie.FTEID{TEID: 1, IPv4: N3Address})},
+		FARs: []ie.CreateFAR{forwardFAR(1)},
+	})
+	checkRejection(t, r, ie.CauseRuleCreationModificationFailure, 0, &ie.FailedRuleID{RuleType: ie.RuleTypePDR, RuleID: 7})
+	if table.GetByTEID(1) != first || len(table.bySEID) != 2 {
+		t.Errorf("rejected session changed the table")
+	}
+	if table.GetByTEID(created[0].LocalFTEID.TEID) != second {
+		t.Errorf("allocated TEID does not lead to its session")
+	}
+}
+
+func TestEstablishRejections(t *testing.T) {
+	dropFAR := ie.CreateFAR{FARID: 1, ApplyAction: ie.ApplyActionDROP}
+	withURR := uplinkPDR(1, 1, nil)
+	withURR.URRIDs = []ie.URRID{9}
+	withQER := uplinkPDR(1, 1, nil)
+	withQER.QERIDs = []ie.QERID{9}
+	withoutFAR := uplinkPDR(1, 1, nil)
+	withoutFAR.FARID = nil
+
+	tests := []struct {
+		name        string
+		rules       ruleSet
+		cause       ie.Cause
+		offendingIE uint16
+		failedRule  *ie.FailedRuleID
+	}{
+		{
+			name:       "duplicate PDR ID",
+			rules:      ruleSet{PDRs: []ie.CreatePDR{uplinkPDR(1, 1, nil), uplinkPDR(1, 1, nil)}, FARs: []ie.CreateFAR{dropFAR}},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypePDR, RuleID: 1},
+		},
+		{
+			name:       "duplicate FAR ID",
+			rules:      ruleSet{PDRs: []ie.CreatePDR{uplinkPDR(1, 1, nil)}, FARs: []ie.CreateFAR{dropFAR, forwardFAR(1)}},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypeFAR, RuleID: 1},
+		},
+		{
+			name:        "PDR without FAR",
+			rules:       ruleSet{PDRs: []ie.CreatePDR{withoutFAR}, FARs: []ie.CreateFAR{dropFAR}},
+			cause:       ie.CauseConditionalIEMissing,
+			offendingIE: ie.TypeFARID,
+		},
+		{
+			name:       "PDR with an unknown FAR",
+			rules:      ruleSet{PDRs: []ie.CreatePDR{uplinkPDR(1, 2, nil)}, FARs: []ie.CreateFAR{dropFAR}},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypePDR, RuleID: 1},
+		},
+		{
+			name:       "PDR with an unknown URR",
+			rules:      ruleSet{PDRs: []ie.CreatePDR{withURR}, FARs: []ie.CreateFAR{dropFAR}},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypePDR, RuleID: 1},
+		},
+		{
+			name:       "PDR with an unknown QER",
+			rules:      ruleSet{PDRs: []ie.CreatePDR{withQER}, FARs: []ie.CreateFAR{dropFAR}},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypePDR, RuleID: 1},
+		},
+		{
+			name:        "forwarding FAR without Forwarding Parameters",
+			rules:       ruleSet{PDRs: []ie.CreatePDR{uplinkPDR(1, 1, nil)}, FARs: []ie.CreateFAR{{FARID: 1, ApplyAction: ie.ApplyActionFORW}}},
+			cause:       ie.CauseConditionalIEMissing,
+			offendingIE: ie.TypeForwardingParameters,
+		},
+		{
+			name:       "FAR that neither drops, forwards nor buffers",
+			rules:      ruleSet{PDRs: []ie.CreatePDR{uplinkPDR(1, 1, nil)}, FARs: []ie.CreateFAR{{FARID: 1, ApplyAction: ie.ApplyActionDROP | ie.ApplyActionFORW}}},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypeFAR, RuleID: 1},
+		},
+		{
+			name:        "F-TEID of a family without N3 address",
+			rules:       ruleSet{PDRs: []ie.CreatePDR{uplinkPDR(1, 1, &ie.FTEID{Choose: true, ChooseIPv6: true})}, FARs: []ie.CreateFAR{dropFAR}},
+			cause:       ie.CauseInvalidFTEIDAllocationOption,
+			offendingIE: ie.TypeFTEID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewSessionTable()
+			s, created, r := table.Establish("smf", testCPFSEID, tt.rules)
+			checkRejection(t, r, tt.cause, tt.offendingIE, tt.failedRule)
+			if s != nil || created != nil {
+				t.Errorf("rejected establishment returned %+v, %+v", s, created)
+			}
+			if len(table.bySEID) != 0 || len(table.byTEID) != 0 {
+				t.Errorf("rejected session left in the table")
+			}
+		})
+	}
+}
+
+func TestDecodeSessionEstablishmentRequestRejections(t *testing.T) {
+	nodeID := ie.NodeID{Type: ie.NodeIDFQDN, FQDN: "smf"}
+	pdr := uplinkPDR(1, 1, nil)
+	far := forwardFAR(1)
+	tests := []struct {
+		name        string
+		values      []ie.Value
+		cpSEID      uint64
+		offendingIE uint16
+	}{
+		{"no Node ID", []ie.Value{testCPFSEID, pdr, far}, 0, ie.TypeNodeID},
+		{"no F-SEID", []ie.Value{nodeID, pdr, far}, 0, ie.TypeFSEID},
+		{"no Create PDR", []ie.Value{nodeID, testCPFSEID, far}, testCPFSEID.SEID, ie.TypeCreatePDR},
+		{"no Create FAR", []ie.Value{nodeID, testCPFSEID, pdr}, testCPFSEID.SEID, ie.TypeCreateFAR},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := newPayload(tt.values...)
+			if err != nil {
+				t.Fatalf("newPayload: %v", err)
+			}
+			msg := &PFCPMessage{MessageType: PFCPSessionEstablishmentRequest, HasSEID: true, Payload: payload}
+			_, cpSEID, err := decodeSessionEstablishmentRequest(msg)
+			r, ok := err.(*rejection)
+			if !ok {
+				t.Fatalf("error %v, expected a rejection", err)
+			}
+			checkRejection(t, r, ie.CauseMandatoryIEMissing, tt.offendingIE, nil)
+			if cpSEID != tt.cpSEID {
+				t.Errorf("SEID %#x to answer with, expected %#x", cpSEID, tt.cpSEID)
+			}
+		})
+	}
+}
+
+// establishMeasured establishes a session with an uplink PDR on an allocated
+// F-TEID and a downlink PDR, and URRs 1 to 3 of which the uplink PDR uses 1
+func establishMeasured(t *testing.T, table *SessionTable) *Session {
+	t.Helper()
+	uplink := uplinkPDR(1, 1, chooseFTEID(-1))
+	uplink.URRIDs = []ie.URRID{1}
+	downlink := ie.CreatePDR{PDRID: 2, Precedence: 100, PDI: ie.PDI{SourceInterface: ie.SourceInterface(ie.InterfaceCore)}, FARID: farID(1)}
+	var urrs []ie.CreateURR
+	for _, id := range []ie.URRID{3, 1, 2} {
+		urrs = append(urrs, ie.CreateURR{URRID: id, MeasurementMethod: ie.MeasurementMethodVOLUM})
+	}
+	s, _, r := table.Establish("smf", testCPFSEID, ruleSet{
+		PDRs: []ie.CreatePDR{uplink, downlink},
+		FARs: []ie.CreateFAR{forwardFAR(1)},
+		URRs: urrs,
+	})
+	if r != nil {
+		t.Fatalf("Establish: %v", r)
+	}
+	return s
+}
+
+func TestModify(t *testing.T) {
+	tests := []struct {
+		name       string
+		changes    ruleChanges
+		cause      ie.Cause // 0 when accepted
+		failedRule *ie.FailedRuleID
+		reported   []ie.URRID
+	}{
+		{
+			name:     "URR removal",
+			changes:  ruleChanges{RemoveURRs: []ie.RemoveURR{{URRID: 2}, {URRID: 3}}},
+			reported: []ie.URRID{2, 3},
+		},
+		{
+			name: "URR removal and PDR update to an unknown FAR",
+			changes: ruleChanges{
+				RemoveURRs: []ie.RemoveURR{{URRID: 2}},
+				UpdatePDRs: []ie.UpdatePDR{{PDRID: 2, FARID: farID(9)}},
+			},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypePDR, RuleID: 2},
+		},
+		{
+			name:       "removal of a URR a PDR uses",
+			changes:    ruleChanges{RemoveURRs: []ie.RemoveURR{{URRID: 1}}},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypePDR, RuleID: 1},
+		},
+		{
+			name: "PDR replaced by one with an unknown FAR",
+			changes: ruleChanges{
+				RemovePDRs: []ie.RemovePDR{{PDRID: 1}},
+				Create:     ruleSet{PDRs: []ie.CreatePDR{uplinkPDR(3, 9, chooseFTEID(-1))}},
+			},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypePDR, RuleID: 3},
+		},
+		{
+			name: "removal of an unknown PDR after a URR removal",
+			changes: ruleChanges{
+				RemovePDRs: []ie.RemovePDR{{PDRID: 7}},
+				RemoveURRs: []ie.RemoveURR{{URRID: 2}},
+			},
+			cause:      ie.CauseRuleCreationModificationFailure,
+			failedRule: &ie.FailedRuleID{RuleType: ie.RuleTypePDR, RuleID: 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewSessionTable()
+			old := establishMeasured(t, table)
+			seid := old.LocalSEID
+			byTEID := maps.Clone(table.byTEID)
+
+			s, created, reports, r := table.Modify(seid, nil, &tt.changes)
+			if tt.cause != 0 {
+				checkRejection(t, r, tt.cause, 0, tt.failedRule)
+				if s != old || created != nil || reports != nil {
+					t.Errorf("rejected modification returned %p, %+v, %+v; expected the session as it was", s, created, reports)
+				}
+				if table.Get(seid) != old || !maps.Equal(table.byTEID, byTEID) {
+					t.Errorf("rejected modification changed the table")
+				}
+				if len(old.URRs) != 3 || len(old.PDRs) != 2 || *old.PDRs[2].FARID != 1 {
+					t.Errorf("rejected modification changed the session")
+				}
+				return
+			}
+
+			if r != nil {
+				t.Fatalf("Modify: %v", r)
+			}
+			if table.Get(seid) != s {
+				t.Errorf("modified session not in the table")
+			}
+			for teid := range byTEID {
+				if table.GetByTEID(teid) != s {
+					t.Errorf("TEID %#x does not lead to the modified session", teid)
+				}
+			}
+			if len(reports) != len(tt.reported) {
+				t.Fatalf("%d usage reports, expected %d", len(reports), len(tt.reported))
+			}
+			for i, report := range reports {
+				if report.URRID != tt.reported[i] || report.Trigger != ie.UsageReportTriggerTERMR {
+					t.Errorf("usage report %+v, expected TERMR for URR %d", report, tt.reported[i])
+				}
+			}
+		})
+	}
+}
+
+func TestModifyUnknownSession(t *testing.T) {
+	table := NewSessionTable()
+	s, _, _, r := table.Modify(1, nil, &ruleChanges{})
+	checkRejection(t, r, ie.CauseSessionContextNotFound, 0, nil)
+	if s != nil {
+		t.Errorf("session %+v for an unknown SEID", s)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	table := NewSessionTable()
+	s := establishMeasured(t, table)
+	other := establishMeasured(t, table)
+
+	deleted, reports, r := table.Delete(s.LocalSEID)
+	if r != nil {
+		t.Fatalf("Delete: %v", r)
+	}
+	if deleted != s {
+		t.Errorf("deleted %p, expected the session %p", deleted, s)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("%d usage reports, expected one per URR", len(reports))
+	}
+	for i, report := range reports {
+		if report.URRID != ie.URRID(i+1) || report.Trigger != ie.UsageReportTriggerTERMR || report.URSEQN != 0 {
+			t.Errorf("usage report %+v, expected the first TERMR for URR %d", report, i+1)
+		}
+	}
+	if table.Get(s.LocalSEID) != nil {
+		t.Errorf("deleted session still in the table")
+	}
+	for teid, owner := range table.byTEID {
+		if owner != other {
+			t.Errorf("TEID %#x still leads to the deleted session", teid)
+		}
+	}
+	if table.Get(other.LocalSEID) != other {
+		t.Errorf("deletion removed another session")
+	}
+
+	_, _, r = table.Delete(s.LocalSEID)
+	checkRejection(t, r, ie.CauseSessionContextNotFound, 0, nil)
+}
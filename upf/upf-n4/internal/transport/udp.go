@@ -1,29 +1,172 @@
 package transport
 
 import (
+	"errors"
 	"log"
 	"net"
+	"sync"
+	"time"
+
+	"github.com/danipopa/mob5g/upf/upf-n4/internal/pfcp"
+)
+
+const (
+	// maxDatagramSize is the largest UDP payload, so that no message is
+	// truncated
+	maxDatagramSize = 65535
+	// ResponseCacheTTL is how long a response is kept to answer the
+	// retransmissions of its request. It covers the N1 retransmissions a
+	// peer makes T1 apart with the usual timers.
+	ResponseCacheTTL = 30 * time.Second
 )
 
-// ListenForPFCPMessages listens for incoming PFCP messages on the specified UDP port.
-func ListenForPFCPMessages(port int, handler func([]byte, string)) error {
+// Server owns the UDP socket of the PFCP interface. Responses are sent
+// from it, and the retransmissions of requests are answered with the
+// response already sent instead of being handled again (TS 29.244 6.4).
+type Server struct {
+	conn  *net.UDPConn
+	cache *responseCache
+}
+
+// ListenForPFCPMessages opens the UDP socket of the PFCP interface on the
+// specified port. Serve handles the messages received on it.
+func ListenForPFCPMessages(port int) (*Server, error) {
 	addr := net.UDPAddr{Port: port}
 	conn, err := net.ListenUDP("udp", &addr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer conn.Close()
-
 	log.Printf("Listening for PFCP messages on port %d...", port)
-	buf := make([]byte, 1500)
+	return &Server{conn: conn, cache: newResponseCache(ResponseCacheTTL)}, nil
+}
 
+// Serve gives each datagram received to the handler, in a goroutine of its
+// own, until the server is closed
+func (s *Server) Serve(handler func([]byte, string)) error {
+	buf := make([]byte, maxDatagramSize)
 	for {
-		n, remoteAddr, err := conn.ReadFromUDP(buf)
+		n, remoteAddr, err := s.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
 		if err != nil {
 			log.Printf("Error reading UDP packet: %v", err)
 			continue
 		}
-		go handler(buf[:n], remoteAddr.String())
+		// buf is reused for the next datagram while the handler runs
+		data := append([]byte(nil), buf[:n]...)
+		peer := remoteAddr.String()
+
+		key, request := exchangeOf(data, peer, true)
+		if request {
+			if response, duplicate := s.cache.begin(key, time.Now()); duplicate {
+				if response == nil {
+					log.Printf("Dropping retransmission of PFCP request %d from %s, still handled", key.sequenceNumber, peer)
+				} else if _, err := s.conn.WriteToUDP(response, remoteAddr); err != nil {
+					log.Printf("Error resending PFCP response to %s: %v", peer, err)
+				}
+				continue
+			}
+		}
+		go func() {
+			handler(data, peer)
+			if request {
+				// A request left unanswered is handled again when it is
+				// retransmitted
+				s.cache.abandon(key)
+			}
+		}()
+	}
+}
+
+// Send sends a message to a peer. A response is kept to answer the
+// retransmissions of its request.
+func (s *Server) Send(data []byte, addr string) error {
+	remoteAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	if key, ok := exchangeOf(data, addr, false); ok {
+		s.cache.complete(key, data, time.Now())
+	}
+	_, err = s.conn.WriteToUDP(data, remoteAddr)
+	return err
+}
+
+// Close closes the socket, which ends Serve
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// exchange identifies a request and its response: the sequence number of
+// a request is unique among those of the peer (TS 29.244 7.2.2.1)
+type exchange struct {
+	peer           string
+	sequenceNumber uint32
+}
+
+// exchangeOf returns the exchange of a request when request is true, or of
+// a response, and false for messages of the other kind or malformed ones
+func exchangeOf(data []byte, peer string, request bool) (exchange, bool) {
+	msg, err := pfcp.DeserializePFCPMessage(data)
+	if err != nil || pfcp.IsRequest(msg.MessageType) != request {
+		return exchange{}, false
+	}
+	return exchange{peer: peer, sequenceNumber: msg.SequenceNumber}, true
+}
+
+// cachedResponse is the response to a request, nil while it is handled
+type cachedResponse struct {
+	data    []byte
+	expires time.Time
+}
+
+// responseCache holds the requests received lately and their responses
+type responseCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[exchange]*cachedResponse
+	lastSweep time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{ttl: ttl, entries: make(map[exchange]*cachedResponse)}
+}
+
+// begin records a request, and returns whether it is a retransmission with
+// the response sent for it, if any
+func (c *responseCache) begin(key exchange, now time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > c.ttl {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
 	}
+	if entry := c.entries[key]; entry != nil && !now.After(entry.expires) {
+		return entry.data, true
+	}
+	c.entries[key] = &cachedResponse{expires: now.Add(c.ttl)}
+	return nil, false
+}
+
+// complete records the response to a request
+func (c *responseCache) complete(key exchange, data []byte, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &cachedResponse{data: data, expires: now.Add(c.ttl)}
 }
 
+// abandon forgets a request handled without a response, so that its
+// retransmissions are handled again rather than dropped
+func (c *responseCache) abandon(key exchange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry := c.entries[key]; entry != nil && entry.data == nil {
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	const ttl = 30 * time.Second
+	start := time.Now()
+	key := exchange{peer: "192.0.2.10:8805", sequenceNumber: 1}
+	response := []byte{0x20, 2, 0, 4, 0, 0, 1, 0}
+
+	tests := []struct {
+		name      string
+		steps     func(c *responseCache)
+		at        time.Time
+		response  []byte
+		duplicate bool
+	}{
+		{
+			name:  "new request",
+			steps: func(c *responseCache) {},
+			at:    start,
+		},
+		{
+			name:      "retransmission while handled",
+			steps:     func(c *responseCache) { c.begin(key, start) },
+			at:        start.Add(time.Second),
+			duplicate: true,
+		},
+		{
+			name: "retransmission after the response",
+			steps: func(c *responseCache) {
+				c.begin(key, start)
+				c.complete(key, response, start.Add(time.Second))
+			},
+			at:        start.Add(ttl),
+			response:  response,
+			duplicate: true,
+		},
+		{
+			name: "request of another peer",
+			steps: func(c *responseCache) {
+				c.begin(exchange{peer: "192.0.2.11:8805", sequenceNumber: 1}, start)
+			},
+			at: start.Add(time.Second),
+		},
+		{
+			name: "request after the response expired",
+			steps: func(c *responseCache) {
+				c.begin(key, start)
+				c.complete(key, response, start)
+			},
+			at: start.Add(ttl + time.Second),
+		},
+		{
+			name:  "request still handled after the TTL",
+			steps: func(c *responseCache) { c.begin(key, start) },
+			at:    start.Add(ttl + time.Second),
+		},
+		{
+			name: "retransmission of a request left unanswered",
+			steps: func(c *responseCache) {
+				c.begin(key, start)
+				c.abandon(key)
+			},
+			at: start.Add(time.Second),
+		},
+		{
+			name: "retransmission after the response, abandoned",
+			steps: func(c *responseCache) {
+				c.begin(key, start)
+				c.complete(key, response, start)
+				c.abandon(key)
+			},
+			at:        start.Add(time.Second),
+			response:  response,
+			duplicate: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newResponseCache(ttl)
+			tt.steps(c)
+			got, duplicate := c.begin(key, tt.at)
+			if duplicate != tt.duplicate || !bytes.Equal(got, tt.response) {
+				t.Fatalf("begin returned % x, %v; expected % x, %v", got, duplicate, tt.response, tt.duplicate)
+			}
+			if !duplicate {
+				// The request is now handled, and its retransmissions dropped
+				if got, duplicate := c.begin(key, tt.at); !duplicate || got != nil {
+					t.Errorf("retransmission of the new request: % x, %v", got, duplicate)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseCacheSweep(t *testing.T) {
+	const ttl = 30 * time.Second
+	start := time.Now()
+	c := newResponseCache(ttl)
+	for seq := uint32(1); seq <= 3; seq++ {
+		c.begin(exchange{peer: "192.0.2.10:8805", sequenceNumber: seq}, start)
+	}
+	c.begin(exchange{peer: "192.0.2.10:8805", sequenceNumber: 4}, start.Add(2*ttl))
+	if len(c.entries) != 1 {
+		t.Errorf("%d entries after the TTL, expected only the latest request", len(c.entries))
+	}
+}
+
+// TestServeHandlesUnansweredRetransmissions checks that the retransmission
+// of a request the handler did not answer is handled again
+func TestServeHandlesUnansweredRetransmissions(t *testing.T) {
+	s, err := ListenForPFCPMessages(0)
+	if err != nil {
+		t.Fatalf("ListenForPFCPMessages: %v", err)
+	}
+	defer s.Close()
+	handled := make(chan []byte)
+	go s.Serve(func(data []byte, addr string) { handled <- data })
+
+	conn, err := net.DialUDP("udp", nil, s.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("DialUDP: %v", err)
+	}
+	defer conn.Close()
+	request := []byte{0x20, 5, 0, 4, 0, 0, 1, 0} // Association Setup Request
+	for i := 0; i < 2; i++ {
+		if _, err := conn.Write(request); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		select {
+		case data := <-handled:
+			if !bytes.Equal(data, request) {
+				t.Errorf("handled % x, expected % x", data, request)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("transmission %d not handled", i+1)
+		}
+		// Let the handler goroutine return before the retransmission
+		time.Sleep(50 * time.Millisecond)
+	}
+}